@@ -35,6 +35,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/vhive-serverless/vhive/keepalive"
 	"github.com/vhive-serverless/vhive/metrics"
 
 	log "github.com/sirupsen/logrus"
@@ -49,7 +50,7 @@ var (
 
 func TestBenchParallelServe(t *testing.T) {
 	var (
-		servedTh      uint64
+		keepAlive     keepalive.PolicyFactory
 		pinnedFuncNum int
 		isSyncOffload bool = true
 		serveMetrics       = make([]*metrics.Metric, *parallelNum)
@@ -63,7 +64,7 @@ func TestBenchParallelServe(t *testing.T) {
 	imageName, isPresent := images[*funcName]
 	require.True(t, isPresent, "Function is not supported")
 
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	createResultsDir()
 
@@ -125,7 +126,7 @@ func TestBenchParallelServe(t *testing.T) {
 
 func TestBenchWarmServe(t *testing.T) {
 	var (
-		servedTh          uint64
+		keepAlive         keepalive.PolicyFactory
 		pinnedFuncNum     int
 		isSyncOffload     bool = true
 		images                 = getAllImages()
@@ -136,7 +137,7 @@ func TestBenchWarmServe(t *testing.T) {
 	imageName, isPresent := images[*funcName]
 	require.True(t, isPresent, "Function is not supported")
 
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	createResultsDir()
 
@@ -190,7 +191,7 @@ func TestBenchWarmServe(t *testing.T) {
 
 func TestBenchServe(t *testing.T) {
 	var (
-		servedTh          uint64
+		keepAlive         keepalive.PolicyFactory
 		pinnedFuncNum     int
 		isSyncOffload     bool = true
 		images                 = getAllImages()
@@ -201,7 +202,7 @@ func TestBenchServe(t *testing.T) {
 	imageName, isPresent := images[*funcName]
 	require.True(t, isPresent, "Function is not supported")
 
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	createResultsDir()
 
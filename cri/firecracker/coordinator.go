@@ -67,7 +67,7 @@ func newFirecrackerCoordinator(orch *ctriface.Orchestrator, opts ...coordinatorO
 	return c
 }
 
-func (c *coordinator) getIdleInstance(image string) *funcInstance {
+func (c *coordinator) getIdleInstance(image string, spec *ctriface.VMSpec) *funcInstance {
 	c.Lock()
 	defer c.Unlock()
 
@@ -77,10 +77,12 @@ func (c *coordinator) getIdleInstance(image string) *funcInstance {
 		return nil
 	}
 
-	if len(idles) != 0 {
-		fi := idles[0]
-		c.idleInstances[image] = idles[1:]
-		return fi
+	// only an instance with the same VM resources can be reused
+	for i, fi := range idles {
+		if fi.Spec.Equal(spec) {
+			c.idleInstances[image] = append(idles[:i:i], idles[i+1:]...)
+			return fi
+		}
 	}
 
 	return nil
@@ -99,16 +101,16 @@ func (c *coordinator) setIdleInstance(fi *funcInstance) {
 }
 
 func (c *coordinator) startVM(ctx context.Context, image string) (*funcInstance, error) {
-	return c.startVMWithEnvironment(ctx, image, []string{})
+	return c.startVMWithEnvironment(ctx, image, []string{}, nil)
 }
 
-func (c *coordinator) startVMWithEnvironment(ctx context.Context, image string, environment []string) (*funcInstance, error) {
-	if fi := c.getIdleInstance(image); c.orch != nil && c.orch.GetSnapshotsEnabled() && fi != nil {
+func (c *coordinator) startVMWithEnvironment(ctx context.Context, image string, environment []string, spec *ctriface.VMSpec) (*funcInstance, error) {
+	if fi := c.getIdleInstance(image, spec); c.orch != nil && c.orch.GetSnapshotsEnabled() && fi != nil {
 		err := c.orchLoadInstance(ctx, fi)
 		return fi, err
 	}
 
-	return c.orchStartVM(ctx, image, environment)
+	return c.orchStartVM(ctx, image, environment, spec)
 }
 
 func (c *coordinator) stopVM(ctx context.Context, containerID string) error {
@@ -154,7 +156,7 @@ func (c *coordinator) insertActive(containerID string, fi *funcInstance) error {
 	return nil
 }
 
-func (c *coordinator) orchStartVM(ctx context.Context, image string, envVariables []string) (*funcInstance, error) {
+func (c *coordinator) orchStartVM(ctx context.Context, image string, envVariables []string, spec *ctriface.VMSpec) (*funcInstance, error) {
 	vmID := strconv.Itoa(int(atomic.AddUint64(&c.nextID, 1)))
 	logger := log.WithFields(
 		log.Fields{
@@ -173,14 +175,35 @@ func (c *coordinator) orchStartVM(ctx context.Context, image string, envVariable
 	ctxTimeout, cancel := context.WithTimeout(ctx, time.Second*40)
 	defer cancel()
 
+	fromSnapshot := false
 	if !c.withoutOrchestrator {
-		resp, _, err = c.orch.StartVMWithEnvironment(ctxTimeout, vmID, image, envVariables)
-		if err != nil {
-			logger.WithError(err).Error("coordinator failed to start VM")
+		// skip the IDs taken by the snapshots in the catalog
+		for c.orch.HasCatalogSnapshot(vmID) {
+			vmID = strconv.Itoa(int(atomic.AddUint64(&c.nextID, 1)))
+		}
+		logger = logger.WithFields(log.Fields{"vmID": vmID})
+
+		if c.orch.GetSnapshotsEnabled() {
+			resp, _, err = c.orch.StartVMFromSnapshot(ctxTimeout, vmID, image, spec)
+			fromSnapshot = err == nil
+			if err != nil && !errors.Is(err, ctriface.ErrNoSnapshot) {
+				logger.WithError(err).Warn("coordinator failed to start VM from the golden snapshot")
+			}
+		}
+
+		if !fromSnapshot {
+			resp, _, err = c.orch.StartVMWithEnvironment(ctxTimeout, vmID, image, envVariables, spec)
+			if err != nil {
+				logger.WithError(err).Error("coordinator failed to start VM")
+			}
 		}
 	}
 
-	fi := newFuncInstance(vmID, image, resp)
+	fi := newFuncInstance(vmID, image, spec, resp)
+	if fromSnapshot {
+		// the instance is offloaded and loaded using the golden snapshot
+		fi.OnceCreateSnapInstance.Do(func() {})
+	}
 	logger.Debug("successfully created fresh instance")
 	return fi, err
 }
@@ -32,15 +32,17 @@ import (
 type funcInstance struct {
 	VmID                   string
 	Image                  string
+	Spec                   *ctriface.VMSpec
 	Logger                 *log.Entry
 	OnceCreateSnapInstance *sync.Once
 	StartVMResponse        *ctriface.StartVMResponse
 }
 
-func newFuncInstance(vmID, image string, startVMResponse *ctriface.StartVMResponse) *funcInstance {
+func newFuncInstance(vmID, image string, spec *ctriface.VMSpec, startVMResponse *ctriface.StartVMResponse) *funcInstance {
 	f := &funcInstance{
 		VmID:                   vmID,
 		Image:                  image,
+		Spec:                   spec.WithDefaults(),
 		OnceCreateSnapInstance: new(sync.Once),
 		StartVMResponse:        startVMResponse,
 	}
@@ -110,8 +110,14 @@ func (fs *FirecrackerService) createUserContainer(ctx context.Context, r *criapi
 		return nil, err
 	}
 
+	spec, err := getVMSpec(r)
+	if err != nil {
+		log.WithError(err).Error("invalid VM resources")
+		return nil, err
+	}
+
 	environment := cri.ToStringArray(config.GetEnvs())
-	funcInst, err := fs.coordinator.startVMWithEnvironment(context.Background(), guestImage, environment)
+	funcInst, err := fs.coordinator.startVMWithEnvironment(context.Background(), guestImage, environment, spec)
 	if err != nil {
 		log.WithError(err).Error("failed to start VM")
 		return nil, err
@@ -0,0 +1,107 @@
+// MIT License
+//
+// Copyright (c) 2020 Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package firecracker
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/vhive-serverless/vhive/ctriface"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+// Pod or container annotations that set the resources of the function's VM,
+// e.g., in the template of a Knative service
+const (
+	vcpuCountAnnotation      = "vhive.io/vcpu-count"
+	memSizeMibAnnotation     = "vhive.io/mem-size-mib"
+	kernelArgsAnnotation     = "vhive.io/kernel-args"
+	timeoutSecondsAnnotation = "vhive.io/timeout-seconds"
+)
+
+const mib = 1024 * 1024
+
+// getVMSpec Returns the spec of the VM for the user container.
+// The resource limits of the container give the lower bound for the vCPUs and the memory
+// of the VM, the annotations of the pod and then of the container set them explicitly.
+func getVMSpec(r *criapi.CreateContainerRequest) (*ctriface.VMSpec, error) {
+	spec := ctriface.DefaultVMSpec()
+
+	resources := r.GetConfig().GetLinux().GetResources()
+	if quota, period := resources.GetCpuQuota(), resources.GetCpuPeriod(); quota > 0 && period > 0 {
+		vcpus := uint32((quota + period - 1) / period)
+		if vcpus > 1 && vcpus%2 != 0 {
+			vcpus++ // Firecracker supports only 1 or an even number of vCPUs
+		}
+		if vcpus > spec.VcpuCount {
+			spec.VcpuCount = vcpus
+		}
+	}
+
+	if limit := resources.GetMemoryLimitInBytes(); limit > 0 {
+		memSizeMib := uint32((limit + mib - 1) / mib)
+		if memSizeMib > spec.MemSizeMib {
+			spec.MemSizeMib = memSizeMib
+		}
+	}
+
+	for _, annotations := range []map[string]string{
+		r.GetSandboxConfig().GetAnnotations(),
+		r.GetConfig().GetAnnotations(),
+	} {
+		if err := applyVMSpecAnnotations(spec, annotations); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+func applyVMSpecAnnotations(spec *ctriface.VMSpec, annotations map[string]string) error {
+	for key, field := range map[string]*uint32{
+		vcpuCountAnnotation:      &spec.VcpuCount,
+		memSizeMibAnnotation:     &spec.MemSizeMib,
+		timeoutSecondsAnnotation: &spec.TimeoutSeconds,
+	} {
+		val, ok := annotations[key]
+		if !ok {
+			continue
+		}
+
+		num, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return fmt.Errorf("invalid value %q of annotation %s: %w", val, key, err)
+		}
+		*field = uint32(num)
+	}
+
+	if val, ok := annotations[kernelArgsAnnotation]; ok {
+		spec.KernelArgs = val
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+// MIT License
+//
+// Copyright (c) 2020 Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package firecracker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vhive-serverless/vhive/ctriface"
+	criapi "k8s.io/cri-api/pkg/apis/runtime/v1alpha2"
+)
+
+func newCreateContainerRequest(resources *criapi.LinuxContainerResources, podAnnotations, annotations map[string]string) *criapi.CreateContainerRequest {
+	return &criapi.CreateContainerRequest{
+		Config: &criapi.ContainerConfig{
+			Linux:       &criapi.LinuxContainerConfig{Resources: resources},
+			Annotations: annotations,
+		},
+		SandboxConfig: &criapi.PodSandboxConfig{Annotations: podAnnotations},
+	}
+}
+
+func TestGetVMSpec(t *testing.T) {
+	spec, err := getVMSpec(newCreateContainerRequest(nil, nil, nil))
+	require.NoError(t, err, "Failed to get the default spec")
+	require.True(t, spec.Equal(ctriface.DefaultVMSpec()), "Spec without limits must be the default one")
+
+	spec, err = getVMSpec(newCreateContainerRequest(&criapi.LinuxContainerResources{
+		CpuPeriod:          100000,
+		CpuQuota:           250000,
+		MemoryLimitInBytes: 1000 * mib,
+	}, nil, nil))
+	require.NoError(t, err, "Failed to get the spec from the limits")
+	require.Equal(t, uint32(4), spec.VcpuCount, "vCPUs must be rounded up to an even number")
+	require.Equal(t, uint32(1000), spec.MemSizeMib, "Memory must follow the limit")
+
+	spec, err = getVMSpec(newCreateContainerRequest(&criapi.LinuxContainerResources{
+		MemoryLimitInBytes: 64 * mib,
+	}, nil, nil))
+	require.NoError(t, err, "Failed to get the spec from the limits")
+	require.Equal(t, ctriface.DefaultVMSpec().MemSizeMib, spec.MemSizeMib, "Memory must not go below the default")
+
+	spec, err = getVMSpec(newCreateContainerRequest(
+		&criapi.LinuxContainerResources{MemoryLimitInBytes: 1000 * mib},
+		map[string]string{memSizeMibAnnotation: "2048", vcpuCountAnnotation: "2"},
+		map[string]string{memSizeMibAnnotation: "512", kernelArgsAnnotation: "quiet"},
+	))
+	require.NoError(t, err, "Failed to get the spec from the annotations")
+	require.Equal(t, uint32(2), spec.VcpuCount, "vCPUs must follow the pod annotation")
+	require.Equal(t, uint32(512), spec.MemSizeMib, "Container annotation must override the pod one")
+	require.Equal(t, "quiet", spec.KernelArgs, "Kernel args must follow the annotation")
+
+	_, err = getVMSpec(newCreateContainerRequest(nil, nil, map[string]string{vcpuCountAnnotation: "3"}))
+	require.Error(t, err, "Odd number of vCPUs must be rejected")
+
+	_, err = getVMSpec(newCreateContainerRequest(nil, nil, map[string]string{memSizeMibAnnotation: "lots"}))
+	require.Error(t, err, "Malformed annotation must be rejected")
+}
+
+func TestIdleInstanceSpec(t *testing.T) {
+	c := newFirecrackerCoordinator(nil, withoutOrchestrator())
+	image := "spec-image"
+
+	fi := newFuncInstance("1", image, &ctriface.VMSpec{MemSizeMib: 1024}, nil)
+	c.setIdleInstance(fi)
+
+	require.Nil(t, c.getIdleInstance(image, nil), "Instance with other resources must not be reused")
+	require.Equal(t, fi, c.getIdleInstance(image, &ctriface.VMSpec{MemSizeMib: 1024}), "Instance must be reused")
+	require.Nil(t, c.getIdleInstance(image, &ctriface.VMSpec{MemSizeMib: 1024}), "Instance must be reused once")
+}
@@ -69,21 +69,44 @@ const (
 	testImageName = "ghcr.io/ease-lab/helloworld:var_workload"
 )
 
-// StartVM Boots a VM if it does not exist
-func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
-	return o.StartVMWithEnvironment(ctx, vmID, imageName, []string{})
+// StartVM Boots a VM if it does not exist. A nil spec gives a VM with the default spec.
+func (o *Orchestrator) StartVM(ctx context.Context, vmID, imageName string, spec *VMSpec) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
+	return o.StartVMWithEnvironment(ctx, vmID, imageName, []string{}, spec)
 }
 
-func (o *Orchestrator) StartVMWithEnvironment(ctx context.Context, vmID, imageName string, environmentVariables []string) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
+// StartVMWithEnvironment Boots a VM if it does not exist, with the given environment
+// variables set in the container. A nil spec gives a VM with the default spec.
+func (o *Orchestrator) StartVMWithEnvironment(ctx context.Context, vmID, imageName string, environmentVariables []string, spec *VMSpec) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
+	return o.startVM(ctx, vmID, imageName, environmentVariables, spec, nil)
+}
+
+// startVM Boots a VM. If the VM is going to be loaded from a shared snapshot,
+// the VM gets its own network namespace with the network interface of the snapshot
+func (o *Orchestrator) startVM(ctx context.Context, vmID, imageName string, environmentVariables []string, spec *VMSpec, snap *CatalogEntry) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
 	var (
 		startVMMetric *metrics.Metric = metrics.NewMetric()
 		tStart        time.Time
+		vm            *misc.VM
+		err           error
 	)
 
 	logger := log.WithFields(log.Fields{"vmID": vmID, "image": imageName})
 	logger.Debug("StartVM: Received StartVM")
 
-	vm, err := o.vmPool.Allocate(vmID, o.hostIface)
+	spec = spec.WithDefaults()
+	if err := spec.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if o.HasCatalogSnapshot(vmID) {
+		return nil, nil, errors.Errorf("VM ID %s is taken by a snapshot in the catalog", vmID)
+	}
+
+	if snap != nil {
+		vm, err = o.vmPool.AllocateWithNetNS(vmID, snap.Ni, o.hostIface)
+	} else {
+		vm, err = o.vmPool.Allocate(vmID, o.hostIface)
+	}
 	if err != nil {
 		logger.Error("failed to allocate VM in VM pool")
 		return nil, nil, err
@@ -105,8 +128,15 @@ func (o *Orchestrator) StartVMWithEnvironment(ctx context.Context, vmID, imageNa
 	}
 	startVMMetric.MetricMap[metrics.GetImage] = metrics.ToUS(time.Since(tStart))
 
+	o.vmSpecs.Store(vmID, spec)
+	defer func() {
+		if retErr != nil {
+			o.vmSpecs.Delete(vmID)
+		}
+	}()
+
 	tStart = time.Now()
-	conf := o.getVMConfig(vm)
+	conf := o.getVMConfig(vm, spec)
 	resp, err := o.fcClient.CreateVM(ctx, conf)
 	startVMMetric.MetricMap[metrics.FcCreateVM] = metrics.ToUS(time.Since(tStart))
 	if err != nil {
@@ -144,7 +174,7 @@ func (o *Orchestrator) StartVMWithEnvironment(ctx context.Context, vmID, imageNa
 
 	defer func() {
 		if retErr != nil {
-			if err := container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+			if err := container.Delete(ctx, o.getContainerDeleteOpts(vmID)...); err != nil {
 				logger.WithError(err).Errorf("failed to delete container after failure")
 			}
 		}
@@ -201,23 +231,23 @@ func (o *Orchestrator) StartVMWithEnvironment(ctx context.Context, vmID, imageNa
 		}
 	}()
 
-	if err := os.MkdirAll(o.getVMBaseDir(vmID), 0777); err != nil {
+	if err := o.resetVMBaseDir(vmID); err != nil {
 		logger.Error("Failed to create VM base dir")
 		return nil, nil, err
 	}
+
+	if snap != nil {
+		o.vmSnapshots.Store(vmID, snap)
+		defer func() {
+			if retErr != nil {
+				o.vmSnapshots.Delete(vmID)
+			}
+		}()
+	}
 	if o.GetUPFEnabled() {
 		logger.Debug("Registering VM with the memory manager")
 
-		stateCfg := manager.SnapshotStateCfg{
-			VMID:             vmID,
-			GuestMemPath:     o.getMemoryFile(vmID),
-			BaseDir:          o.getVMBaseDir(vmID),
-			GuestMemSize:     int(conf.MachineCfg.MemSizeMib) * 1024 * 1024,
-			IsLazyMode:       o.isLazyMode,
-			VMMStatePath:     o.getSnapshotFile(vmID),
-			WorkingSetPath:   o.getWorkingSetFile(vmID),
-			InstanceSockAddr: resp.UPFSockPath,
-		}
+		stateCfg := o.getMemoryStateCfg(vmID, spec, resp.UPFSockPath)
 		if err := o.memoryManager.RegisterVM(stateCfg); err != nil {
 			return nil, nil, errors.Wrap(err, "failed to register VM with memory manager")
 			// NOTE (Plamen): Potentially need a defer(DeregisteVM) here if RegisterVM is not last to execute
@@ -226,7 +256,47 @@ func (o *Orchestrator) StartVMWithEnvironment(ctx context.Context, vmID, imageNa
 
 	logger.Debug("Successfully started a VM")
 
-	return &StartVMResponse{GuestIP: vm.Ni.PrimaryAddress}, startVMMetric, nil
+	return &StartVMResponse{GuestIP: getGuestIP(vm)}, startVMMetric, nil
+}
+
+// getMemoryStateCfg Returns the config of the VM for the memory manager. A VM that is loaded
+// from a shared snapshot replays the working set of the snapshot, if the snapshot has one,
+// until it records its own, so that it is served in the replay mode from the first load
+func (o *Orchestrator) getMemoryStateCfg(vmID string, spec *VMSpec, sockAddr string) manager.SnapshotStateCfg {
+	cfg := manager.SnapshotStateCfg{
+		VMID:             vmID,
+		GuestMemPath:     o.getMemoryFile(vmID),
+		BaseDir:          o.getVMBaseDir(vmID),
+		GuestMemSize:     spec.GuestMemSize(),
+		IsLazyMode:       o.isLazyMode,
+		IsHybridMode:     o.isHybridMode,
+		VMMStatePath:     o.getSnapshotFile(vmID),
+		WorkingSetPath:   o.getWorkingSetFile(vmID),
+		InstanceSockAddr: sockAddr,
+	}
+	if snap, ok := o.vmSnapshots.Load(vmID); ok && snap.(*CatalogEntry).VMID != vmID {
+		cfg.SharedWorkingSetPath = snap.(*CatalogEntry).WorkingSetFile
+	}
+
+	return cfg
+}
+
+// getVMSpec Returns the spec the VM was started with
+func (o *Orchestrator) getVMSpec(vmID string) *VMSpec {
+	if spec, ok := o.vmSpecs.Load(vmID); ok {
+		return spec.(*VMSpec)
+	}
+
+	return DefaultVMSpec()
+}
+
+// getGuestIP Returns the address at which the host reaches the VM
+func getGuestIP(vm *misc.VM) string {
+	if vm.Net != nil {
+		return vm.Net.CloneAddress
+	}
+
+	return vm.Ni.PrimaryAddress
 }
 
 // StopSingleVM Shuts down a VM
@@ -238,11 +308,8 @@ func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
 	ctx = namespaces.WithNamespace(ctx, namespaceName)
 	vm, err := o.vmPool.GetVM(vmID)
 	if err != nil {
-		if _, ok := err.(*misc.NonExistErr); ok {
-			logger.Panic("StopVM: VM does not exist")
-		}
-		logger.Panic("StopVM: GetVM() failed for an unknown reason")
-
+		logger.WithError(err).Error("StopVM: failed to get VM")
+		return errors.Wrap(err, "failed to stop VM")
 	}
 
 	logger = log.WithFields(log.Fields{"vmID": vmID})
@@ -263,7 +330,7 @@ func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
 	}
 
 	container := *vm.Container
-	if err := container.Delete(ctx, containerd.WithSnapshotCleanup); err != nil {
+	if err := container.Delete(ctx, o.getContainerDeleteOpts(vmID)...); err != nil {
 		logger.WithError(err).Error("failed to delete container")
 		return err
 	}
@@ -279,12 +346,31 @@ func (o *Orchestrator) StopSingleVM(ctx context.Context, vmID string) error {
 	}
 
 	o.workloadIo.Delete(vmID)
+	o.vmSpecs.Delete(vmID)
+	if snap, ok := o.vmSnapshots.LoadAndDelete(vmID); ok {
+		o.catalog.release(snap.(*CatalogEntry))
+	}
+
+	if o.GetUPFEnabled() {
+		if err := o.memoryManager.DeregisterVM(vmID); err != nil {
+			logger.WithError(err).Warn("failed to deregister VM from the memory manager")
+		}
+	}
 
 	logger.Debug("Stopped VM successfully")
 
 	return nil
 }
 
+// The root filesystem of a cataloged snapshot is kept for restoring the VM later
+func (o *Orchestrator) getContainerDeleteOpts(vmID string) []containerd.DeleteOpts {
+	if _, ok := o.catalog.lookupVM(vmID); ok && !o.isSnapshotsCleanup {
+		return nil
+	}
+
+	return []containerd.DeleteOpts{containerd.WithSnapshotCleanup}
+}
+
 // Checks whether a URL has a .local domain
 func isLocalDomain(s string) (bool, error) {
 	if !strings.Contains(s, "://") {
@@ -373,16 +459,20 @@ func getK8sDNS() []string {
 	return dnsIPs
 }
 
-func (o *Orchestrator) getVMConfig(vm *misc.VM) *proto.CreateVMRequest {
-	kernelArgs := "ro noapic reboot=k panic=1 pci=off nomodules systemd.log_color=false systemd.unit=firecracker.target init=/sbin/overlay-init tsc=reliable quiet 8250.nr_uarts=0 ipv6.disable=1"
+func (o *Orchestrator) getVMConfig(vm *misc.VM, spec *VMSpec) *proto.CreateVMRequest {
+	var jailerConfig *proto.JailerConfig
+	if vm.Net != nil {
+		jailerConfig = &proto.JailerConfig{NetNS: vm.Net.NetNSPath()}
+	}
 
 	return &proto.CreateVMRequest{
+		JailerConfig:   jailerConfig,
 		VMID:           vm.ID,
-		TimeoutSeconds: 100,
-		KernelArgs:     kernelArgs,
+		TimeoutSeconds: spec.TimeoutSeconds,
+		KernelArgs:     spec.KernelArgs,
 		MachineCfg: &proto.FirecrackerMachineConfiguration{
-			VcpuCount:  1,
-			MemSizeMib: 256,
+			VcpuCount:  spec.VcpuCount,
+			MemSizeMib: spec.MemSizeMib,
 		},
 		NetworkInterfaces: []*proto.FirecrackerNetworkInterface{{
 			StaticConfig: &proto.StaticNetworkConfiguration{
@@ -469,6 +559,10 @@ func (o *Orchestrator) CreateSnapshot(ctx context.Context, vmID string) error {
 
 	ctx = namespaces.WithNamespace(ctx, namespaceName)
 
+	if snap, ok := o.vmSnapshots.Load(vmID); ok && snap.(*CatalogEntry).VMID != vmID {
+		return errors.Errorf("VM %s is loaded from the shared snapshot of VM %s", vmID, snap.(*CatalogEntry).VMID)
+	}
+
 	req := &proto.CreateSnapshotRequest{
 		VMID:             vmID,
 		SnapshotFilePath: o.getSnapshotFile(vmID),
@@ -480,6 +574,34 @@ func (o *Orchestrator) CreateSnapshot(ctx context.Context, vmID string) error {
 		return err
 	}
 
+	vm, err := o.vmPool.GetVM(vmID)
+	if err != nil || vm.Image == nil {
+		return nil
+	}
+
+	o.snapshotImages.Store(vmID, (*vm.Image).Name())
+
+	spec := o.getVMSpec(vmID)
+
+	entry := &CatalogEntry{
+		Image:          (*vm.Image).Name(),
+		ImageDigest:    (*vm.Image).Target().Digest.String(),
+		VMConfig:       spec.configKey(),
+		VMID:           vmID,
+		Ni:             vm.Ni,
+		GuestMemSize:   spec.GuestMemSize(),
+		SnapFile:       o.getSnapshotFile(vmID),
+		MemFile:        o.getMemoryFile(vmID),
+		WorkingSetFile: o.getWorkingSetFile(vmID),
+		CreatedAt:      time.Now(),
+		users:          1, // the snapshotted VM
+	}
+	if added, err := o.catalog.add(entry); err != nil {
+		logger.WithError(err).Warn("failed to add snapshot to the catalog")
+	} else if added {
+		o.vmSnapshots.Store(vmID, entry)
+	}
+
 	return nil
 }
 
@@ -547,17 +669,14 @@ func (o *Orchestrator) Offload(ctx context.Context, vmID string) error {
 
 	_, err := o.vmPool.GetVM(vmID)
 	if err != nil {
-		if _, ok := err.(*misc.NonExistErr); ok {
-			logger.Panic("Offload: VM does not exist")
-		}
-		logger.Panic("Offload: GetVM() failed for an unknown reason")
-
+		logger.WithError(err).Error("Offload: failed to get VM")
+		return errors.Wrap(err, "failed to offload VM")
 	}
 
 	if o.GetUPFEnabled() {
 		if err := o.memoryManager.Deactivate(vmID); err != nil {
-			logger.Error("Failed to deactivate VM in the memory manager")
-			return err
+			logger.WithError(err).Error("Failed to deactivate VM in the memory manager")
+			return errors.Wrap(err, "failed to deactivate VM in the memory manager")
 		}
 	}
 
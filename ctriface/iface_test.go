@@ -65,11 +65,12 @@ func TestPauseSnapResume(t *testing.T) {
 		WithTestModeOn(true),
 		WithUPF(*isUPFEnabled),
 		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
 	)
 
 	vmID := "4"
 
-	_, _, err := orch.StartVM(ctx, vmID, testImageName)
+	_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
 	require.NoError(t, err, "Failed to start VM")
 
 	err = orch.PauseVM(ctx, vmID)
@@ -87,6 +88,66 @@ func TestPauseSnapResume(t *testing.T) {
 	orch.Cleanup()
 }
 
+func TestSnapshotManagement(t *testing.T) {
+	log.SetFormatter(&log.TextFormatter{
+		TimestampFormat: ctrdlog.RFC3339NanoFixed,
+		FullTimestamp:   true,
+	})
+	//log.SetReportCaller(true) // FIXME: make sure it's false unless debugging
+
+	log.SetOutput(os.Stdout)
+
+	log.SetLevel(log.InfoLevel)
+
+	testTimeout := 120 * time.Second
+	ctx, cancel := context.WithTimeout(namespaces.WithNamespace(context.Background(), namespaceName), testTimeout)
+	defer cancel()
+
+	orch := NewOrchestrator(
+		"devmapper",
+		"",
+		WithTestModeOn(true),
+		WithUPF(*isUPFEnabled),
+		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
+	)
+
+	vmID := "7"
+
+	_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
+	require.NoError(t, err, "Failed to start VM")
+
+	err = orch.SnapshotVM(ctx, vmID)
+	require.NoError(t, err, "Failed to snapshot VM")
+
+	si, err := orch.GetSnapshot(vmID)
+	require.NoError(t, err, "Failed to get snapshot")
+	require.Equal(t, testImageName, si.Image, "Wrong snapshot image")
+	require.NotZero(t, si.MemFileSize, "Guest memory file is empty")
+
+	snapshots, err := orch.ListSnapshots()
+	require.NoError(t, err, "Failed to list snapshots")
+	found := false
+	for _, snap := range snapshots {
+		found = found || snap.VMID == vmID
+	}
+	require.True(t, found, "Snapshot is not listed")
+
+	err = orch.DeleteSnapshot(vmID)
+	require.Error(t, err, "Snapshot of a VM in use must not be deleted")
+
+	err = orch.StopSingleVM(ctx, vmID)
+	require.NoError(t, err, "Failed to stop VM")
+
+	err = orch.DeleteSnapshot(vmID)
+	require.NoError(t, err, "Failed to delete snapshot")
+
+	_, err = orch.GetSnapshot(vmID)
+	require.Error(t, err, "Deleted snapshot must not be found")
+
+	orch.Cleanup()
+}
+
 func TestStartStopSerial(t *testing.T) {
 	log.SetFormatter(&log.TextFormatter{
 		TimestampFormat: ctrdlog.RFC3339NanoFixed,
@@ -108,11 +169,12 @@ func TestStartStopSerial(t *testing.T) {
 		WithTestModeOn(true),
 		WithUPF(*isUPFEnabled),
 		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
 	)
 
 	vmID := "5"
 
-	_, _, err := orch.StartVM(ctx, vmID, testImageName)
+	_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
 	require.NoError(t, err, "Failed to start VM")
 
 	err = orch.StopSingleVM(ctx, vmID)
@@ -142,11 +204,12 @@ func TestPauseResumeSerial(t *testing.T) {
 		WithTestModeOn(true),
 		WithUPF(*isUPFEnabled),
 		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
 	)
 
 	vmID := "6"
 
-	_, _, err := orch.StartVM(ctx, vmID, testImageName)
+	_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
 	require.NoError(t, err, "Failed to start VM")
 
 	err = orch.PauseVM(ctx, vmID)
@@ -183,6 +246,7 @@ func TestStartStopParallel(t *testing.T) {
 		WithTestModeOn(true),
 		WithUPF(*isUPFEnabled),
 		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
 	)
 
 	// Pull image
@@ -196,7 +260,7 @@ func TestStartStopParallel(t *testing.T) {
 			go func(i int) {
 				defer vmGroup.Done()
 				vmID := fmt.Sprintf("%d", i)
-				_, _, err := orch.StartVM(ctx, vmID, testImageName)
+				_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
 				require.NoError(t, err, "Failed to start VM "+vmID)
 			}(i)
 		}
@@ -242,6 +306,7 @@ func TestPauseResumeParallel(t *testing.T) {
 		WithTestModeOn(true),
 		WithUPF(*isUPFEnabled),
 		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
 	)
 
 	// Pull image
@@ -255,7 +320,7 @@ func TestPauseResumeParallel(t *testing.T) {
 			go func(i int) {
 				defer vmGroup.Done()
 				vmID := fmt.Sprintf("%d", i)
-				_, _, err := orch.StartVM(ctx, vmID, testImageName)
+				_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
 				require.NoError(t, err, "Failed to start VM")
 			}(i)
 		}
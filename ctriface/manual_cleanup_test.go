@@ -59,11 +59,12 @@ func TestSnapLoad(t *testing.T) {
 		WithTestModeOn(true),
 		WithUPF(*isUPFEnabled),
 		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
 	)
 
 	vmID := "1"
 
-	_, _, err := orch.StartVM(ctx, vmID, testImageName)
+	_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
 	require.NoError(t, err, "Failed to start VM")
 
 	err = orch.PauseVM(ctx, vmID)
@@ -109,11 +110,12 @@ func TestSnapLoadMultiple(t *testing.T) {
 		WithTestModeOn(true),
 		WithUPF(*isUPFEnabled),
 		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
 	)
 
 	vmID := "3"
 
-	_, _, err := orch.StartVM(ctx, vmID, testImageName)
+	_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
 	require.NoError(t, err, "Failed to start VM")
 
 	err = orch.PauseVM(ctx, vmID)
@@ -171,6 +173,7 @@ func TestParallelSnapLoad(t *testing.T) {
 		WithTestModeOn(true),
 		WithUPF(*isUPFEnabled),
 		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
 	)
 
 	// Pull image
@@ -184,7 +187,7 @@ func TestParallelSnapLoad(t *testing.T) {
 			defer vmGroup.Done()
 			vmID := fmt.Sprintf("%d", i+vmIDBase)
 
-			_, _, err := orch.StartVM(ctx, vmID, testImageName)
+			_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
 			require.NoError(t, err, "Failed to start VM, "+vmID)
 
 			err = orch.PauseVM(ctx, vmID)
@@ -233,6 +236,7 @@ func TestParallelPhasedSnapLoad(t *testing.T) {
 		WithTestModeOn(true),
 		WithUPF(*isUPFEnabled),
 		WithLazyMode(*isLazyMode),
+		WithSnapshotsCleanup(true),
 	)
 
 	// Pull image
@@ -246,7 +250,7 @@ func TestParallelPhasedSnapLoad(t *testing.T) {
 			go func(i int) {
 				defer vmGroup.Done()
 				vmID := fmt.Sprintf("%d", i+vmIDBase)
-				_, _, err := orch.StartVM(ctx, vmID, testImageName)
+				_, _, err := orch.StartVM(ctx, vmID, testImageName, nil)
 				require.NoError(t, err, "Failed to start VM, "+vmID)
 			}(i)
 		}
@@ -31,6 +31,7 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/containerd/containerd"
@@ -76,18 +77,46 @@ type Orchestrator struct {
 	vmPool       *misc.VMPool
 	cachedImages map[string]containerd.Image
 	workloadIo   sync.Map // vmID string -> WorkloadIoWriter
-	snapshotter  string
-	client       *containerd.Client
-	fcClient     *fcclient.Client
+	vmSpecs      sync.Map // vmID string -> *VMSpec
+	// image names of the snapshotted VMs
+	snapshotImages sync.Map // vmID string -> string
+	// snapshots that survive orchestrator restarts
+	catalog     *snapshotCatalog
+	vmSnapshots sync.Map // vmID string -> *CatalogEntry the VM uses
+	snapshotter string
+	client      *containerd.Client
+	fcClient    *fcclient.Client
 	// store *skv.KVStore
-	snapshotsEnabled bool
-	isUPFEnabled     bool
-	isLazyMode       bool
-	snapshotsDir     string
-	isMetricsMode    bool
-	hostIface        string
+	snapshotsEnabled   bool
+	isUPFEnabled       bool
+	isLazyMode         bool
+	isHybridMode       bool
+	snapshotsDir       string
+	isSnapshotsCleanup bool
+	isMetricsMode      bool
+	hostIface          string
+	vethCIDR           string
+	cloneCIDR          string
+
+	memoryManager        *manager.MemoryManager
+	memoryManagerWorkers int
+	wsMissThreshold      int
+	wsMissWindow         int
+	wsRecordings         int
+	wsPageFrequency      float64
+	pageServerAddr       string
+	trackDirtyPages      bool
+	compressWorkingSet   bool
+	checksumWorkingSet   bool
+}
 
-	memoryManager *manager.MemoryManager
+// pageServerSnapshot Returns the name of the guest memory file on the page server
+func (o *Orchestrator) pageServerSnapshot(cfg manager.SnapshotStateCfg) string {
+	rel, err := filepath.Rel(o.snapshotsDir, cfg.GuestMemPath)
+	if err != nil {
+		return cfg.GuestMemPath
+	}
+	return rel
 }
 
 // NewOrchestrator Initializes a new orchestrator
@@ -105,9 +134,9 @@ func NewOrchestrator(snapshotter, hostIface string, opts ...OrchestratorOption)
 		opt(o)
 	}
 
-	if _, err := os.Stat(o.snapshotsDir); err != nil {
-		if !os.IsNotExist(err) {
-			log.Panicf("Snapshot dir %s exists", o.snapshotsDir)
+	if o.vethCIDR != "" || o.cloneCIDR != "" {
+		if err := o.vmPool.SetVMNetworkRanges(o.vethCIDR, o.cloneCIDR); err != nil {
+			log.Panic("Invalid VM network ranges: ", err)
 		}
 	}
 
@@ -115,9 +144,28 @@ func NewOrchestrator(snapshotter, hostIface string, opts ...OrchestratorOption)
 		log.Panicf("Failed to create snapshots dir %s", o.snapshotsDir)
 	}
 
+	o.catalog, err = newSnapshotCatalog(o.snapshotsDir)
+	if err != nil {
+		log.Panic("Failed to load snapshot catalog", err)
+	}
+
 	if o.GetUPFEnabled() {
 		managerCfg := manager.MemoryManagerCfg{
-			MetricsModeOn: o.isMetricsMode,
+			MetricsModeOn:      o.isMetricsMode,
+			Workers:            o.memoryManagerWorkers,
+			MissThreshold:      o.wsMissThreshold,
+			MissWindow:         o.wsMissWindow,
+			Recordings:         o.wsRecordings,
+			PageFrequency:      o.wsPageFrequency,
+			TrackDirtyPages:    o.trackDirtyPages,
+			CompressWorkingSet: o.compressWorkingSet,
+			ChecksumWorkingSet: o.checksumWorkingSet,
+		}
+		if o.pageServerAddr != "" {
+			managerCfg.PageSource, err = manager.NewRemoteSourceFactory(o.pageServerAddr, o.pageServerSnapshot)
+			if err != nil {
+				log.Panic("Failed to connect to the page server", err)
+			}
 		}
 		o.memoryManager = manager.NewMemoryManager(managerCfg)
 	}
@@ -151,9 +199,12 @@ func (o *Orchestrator) setupCloseHandler() {
 }
 
 // Cleanup Removes the bridges created by the VM pool's tap manager
-// Cleans up snapshots directory
+// Cleans up snapshots directory if snapshots cleanup is on
 func (o *Orchestrator) Cleanup() {
 	o.vmPool.RemoveBridges()
+	if !o.isSnapshotsCleanup {
+		return
+	}
 	if err := os.RemoveAll(o.snapshotsDir); err != nil {
 		log.Panic("failed to delete snapshots dir", err)
 	}
@@ -169,6 +220,11 @@ func (o *Orchestrator) GetUPFEnabled() bool {
 	return o.isUPFEnabled
 }
 
+// GetSnapshotsDir Returns the directory where the snapshots of the VMs are stored
+func (o *Orchestrator) GetSnapshotsDir() string {
+	return o.snapshotsDir
+}
+
 // DumpUPFPageStats Dumps the memory manager's stats about the number of
 // the unique pages and the number of the pages that are reused across invocations
 func (o *Orchestrator) DumpUPFPageStats(vmID, functionName, metricsOutFilePath string) error {
@@ -194,11 +250,59 @@ func (o *Orchestrator) GetUPFLatencyStats(vmID string) ([]*metrics.Metric, error
 	return o.memoryManager.GetUPFLatencyStats(vmID)
 }
 
+// ListMemoryVMs Returns the state of the VMs in the memory manager
+func (o *Orchestrator) ListMemoryVMs() ([]*manager.VMInfo, error) {
+	log.Debug("Orchestrator received ListMemoryVMs")
+
+	if o.memoryManager == nil {
+		return nil, errors.New("UPFs are not enabled")
+	}
+
+	return o.memoryManager.ListVMs(), nil
+}
+
+// GetMemoryVM Returns the state of the VM in the memory manager, the VM may be running
+func (o *Orchestrator) GetMemoryVM(vmID string) (*manager.VMInfo, error) {
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger.Debug("Orchestrator received GetMemoryVM")
+
+	if o.memoryManager == nil {
+		return nil, errors.New("UPFs are not enabled")
+	}
+
+	return o.memoryManager.GetVMInfo(vmID)
+}
+
+// GetDirtyPages Returns the offsets in the guest memory file of the pages
+// that the VM wrote during its last activation
+func (o *Orchestrator) GetDirtyPages(vmID string) ([]uint64, error) {
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger.Debug("Orchestrator received GetDirtyPages")
+
+	if o.memoryManager == nil {
+		return nil, errors.New("UPFs are not enabled")
+	}
+
+	return o.memoryManager.GetDirtyPages(vmID)
+}
+
+// getSnapshotFile Returns the VM state file of the snapshot that the VM uses,
+// which may be shared with other VMs
 func (o *Orchestrator) getSnapshotFile(vmID string) string {
+	if snap, ok := o.vmSnapshots.Load(vmID); ok {
+		return snap.(*CatalogEntry).SnapFile
+	}
+
 	return filepath.Join(o.getVMBaseDir(vmID), "snap_file")
 }
 
+// getMemoryFile Returns the guest memory file of the snapshot that the VM uses,
+// which may be shared with other VMs, copy-on-write
 func (o *Orchestrator) getMemoryFile(vmID string) string {
+	if snap, ok := o.vmSnapshots.Load(vmID); ok {
+		return snap.(*CatalogEntry).MemFile
+	}
+
 	return filepath.Join(o.getVMBaseDir(vmID), "mem_file")
 }
 
@@ -210,6 +314,19 @@ func (o *Orchestrator) getVMBaseDir(vmID string) string {
 	return filepath.Join(o.snapshotsDir, vmID)
 }
 
+// resetVMBaseDir Creates an empty base dir for a new VM. The files that an earlier VM with
+// the same ID left behind, e.g., before the orchestrator restarted, are removed, so that
+// the new VM does not inherit its snapshot, working set, or stats. Must not be called
+// for the VMs whose snapshots are in the catalog
+func (o *Orchestrator) resetVMBaseDir(vmID string) error {
+	dir := o.getVMBaseDir(vmID)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+
+	return os.MkdirAll(dir, 0777)
+}
+
 func (o *Orchestrator) setupHeartbeat() {
 	heartbeat := time.NewTicker(60 * time.Second)
 
@@ -57,6 +57,25 @@ func WithSnapshotsDir(snapshotsDir string) OrchestratorOption {
 	}
 }
 
+// WithSnapshotsCleanup Sets whether the snapshots directory,
+// including the snapshot catalog, is removed upon cleanup.
+// By default, snapshots survive orchestrator restarts
+func WithSnapshotsCleanup(isSnapshotsCleanup bool) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.isSnapshotsCleanup = isSnapshotsCleanup
+	}
+}
+
+// WithVMNetworkRanges Sets the address ranges of the veth pairs and of the clone addresses
+// of the VMs that are loaded from a shared snapshot in their own network namespaces,
+// which must not clash with the other networks of the host, see taps.DefaultVethCIDR
+func WithVMNetworkRanges(vethCIDR, cloneCIDR string) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.vethCIDR = vethCIDR
+		o.cloneCIDR = cloneCIDR
+	}
+}
+
 // WithLazyMode Sets the lazy paging mode on (or off),
 // where all guest memory pages are brought on demand.
 // Only works if snapshots are enabled
@@ -66,6 +85,77 @@ func WithLazyMode(isLazyMode bool) OrchestratorOption {
 	}
 }
 
+// WithHybridMode Sets the hybrid paging mode on (or off),
+// where the pages are brought on demand while the recorded trace
+// is prefetched in the background. Only works if snapshots are enabled
+func WithHybridMode(isHybridMode bool) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.isHybridMode = isHybridMode
+	}
+}
+
+// WithPageServer Sets the address of the page server that serves the guest memory
+// of the snapshots instead of the local disk, the snapshots are named by their
+// path relative to the snapshots directory. Only works if UPFs are enabled
+func WithPageServer(addr string) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.pageServerAddr = addr
+	}
+}
+
+// WithDirtyPageTracking Sets the memory manager to record the pages that each activation
+// of a VM writes, using the write-protect faults. Only works if UPFs are enabled
+func WithDirtyPageTracking(trackDirtyPages bool) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.trackDirtyPages = trackDirtyPages
+	}
+}
+
+// WithWorkingSetCompression Sets the memory manager to compress the working set files,
+// which reduces the bytes fetched upon a load at the cost of decompressing them.
+// Only works if UPFs are enabled
+func WithWorkingSetCompression(compressWorkingSet bool) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.compressWorkingSet = compressWorkingSet
+	}
+}
+
+// WithWorkingSetChecksums Sets the memory manager to store the checksums of the pages
+// in the working set files and to verify them when fetching the working set.
+// Only works if UPFs are enabled
+func WithWorkingSetChecksums(checksumWorkingSet bool) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.checksumWorkingSet = checksumWorkingSet
+	}
+}
+
+// WithMemoryManagerWorkers Sets the number of goroutines that fetch
+// and install the working set of a VM in parallel
+func WithMemoryManagerWorkers(workers int) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.memoryManagerWorkers = workers
+	}
+}
+
+// WithWorkingSetMissThreshold Sets the number of the pages missing from the working set
+// per activation, on average over the window of activations, above which they are merged
+// into the working set. Zero disables the merging.
+func WithWorkingSetMissThreshold(threshold, window int) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.wsMissThreshold = threshold
+		o.wsMissWindow = window
+	}
+}
+
+// WithWorkingSetRecordings Sets the number of the invocations recorded to build the working set
+// and the fraction of them that must touch a page for it to be in the working set
+func WithWorkingSetRecordings(recordings int, pageFrequency float64) OrchestratorOption {
+	return func(o *Orchestrator) {
+		o.wsRecordings = recordings
+		o.wsPageFrequency = pageFrequency
+	}
+}
+
 // WithMetricsMode Sets the metrics mode
 func WithMetricsMode(isMetricsMode bool) OrchestratorOption {
 	return func(o *Orchestrator) {
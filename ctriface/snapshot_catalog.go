@@ -0,0 +1,224 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vhive-serverless/vhive/taps"
+)
+
+const catalogFileName = "catalog.json"
+
+var (
+	// ErrNoSnapshot No snapshot for the image and the VM configuration is in the catalog
+	ErrNoSnapshot = errors.New("no snapshot in the catalog")
+	// ErrSnapshotNotFound The VM has no snapshot
+	ErrSnapshotNotFound = errors.New("snapshot does not exist")
+	// ErrSnapshotInUse The snapshot is used by a running VM
+	ErrSnapshotInUse = errors.New("snapshot is in use")
+)
+
+// CatalogEntry Describes a snapshot that VMs can be loaded from, also after
+// the orchestrator restarts. There is one such (golden) snapshot per image
+// and VM configuration, and it is shared by all VMs loaded from it
+type CatalogEntry struct {
+	Image       string `json:"image"`
+	ImageDigest string `json:"image_digest"`
+	VMConfig    string `json:"vm_config"`
+	// ID of the snapshotted VM, whose root filesystem is kept for the snapshot
+	VMID string `json:"vm_id"`
+	// network interface of the snapshotted VM, which the loaded VMs keep in their own network namespaces
+	Ni             *taps.NetworkInterface `json:"network_interface"`
+	GuestMemSize   int                    `json:"guest_mem_size"`
+	SnapFile       string                 `json:"snap_file"`
+	MemFile        string                 `json:"mem_file"`
+	WorkingSetFile string                 `json:"working_set_pages"`
+	CreatedAt      time.Time              `json:"created_at"`
+
+	users int // number of running VMs that use the snapshot
+}
+
+// snapshotCatalog An on-disk catalog of snapshots indexed by image digest and VM configuration
+type snapshotCatalog struct {
+	sync.Mutex
+	path    string
+	entries map[string]*CatalogEntry // indexed by catalogKey
+}
+
+func catalogKey(imageDigest, vmConfig string) string {
+	return imageDigest + "/" + vmConfig
+}
+
+// newSnapshotCatalog Loads the catalog from the directory, or creates an empty one.
+// Entries whose snapshot files are missing are dropped.
+func newSnapshotCatalog(dir string) (*snapshotCatalog, error) {
+	c := &snapshotCatalog{
+		path:    filepath.Join(dir, catalogFileName),
+		entries: make(map[string]*CatalogEntry),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, errors.Wrapf(err, "failed to read snapshot catalog %s", c.path)
+	}
+
+	var entries []*CatalogEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse snapshot catalog %s", c.path)
+	}
+
+	for _, entry := range entries {
+		logger := log.WithFields(log.Fields{"vmID": entry.VMID, "image": entry.Image})
+
+		if !fileExists(entry.SnapFile) || !fileExists(entry.MemFile) {
+			logger.Warn("Dropping catalog entry, snapshot files are missing")
+			continue
+		}
+
+		logger.Debug("Loaded snapshot from the catalog")
+		c.entries[catalogKey(entry.ImageDigest, entry.VMConfig)] = entry
+	}
+
+	return c, c.save()
+}
+
+// save Writes the catalog to disk atomically. Must be called with the lock held
+// or before the catalog is shared.
+func (c *snapshotCatalog) save() error {
+	entries := make([]*CatalogEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to serialize snapshot catalog")
+	}
+
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write snapshot catalog")
+	}
+
+	return os.Rename(tmpPath, c.path)
+}
+
+// add Adds the entry unless there is already a snapshot with the same key.
+// Returns true if the entry was added.
+func (c *snapshotCatalog) add(entry *CatalogEntry) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	key := catalogKey(entry.ImageDigest, entry.VMConfig)
+	if _, ok := c.entries[key]; ok {
+		return false, nil
+	}
+
+	c.entries[key] = entry
+
+	return true, c.save()
+}
+
+// acquire Returns the entry for the image and the VM configuration,
+// which must be released when the VM that uses the snapshot stops
+func (c *snapshotCatalog) acquire(imageDigest, vmConfig string) (*CatalogEntry, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[catalogKey(imageDigest, vmConfig)]
+	if !ok {
+		return nil, ErrNoSnapshot
+	}
+
+	entry.users++
+
+	return entry, nil
+}
+
+// release Releases the entry acquired by a VM
+func (c *snapshotCatalog) release(entry *CatalogEntry) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry.users--
+}
+
+// lookupVM Returns the entry of the VM's snapshot, if any
+func (c *snapshotCatalog) lookupVM(vmID string) (*CatalogEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, entry := range c.entries {
+		if entry.VMID == vmID {
+			return entry, true
+		}
+	}
+
+	return nil, false
+}
+
+// remove Removes the entries of the VM's snapshot
+func (c *snapshotCatalog) remove(vmID string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	for key, entry := range c.entries {
+		if entry.VMID == vmID {
+			if entry.users > 0 {
+				return errors.Wrapf(ErrSnapshotInUse, "VM %s, by %d VMs", vmID, entry.users)
+			}
+			delete(c.entries, key)
+		}
+	}
+
+	return c.save()
+}
+
+// list Returns all entries of the catalog
+func (c *snapshotCatalog) list() []*CatalogEntry {
+	c.Lock()
+	defer c.Unlock()
+
+	entries := make([]*CatalogEntry, 0, len(c.entries))
+	for _, entry := range c.entries {
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,146 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vhive-serverless/vhive/taps"
+)
+
+func newTestCatalogEntry(t *testing.T, dir, vmID, digest string) *CatalogEntry {
+	vmDir := filepath.Join(dir, vmID)
+	require.NoError(t, os.MkdirAll(vmDir, 0777))
+
+	entry := &CatalogEntry{
+		Image:          testImageName,
+		ImageDigest:    digest,
+		VMConfig:       DefaultVMSpec().configKey(),
+		VMID:           vmID,
+		Ni:             &taps.NetworkInterface{HostDevName: vmID + "_tap", MacAddress: "02:FC:00:00:00:01"},
+		GuestMemSize:   DefaultVMSpec().GuestMemSize(),
+		SnapFile:       filepath.Join(vmDir, "snap_file"),
+		MemFile:        filepath.Join(vmDir, "mem_file"),
+		WorkingSetFile: filepath.Join(vmDir, "working_set_pages"),
+		CreatedAt:      time.Now(),
+	}
+
+	for _, path := range []string{entry.SnapFile, entry.MemFile} {
+		require.NoError(t, os.WriteFile(path, []byte("snapshot"), 0644))
+	}
+
+	return entry
+}
+
+func TestResetVMBaseDir(t *testing.T) {
+	o := &Orchestrator{snapshotsDir: t.TempDir()}
+
+	// a VM with the same ID ran before the orchestrator restarted
+	stale := o.getWorkingSetFile("1-0")
+	require.NoError(t, os.MkdirAll(filepath.Dir(stale), 0777))
+	require.NoError(t, os.WriteFile(stale, []byte("pages"), 0644))
+
+	require.NoError(t, o.resetVMBaseDir("1-0"), "Failed to reset the VM base dir")
+	require.DirExists(t, o.getVMBaseDir("1-0"))
+	require.NoFileExists(t, stale, "A new VM must not inherit the working set of an earlier one")
+
+	require.NoError(t, o.resetVMBaseDir("2-0"), "Failed to create the VM base dir")
+	require.DirExists(t, o.getVMBaseDir("2-0"))
+}
+
+func TestMemoryStateCfg(t *testing.T) {
+	dir := t.TempDir()
+	o := &Orchestrator{snapshotsDir: dir}
+	entry := newTestCatalogEntry(t, dir, "1-0", "sha256:aaaa")
+
+	// the snapshotted VM records the working set of the snapshot
+	o.vmSnapshots.Store("1-0", entry)
+	cfg := o.getMemoryStateCfg("1-0", DefaultVMSpec(), "")
+	require.Equal(t, entry.WorkingSetFile, cfg.WorkingSetPath)
+	require.Empty(t, cfg.SharedWorkingSetPath)
+
+	// the VMs loaded from the snapshot replay it, and record their own ones
+	o.vmSnapshots.Store("2-0", entry)
+	cfg = o.getMemoryStateCfg("2-0", DefaultVMSpec(), "")
+	require.Equal(t, entry.MemFile, cfg.GuestMemPath)
+	require.Equal(t, entry.SnapFile, cfg.VMMStatePath)
+	require.Equal(t, entry.WorkingSetFile, cfg.SharedWorkingSetPath)
+	require.Equal(t, o.getWorkingSetFile("2-0"), cfg.WorkingSetPath)
+	require.NotEqual(t, cfg.SharedWorkingSetPath, cfg.WorkingSetPath)
+
+	// a VM started from scratch has no shared working set
+	cfg = o.getMemoryStateCfg("3-0", DefaultVMSpec(), "")
+	require.Empty(t, cfg.SharedWorkingSetPath)
+}
+
+func TestSnapshotCatalogReload(t *testing.T) {
+	dir := t.TempDir()
+	vmConfig := DefaultVMSpec().configKey()
+
+	catalog, err := newSnapshotCatalog(dir)
+	require.NoError(t, err, "Failed to create catalog")
+
+	entry := newTestCatalogEntry(t, dir, "1-0", "sha256:aaaa")
+	added, err := catalog.add(entry)
+	require.NoError(t, err, "Failed to add entry")
+	require.True(t, added, "Entry must be added")
+
+	added, err = catalog.add(newTestCatalogEntry(t, dir, "3-0", "sha256:aaaa"))
+	require.NoError(t, err, "Failed to add entry")
+	require.False(t, added, "Only one snapshot per image and VM config must be cataloged")
+
+	_, err = catalog.add(newTestCatalogEntry(t, dir, "2-0", "sha256:bbbb"))
+	require.NoError(t, err, "Failed to add entry")
+	require.NoError(t, os.Remove(filepath.Join(dir, "2-0", "mem_file")))
+
+	catalog, err = newSnapshotCatalog(dir)
+	require.NoError(t, err, "Failed to reload catalog")
+	require.Len(t, catalog.list(), 1, "Entry with missing files must be dropped")
+
+	_, err = catalog.acquire("sha256:aaaa", (&VMSpec{VcpuCount: 2}).configKey())
+	require.Equal(t, ErrNoSnapshot, err, "Snapshot of another VM config must not be acquired")
+
+	reloaded, err := catalog.acquire("sha256:aaaa", vmConfig)
+	require.NoError(t, err, "Failed to acquire reloaded entry")
+	require.Equal(t, "1-0", reloaded.VMID)
+	require.Equal(t, entry.Ni, reloaded.Ni)
+	require.Equal(t, entry.GuestMemSize, reloaded.GuestMemSize)
+
+	shared, err := catalog.acquire("sha256:aaaa", vmConfig)
+	require.NoError(t, err, "Failed to acquire shared entry")
+	require.Equal(t, reloaded, shared, "Snapshot must be shared")
+
+	require.Error(t, catalog.remove("1-0"), "Snapshot in use must not be removed")
+	catalog.release(reloaded)
+	catalog.release(shared)
+	require.NoError(t, catalog.remove("1-0"), "Failed to remove entry")
+
+	catalog, err = newSnapshotCatalog(dir)
+	require.NoError(t, err, "Failed to reload catalog")
+	require.Empty(t, catalog.list(), "Removed entry must not be reloaded")
+}
@@ -0,0 +1,300 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vhive-serverless/vhive/metrics"
+)
+
+// SnapshotInfo Describes a snapshot of a VM stored on disk
+type SnapshotInfo struct {
+	VMID      string
+	Image     string // empty if the snapshot was not created by this orchestrator
+	CreatedAt time.Time
+
+	SnapFileSize   int64
+	MemFileSize    int64
+	WorkingSetSize int64 // zero until the working set is recorded (REAP only)
+}
+
+// Size Returns the total size of the snapshot files on disk, in bytes
+func (si *SnapshotInfo) Size() int64 {
+	return si.SnapFileSize + si.MemFileSize + si.WorkingSetSize
+}
+
+// SnapshotVM Pauses a running VM, creates its snapshot, and resumes the VM
+func (o *Orchestrator) SnapshotVM(ctx context.Context, vmID string) error {
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger.Debug("Orchestrator received SnapshotVM")
+
+	if err := o.PauseVM(ctx, vmID); err != nil {
+		return err
+	}
+
+	if err := o.CreateSnapshot(ctx, vmID); err != nil {
+		return err
+	}
+
+	if _, err := o.ResumeVM(ctx, vmID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetSnapshot Returns the description of the snapshot of a VM. Snapshots in the catalog
+// are described by their catalog entries, which outlive the orchestrator
+func (o *Orchestrator) GetSnapshot(vmID string) (*SnapshotInfo, error) {
+	if entry, ok := o.catalog.lookupVM(vmID); ok {
+		return o.getCatalogSnapshot(entry)
+	}
+
+	snapStat, err := os.Stat(o.getSnapshotFile(vmID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Wrapf(ErrSnapshotNotFound, "VM %s", vmID)
+		}
+		return nil, errors.Wrapf(err, "failed to stat snapshot of VM %s", vmID)
+	}
+
+	si := &SnapshotInfo{
+		VMID:         vmID,
+		CreatedAt:    snapStat.ModTime(),
+		SnapFileSize: snapStat.Size(),
+	}
+
+	if image, ok := o.snapshotImages.Load(vmID); ok {
+		si.Image = image.(string)
+	}
+
+	if err := si.statFiles(o.getMemoryFile(vmID), o.getWorkingSetFile(vmID)); err != nil {
+		return nil, err
+	}
+
+	return si, nil
+}
+
+// getCatalogSnapshot Returns the description of a snapshot in the catalog
+func (o *Orchestrator) getCatalogSnapshot(entry *CatalogEntry) (*SnapshotInfo, error) {
+	snapStat, err := os.Stat(entry.SnapFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to stat snapshot of VM %s", entry.VMID)
+	}
+
+	si := &SnapshotInfo{
+		VMID:         entry.VMID,
+		Image:        entry.Image,
+		CreatedAt:    entry.CreatedAt,
+		SnapFileSize: snapStat.Size(),
+	}
+
+	if err := si.statFiles(entry.MemFile, entry.WorkingSetFile); err != nil {
+		return nil, err
+	}
+
+	return si, nil
+}
+
+// statFiles Fills in the sizes of the guest memory file and of the working set file, if any
+func (si *SnapshotInfo) statFiles(memFile, wsFile string) error {
+	memStat, err := os.Stat(memFile)
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat guest memory file of VM %s", si.VMID)
+	}
+	si.MemFileSize = memStat.Size()
+
+	if wsStat, err := os.Stat(wsFile); err == nil {
+		si.WorkingSetSize = wsStat.Size()
+	}
+
+	return nil
+}
+
+// ListSnapshots Returns the descriptions of the snapshots in the catalog and of the
+// other snapshots in the snapshots directory, sorted by creation time. The image of
+// the latter is only known if they were created since the orchestrator started
+func (o *Orchestrator) ListSnapshots() ([]*SnapshotInfo, error) {
+	entries, err := os.ReadDir(o.snapshotsDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read snapshots dir %s", o.snapshotsDir)
+	}
+
+	var (
+		snapshots = make([]*SnapshotInfo, 0, len(entries))
+		listed    = make(map[string]bool)
+	)
+
+	for _, entry := range o.catalog.list() {
+		si, err := o.getCatalogSnapshot(entry)
+		if err != nil {
+			log.WithFields(log.Fields{"vmID": entry.VMID}).WithError(err).Warn("Skipping broken snapshot")
+			continue
+		}
+
+		snapshots = append(snapshots, si)
+		listed[entry.VMID] = true
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || listed[entry.Name()] {
+			continue
+		}
+
+		vmID := entry.Name()
+		if _, err := os.Stat(o.getSnapshotFile(vmID)); err != nil {
+			// the VM has never been snapshotted
+			continue
+		}
+
+		si, err := o.GetSnapshot(vmID)
+		if err != nil {
+			log.WithFields(log.Fields{"vmID": vmID}).WithError(err).Warn("Skipping broken snapshot")
+			continue
+		}
+
+		snapshots = append(snapshots, si)
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+
+	return snapshots, nil
+}
+
+// DeleteSnapshot Removes the snapshot files of a VM. The snapshot of a VM
+// that is still in use (i.e., active or offloaded) cannot be deleted.
+func (o *Orchestrator) DeleteSnapshot(vmID string) error {
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+	logger.Debug("Orchestrator received DeleteSnapshot")
+
+	if _, err := os.Stat(o.getSnapshotFile(vmID)); err != nil {
+		return errors.Wrapf(ErrSnapshotNotFound, "VM %s", vmID)
+	}
+
+	if _, ok := o.vmPool.GetVMMap()[vmID]; ok {
+		return errors.Wrapf(ErrSnapshotInUse, "VM %s, stop the VM first", vmID)
+	}
+
+	if err := o.catalog.remove(vmID); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(o.getVMBaseDir(vmID)); err != nil {
+		logger.WithError(err).Error("Failed to remove snapshot files")
+		return err
+	}
+
+	// the root filesystem of a cataloged snapshot outlives its VM
+	ctx := namespaces.WithNamespace(context.Background(), namespaceName)
+	if err := o.client.SnapshotService(o.snapshotter).Remove(ctx, vmID); err != nil && !errdefs.IsNotFound(err) {
+		logger.WithError(err).Warn("Failed to remove root filesystem of the snapshotted VM")
+	}
+
+	o.snapshotImages.Delete(vmID)
+
+	return nil
+}
+
+// HasCatalogSnapshot Returns true if the ID is taken by a VM whose snapshot is in the catalog
+func (o *Orchestrator) HasCatalogSnapshot(vmID string) bool {
+	_, ok := o.catalog.lookupVM(vmID)
+	return ok
+}
+
+// StartVMFromSnapshot Starts a VM from the golden snapshot of the image, i.e., the cataloged
+// snapshot for the image and the VM spec, which may have been created before
+// the orchestrator restarted. Many VMs can be loaded from the same snapshot at the same
+// time: the guest memory file is shared copy-on-write, and each VM keeps the network
+// interface of the snapshot inside its own network namespace, while the host reaches
+// the VM at the returned guest IP. The guest root filesystem of the snapshot is shared
+// too. Loading requires firecracker-containerd to start the VMM in the network namespace
+// from the VM's jailer config. Returns ErrNoSnapshot if there is no golden snapshot.
+func (o *Orchestrator) StartVMFromSnapshot(ctx context.Context, vmID, imageName string, spec *VMSpec) (_ *StartVMResponse, _ *metrics.Metric, retErr error) {
+	logger := log.WithFields(log.Fields{"vmID": vmID, "image": imageName})
+	logger.Debug("Orchestrator received StartVMFromSnapshot")
+
+	ctx = namespaces.WithNamespace(ctx, namespaceName)
+
+	image, err := o.getImage(ctx, imageName)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "Failed to get/pull image")
+	}
+
+	snap, err := o.catalog.acquire(
+		(*image).Target().Digest.String(),
+		spec.configKey(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The VM is booted to set up the shim, which the snapshot is then loaded into
+	resp, startMetric, err := o.startVM(ctx, vmID, imageName, []string{}, spec, snap)
+	if err != nil {
+		o.catalog.release(snap)
+		return nil, nil, err
+	}
+
+	defer func() {
+		if retErr != nil {
+			if err := o.StopSingleVM(ctx, vmID); err != nil {
+				logger.WithError(err).Error("failed to stop VM after failing to load it from snapshot")
+			}
+		}
+	}()
+
+	if err := o.Offload(ctx, vmID); err != nil {
+		return nil, nil, err
+	}
+
+	loadMetric, err := o.LoadSnapshot(ctx, vmID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resumeMetric, err := o.ResumeVM(ctx, vmID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, m := range []*metrics.Metric{loadMetric, resumeMetric} {
+		for k, v := range m.MetricMap {
+			startMetric.MetricMap[k] = v
+		}
+	}
+
+	logger.Debug("Started VM from snapshot")
+
+	return resp, startMetric, nil
+}
@@ -0,0 +1,119 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ctriface
+
+import (
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultVcpuCount      = 1
+	defaultMemSizeMib     = 256
+	defaultTimeoutSeconds = 100
+	defaultKernelArgs     = "ro noapic reboot=k panic=1 pci=off nomodules systemd.log_color=false systemd.unit=firecracker.target init=/sbin/overlay-init tsc=reliable quiet 8250.nr_uarts=0 ipv6.disable=1"
+
+	// limits of Firecracker
+	maxVcpuCount  = 32
+	minMemSizeMib = 128
+)
+
+// ErrInvalidVMSpec The VM spec exceeds the limits of Firecracker
+var ErrInvalidVMSpec = errors.New("invalid VM spec")
+
+// VMSpec Resources and boot parameters of a VM. Zero fields take the default values.
+type VMSpec struct {
+	VcpuCount  uint32
+	MemSizeMib uint32
+	KernelArgs string
+	// firecracker-containerd timeout for the VM to boot
+	TimeoutSeconds uint32
+}
+
+// DefaultVMSpec Returns the spec of the VMs for which no spec is given
+func DefaultVMSpec() *VMSpec {
+	return &VMSpec{
+		VcpuCount:      defaultVcpuCount,
+		MemSizeMib:     defaultMemSizeMib,
+		KernelArgs:     defaultKernelArgs,
+		TimeoutSeconds: defaultTimeoutSeconds,
+	}
+}
+
+// WithDefaults Returns a copy of the spec where the zero fields are set to
+// the default values. A nil spec gives the default spec.
+func (s *VMSpec) WithDefaults() *VMSpec {
+	spec := DefaultVMSpec()
+	if s == nil {
+		return spec
+	}
+
+	if s.VcpuCount != 0 {
+		spec.VcpuCount = s.VcpuCount
+	}
+	if s.MemSizeMib != 0 {
+		spec.MemSizeMib = s.MemSizeMib
+	}
+	if s.KernelArgs != "" {
+		spec.KernelArgs = s.KernelArgs
+	}
+	if s.TimeoutSeconds != 0 {
+		spec.TimeoutSeconds = s.TimeoutSeconds
+	}
+
+	return spec
+}
+
+// Validate Checks that Firecracker can run a VM with the spec
+func (s *VMSpec) Validate() error {
+	spec := s.WithDefaults()
+
+	if spec.VcpuCount > maxVcpuCount || (spec.VcpuCount > 1 && spec.VcpuCount%2 != 0) {
+		return errors.Wrapf(ErrInvalidVMSpec, "vCPU count %d, must be 1 or an even number up to %d", spec.VcpuCount, maxVcpuCount)
+	}
+
+	if spec.MemSizeMib < minMemSizeMib {
+		return errors.Wrapf(ErrInvalidVMSpec, "memory size %d MiB, must be at least %d MiB", spec.MemSizeMib, minMemSizeMib)
+	}
+
+	return nil
+}
+
+// GuestMemSize Returns the size of the guest memory in bytes
+func (s *VMSpec) GuestMemSize() int {
+	return int(s.WithDefaults().MemSizeMib) * 1024 * 1024
+}
+
+// Equal Returns true if the specs give the same VM, taking the defaults into account
+func (s *VMSpec) Equal(other *VMSpec) bool {
+	return *s.WithDefaults() == *other.WithDefaults()
+}
+
+// configKey Returns the part of the spec that a snapshot depends on
+func (s *VMSpec) configKey() string {
+	spec := s.WithDefaults()
+	sum := sha256.Sum256([]byte(spec.KernelArgs))
+	return fmt.Sprintf("vcpu%d-mem%dmib-%x", spec.VcpuCount, spec.MemSizeMib, sum[:8])
+}
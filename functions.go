@@ -25,51 +25,126 @@ package main
 import (
 	"context"
 	"fmt"
-	"math/rand"
 	"net"
+	"net/http"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
 
-	"golang.org/x/sync/semaphore"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
+	"github.com/vhive-serverless/vhive/ctriface"
 	hpb "github.com/vhive-serverless/vhive/examples/protobuf/helloworld"
+	"github.com/vhive-serverless/vhive/keepalive"
 	"github.com/vhive-serverless/vhive/metrics"
+	"github.com/vhive-serverless/vhive/proxy"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
 var isTestMode bool // set with a call to NewFuncPool
 
+var (
+	// ErrFunctionNotFound The function is not registered in the pool
+	ErrFunctionNotFound = errors.New("function is not registered")
+	// ErrInvalidFunctionConfig The settings of the function are invalid
+	ErrInvalidFunctionConfig = errors.New("invalid function config")
+	// ErrFunctionConflict The function is already registered with different settings
+	ErrFunctionConflict = errors.New("function is already registered with different settings")
+	// ErrNoRunningInstance The function has no running instance
+	ErrNoRunningInstance = errors.New("function has no running instance")
+)
+
+const (
+	// defaultTimeout Timeout of the requests to a running instance when the client sets no deadline
+	defaultTimeout = 20 * time.Second
+	// startTimeout Timeout of starting or loading an instance
+	startTimeout = 5 * time.Minute
+	// defaultPort Port of the function's server in the instance, as in the helloworld example
+	defaultPort = 50051
+)
+
+const (
+	// ProtocolGRPC The function's server speaks gRPC, e.g., serves the helloworld Greeter service
+	ProtocolGRPC = "grpc"
+	// ProtocolHTTP The function's server speaks HTTP/1.1
+	ProtocolHTTP = "http"
+)
+
 //////////////////////////////// FunctionPool type //////////////////////////////////////////
 
 // FuncPool Pool of functions
 type FuncPool struct {
 	sync.Mutex
-	funcMap        map[string]*Function
-	saveMemoryMode bool
-	servedTh       uint64
-	pinnedFuncNum  int
-	stats          *Stats
+	funcMap            map[string]*Function
+	saveMemoryMode     bool
+	newKeepAlivePolicy keepalive.PolicyFactory
+	pinnedFuncNum      int
+	maxInstances       int           // default maximum number of instances per function
+	timeout            time.Duration // default timeout of the requests to a function
+	stats              *Stats
+}
+
+// FunctionConfig Per-function settings, the zero values take the pool's defaults
+type FunctionConfig struct {
+	// resources of the function's VMs
+	VMSpec *ctriface.VMSpec
+	// maximum number of instances the function scales out to
+	MaxInstances int
+	// timeout of the requests to a running instance when the client sets no deadline
+	Timeout time.Duration
+	// port the function's server listens on in the instance
+	Port int
+	// protocol the function's server speaks, ProtocolGRPC or ProtocolHTTP
+	Protocol string
 }
 
-// NewFuncPool Initializes a pool of functions. Functions can only be added
-// but never removed from the map.
-func NewFuncPool(saveMemoryMode bool, servedTh uint64, pinnedFuncNum int, testModeOn bool) *FuncPool {
+// FuncPoolOption Options to pass to FuncPool
+type FuncPoolOption func(*FuncPool)
+
+// WithMaxInstances Sets the default maximum number of instances per function
+func WithMaxInstances(maxInstances int) FuncPoolOption {
+	return func(p *FuncPool) {
+		p.maxInstances = maxInstances
+	}
+}
+
+// WithTimeout Sets the default timeout of the requests to a running instance
+// when the client sets no deadline
+func WithTimeout(timeout time.Duration) FuncPoolOption {
+	return func(p *FuncPool) {
+		p.timeout = timeout
+	}
+}
+
+// NewFuncPool Initializes a pool of functions. Functions are added either
+// explicitly (RegisterFunction) or upon their first invocation, and removed
+// with DeregisterFunction. The keep-alive policy decides when the idle instances
+// of the functions that are not pinned are removed, nil for the default fixed window.
+func NewFuncPool(saveMemoryMode bool, newKeepAlivePolicy keepalive.PolicyFactory, pinnedFuncNum int, testModeOn bool, opts ...FuncPoolOption) *FuncPool {
 	p := new(FuncPool)
 	p.funcMap = make(map[string]*Function)
 	p.saveMemoryMode = saveMemoryMode
-	p.servedTh = servedTh
+	p.newKeepAlivePolicy = newKeepAlivePolicy
+	if p.newKeepAlivePolicy == nil {
+		p.newKeepAlivePolicy = keepalive.NewFixedPolicy(keepalive.DefaultWindow)
+	}
 	p.pinnedFuncNum = pinnedFuncNum
+	p.maxInstances = 1
+	p.timeout = defaultTimeout
 	p.stats = NewStats()
 
+	for _, opt := range opts {
+		opt(p)
+	}
+
 	if !testModeOn {
 		heartbeat := time.NewTicker(60 * time.Second)
 
@@ -88,6 +163,11 @@ func NewFuncPool(saveMemoryMode bool, servedTh uint64, pinnedFuncNum int, testMo
 
 // getFunction Returns a ptr to a function or creates it unless it exists
 func (p *FuncPool) getFunction(fID, imageName string) *Function {
+	return p.getFunctionWithConfig(fID, imageName, FunctionConfig{})
+}
+
+// getFunctionWithConfig Returns a ptr to a function or creates it with the config unless it exists
+func (p *FuncPool) getFunctionWithConfig(fID, imageName string, cfg FunctionConfig) *Function {
 	p.Lock()
 	defer p.Unlock()
 
@@ -103,8 +183,21 @@ func (p *FuncPool) getFunction(fID, imageName string) *Function {
 			isToPin = false
 		}
 
-		logger.Debugf("Created function, pinned=%t, shut down after %d requests", isToPin, p.servedTh)
-		p.funcMap[fID] = NewFunction(fID, imageName, p.stats, p.servedTh, isToPin)
+		if cfg.MaxInstances == 0 {
+			cfg.MaxInstances = p.maxInstances
+		}
+		if cfg.Timeout == 0 {
+			cfg.Timeout = p.timeout
+		}
+		if cfg.Port == 0 {
+			cfg.Port = defaultPort
+		}
+		if cfg.Protocol == "" {
+			cfg.Protocol = ProtocolGRPC
+		}
+
+		logger.Debugf("Created function, pinned=%t, up to %d instances", isToPin, cfg.MaxInstances)
+		p.funcMap[fID] = NewFunction(fID, imageName, cfg, p.stats, p.newKeepAlivePolicy(), isToPin)
 
 		if err := p.stats.CreateStats(fID); err != nil {
 			logger.Panic("GetFunction: Function exists")
@@ -114,6 +207,127 @@ func (p *FuncPool) getFunction(fID, imageName string) *Function {
 	return p.funcMap[fID]
 }
 
+// lookupFunction Returns a ptr to a function if it exists
+func (p *FuncPool) lookupFunction(fID string) (*Function, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	f, found := p.funcMap[fID]
+	if !found {
+		return nil, errors.Wrap(ErrFunctionNotFound, fID)
+	}
+
+	return f, nil
+}
+
+// RegisterFunction Adds a function to the pool without starting its instances.
+// Registering a function again succeeds only with the same settings.
+func (p *FuncPool) RegisterFunction(fID, imageName string, cfg FunctionConfig) (*Function, error) {
+	if fID == "" || imageName == "" {
+		return nil, errors.Wrap(ErrInvalidFunctionConfig, "empty function ID or image name")
+	}
+
+	if cfg.MaxInstances < 0 {
+		return nil, errors.Wrapf(ErrInvalidFunctionConfig, "maximum number of instances %d", cfg.MaxInstances)
+	}
+
+	if cfg.Timeout < 0 {
+		return nil, errors.Wrapf(ErrInvalidFunctionConfig, "timeout %s", cfg.Timeout)
+	}
+
+	if cfg.Port < 0 || cfg.Port > 65535 {
+		return nil, errors.Wrapf(ErrInvalidFunctionConfig, "port %d", cfg.Port)
+	}
+
+	if cfg.Protocol != "" && cfg.Protocol != ProtocolGRPC && cfg.Protocol != ProtocolHTTP {
+		return nil, errors.Wrapf(ErrInvalidFunctionConfig, "unknown protocol %s", cfg.Protocol)
+	}
+
+	if err := cfg.VMSpec.Validate(); err != nil {
+		return nil, err
+	}
+
+	if f, err := p.lookupFunction(fID); err == nil {
+		if f.imageName != imageName {
+			return nil, errors.Wrapf(ErrFunctionConflict, "function %s has image %s", fID, f.imageName)
+		}
+		if !f.spec.Equal(cfg.VMSpec) {
+			return nil, errors.Wrapf(ErrFunctionConflict, "function %s has a different VM spec", fID)
+		}
+		if cfg.MaxInstances != 0 && f.maxInstances != cfg.MaxInstances {
+			return nil, errors.Wrapf(ErrFunctionConflict, "function %s has up to %d instances", fID, f.maxInstances)
+		}
+		if cfg.Timeout != 0 && f.timeout != cfg.Timeout {
+			return nil, errors.Wrapf(ErrFunctionConflict, "function %s has timeout %s", fID, f.timeout)
+		}
+		if cfg.Port != 0 && f.port != cfg.Port {
+			return nil, errors.Wrapf(ErrFunctionConflict, "function %s has port %d", fID, f.port)
+		}
+		if cfg.Protocol != "" && f.protocol != cfg.Protocol {
+			return nil, errors.Wrapf(ErrFunctionConflict, "function %s has protocol %s", fID, f.protocol)
+		}
+		return f, nil
+	}
+
+	return p.getFunctionWithConfig(fID, imageName, cfg), nil
+}
+
+// DeregisterFunction Stops the instances of the function, if any, and removes the function from the pool.
+// Returns the state of the function right before its removal.
+func (p *FuncPool) DeregisterFunction(fID string) (*FunctionInfo, error) {
+	p.Lock()
+
+	f, found := p.funcMap[fID]
+	if !found {
+		p.Unlock()
+		return nil, errors.Wrap(ErrFunctionNotFound, fID)
+	}
+
+	delete(p.funcMap, fID)
+
+	p.Unlock()
+
+	f.cancelKeepAlive()
+
+	if err := f.StopInstances(); err != nil {
+		return nil, err
+	}
+
+	info := f.GetInfo()
+
+	if err := p.stats.RemoveStats(fID); err != nil {
+		log.WithFields(log.Fields{"fID": fID}).Warn(err)
+	}
+
+	return info, nil
+}
+
+// ListFunctions Returns all functions in the pool sorted by their IDs
+func (p *FuncPool) ListFunctions() []*Function {
+	p.Lock()
+	defer p.Unlock()
+
+	funcs := make([]*Function, 0, len(p.funcMap))
+	for _, f := range p.funcMap {
+		funcs = append(funcs, f)
+	}
+	sort.Slice(funcs, func(i, j int) bool {
+		numA, errA := strconv.Atoi(funcs[i].fID)
+		numB, errB := strconv.Atoi(funcs[j].fID)
+		if errA == nil && errB == nil {
+			return numA < numB
+		}
+		return funcs[i].fID < funcs[j].fID
+	})
+
+	return funcs
+}
+
+// GetFunction Returns the function if it is registered
+func (p *FuncPool) GetFunction(fID string) (*Function, error) {
+	return p.lookupFunction(fID)
+}
+
 // Serve Service RPC request by triggering the corresponding function.
 func (p *FuncPool) Serve(ctx context.Context, fID, imageName, payload string) (*hpb.FwdHelloResp, *metrics.Metric, error) {
 	f := p.getFunction(fID, imageName)
@@ -121,28 +335,56 @@ func (p *FuncPool) Serve(ctx context.Context, fID, imageName, payload string) (*
 	return f.Serve(ctx, fID, imageName, payload)
 }
 
-// AddInstance Adds instance of the function
+// ServeGRPC Forwards the call of any gRPC method to the registered function
+func (p *FuncPool) ServeGRPC(fID, method string, stream grpc.ServerStream) error {
+	f, err := p.lookupFunction(fID)
+	if err != nil {
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	return f.ServeGRPC(method, stream)
+}
+
+// ServeHTTP Forwards the HTTP request to the registered function
+func (p *FuncPool) ServeHTTP(fID string, w http.ResponseWriter, r *http.Request) {
+	f, err := p.lookupFunction(fID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	f.ServeHTTP(w, r)
+}
+
+// AddInstance Adds the first instance of the function
 func (p *FuncPool) AddInstance(fID, imageName string) (string, error) {
 	f := p.getFunction(fID, imageName)
 
-	logger := log.WithFields(log.Fields{"fID": f.fID})
-
-	f.OnceAddInstance.Do(
-		func() {
-			logger.Debug("Function is inactive, starting the instance...")
-			f.AddInstance()
-		})
+	if _, err := f.AddInstance(); err != nil {
+		return "", err
+	}
 
 	return "Instance started", nil
 }
 
-// RemoveInstance Removes instance of the function (blocking)
+// RemoveInstance Removes the running instances of the function (blocking)
 func (p *FuncPool) RemoveInstance(fID, imageName string, isSync bool) (string, error) {
 	f := p.getFunction(fID, imageName)
 
 	return f.RemoveInstance(isSync)
 }
 
+// CreateSnapshot Creates a snapshot of a running instance of the function,
+// unless all running instances already have a snapshot
+func (p *FuncPool) CreateSnapshot(fID string) (string, error) {
+	f, err := p.lookupFunction(fID)
+	if err != nil {
+		return "", err
+	}
+
+	return f.CreateSnapshot()
+}
+
 // DumpUPFPageStats Dumps the memory manager's stats for a function about the number of
 // the unique pages and the number of the pages that are reused across invocations
 func (p *FuncPool) DumpUPFPageStats(fID, imageName, functionName, metricsOutFilePath string) error {
@@ -160,57 +402,108 @@ func (p *FuncPool) DumpUPFLatencyStats(fID, imageName, functionName, latencyOutF
 
 //////////////////////////////// Function type //////////////////////////////////////////////
 
+// InstanceState State of the function's instance
+type InstanceState int
+
+const (
+	// InstanceInactive The instance has never been started or has been stopped
+	InstanceInactive InstanceState = iota
+	// InstanceRunning The instance is up and serving requests
+	InstanceRunning
+	// InstanceOffloaded The instance has been offloaded and can be loaded from its snapshot
+	InstanceOffloaded
+	// InstanceUnhealthy An operation on the instance failed, the instance is recreated when it starts next time
+	InstanceUnhealthy
+)
+
+// instanceStatePriority The state of a function is the state of its instance with the highest priority
+var instanceStatePriority = map[InstanceState]int{
+	InstanceInactive:  0,
+	InstanceUnhealthy: 1,
+	InstanceOffloaded: 2,
+	InstanceRunning:   3,
+}
+
+func (s InstanceState) String() string {
+	switch s {
+	case InstanceRunning:
+		return "running"
+	case InstanceOffloaded:
+		return "offloaded"
+	case InstanceUnhealthy:
+		return "unhealthy"
+	default:
+		return "inactive"
+	}
+}
+
+// FunctionInfo A consistent view of the function's state.
+// VMID, GuestIP and IsSnapshotReady describe the first instance of the function.
+type FunctionInfo struct {
+	FID             string
+	ImageName       string
+	State           InstanceState
+	VMID            string
+	GuestIP         string
+	IsPinned        bool
+	IsSnapshotReady bool
+	VMSpec          *ctriface.VMSpec
+	Served          uint64
+	Started         uint64
+	Failed          uint64          // number of failed operations on the function's instances
+	ColdStartMetric *metrics.Metric // breakdown of the last cold start, nil if none
+	MaxInstances    int
+	Timeout         time.Duration
+	Port            int
+	Protocol        string
+	Instances       []*InstanceInfo
+}
+
 // Function type
 type Function struct {
 	sync.RWMutex
-	OnceAddInstance        *sync.Once
-	fID                    string
-	imageName              string
-	vmID                   string
-	lastInstanceID         int
-	isPinnedInMem          bool // if pinned, the orchestrator does not stop/offload it)
-	stats                  *Stats
-	servedTh               uint64
-	sem                    *semaphore.Weighted
-	servedSyncCounter      int64
-	isSnapshotReady        bool // if ready, the orchestrator should load the instance rather than creating it
-	OnceCreateSnapInstance *sync.Once
-	funcClient             *hpb.GreeterClient
-	conn                   *grpc.ClientConn
-	guestIP                string
-}
-
-// NewFunction Initializes a function
+	fID             string
+	imageName       string
+	spec            *ctriface.VMSpec // resources of the function's VMs
+	lastInstanceID  int
+	isPinnedInMem   bool // if pinned, the orchestrator does not stop/offload it)
+	stats           *Stats
+	maxInstances    int
+	timeout         time.Duration   // timeout of the requests to a running instance when the client sets no deadline
+	port            int             // port of the function's server in the instance
+	protocol        string          // ProtocolGRPC or ProtocolHTTP
+	instances       []*Instance     // instances are never removed, the inactive ones are started again
+	coldStartMetric *metrics.Metric // breakdown of the last cold start
+
+	// idleMu protects the function's idle time that the keep-alive policy learns from
+	idleMu    sync.Mutex
+	keepAlive keepalive.Policy
+	inFlight  int       // number of requests being served
+	idleSince time.Time // completion time of the last request
+}
+
+// NewFunction Initializes a function with the config, where all settings must be set except the VM spec
 // Note: for numerical fIDs, [0, hotFunctionsNum) and [hotFunctionsNum; hotFunctionsNum+warmFunctionsNum)
 // are functions that are pinned in memory (stopping or offloading by the daemon is not allowed)
-func NewFunction(fID, imageName string, Stats *Stats, servedTh uint64, isToPin bool) *Function {
+func NewFunction(fID, imageName string, cfg FunctionConfig, Stats *Stats, keepAlive keepalive.Policy, isToPin bool) *Function {
 	f := new(Function)
 	f.fID = fID
 	f.imageName = imageName
-	f.OnceAddInstance = new(sync.Once)
+	f.spec = cfg.VMSpec.WithDefaults()
 	f.isPinnedInMem = isToPin
 	f.stats = Stats
-	f.OnceCreateSnapInstance = new(sync.Once)
-
-	// Normal distribution with stddev=servedTh/2, mean=servedTh
-	thresh := int64(rand.NormFloat64()*float64(servedTh/2) + float64(servedTh))
-	if thresh <= 0 {
-		thresh = int64(servedTh)
-	}
-	if isTestMode && servedTh == 40 { // 40 is used in tests
-		thresh = 40
-	}
-
-	f.servedTh = uint64(thresh)
-	f.sem = semaphore.NewWeighted(int64(f.servedTh))
-	f.servedSyncCounter = int64(f.servedTh) // cannot use uint64 for the counter due to the overflow
+	f.keepAlive = keepAlive
+	f.maxInstances = cfg.MaxInstances
+	f.timeout = cfg.Timeout
+	f.port = cfg.Port
+	f.protocol = cfg.Protocol
 
 	log.WithFields(
 		log.Fields{
-			"fID":      f.fID,
-			"image":    f.imageName,
-			"isPinned": f.isPinnedInMem,
-			"servedTh": f.servedTh,
+			"fID":          f.fID,
+			"image":        f.imageName,
+			"isPinned":     f.isPinnedInMem,
+			"maxInstances": f.maxInstances,
 		},
 	).Info("New function added")
 
@@ -218,300 +511,399 @@ func NewFunction(fID, imageName string, Stats *Stats, servedTh uint64, isToPin b
 }
 
 // Serve Service RPC request and response on behalf of a function, spinning
-// function instances when necessary.
+// function instances when necessary. The function's instances must serve
+// the helloworld Greeter service.
+func (f *Function) Serve(ctx context.Context, fID, imageName, reqPayload string) (*hpb.FwdHelloResp, *metrics.Metric, error) {
+	if f.protocol != ProtocolGRPC {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "function %s serves %s, not gRPC", f.fID, f.protocol)
+	}
+
+	var resp *hpb.HelloReply
+	isColdStart, serveMetric, err := f.serve(ctx, func(ctx context.Context, inst *Instance) (err error) {
+		resp, err = inst.fwdRPC(ctx, reqPayload)
+		return err
+	})
+	if err != nil {
+		return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: ""}, serveMetric, err
+	}
+
+	return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: resp.Message}, serveMetric, nil
+}
+
+// ServeGRPC Forwards the call of any gRPC method to an instance of the function
+// without decoding the messages
+func (f *Function) ServeGRPC(method string, stream grpc.ServerStream) error {
+	if f.protocol != ProtocolGRPC {
+		return status.Errorf(codes.FailedPrecondition, "function %s serves %s, not gRPC", f.fID, f.protocol)
+	}
+
+	_, _, err := f.serve(stream.Context(), func(ctx context.Context, inst *Instance) error {
+		return inst.proxyStream(ctx, method, stream)
+	})
+
+	return err
+}
+
+// ServeHTTP Forwards the HTTP request to an instance of the function
+func (f *Function) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if f.protocol != ProtocolHTTP {
+		http.Error(w, fmt.Sprintf("function %s serves %s, not HTTP", f.fID, f.protocol), http.StatusBadRequest)
+		return
+	}
+
+	isForwarded := false
+	_, _, err := f.serve(r.Context(), func(ctx context.Context, inst *Instance) error {
+		isForwarded = true
+		return inst.proxyHTTP(w, r.WithContext(ctx))
+	})
+
+	// the proxy responds to the client itself
+	if err != nil && !isForwarded {
+		http.Error(w, err.Error(), proxy.HTTPStatusFromCode(status.Code(err)))
+	}
+}
+
+// serve Assigns the request to an instance, spinning function instances when necessary,
+// and forwards the request to the instance with fwd.
+// The client's deadline applies to forwarding if set, otherwise the function's timeout.
 //
 // Synchronization description:
-// 1. Function needs to start an instance (with a unique vmID) if there are none: goroutines are synchronized with do.Once
-// 2. Function (that is not pinned) can serve only up to servedTh requests (controlled by a WeightedSemaphore)
-//    a. The last goroutine needs to trigger the function's instance shutdown, then reset the semaphore,
-//       allowing new goroutines to serve their requests.
-//    b. The last goroutine is determined by the atomic counter: the goroutine with syncID==0 shuts down
-//       the instance.
-//    c. Instance shutdown is performed asynchronously because all instances have unique IDs.
-func (f *Function) Serve(ctx context.Context, fID, imageName, reqPayload string) (*hpb.FwdHelloResp, *metrics.Metric, error) {
+// 1. The request is assigned to the instance with the least outstanding requests (see pickInstance).
+//    If all instances are busy, the function scales out, up to maxInstances.
+// 2. An instance needs to start (with a unique vmID) if it is not running: the first request starts it,
+//    the others wait for the start unless their context is done (see Instance.ensureStarted)
+// 3. An instance of a function that is not pinned is retired when it has been idle for the keep-alive window
+//    of the function's policy (see Instance.beginRequest and Instance.endRequest):
+//    a. The last request to complete schedules the retirement, the next request to arrive cancels it.
+//    b. The retirement holds off the requests assigned to the instance until it is removed,
+//       then they start the instance again.
+func (f *Function) serve(ctx context.Context, fwd func(ctx context.Context, inst *Instance) error) (bool, *metrics.Metric, error) {
 	var (
 		serveMetric *metrics.Metric = metrics.NewMetric()
 		tStart      time.Time
-		syncID      int64 = -1 // default is no synchronization
-		isColdStart bool  = false
 	)
 
 	logger := log.WithFields(log.Fields{"fID": f.fID})
 
-	if !f.isPinnedInMem {
-		if err := f.sem.Acquire(context.Background(), 1); err != nil {
-			logger.Panic("Failed to acquire semaphore for serving")
-		}
+	f.beginRequest()
+	defer f.endRequest()
 
-		syncID = atomic.AddInt64(&f.servedSyncCounter, -1) // unique number for goroutines acquiring the semaphore
-	}
+	inst := f.pickInstance()
+	inst.beginRequest()
+	defer inst.endRequest()
+
+	logger = logger.WithFields(log.Fields{"instance": inst.id})
 
 	f.stats.IncServed(f.fID)
+	f.stats.IncInstanceServed(f.fID, inst.id)
 
-	f.OnceAddInstance.Do(
-		func() {
-			var metr *metrics.Metric
-			isColdStart = true
-			logger.Debug("Function is inactive, starting the instance...")
-			tStart = time.Now()
-			metr = f.AddInstance()
-			serveMetric.MetricMap[metrics.AddInstance] = metrics.ToUS(time.Since(tStart))
-
-			if metr != nil {
-				for k, v := range metr.MetricMap {
-					serveMetric.MetricMap[k] = v
-				}
+	tStart = time.Now()
+	metr, isColdStart, err := inst.ensureStarted(ctx)
+	if isColdStart {
+		serveMetric.MetricMap[metrics.AddInstance] = metrics.ToUS(time.Since(tStart))
+
+		if metr != nil {
+			for k, v := range metr.MetricMap {
+				serveMetric.MetricMap[k] = v
 			}
-		})
+		}
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = proxy.ContextError(ctx)
+		} else {
+			logger.WithError(err).Error("Failed to start instance")
+		}
+		return isColdStart, serveMetric, err
+	}
 
-	f.RLock()
+	inst.RLock()
 
-	// FIXME: keep a strict deadline for forwarding RPCs to a warm function
-	// Eventually, it needs to be RPC-dependent and probably client-defined
-	ctxFwd, cancel := context.WithDeadline(context.Background(), time.Now().Add(20*time.Second))
-	defer cancel()
+	ctxFwd := ctx
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctxFwd, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
 
 	tStart = time.Now()
-	resp, err := f.fwdRPC(ctxFwd, reqPayload)
+	err = fwd(ctxFwd, inst)
 	serveMetric.MetricMap[metrics.FuncInvocation] = metrics.ToUS(time.Since(tStart))
 
-	if err != nil && ctxFwd.Err() == context.Canceled {
-		// context deadline exceeded
-		f.RUnlock()
-		return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: ""}, serveMetric, err
-	} else if err != nil {
-		if e, ok := status.FromError(err); ok {
-			switch e.Code() {
-			case codes.DeadlineExceeded:
-				// deadline exceeded
-				f.RUnlock()
-				return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: ""}, serveMetric, err
-			default:
-				logger.Warn("Function returned error: ", err)
-				f.RUnlock()
-				return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: ""}, serveMetric, err
-			}
-		} else {
-			logger.Panic("Not able to parse error returned ", err)
+	if err != nil {
+		inst.RUnlock()
+		if ctxFwd.Err() == nil {
+			logger.Warn("Function returned error: ", err)
+		}
+		if proxy.IsUnreachable(err) {
+			// the function's server in the instance is unreachable, unlike if it returns Unavailable itself
+			inst.fail("forward request to", err)
 		}
+		return isColdStart, serveMetric, err
 	}
 
+	inst.RUnlock()
+
 	if orch.GetSnapshotsEnabled() {
-		f.OnceCreateSnapInstance.Do(
-			func() {
-				logger.Debug("First time offloading, need to create a snapshot first")
-				f.CreateInstanceSnapshot()
-				f.isSnapshotReady = true
-			})
+		// the response is returned anyway, the instance is recreated later if it fails
+		if isCreated, _ := inst.createSnapshot(); isCreated {
+			logger.Debug("Created the snapshot of the instance after its first request")
+		}
 	}
 
-	f.RUnlock()
-
-	if !f.isPinnedInMem && syncID == 0 {
-		logger.Debugf("Function has to shut down its instance, served %d requests", f.GetStatServed())
-		tStart = time.Now()
-		if _, err := f.RemoveInstance(false); err != nil {
-			logger.Panic("Failed to remove instance after servedTh expired", err)
-		}
-		serveMetric.MetricMap[metrics.RetireOld] = metrics.ToUS(time.Since(tStart))
-		f.ZeroServedStat()
-		f.servedSyncCounter = int64(f.servedTh) // reset counter
-		f.sem.Release(int64(f.servedTh))
+	if isColdStart {
+		f.Lock()
+		f.coldStartMetric = serveMetric
+		f.Unlock()
 	}
 
-	return &hpb.FwdHelloResp{IsColdStart: isColdStart, Payload: resp.Message}, serveMetric, err
+	return isColdStart, serveMetric, nil
 }
 
-// FwdRPC Forward the RPC to an instance, then forwards the response back.
-func (f *Function) fwdRPC(ctx context.Context, reqPayload string) (*hpb.HelloReply, error) {
-	f.RLock()
-	defer f.RUnlock()
+// pickInstance Assigns a request to the running (or starting) instance with the least outstanding
+// requests. If there is none, or all of them are busy, the request is assigned to an inactive
+// instance, which is added unless the function has maxInstances instances already.
+func (f *Function) pickInstance() *Instance {
+	f.Lock()
+	defer f.Unlock()
 
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+	var (
+		best       *Instance
+		inactive   *Instance
+		candidates int
+	)
 
-	funcClient := *f.funcClient
+	for _, inst := range f.instances {
+		if !inst.active() && inst.getOutstanding() == 0 {
+			if inactive == nil {
+				inactive = inst
+			}
+			continue
+		}
 
-	logger.Debug("FwdRPC: Forwarding RPC to function instance")
-	resp, err := funcClient.SayHello(ctx, &hpb.HelloRequest{Name: reqPayload})
-	logger.Debug("FwdRPC: Received a response from the  function instance")
+		candidates++
+		if best == nil || inst.getOutstanding() < best.getOutstanding() {
+			best = inst
+		}
+	}
 
-	return resp, err
-}
+	if best == nil || (best.getOutstanding() > 0 && candidates < f.maxInstances) {
+		if inactive == nil && len(f.instances) < f.maxInstances {
+			inactive = newInstance(f, len(f.instances))
+			f.instances = append(f.instances, inactive)
+		}
+		if inactive != nil {
+			best = inactive
+		}
+	}
 
-// AddInstance Starts a VM, waits till it is ready.
-// Note: this function is called from sync.Once construct
-func (f *Function) AddInstance() *metrics.Metric {
-	f.Lock()
-	defer f.Unlock()
+	atomic.AddInt64(&best.outstanding, 1)
 
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+	return best
+}
 
-	logger.Debug("Adding instance")
+// getInstances Returns the instances of the function
+func (f *Function) getInstances() []*Instance {
+	f.RLock()
+	defer f.RUnlock()
 
-	var metr *metrics.Metric = nil
+	return append([]*Instance(nil), f.instances...)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
-	defer cancel()
+// beginRequest Registers an arriving request, recording the idle time of the function
+func (f *Function) beginRequest() {
+	f.idleMu.Lock()
+	defer f.idleMu.Unlock()
 
-	if f.isSnapshotReady {
-		metr = f.LoadInstance()
-	} else {
-		resp, _, err := orch.StartVM(ctx, f.getVMID(), f.imageName)
-		if err != nil {
-			log.Panic(err)
-		}
-		f.guestIP = resp.GuestIP
-		f.vmID = f.getVMID()
-		f.lastInstanceID++
+	if f.inFlight == 0 && !f.idleSince.IsZero() {
+		f.keepAlive.RecordIdleTime(time.Since(f.idleSince))
 	}
 
-	tStart := time.Now()
-	funcClient, err := f.getFuncClient()
-	if metr != nil {
-		metr.MetricMap[metrics.ConnectFuncClient] = metrics.ToUS(time.Since(tStart))
-	}
-	if err != nil {
-		logger.Panic("Failed to acquire func client", err)
-	}
-	f.funcClient = &funcClient
+	f.inFlight++
+}
 
-	f.stats.IncStarted(f.fID)
+// endRequest Registers a completed request
+func (f *Function) endRequest() {
+	f.idleMu.Lock()
+	defer f.idleMu.Unlock()
 
-	return metr
+	f.inFlight--
+	if f.inFlight == 0 {
+		f.idleSince = time.Now()
+	}
 }
 
-// RemoveInstanceAsync Stops an instance (VM) of the function.
-func (f *Function) RemoveInstanceAsync() {
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+// cancelKeepAlive Stops retiring and pre-warming the instances of a function that is being removed
+func (f *Function) cancelKeepAlive() {
+	for _, inst := range f.getInstances() {
+		inst.cancelKeepAlive()
+	}
+}
 
-	logger.Debug("Removing instance (async)")
+// AddInstance Starts the first instance of the function unless it is running.
+func (f *Function) AddInstance() (*metrics.Metric, error) {
+	f.Lock()
+	if len(f.instances) == 0 {
+		f.instances = append(f.instances, newInstance(f, 0))
+	}
+	inst := f.instances[0]
+	f.Unlock()
 
-	go func() {
-		err := orch.StopSingleVM(context.Background(), f.vmID)
-		if err != nil {
-			log.Warn(err)
-		}
-	}()
+	metr, _, err := inst.ensureStarted(context.Background())
+
+	return metr, err
 }
 
-// RemoveInstance Stops an instance (VM) of the function.
-func (f *Function) RemoveInstance(isSync bool) (string, error) {
+// allocVMID Returns a unique vmID for a new instance. Skips the VM IDs that are taken
+// by the snapshots in the catalog, which may have been created before the orchestrator restarted
+func (f *Function) allocVMID() string {
 	f.Lock()
 	defer f.Unlock()
 
-	logger := log.WithFields(log.Fields{"fID": f.fID, "isSync": isSync})
+	for orch.HasCatalogSnapshot(f.getVMID()) {
+		f.lastInstanceID++
+	}
 
-	logger.Debug("Removing instance")
+	vmID := f.getVMID()
+	f.lastInstanceID++
 
-	var (
-		r   string
-		err error
-	)
+	return vmID
+}
 
-	f.OnceAddInstance = new(sync.Once)
+// RemoveInstance Removes the running instances of the function.
+func (f *Function) RemoveInstance(isSync bool) (string, error) {
+	var msgs []string
 
-	if orch.GetSnapshotsEnabled() {
-		f.OffloadInstance()
-		r = "Successfully offloaded instance " + f.vmID
-	} else {
-		if isSync {
-			err = orch.StopSingleVM(context.Background(), f.vmID)
-		} else {
-			f.RemoveInstanceAsync()
-			r = "Successfully removed (async) instance " + f.vmID
+	for _, inst := range f.getInstances() {
+		if !inst.active() {
+			continue
 		}
-	}
 
-	return r, err
-}
+		r, err := inst.Remove(isSync)
+		if err != nil {
+			return r, err
+		}
+		msgs = append(msgs, r)
+	}
 
-// DumpUPFPageStats Dumps the memory manager's stats about the number of
-// the unique pages and the number of the pages that are reused across invocations
-func (f *Function) DumpUPFPageStats(functionName, metricsOutFilePath string) error {
-	return orch.DumpUPFPageStats(f.vmID, functionName, metricsOutFilePath)
-}
+	if len(msgs) == 0 {
+		return "", errors.Wrap(ErrNoRunningInstance, f.fID)
+	}
 
-// DumpUPFLatencyStats Dumps the memory manager's latency stats
-func (f *Function) DumpUPFLatencyStats(functionName, latencyOutFilePath string) error {
-	return orch.DumpUPFLatencyStats(f.vmID, functionName, latencyOutFilePath)
+	return strings.Join(msgs, "; "), nil
 }
 
-// CreateInstanceSnapshot Creates a snapshot of the instance
-func (f *Function) CreateInstanceSnapshot() {
-	logger := log.WithFields(log.Fields{"fID": f.fID})
-
-	logger.Debug("Creating instance snapshot")
+// StopInstances Shuts down the instances (VMs) of the function for good, i.e.,
+// the instances are stopped even if they were offloaded.
+func (f *Function) StopInstances() error {
+	for _, inst := range f.getInstances() {
+		if err := inst.Stop(); err != nil {
+			return err
+		}
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
+	return nil
+}
 
-	err := orch.PauseVM(ctx, f.vmID)
-	if err != nil {
-		log.Panic(err)
+// GetInfo Returns the current state of the function
+func (f *Function) GetInfo() *FunctionInfo {
+	f.RLock()
+	info := &FunctionInfo{
+		FID:             f.fID,
+		ImageName:       f.imageName,
+		IsPinned:        f.isPinnedInMem,
+		VMSpec:          f.spec,
+		ColdStartMetric: f.coldStartMetric,
+		MaxInstances:    f.maxInstances,
+		Timeout:         f.timeout,
+		Port:            f.port,
+		Protocol:        f.protocol,
 	}
+	instances := append([]*Instance(nil), f.instances...)
+	f.RUnlock()
 
-	err = orch.CreateSnapshot(ctx, f.vmID)
-	if err != nil {
-		log.Panic(err)
-	}
+	info.State = InstanceInactive
+	for _, inst := range instances {
+		instInfo := inst.GetInfo()
+		info.Instances = append(info.Instances, instInfo)
 
-	_, err = orch.ResumeVM(ctx, f.vmID)
-	if err != nil {
-		log.Panic(err)
+		if instanceStatePriority[instInfo.State] > instanceStatePriority[info.State] {
+			info.State = instInfo.State
+		}
 	}
-}
 
-// OffloadInstance Offloads the instance
-func (f *Function) OffloadInstance() {
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+	if len(info.Instances) > 0 {
+		info.VMID = info.Instances[0].VMID
+		info.GuestIP = info.Instances[0].GuestIP
+		info.IsSnapshotReady = info.Instances[0].IsSnapshotReady
+	}
 
-	logger.Debug("Offloading instance")
+	info.Served = f.stats.GetServed(f.fID)
+	info.Started = f.stats.GetStarted(f.fID)
+	info.Failed = f.stats.GetFailed(f.fID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
-	defer cancel()
+	return info
+}
 
-	err := orch.Offload(ctx, f.vmID)
-	if err != nil {
-		log.Panic(err)
+// getFirstVMID Returns the vmID of the first instance of the function
+func (f *Function) getFirstVMID() string {
+	instances := f.getInstances()
+	if len(instances) == 0 {
+		return ""
 	}
-	f.conn.Close()
-}
 
-// LoadInstance Loads a new instance of the function from its snapshot and resumes it
-// The tap, the shim and the vmID remain the same
-func (f *Function) LoadInstance() *metrics.Metric {
-	logger := log.WithFields(log.Fields{"fID": f.fID})
+	return instances[0].GetInfo().VMID
+}
 
-	logger.Debug("Loading instance")
+// DumpUPFPageStats Dumps the memory manager's stats about the number of
+// the unique pages and the number of the pages that are reused across invocations
+func (f *Function) DumpUPFPageStats(functionName, metricsOutFilePath string) error {
+	return orch.DumpUPFPageStats(f.getFirstVMID(), functionName, metricsOutFilePath)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*60)
-	defer cancel()
+// DumpUPFLatencyStats Dumps the memory manager's latency stats
+func (f *Function) DumpUPFLatencyStats(functionName, latencyOutFilePath string) error {
+	return orch.DumpUPFLatencyStats(f.getFirstVMID(), functionName, latencyOutFilePath)
+}
 
-	loadMetr, err := orch.LoadSnapshot(ctx, f.vmID)
-	if err != nil {
-		log.Panic(err)
+// CreateSnapshot Creates a snapshot of a running instance on demand.
+// Returns the ID of the snapshotted VM.
+func (f *Function) CreateSnapshot() (string, error) {
+	if !orch.GetSnapshotsEnabled() {
+		return "", errors.New("snapshots are not enabled")
 	}
 
-	resumeMetr, err := orch.ResumeVM(ctx, f.vmID)
-	if err != nil {
-		log.Panic(err)
+	isActive := false
+	for _, inst := range f.getInstances() {
+		if !inst.active() {
+			continue
+		}
+		isActive = true
+
+		isCreated, err := inst.createSnapshot()
+		if err != nil {
+			return "", err
+		}
+		if isCreated {
+			return inst.GetInfo().VMID, nil
+		}
 	}
 
-	for k, v := range resumeMetr.MetricMap {
-		loadMetr.MetricMap[k] = v
+	if !isActive {
+		return "", errors.Wrap(ErrNoRunningInstance, f.fID)
 	}
 
-	return loadMetr
+	return "", errors.Errorf("function %s already has a snapshot", f.fID)
 }
 
 // GetStatServed Returns the served counter value
 func (f *Function) GetStatServed() uint64 {
-	return atomic.LoadUint64(&f.stats.statMap[f.fID].served)
+	return f.stats.GetServed(f.fID)
 }
 
 // ZeroServedStat Zero served counter
 func (f *Function) ZeroServedStat() {
-	atomic.StoreUint64(&f.stats.statMap[f.fID].served, 0)
+	f.stats.ZeroServed(f.fID)
 }
 
 // getVMID Creates the vmID for the function
@@ -519,32 +911,6 @@ func (f *Function) getVMID() string {
 	return fmt.Sprintf("%s-%d", f.fID, f.lastInstanceID)
 }
 
-func (f *Function) getFuncClient() (hpb.GreeterClient, error) {
-	backoffConfig := backoff.DefaultConfig
-	backoffConfig.MaxDelay = 5 * time.Second
-	connParams := grpc.ConnectParams{
-		Backoff: backoffConfig,
-	}
-
-	gopts := []grpc.DialOption{
-		grpc.WithBlock(),
-		grpc.WithInsecure(),
-		grpc.FailOnNonTempDialError(true),
-		grpc.WithConnectParams(connParams),
-		grpc.WithContextDialer(contextDialer),
-	}
-
-	//  This timeout must be large enough for all functions to start up (e.g., ML training takes few seconds)
-	ctxx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	conn, err := grpc.DialContext(ctxx, f.guestIP+":50051", gopts...)
-	f.conn = conn
-	if err != nil {
-		return nil, err
-	}
-	return hpb.NewGreeterClient(conn), nil
-}
-
 func contextDialer(ctx context.Context, address string) (net.Conn, error) {
 	if deadline, ok := ctx.Deadline(); ok {
 		return timeoutDialer(address, time.Until(deadline))
@@ -0,0 +1,820 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+
+	"github.com/vhive-serverless/vhive/ctriface"
+	hpb "github.com/vhive-serverless/vhive/examples/protobuf/helloworld"
+	"github.com/vhive-serverless/vhive/metrics"
+	"github.com/vhive-serverless/vhive/misc"
+	"github.com/vhive-serverless/vhive/proxy"
+)
+
+// maxStartAttempts Number of times a request tries to start an instance,
+// the instance is recreated after a failed attempt
+const maxStartAttempts = 2
+
+// InstanceError A failed operation on a function's instance. The instance is
+// marked unhealthy and is recreated from scratch when it starts next time.
+type InstanceError struct {
+	FID  string
+	ID   int
+	VMID string
+	Op   string
+	Err  error
+}
+
+func (e *InstanceError) Error() string {
+	return fmt.Sprintf("failed to %s instance %d (vmID %s) of function %s: %v", e.Op, e.ID, e.VMID, e.FID, e.Err)
+}
+
+// Cause Returns the underlying error, see github.com/pkg/errors
+func (e *InstanceError) Cause() error {
+	return e.Err
+}
+
+// Unwrap Returns the underlying error
+func (e *InstanceError) Unwrap() error {
+	return e.Err
+}
+
+// Instance An instance (VM) of a function. The instance keeps its vmID
+// when it is offloaded and loaded again from its snapshot.
+type Instance struct {
+	sync.RWMutex
+	f                      *Function
+	id                     int // index of the instance among the function's instances
+	vmID                   string
+	isSnapshotReady        bool // if ready, the orchestrator should load the instance rather than creating it
+	OnceCreateSnapInstance *sync.Once
+	funcClient             *hpb.GreeterClient
+	conn                   *grpc.ClientConn
+	guestIP                string
+	isActive               int32 // if 1, the instance is running, accessed atomically
+	isUnhealthy            int32 // if 1, an operation on the instance failed, accessed atomically
+	outstanding            int64 // number of requests assigned to the instance, accessed atomically
+
+	// startMu guards starting, which is closed when the ongoing start completes
+	startMu  sync.Mutex
+	starting chan struct{}
+
+	// idleMu serializes the arrival and the completion of requests with scheduling
+	// the retirement and the pre-warming of the instance, which run without it
+	idleMu         sync.Mutex
+	idleTimer      *time.Timer
+	idleGen        uint64        // incremented to cancel the pending retirement or pre-warming
+	idleStepDone   chan struct{} // closed when the ongoing retirement or pre-warming completes
+	isRetiring     bool
+	isDeregistered bool
+}
+
+// idleStep A step of the keep-alive policy, taken once the instance has been idle for the delay
+type idleStep struct {
+	delay    time.Duration
+	isRetire bool // if false, the instance is pre-warmed
+}
+
+// InstanceInfo A consistent view of the instance's state
+type InstanceInfo struct {
+	ID              int
+	State           InstanceState
+	VMID            string
+	GuestIP         string
+	IsSnapshotReady bool
+	Outstanding     int64
+	Served          uint64
+	Started         uint64
+	Failed          uint64
+}
+
+func newInstance(f *Function, id int) *Instance {
+	return &Instance{
+		f:                      f,
+		id:                     id,
+		OnceCreateSnapInstance: new(sync.Once),
+	}
+}
+
+func (i *Instance) logger() *log.Entry {
+	return log.WithFields(log.Fields{"fID": i.f.fID, "instance": i.id})
+}
+
+func (i *Instance) active() bool {
+	return atomic.LoadInt32(&i.isActive) == 1
+}
+
+func (i *Instance) setActive(isActive bool) {
+	var v int32
+	if isActive {
+		v = 1
+	}
+	atomic.StoreInt32(&i.isActive, v)
+}
+
+func (i *Instance) healthy() bool {
+	return atomic.LoadInt32(&i.isUnhealthy) == 0
+}
+
+func (i *Instance) setHealthy(isHealthy bool) {
+	var v int32
+	if !isHealthy {
+		v = 1
+	}
+	atomic.StoreInt32(&i.isUnhealthy, v)
+}
+
+// fail Marks the instance unhealthy after the operation failed, and counts the failure
+func (i *Instance) fail(op string, err error) error {
+	i.setHealthy(false)
+
+	i.f.stats.IncFailed(i.f.fID)
+	i.f.stats.IncInstanceFailed(i.f.fID, i.id)
+
+	i.logger().WithError(err).Errorf("Failed to %s instance", op)
+
+	return &InstanceError{FID: i.f.fID, ID: i.id, VMID: i.vmID, Op: op, Err: err}
+}
+
+// getOutstanding Returns the number of requests assigned to the instance
+func (i *Instance) getOutstanding() int64 {
+	return atomic.LoadInt64(&i.outstanding)
+}
+
+// beginRequest Registers a request assigned to the instance, cancelling the retirement of the instance.
+// If the instance is being retired, waits till it is removed, so that the request starts it again.
+func (i *Instance) beginRequest() {
+	i.idleMu.Lock()
+	i.stopIdleTimer()
+	var retired chan struct{}
+	if i.isRetiring {
+		retired = i.idleStepDone
+	}
+	i.idleMu.Unlock()
+
+	if retired != nil {
+		<-retired
+	}
+}
+
+// endRequest Registers a completed request. The last request to complete schedules
+// the retirement of the instance, unless the function is pinned. Only the first
+// instance of a function is pre-warmed, the other instances are scaled in.
+// An unhealthy instance is retired right away, even if the function is pinned.
+func (i *Instance) endRequest() {
+	i.idleMu.Lock()
+	defer i.idleMu.Unlock()
+
+	if atomic.AddInt64(&i.outstanding, -1) > 0 {
+		return
+	}
+
+	if i.isDeregistered {
+		return
+	}
+
+	if !i.healthy() {
+		i.scheduleIdle(idleStep{isRetire: true})
+		return
+	}
+
+	if i.f.isPinnedInMem {
+		return
+	}
+
+	preWarm, keepAlive := i.f.keepAlive.Windows()
+	if preWarm == 0 || i.id != 0 {
+		i.scheduleIdle(idleStep{delay: keepAlive, isRetire: true})
+		return
+	}
+
+	// remove the instance right away and bring it back shortly before the next request is expected
+	i.scheduleIdle(
+		idleStep{isRetire: true},
+		idleStep{delay: preWarm},
+		idleStep{delay: keepAlive, isRetire: true},
+	)
+}
+
+// scheduleIdle Takes the steps one after another unless a request arrives in between.
+// Must be called with idleMu held. The steps are taken without idleMu, since starting
+// or removing the instance takes long, and the retiring flag holds off the requests
+// that arrive during the retirement instead, see beginRequest.
+func (i *Instance) scheduleIdle(steps ...idleStep) {
+	gen := i.idleGen
+	step := steps[0]
+
+	i.idleTimer = time.AfterFunc(step.delay, func() {
+		i.idleMu.Lock()
+		for i.idleStepDone != nil {
+			// the step scheduled before the last request is still ongoing
+			done := i.idleStepDone
+			i.idleMu.Unlock()
+			<-done
+			i.idleMu.Lock()
+		}
+		if !i.isIdle(gen) {
+			i.idleMu.Unlock()
+			return
+		}
+		i.idleStepDone = make(chan struct{})
+		i.isRetiring = step.isRetire
+		i.idleMu.Unlock()
+
+		if step.isRetire {
+			i.retire()
+		} else {
+			i.preWarm()
+		}
+
+		i.idleMu.Lock()
+		defer i.idleMu.Unlock()
+
+		close(i.idleStepDone)
+		i.idleStepDone = nil
+		i.isRetiring = false
+
+		if len(steps) > 1 && i.isIdle(gen) {
+			i.scheduleIdle(steps[1:]...)
+		}
+	})
+}
+
+// isIdle Returns true if no request has arrived since the idle step was scheduled
+// at the generation. Must be called with idleMu held.
+func (i *Instance) isIdle(gen uint64) bool {
+	return gen == i.idleGen && i.getOutstanding() == 0 && !i.isDeregistered
+}
+
+// stopIdleTimer Cancels the pending retirement or pre-warming. Must be called with idleMu held.
+func (i *Instance) stopIdleTimer() {
+	i.idleGen++
+	if i.idleTimer != nil {
+		i.idleTimer.Stop()
+		i.idleTimer = nil
+	}
+}
+
+// cancelKeepAlive Stops retiring and pre-warming the instance of a function that is being removed,
+// and waits for the ongoing retirement or pre-warming, if any
+func (i *Instance) cancelKeepAlive() {
+	i.idleMu.Lock()
+	i.isDeregistered = true
+	i.stopIdleTimer()
+	done := i.idleStepDone
+	i.idleMu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// retire Removes the idle instance, if it is running
+func (i *Instance) retire() {
+	if !i.active() {
+		return
+	}
+
+	logger := i.logger()
+
+	logger.Debugf("Instance has to shut down, served %d requests", i.f.stats.GetInstanceServed(i.f.fID, i.id))
+	if _, err := i.Remove(false); err != nil {
+		logger.WithError(err).Error("Failed to remove idle instance")
+	}
+}
+
+// preWarm Starts the instance ahead of the expected request. The requests that arrive
+// in the meantime wait for the start, see ensureStarted.
+func (i *Instance) preWarm() {
+	logger := i.logger()
+
+	logger.Debug("Pre-warming the instance")
+
+	if _, _, err := i.ensureStarted(context.Background()); err != nil {
+		logger.WithError(err).Error("Failed to pre-warm instance")
+	}
+}
+
+// ensureStarted Starts the instance unless it is running, or waits for the ongoing start.
+// Waiting stops when the context is done, while the start continues for the other requests.
+// Returns the metric of the start and true if this call started the instance.
+func (i *Instance) ensureStarted(ctx context.Context) (*metrics.Metric, bool, error) {
+	for {
+		i.startMu.Lock()
+		if i.active() {
+			i.startMu.Unlock()
+			return nil, false, nil
+		}
+
+		starting := i.starting
+		if starting == nil {
+			i.starting = make(chan struct{})
+			i.startMu.Unlock()
+
+			i.logger().Debug("Instance is inactive, starting the instance...")
+			metr, err := i.Start(ctx)
+			for attempt := 1; err != nil && ctx.Err() == nil && attempt < maxStartAttempts; attempt++ {
+				i.logger().WithError(err).Warn("Retrying to start the instance")
+				metr, err = i.Start(ctx)
+			}
+
+			i.startMu.Lock()
+			close(i.starting)
+			i.starting = nil
+			i.startMu.Unlock()
+
+			return metr, true, err
+		}
+		i.startMu.Unlock()
+
+		// the start may fail, e.g., if the context of the starting request is done, then retry
+		select {
+		case <-starting:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// fwdRPC Forward the RPC to the instance, then forwards the response back.
+// Must be called with the instance's read lock held.
+func (i *Instance) fwdRPC(ctx context.Context, reqPayload string) (*hpb.HelloReply, error) {
+	logger := i.logger()
+
+	funcClient := *i.funcClient
+
+	logger.Debug("FwdRPC: Forwarding RPC to function instance")
+	resp, err := funcClient.SayHello(ctx, &hpb.HelloRequest{Name: reqPayload})
+	logger.Debug("FwdRPC: Received a response from the  function instance")
+
+	return resp, err
+}
+
+// Start Starts the VM of the instance, or loads it from a snapshot, and waits till it is ready.
+// If the context is done before the instance is ready, the VM is stopped or offloaded again.
+// An unhealthy instance is recreated, i.e., its VM is stopped and a new VM is started.
+// Note: use ensureStarted to start the instance only once
+func (i *Instance) Start(ctx context.Context) (*metrics.Metric, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	logger := i.logger()
+
+	logger.Debug("Adding instance")
+
+	if !i.healthy() {
+		i.discard()
+	}
+
+	var metr *metrics.Metric = nil
+
+	startCtx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+
+	if i.isSnapshotReady {
+		loadMetr, err := i.load(startCtx)
+		if err != nil {
+			i.abortStart()
+			return nil, i.startFailed(ctx, "load", err)
+		}
+		metr = loadMetr
+	} else if restoreMetr, ok := i.restore(startCtx); ok {
+		metr = restoreMetr
+	} else {
+		vmID := i.f.allocVMID()
+		resp, _, err := orch.StartVM(startCtx, vmID, i.f.imageName, i.f.spec)
+		if err != nil {
+			return nil, i.startFailed(ctx, "start", err)
+		}
+		i.guestIP = resp.GuestIP
+		i.vmID = vmID
+	}
+
+	tStart := time.Now()
+	err := i.connect(startCtx)
+	if metr != nil {
+		metr.MetricMap[metrics.ConnectFuncClient] = metrics.ToUS(time.Since(tStart))
+	}
+	if err != nil {
+		i.abortStart()
+		return nil, i.startFailed(ctx, "connect to", err)
+	}
+	i.setActive(true)
+
+	i.f.stats.IncStarted(i.f.fID)
+	i.f.stats.IncInstanceStarted(i.f.fID, i.id)
+
+	return metr, nil
+}
+
+// startFailed Returns the error of the failed start. The instance becomes unhealthy
+// unless the start failed because the context of the request is done.
+func (i *Instance) startFailed(ctx context.Context, op string, err error) error {
+	if ctx.Err() != nil {
+		return errors.Wrapf(err, "failed to %s instance", op)
+	}
+
+	return i.fail(op, err)
+}
+
+// abortStart Stops the VM of the instance that failed to start,
+// or offloads it if it has a snapshot to be loaded from next time.
+// If neither succeeds, the instance becomes unhealthy.
+// Must be called with the instance's lock held.
+func (i *Instance) abortStart() {
+	logger := i.logger()
+
+	logger.Debug("Aborting instance start")
+
+	// the context of the start may be done already
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if i.conn != nil {
+		i.conn.Close()
+		i.conn = nil
+	}
+
+	if i.isSnapshotReady {
+		if err := orch.Offload(ctx, i.vmID); err != nil {
+			logger.WithError(err).Warn("Failed to offload instance that failed to start")
+			i.setHealthy(false)
+		}
+		return
+	}
+
+	if err := orch.StopSingleVM(ctx, i.vmID); err != nil {
+		logger.WithError(err).Warn("Failed to stop instance that failed to start")
+		i.setHealthy(false)
+		return
+	}
+	i.vmID = ""
+}
+
+// discard Stops the VM of the unhealthy instance, if it is still there, and drops
+// the snapshot of the instance, so that the instance starts from scratch next time.
+// Must be called with the instance's lock held.
+func (i *Instance) discard() {
+	logger := i.logger()
+
+	logger.Info("Discarding unhealthy instance")
+
+	if i.vmID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+		defer cancel()
+
+		// the VM may be gone already
+		if err := orch.StopSingleVM(ctx, i.vmID); err != nil {
+			if _, ok := errors.Cause(err).(misc.NonExistErr); !ok {
+				logger.WithError(err).Warn("Failed to stop the VM of unhealthy instance")
+			}
+		}
+	}
+
+	if i.conn != nil {
+		i.conn.Close()
+		i.conn = nil
+	}
+
+	i.vmID = ""
+	i.guestIP = ""
+	i.isSnapshotReady = false
+	i.OnceCreateSnapInstance = new(sync.Once)
+	i.setHealthy(true)
+}
+
+// restore Starts the instance from the golden snapshot of the function's image,
+// if snapshots are enabled and the image has one.
+// Must be called with the instance's lock held.
+func (i *Instance) restore(ctx context.Context) (*metrics.Metric, bool) {
+	if !orch.GetSnapshotsEnabled() {
+		return nil, false
+	}
+
+	logger := i.logger()
+
+	vmID := i.f.allocVMID()
+	resp, restoreMetr, err := orch.StartVMFromSnapshot(ctx, vmID, i.f.imageName, i.f.spec)
+	if err != nil {
+		if errors.Cause(err) != ctriface.ErrNoSnapshot {
+			logger.WithError(err).Warn("Failed to start instance from the golden snapshot")
+		}
+		return nil, false
+	}
+
+	logger.Debug("Started instance from the golden snapshot")
+
+	i.guestIP = resp.GuestIP
+	i.vmID = vmID
+
+	// the instance is offloaded and loaded using the golden snapshot
+	i.OnceCreateSnapInstance.Do(func() {})
+	i.isSnapshotReady = true
+
+	return restoreMetr, true
+}
+
+// removeAsync Stops the VM of the instance asynchronously.
+func (i *Instance) removeAsync() {
+	i.logger().Debug("Removing instance (async)")
+
+	vmID := i.vmID
+	go func() {
+		err := orch.StopSingleVM(context.Background(), vmID)
+		if err != nil {
+			i.fail("stop", err)
+		}
+	}()
+}
+
+// Remove Offloads the instance if snapshots are enabled, otherwise stops its VM.
+func (i *Instance) Remove(isSync bool) (string, error) {
+	i.Lock()
+	defer i.Unlock()
+
+	logger := i.logger().WithFields(log.Fields{"isSync": isSync})
+
+	logger.Debug("Removing instance")
+
+	var (
+		r   string
+		err error
+	)
+
+	i.setActive(false)
+
+	if orch.GetSnapshotsEnabled() {
+		if err = i.offload(); err != nil {
+			return "", i.fail("offload", err)
+		}
+		r = "Successfully offloaded instance " + i.vmID
+	} else {
+		if isSync {
+			if err = orch.StopSingleVM(context.Background(), i.vmID); err != nil {
+				err = i.fail("stop", err)
+			}
+		} else {
+			i.removeAsync()
+			r = "Successfully removed (async) instance " + i.vmID
+		}
+	}
+
+	return r, err
+}
+
+// Stop Shuts down the instance (VM) for good, i.e.,
+// the instance is stopped even if it was offloaded.
+func (i *Instance) Stop() error {
+	i.Lock()
+	defer i.Unlock()
+
+	logger := i.logger()
+
+	if !i.healthy() {
+		i.setActive(false)
+		i.discard()
+		return nil
+	}
+
+	if !i.active() && !i.isSnapshotReady {
+		return nil
+	}
+
+	logger.Debug("Stopping instance")
+
+	if err := orch.StopSingleVM(context.Background(), i.vmID); err != nil {
+		return i.fail("stop", err)
+	}
+
+	if i.conn != nil {
+		i.conn.Close()
+	}
+
+	i.OnceCreateSnapInstance = new(sync.Once)
+	i.setActive(false)
+	i.isSnapshotReady = false
+
+	return nil
+}
+
+// GetInfo Returns the current state of the instance
+func (i *Instance) GetInfo() *InstanceInfo {
+	i.RLock()
+	defer i.RUnlock()
+
+	info := &InstanceInfo{
+		ID:              i.id,
+		VMID:            i.vmID,
+		GuestIP:         i.guestIP,
+		IsSnapshotReady: i.isSnapshotReady,
+		Outstanding:     i.getOutstanding(),
+		Served:          i.f.stats.GetInstanceServed(i.f.fID, i.id),
+		Started:         i.f.stats.GetInstanceStarted(i.f.fID, i.id),
+		Failed:          i.f.stats.GetInstanceFailed(i.f.fID, i.id),
+	}
+
+	switch {
+	case !i.healthy():
+		info.State = InstanceUnhealthy
+	case i.active():
+		info.State = InstanceRunning
+	case i.isSnapshotReady:
+		info.State = InstanceOffloaded
+	default:
+		info.State = InstanceInactive
+	}
+
+	return info
+}
+
+// createInstanceSnapshot Creates a snapshot of the instance. If it fails,
+// the instance becomes unhealthy and is recreated when it is idle.
+// Must be called with the instance's lock held, as the VM is paused.
+func (i *Instance) createInstanceSnapshot() error {
+	i.logger().Debug("Creating instance snapshot")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if err := orch.SnapshotVM(ctx, i.vmID); err != nil {
+		return i.fail("snapshot", err)
+	}
+
+	i.isSnapshotReady = true
+
+	return nil
+}
+
+// createSnapshot Creates a snapshot of the running instance unless it has one.
+// Taking the lock waits for the requests that are being forwarded to the instance
+// and holds off the new ones while the VM is paused.
+// Returns true if the snapshot was created.
+func (i *Instance) createSnapshot() (bool, error) {
+	i.RLock()
+	isDone := i.isSnapshotReady || !i.healthy()
+	i.RUnlock()
+
+	// the snapshot has been created, or it has failed and the instance is to be recreated
+	if isDone {
+		return false, nil
+	}
+
+	i.Lock()
+	defer i.Unlock()
+
+	if !i.active() {
+		return false, nil
+	}
+
+	var (
+		isCreated bool
+		err       error
+	)
+	i.OnceCreateSnapInstance.Do(
+		func() {
+			err = i.createInstanceSnapshot()
+			isCreated = err == nil
+		})
+
+	return isCreated, err
+}
+
+// offload Offloads the instance
+func (i *Instance) offload() error {
+	i.logger().Debug("Offloading instance")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*15)
+	defer cancel()
+
+	if err := orch.Offload(ctx, i.vmID); err != nil {
+		return err
+	}
+
+	if i.conn != nil {
+		i.conn.Close()
+	}
+
+	return nil
+}
+
+// load Loads the instance from its snapshot and resumes it
+// The tap, the shim and the vmID remain the same
+func (i *Instance) load(ctx context.Context) (*metrics.Metric, error) {
+	i.logger().Debug("Loading instance")
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*60)
+	defer cancel()
+
+	loadMetr, err := orch.LoadSnapshot(ctx, i.vmID)
+	if err != nil {
+		return nil, err
+	}
+
+	resumeMetr, err := orch.ResumeVM(ctx, i.vmID)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range resumeMetr.MetricMap {
+		loadMetr.MetricMap[k] = v
+	}
+
+	return loadMetr, nil
+}
+
+// connect Waits till the function's server in the instance accepts connections,
+// and connects to it if it speaks gRPC.
+// Must be called with the instance's lock held.
+func (i *Instance) connect(ctx context.Context) error {
+	if i.f.protocol == ProtocolHTTP {
+		return i.waitForServer(ctx)
+	}
+
+	funcClient, err := i.getFuncClient(ctx)
+	if err != nil {
+		return err
+	}
+	i.funcClient = &funcClient
+
+	return nil
+}
+
+// waitForServer Waits till the function's server in the instance accepts connections.
+// The HTTP reverse proxy connects to the server on its own.
+func (i *Instance) waitForServer(ctx context.Context) error {
+	//  This timeout must be large enough for all functions to start up (e.g., ML training takes few seconds)
+	ctxx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+
+	conn, err := contextDialer(ctxx, i.address())
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
+}
+
+// address Returns the address of the function's server in the instance
+func (i *Instance) address() string {
+	return net.JoinHostPort(i.guestIP, strconv.Itoa(i.f.port))
+}
+
+func (i *Instance) getFuncClient(ctx context.Context) (hpb.GreeterClient, error) {
+	backoffConfig := backoff.DefaultConfig
+	backoffConfig.MaxDelay = 5 * time.Second
+	connParams := grpc.ConnectParams{
+		Backoff: backoffConfig,
+	}
+
+	gopts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithInsecure(),
+		grpc.FailOnNonTempDialError(true),
+		grpc.WithConnectParams(connParams),
+		grpc.WithContextDialer(contextDialer),
+	}
+	// tells the unreachable instance from the function returning an error
+	gopts = append(gopts, proxy.DialOptions()...)
+
+	//  This timeout must be large enough for all functions to start up (e.g., ML training takes few seconds)
+	ctxx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctxx, i.address(), gopts...)
+	i.conn = conn
+	if err != nil {
+		return nil, err
+	}
+	return hpb.NewGreeterClient(conn), nil
+}
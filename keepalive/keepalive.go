@@ -0,0 +1,198 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package keepalive
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Fixed Keep an idle instance for a fixed time
+	Fixed = "fixed"
+	// Hybrid Azure-style hybrid histogram policy, see
+	// "Serverless in the Wild", Shahrad et al., USENIX ATC'20
+	Hybrid = "hybrid"
+)
+
+// DefaultWindow The window of the fixed policy, e.g., as in OpenWhisk
+const DefaultWindow = 10 * time.Minute
+
+// Parameters of the hybrid histogram policy, as in the paper
+const (
+	hybridHistogramRange = 4 * time.Hour
+	hybridBinWidth       = time.Minute
+	hybridHeadPercentile = 5
+	hybridTailPercentile = 99
+	hybridMargin         = 0.1
+	hybridCVThreshold    = 2
+	// the fraction of the idle times beyond the histogram range, above which
+	// the histogram cannot predict the next invocation
+	hybridOutOfBoundsThreshold = 0.5
+)
+
+// Policy Decides when the idle instance of a function is removed.
+// Each function has its own policy object.
+type Policy interface {
+	// RecordIdleTime Records for how long the instance was idle before a request arrived
+	RecordIdleTime(idle time.Duration)
+	// Windows Returns the pre-warm window, i.e., for how long the instance is removed
+	// after it becomes idle, and the keep-alive window, i.e., for how long the instance
+	// is kept after the pre-warm window. With no pre-warm window, the instance is
+	// kept for the keep-alive window right after it becomes idle.
+	Windows() (preWarm, keepAlive time.Duration)
+}
+
+// PolicyFactory Creates the policy object of a function
+type PolicyFactory func() Policy
+
+// NewPolicyFactory Returns the factory of the policy with the given name.
+// keepAlive is the window of the fixed policy, which the hybrid policy falls back to.
+func NewPolicyFactory(name string, keepAlive time.Duration) (PolicyFactory, error) {
+	if keepAlive < 0 {
+		return nil, errors.Errorf("invalid keep-alive window %s", keepAlive)
+	}
+
+	switch name {
+	case Fixed:
+		return NewFixedPolicy(keepAlive), nil
+	case Hybrid:
+		return NewHybridPolicy(keepAlive), nil
+	default:
+		return nil, errors.Errorf("unknown keep-alive policy %s", name)
+	}
+}
+
+//////////////////////////////// Fixed policy //////////////////////////////////////////
+
+type fixedPolicy struct {
+	keepAlive time.Duration
+}
+
+// NewFixedPolicy Returns the factory of the policy that keeps
+// an idle instance for the given time
+func NewFixedPolicy(keepAlive time.Duration) PolicyFactory {
+	return func() Policy {
+		return &fixedPolicy{keepAlive: keepAlive}
+	}
+}
+
+func (p *fixedPolicy) RecordIdleTime(idle time.Duration) {}
+
+func (p *fixedPolicy) Windows() (time.Duration, time.Duration) {
+	return 0, p.keepAlive
+}
+
+//////////////////////////////// Hybrid histogram policy //////////////////////////////////////////
+
+// hybridPolicy Tracks the distribution of the function's idle times in a histogram.
+// If the histogram is representative, the instance is removed until shortly before
+// the next invocation is likely (the head of the distribution) and kept until
+// the next invocation is unlikely (the tail). Otherwise, the fixed window is used.
+type hybridPolicy struct {
+	sync.Mutex
+	bins        []uint64
+	outOfBounds uint64
+	total       uint64
+	fallback    time.Duration
+}
+
+// NewHybridPolicy Returns the factory of the hybrid histogram policy,
+// which falls back to the given keep-alive window
+func NewHybridPolicy(fallback time.Duration) PolicyFactory {
+	return func() Policy {
+		return &hybridPolicy{
+			bins:     make([]uint64, hybridHistogramRange/hybridBinWidth),
+			fallback: fallback,
+		}
+	}
+}
+
+func (p *hybridPolicy) RecordIdleTime(idle time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.total++
+
+	bin := int(idle / hybridBinWidth)
+	if bin >= len(p.bins) {
+		p.outOfBounds++
+		return
+	}
+
+	p.bins[bin]++
+}
+
+func (p *hybridPolicy) Windows() (time.Duration, time.Duration) {
+	p.Lock()
+	defer p.Unlock()
+
+	inBounds := p.total - p.outOfBounds
+	if inBounds == 0 || float64(p.outOfBounds) > hybridOutOfBoundsThreshold*float64(p.total) {
+		return 0, p.fallback
+	}
+
+	if p.binsCV() < hybridCVThreshold {
+		return 0, p.fallback
+	}
+
+	head := time.Duration(p.percentileBin(hybridHeadPercentile, inBounds)) * hybridBinWidth
+	tail := time.Duration(p.percentileBin(hybridTailPercentile, inBounds)+1) * hybridBinWidth
+
+	preWarm := time.Duration(float64(head) * (1 - hybridMargin))
+	keepAlive := time.Duration(float64(tail)*(1+hybridMargin)) - preWarm
+
+	return preWarm, keepAlive
+}
+
+// binsCV Returns the coefficient of variation of the bin counts,
+// a flat histogram does not tell much about the next invocation
+func (p *hybridPolicy) binsCV() float64 {
+	mean := float64(p.total-p.outOfBounds) / float64(len(p.bins))
+
+	var variance float64
+	for _, cnt := range p.bins {
+		variance += (float64(cnt) - mean) * (float64(cnt) - mean)
+	}
+	variance /= float64(len(p.bins))
+
+	return math.Sqrt(variance) / mean
+}
+
+// percentileBin Returns the index of the bin the percentile of the idle times falls into
+func (p *hybridPolicy) percentileBin(percentile float64, inBounds uint64) int {
+	target := uint64(math.Ceil(percentile / 100 * float64(inBounds)))
+
+	var cum uint64
+	for i, cnt := range p.bins {
+		cum += cnt
+		if cum >= target && cum > 0 {
+			return i
+		}
+	}
+
+	return len(p.bins) - 1
+}
@@ -0,0 +1,72 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package keepalive
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixedPolicy(t *testing.T) {
+	factory, err := NewPolicyFactory(Fixed, time.Minute)
+	require.NoError(t, err, "Failed to create policy")
+
+	p := factory()
+	p.RecordIdleTime(time.Hour)
+
+	preWarm, keepAlive := p.Windows()
+	require.Zero(t, preWarm, "Fixed policy must not pre-warm")
+	require.Equal(t, time.Minute, keepAlive, "Wrong keep-alive window")
+
+	_, err = NewPolicyFactory("bogus", time.Minute)
+	require.Error(t, err, "Unknown policy must be rejected")
+}
+
+func TestHybridPolicy(t *testing.T) {
+	p := NewHybridPolicy(time.Minute)()
+
+	preWarm, keepAlive := p.Windows()
+	require.Zero(t, preWarm, "Policy without history must not pre-warm")
+	require.Equal(t, time.Minute, keepAlive, "Policy without history must fall back")
+
+	// a function invoked every ~30 minutes
+	for i := 0; i < 100; i++ {
+		p.RecordIdleTime(30*time.Minute + time.Duration(i%3)*time.Minute)
+	}
+
+	preWarm, keepAlive = p.Windows()
+	// the head of 30 minutes and the tail of 33 minutes with the 10% margin
+	require.Equal(t, 27*time.Minute, preWarm, "Wrong pre-warm window")
+	require.InDelta(t, float64(9*time.Minute+18*time.Second), float64(keepAlive), float64(time.Millisecond), "Wrong keep-alive window")
+
+	// mostly out-of-bounds idle times make the histogram useless
+	for i := 0; i < 200; i++ {
+		p.RecordIdleTime(10 * time.Hour)
+	}
+
+	preWarm, keepAlive = p.Windows()
+	require.Zero(t, preWarm, "Policy must fall back for out-of-bounds idle times")
+	require.Equal(t, time.Minute, keepAlive, "Policy must fall back for out-of-bounds idle times")
+}
@@ -30,14 +30,16 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/vhive-serverless/vhive/keepalive"
 )
 
 func TestParallelServe(t *testing.T) {
 	var (
-		servedTh      uint64 = 1
+		keepAlive     keepalive.PolicyFactory = keepalive.NewFixedPolicy(0)
 		pinnedFuncNum int
 	)
-	funcPool = NewFuncPool(isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	// Pull image to work around parallel pulling limitation
 	resp, _, err := funcPool.Serve(context.Background(), "plr-fnc", testImageName, "world")
@@ -69,10 +71,10 @@ func TestParallelServe(t *testing.T) {
 func TestServeThree(t *testing.T) {
 	fID := "200"
 	var (
-		servedTh      uint64 = 1
+		keepAlive     keepalive.PolicyFactory = keepalive.NewFixedPolicy(0)
 		pinnedFuncNum int
 	)
-	funcPool = NewFuncPool(isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
 	require.NoError(t, err, "Function returned error on 1st run")
@@ -0,0 +1,135 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// startDirtyTracking Registers the guest memory for the write-protect faults, so that
+// the pages are installed write-protected and the first write to a page is reported.
+// The VM runs without the tracking if the kernel or the guest memory does not support it.
+func (s *SnapshotState) startDirtyTracking() {
+	s.guestMem.RLock()
+	defer s.guestMem.RUnlock()
+
+	for _, r := range s.guestMem.regions {
+		if err := s.userFaultFD.registerWriteProtect(r.BaseHostVirtAddr, r.Size); err != nil {
+			log.WithFields(log.Fields{"vmID": s.VMID}).WithError(err).Warn("Failed to register for the write-protect faults, dirty pages are not tracked")
+			return
+		}
+	}
+
+	s.isTrackingDirty = true
+}
+
+// serveWriteProtectFault Records that the page is dirty and removes its write protection,
+// which wakes up the faulting thread. The page is not reported again in the activation.
+func (s *SnapshotState) serveWriteProtectFault(address uint64) error {
+	pageSize := uint64(os.Getpagesize())
+	dst := address &^ (pageSize - 1)
+
+	offset, ok := s.guestMem.fileOffset(dst)
+	if !ok {
+		return fmt.Errorf("write-protect fault at %#x is out of the guest memory", address)
+	}
+
+	s.markDirty(offset)
+
+	err := s.userFaultFD.writeProtect(dst, pageSize, false)
+	if errors.Is(err, unix.EAGAIN) {
+		// the layout of the guest memory is changing, the thread faults again if needed
+		return s.userFaultFD.wake(dst, int(pageSize))
+	}
+
+	return err
+}
+
+// markDirty Adds the page to the dirty pages of the activation
+func (s *SnapshotState) markDirty(offset uint64) {
+	if _, ok := s.dirty[offset]; ok {
+		return
+	}
+
+	s.dirty[offset] = struct{}{}
+	atomic.AddInt64(&s.dirtyNum, 1)
+}
+
+// collectDirtyPages Saves the dirty pages of the activation, once the VM is stopped
+func (s *SnapshotState) collectDirtyPages() {
+	s.dirtyPages = nil
+	if !s.isTrackingDirty {
+		return
+	}
+
+	s.dirtyPages = make([]uint64, 0, len(s.dirty))
+	for offset := range s.dirty {
+		s.dirtyPages = append(s.dirtyPages, offset)
+	}
+	sort.Slice(s.dirtyPages, func(i, j int) bool { return s.dirtyPages[i] < s.dirtyPages[j] })
+
+	s.dirty = nil
+}
+
+// GetDirtyPages Returns the offsets in the guest memory file of the pages that the VM wrote
+// during its last activation, sorted. Only these pages differ from the snapshot, e.g.,
+// an incremental snapshot stores only them, and copying only them from the guest memory file
+// resets the VM to the state of the snapshot. Requires the dirty page tracking.
+func (m *MemoryManager) GetDirtyPages(vmID string) ([]uint64, error) {
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+
+	logger.Debug("Returning the dirty pages")
+
+	m.Lock()
+
+	state, ok := m.instances[vmID]
+	if !ok {
+		m.Unlock()
+		logger.Error("VM not registered with the memory manager")
+		return nil, errors.New("VM not registered with the memory manager")
+	}
+
+	m.Unlock()
+
+	state.statusMu.Lock()
+	defer state.statusMu.Unlock()
+
+	if state.isActive {
+		logger.Error("Cannot get dirty pages while VM is active")
+		return nil, errors.New("Cannot get dirty pages while VM is active")
+	}
+
+	if state.dirtyPages == nil {
+		logger.Error("Dirty pages were not tracked in the last activation")
+		return nil, errors.New("Dirty pages were not tracked in the last activation")
+	}
+
+	return state.dirtyPages, nil
+}
@@ -0,0 +1,85 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirtyPages(t *testing.T) {
+	pageSize := uint64(os.Getpagesize())
+
+	m := NewMemoryManager(MemoryManagerCfg{TrackDirtyPages: true})
+	require.NoError(t, m.RegisterVM(SnapshotStateCfg{VMID: "1", GuestMemSize: 16 * int(pageSize)}))
+
+	_, err := m.GetDirtyPages("2")
+	require.Error(t, err, "VM is not registered")
+
+	_, err = m.GetDirtyPages("1")
+	require.Error(t, err, "VM has not been activated")
+
+	state := m.instances["1"]
+	state.setupStateOnActivate()
+	// as if the guest memory were registered for the write-protect faults
+	state.isTrackingDirty = true
+
+	for _, page := range []uint64{7, 2, 7, 3} {
+		state.markDirty(page * pageSize)
+	}
+
+	_, err = m.GetDirtyPages("1")
+	require.Error(t, err, "Cannot get dirty pages while VM is active")
+
+	info, err := m.GetVMInfo("1")
+	require.NoError(t, err)
+	require.True(t, info.IsTrackingDirty)
+	require.Equal(t, int64(3), info.Faults.Dirtied, "Each page must be counted once")
+
+	state.isActive = false
+	state.collectDirtyPages()
+
+	dirty, err := m.GetDirtyPages("1")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2 * pageSize, 3 * pageSize, 7 * pageSize}, dirty)
+
+	// the next activation writes no pages
+	state.setupStateOnActivate()
+	state.isTrackingDirty = true
+	state.isActive = false
+	state.collectDirtyPages()
+
+	dirty, err = m.GetDirtyPages("1")
+	require.NoError(t, err)
+	require.Empty(t, dirty)
+
+	// the kernel does not support the write-protect faults
+	state.setupStateOnActivate()
+	state.isActive = false
+	state.collectDirtyPages()
+
+	_, err = m.GetDirtyPages("1")
+	require.Error(t, err, "Dirty pages were not tracked")
+}
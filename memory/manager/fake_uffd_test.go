@@ -0,0 +1,355 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// the operations of the fake uffd, to inject the errors into
+const (
+	opCopy         = "copy"
+	opZeroPage     = "zeroPage"
+	opWake         = "wake"
+	opRegisterWP   = "registerWriteProtect"
+	opWriteProtect = "writeProtect"
+)
+
+// fakeUFFD An in-process uffd over a fake guest memory at base, as a VMM would register it.
+// It installs the pages like the kernel, except that it installs nothing if any page
+// of the range is present. The events are passed through a pipe, which stands for the uffd.
+type fakeUFFD struct {
+	sync.Mutex
+
+	base    uint64
+	mem     []byte
+	present []bool
+	wp      []bool
+	// the faulting thread has been woken up since the page fault was sent
+	woken []bool
+
+	isWPRegistered bool
+	noZeroPage     bool // UFFDIO_ZEROPAGE is not supported, e.g., for shared memory
+	noWriteProtect bool // the kernel does not support the write-protect faults
+
+	failures map[string][]error // returned by the next calls of the operation
+	calls    map[string]int
+
+	r, w     int
+	isClosed bool
+}
+
+func newFakeUFFD(t *testing.T, base uint64, numPages int) *fakeUFFD {
+	var fds [2]int
+	require.NoError(t, unix.Pipe2(fds[:], unix.O_NONBLOCK|unix.O_CLOEXEC))
+
+	f := &fakeUFFD{
+		base:     base,
+		mem:      make([]byte, numPages*os.Getpagesize()),
+		present:  make([]bool, numPages),
+		wp:       make([]bool, numPages),
+		woken:    make([]bool, numPages),
+		failures: make(map[string][]error),
+		calls:    make(map[string]int),
+		r:        fds[0],
+		w:        fds[1],
+	}
+	t.Cleanup(func() { f.Close() })
+
+	return f
+}
+
+// layout Returns the guest memory layout that the VMM sends with the uffd
+func (f *fakeUFFD) layout() []byte {
+	return []byte(fmt.Sprintf(`[{"base_host_virt_addr": %d, "size": %d, "offset": 0}]`, f.base, len(f.mem)))
+}
+
+// inject Makes the next calls of the operation fail with the errors, in order
+func (f *fakeUFFD) inject(op string, errs ...unix.Errno) {
+	f.Lock()
+	defer f.Unlock()
+
+	for _, errno := range errs {
+		f.failures[op] = append(f.failures[op], os.NewSyscallError("ioctl", errno))
+	}
+}
+
+// call Counts the call of the operation and returns the injected error, if any
+func (f *fakeUFFD) call(op string) error {
+	f.calls[op]++
+
+	if errs := f.failures[op]; len(errs) > 0 {
+		f.failures[op] = errs[1:]
+		return errs[0]
+	}
+
+	return nil
+}
+
+func (f *fakeUFFD) numCalls(op string) int {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.calls[op]
+}
+
+// pages Returns the range of the pages of the guest memory at the address
+func (f *fakeUFFD) pages(start uint64, len int) (int, int, error) {
+	pageSize := os.Getpagesize()
+
+	if start < f.base || start%uint64(pageSize) != 0 || len%pageSize != 0 ||
+		start+uint64(len) > f.base+uint64(cap(f.present)*pageSize) {
+		return 0, 0, os.NewSyscallError("ioctl", unix.ENOENT)
+	}
+
+	first := int(start-f.base) / pageSize
+
+	return first, first + len/pageSize, nil
+}
+
+func (f *fakeUFFD) Fd() uintptr {
+	return uintptr(f.r)
+}
+
+func (f *fakeUFFD) Read(msg []byte) (int, error) {
+	return unix.Read(f.r, msg)
+}
+
+func (f *fakeUFFD) Close() error {
+	f.Lock()
+	defer f.Unlock()
+
+	if f.isClosed {
+		return nil
+	}
+	f.isClosed = true
+
+	unix.Close(f.w)
+	return unix.Close(f.r)
+}
+
+func (f *fakeUFFD) copy(dst uint64, src []byte, mode installMode) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.call(opCopy); err != nil {
+		return err
+	}
+
+	return f.install(dst, src, len(src), mode)
+}
+
+func (f *fakeUFFD) zeroPage(dst uint64, numPages int, mode installMode) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.call(opZeroPage); err != nil {
+		return err
+	}
+	if f.noZeroPage || mode&installWriteProtect != 0 {
+		return os.NewSyscallError("ioctl", unix.EINVAL)
+	}
+
+	return f.install(dst, nil, numPages*os.Getpagesize(), mode)
+}
+
+// install Installs the pages of src at dst, or zero pages if src is nil
+func (f *fakeUFFD) install(dst uint64, src []byte, len int, mode installMode) error {
+	first, end, err := f.pages(dst, len)
+	if err != nil {
+		return err
+	}
+
+	for i := first; i < end; i++ {
+		if f.present[i] {
+			return os.NewSyscallError("ioctl", unix.EEXIST)
+		}
+	}
+
+	pageSize := os.Getpagesize()
+	for i := first; i < end; i++ {
+		page := f.mem[i*pageSize : (i+1)*pageSize]
+		if src != nil {
+			copy(page, src[(i-first)*pageSize:])
+		} else {
+			copy(page, zeroPage)
+		}
+
+		f.present[i] = true
+		f.wp[i] = mode&installWriteProtect != 0
+		if mode&installDontWake == 0 {
+			f.woken[i] = true
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeUFFD) wake(start uint64, len int) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.call(opWake); err != nil {
+		return err
+	}
+
+	first, end, err := f.pages(start, len)
+	if err != nil {
+		return err
+	}
+
+	for i := first; i < end; i++ {
+		f.woken[i] = true
+	}
+
+	return nil
+}
+
+func (f *fakeUFFD) registerWriteProtect(start, len uint64) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.call(opRegisterWP); err != nil {
+		return err
+	}
+	if f.noWriteProtect {
+		return os.NewSyscallError("ioctl", unix.EINVAL)
+	}
+
+	if _, _, err := f.pages(start, int(len)); err != nil {
+		return err
+	}
+	f.isWPRegistered = true
+
+	return nil
+}
+
+func (f *fakeUFFD) writeProtect(start, len uint64, wp bool) error {
+	f.Lock()
+	defer f.Unlock()
+
+	if err := f.call(opWriteProtect); err != nil {
+		return err
+	}
+	if !f.isWPRegistered {
+		return os.NewSyscallError("ioctl", unix.EINVAL)
+	}
+
+	first, end, err := f.pages(start, int(len))
+	if err != nil {
+		return err
+	}
+
+	for i := first; i < end; i++ {
+		if f.present[i] {
+			f.wp[i] = wp
+		}
+		if !wp {
+			f.woken[i] = true
+		}
+	}
+
+	return nil
+}
+
+// sendPageFault Sends the page fault on the page with the flags of struct uffd_msg
+func (f *fakeUFFD) sendPageFault(t *testing.T, page int, flags uint64) {
+	f.Lock()
+	f.woken[page] = false
+	f.Unlock()
+
+	msg := make([]byte, sizeOfUFFDMsg())
+	msg[0] = uffdPageFault()
+	binary.LittleEndian.PutUint64(msg[8:], flags)
+	binary.LittleEndian.PutUint64(msg[16:], f.base+uint64(page*os.Getpagesize())+8) // not page-aligned
+
+	_, err := unix.Write(f.w, msg)
+	require.NoError(t, err, "Failed to send the page fault")
+}
+
+// touch Reads or writes the page as a vCPU would, faulting until the page is accessible.
+// Returns the contents of the page.
+func (f *fakeUFFD) touch(t *testing.T, page int, write bool) []byte {
+	pageSize := os.Getpagesize()
+
+	for i := 0; ; i++ {
+		require.Less(t, i, 10, "The page fault is not served")
+
+		f.Lock()
+		present, wp := f.present[page], f.wp[page]
+		f.Unlock()
+
+		var flags uint64
+		switch {
+		case present && !(write && wp):
+			f.Lock()
+			defer f.Unlock()
+			return append([]byte(nil), f.mem[page*pageSize:(page+1)*pageSize]...)
+		case present:
+			flags = uffdFlagWP() | uffdFlagWrite()
+		case write:
+			flags = uffdFlagWrite()
+		}
+
+		f.sendPageFault(t, page, flags)
+		require.Eventually(t, func() bool { return f.isWoken(page) }, time.Second, time.Millisecond,
+			"The faulting thread is not woken up")
+	}
+}
+
+func (f *fakeUFFD) isWoken(page int) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.woken[page]
+}
+
+func (f *fakeUFFD) isPresent(page int) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.present[page]
+}
+
+func (f *fakeUFFD) isWriteProtected(page int) bool {
+	f.Lock()
+	defer f.Unlock()
+
+	return f.wp[page]
+}
+
+// waitPresent Waits for the pages to be installed, e.g., in the background
+func (f *fakeUFFD) waitPresent(t *testing.T, pages ...int) {
+	for _, page := range pages {
+		require.Eventually(t, func() bool { return f.isPresent(page) }, time.Second, time.Millisecond,
+			"Page %d is not installed", page)
+	}
+}
@@ -0,0 +1,359 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// the maximum size of the region layout that comes with the uffd
+const handshakeBufSize = 64 * 1024
+
+// GuestRegionMapping A region of the guest memory as reported by Firecracker
+// in the UFFD handshake. Firecracker splits the guest memory of large VMs
+// into several regions around the MMIO gap.
+type GuestRegionMapping struct {
+	BaseHostVirtAddr uint64 `json:"base_host_virt_addr"`
+	Size             uint64 `json:"size"`
+	Offset           uint64 `json:"offset"` // in the guest memory file
+}
+
+// guestRegion A region of the guest memory
+type guestRegion struct {
+	GuestRegionMapping
+}
+
+// addrRange A range of addresses [start, end)
+type addrRange struct {
+	start, end uint64
+}
+
+// guestMemory The layout of the guest memory of a VM. The offsets are in the guest memory file,
+// which is how the trace and the working set refer to the pages.
+// The layout changes upon the non-cooperative uffd events, concurrently with the installation
+// of the working set, hence the lock.
+type guestMemory struct {
+	sync.RWMutex
+	regions []*guestRegion // sorted by the offset
+	// the VMM did not report the layout, so there is a single region that starts
+	// at the address of the first page fault
+	isLegacy bool
+	// the ranges that the VMM removed (e.g., upon a balloon inflation) or unmapped,
+	// sorted and disjoint. Their pages read as zeros and must not be installed from the snapshot
+	removed []addrRange
+}
+
+// newGuestMemory Returns the guest memory with the layout from the handshake data,
+// or with the single region of the given size if the VMM sent no layout
+func newGuestMemory(handshake []byte, guestMemSize int) (*guestMemory, error) {
+	if len(handshake) == 0 {
+		return &guestMemory{
+			regions:  []*guestRegion{{GuestRegionMapping: GuestRegionMapping{Size: uint64(guestMemSize)}}},
+			isLegacy: true,
+		}, nil
+	}
+
+	var mappings []GuestRegionMapping
+	if err := json.Unmarshal(handshake, &mappings); err != nil {
+		return nil, fmt.Errorf("failed to parse the guest memory layout: %w", err)
+	}
+
+	if len(mappings) == 0 {
+		return nil, errors.New("guest memory layout has no regions")
+	}
+
+	g := new(guestMemory)
+	for _, m := range mappings {
+		g.regions = append(g.regions, &guestRegion{GuestRegionMapping: m})
+	}
+	sort.Slice(g.regions, func(i, j int) bool { return g.regions[i].Offset < g.regions[j].Offset })
+
+	pageSize := uint64(os.Getpagesize())
+
+	var end uint64
+	for _, r := range g.regions {
+		if r.Size == 0 || r.Size%pageSize != 0 || r.Offset%pageSize != 0 || r.BaseHostVirtAddr%pageSize != 0 {
+			return nil, fmt.Errorf("guest memory region %+v is not page-aligned", r.GuestRegionMapping)
+		}
+		if r.Offset < end {
+			return nil, fmt.Errorf("guest memory region %+v overlaps with the previous one", r.GuestRegionMapping)
+		}
+		end = r.Offset + r.Size
+	}
+
+	if end > uint64(guestMemSize) {
+		return nil, fmt.Errorf("guest memory regions span %d bytes, more than the guest memory size %d", end, guestMemSize)
+	}
+
+	return g, nil
+}
+
+// setBase Sets the start address of the single region if the VMM did not report the layout
+func (g *guestMemory) setBase(address uint64) {
+	g.Lock()
+	defer g.Unlock()
+
+	if g.isLegacy {
+		g.regions[0].BaseHostVirtAddr = address
+	}
+}
+
+// regionOf Returns the region with the offset
+func (g *guestMemory) regionOf(offset uint64) *guestRegion {
+	i := sort.Search(len(g.regions), func(i int) bool { return g.regions[i].Offset+g.regions[i].Size > offset })
+	if i == len(g.regions) || g.regions[i].Offset > offset {
+		return nil
+	}
+
+	return g.regions[i]
+}
+
+// fileOffset Returns the offset of the address in the guest memory file
+func (g *guestMemory) fileOffset(address uint64) (uint64, bool) {
+	g.RLock()
+	defer g.RUnlock()
+
+	for _, r := range g.regions {
+		if address >= r.BaseHostVirtAddr && address < r.BaseHostVirtAddr+r.Size {
+			return r.Offset + address - r.BaseHostVirtAddr, true
+		}
+	}
+
+	return 0, false
+}
+
+// hostAddress Returns the address of the offset in the guest memory file
+func (g *guestMemory) hostAddress(offset uint64) (uint64, bool) {
+	g.RLock()
+	defer g.RUnlock()
+
+	r := g.regionOf(offset)
+	if r == nil {
+		return 0, false
+	}
+
+	return r.BaseHostVirtAddr + offset - r.Offset, true
+}
+
+// split Calls fn for each part of the contiguous range of the guest memory file
+// that lies within a single region, as the regions need not be contiguous in the address space
+func (g *guestMemory) split(offset uint64, numPages int, fn func(offset, address uint64, numPages int) error) error {
+	type part struct {
+		offset, address uint64
+		numPages        int
+	}
+
+	pageSize := uint64(os.Getpagesize())
+
+	// fn is called without the lock, as it may wait for the uffd events to be handled
+	var parts []part
+
+	g.RLock()
+	for numPages > 0 {
+		r := g.regionOf(offset)
+		if r == nil {
+			g.RUnlock()
+			return fmt.Errorf("offset %#x is out of the guest memory", offset)
+		}
+
+		n := int((r.Offset + r.Size - offset) / pageSize)
+		if n > numPages {
+			n = numPages
+		}
+
+		parts = append(parts, part{offset, r.BaseHostVirtAddr + offset - r.Offset, n})
+
+		offset += uint64(n) * pageSize
+		numPages -= n
+	}
+	g.RUnlock()
+
+	for _, p := range parts {
+		if err := fn(p.offset, p.address, p.numPages); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// remove Marks the address range as removed
+func (g *guestMemory) remove(start, end uint64) {
+	g.Lock()
+	defer g.Unlock()
+
+	g.removeLocked(start, end)
+}
+
+func (g *guestMemory) removeLocked(start, end uint64) {
+	merged := addrRange{start, end}
+	ranges := make([]addrRange, 0, len(g.removed)+1)
+	for _, r := range g.removed {
+		if r.end < merged.start || r.start > merged.end {
+			ranges = append(ranges, r)
+			continue
+		}
+		if r.start < merged.start {
+			merged.start = r.start
+		}
+		if r.end > merged.end {
+			merged.end = r.end
+		}
+	}
+	ranges = append(ranges, merged)
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+
+	g.removed = ranges
+}
+
+// isRemoved Returns true if the address has been removed
+func (g *guestMemory) isRemoved(address uint64) bool {
+	g.RLock()
+	defer g.RUnlock()
+
+	i := sort.Search(len(g.removed), func(i int) bool { return g.removed[i].end > address })
+
+	return i < len(g.removed) && g.removed[i].start <= address
+}
+
+// overlapsRemoved Returns true if any address of the range [start, end) has been removed
+func (g *guestMemory) overlapsRemoved(start, end uint64) bool {
+	g.RLock()
+	defer g.RUnlock()
+
+	i := sort.Search(len(g.removed), func(i int) bool { return g.removed[i].end > start })
+
+	return i < len(g.removed) && g.removed[i].start < end
+}
+
+// remap Moves the address range [from, from+length) to the address to,
+// splitting the regions that are moved partially
+func (g *guestMemory) remap(from, to, length uint64) {
+	g.Lock()
+	defer g.Unlock()
+
+	moved := func(address uint64) uint64 { return address - from + to }
+
+	var regions []*guestRegion
+	for _, r := range g.regions {
+		start, end := r.BaseHostVirtAddr, r.BaseHostVirtAddr+r.Size
+		if end <= from || start >= from+length {
+			regions = append(regions, r)
+			continue
+		}
+
+		// split the region at the bounds of the moved range
+		bounds := []uint64{start}
+		if from > start {
+			bounds = append(bounds, from)
+		}
+		if from+length < end {
+			bounds = append(bounds, from+length)
+		}
+		bounds = append(bounds, end)
+
+		for i := 0; i < len(bounds)-1; i++ {
+			lo, hi := bounds[i], bounds[i+1]
+			part := &guestRegion{GuestRegionMapping: GuestRegionMapping{
+				BaseHostVirtAddr: lo,
+				Size:             hi - lo,
+				Offset:           r.Offset + lo - start,
+			}}
+			if lo >= from && hi <= from+length {
+				part.BaseHostVirtAddr = moved(lo)
+			}
+			regions = append(regions, part)
+		}
+	}
+	g.regions = regions
+
+	var removed []addrRange
+	for _, r := range g.removed {
+		switch {
+		case r.end <= from || r.start >= from+length:
+			removed = append(removed, r)
+		default:
+			// the removed pages outside of the moved range stay in place
+			if r.start < from {
+				removed = append(removed, addrRange{r.start, from})
+			}
+			if r.end > from+length {
+				removed = append(removed, addrRange{from + length, r.end})
+			}
+			lo, hi := r.start, r.end
+			if lo < from {
+				lo = from
+			}
+			if hi > from+length {
+				hi = from + length
+			}
+			removed = append(removed, addrRange{moved(lo), moved(hi)})
+		}
+	}
+	g.removed = nil
+	for _, r := range removed {
+		g.removeLocked(r.start, r.end)
+	}
+}
+
+// receiveUFFD Receives the uffd and the guest memory layout, if any, from the VMM
+func receiveUFFD(conn *net.UnixConn) (*os.File, []byte, error) {
+	buf := make([]byte, handshakeBufSize)
+	oob := make([]byte, unix.CmsgSpace(4))
+
+	n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(msgs) != 1 {
+		return nil, nil, fmt.Errorf("expected the uffd in the handshake, got %d control messages", len(msgs))
+	}
+
+	fds, err := unix.ParseUnixRights(&msgs[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(fds) != 1 {
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+		return nil, nil, fmt.Errorf("expected one uffd in the handshake, got %d", len(fds))
+	}
+
+	return os.NewFile(uintptr(fds[0]), "uffd"), buf[:n], nil
+}
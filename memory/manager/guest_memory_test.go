@@ -0,0 +1,231 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestGuestMemoryLayout(t *testing.T) {
+	pageSize := uint64(os.Getpagesize())
+
+	// two regions around a gap, as Firecracker reports for large VMs
+	handshake := []byte(`[
+		{"base_host_virt_addr": 1048576000, "size": 16384, "offset": 0, "page_size_kib": 4},
+		{"base_host_virt_addr": 2097152000, "size": 8192, "offset": 16384, "page_size_kib": 4}
+	]`)
+
+	g, err := newGuestMemory(handshake, 6*int(pageSize))
+	require.NoError(t, err, "Failed to parse the layout")
+	require.False(t, g.isLegacy)
+	require.Len(t, g.regions, 2)
+
+	g.setBase(42) // must not change a reported layout
+
+	offset, ok := g.fileOffset(1048576000 + pageSize)
+	require.True(t, ok)
+	require.Equal(t, pageSize, offset)
+
+	offset, ok = g.fileOffset(2097152000 + pageSize)
+	require.True(t, ok)
+	require.Equal(t, 5*pageSize, offset)
+
+	_, ok = g.fileOffset(1048576000 + 4*pageSize)
+	require.False(t, ok, "Address in the gap must be out of the guest memory")
+
+	addr, ok := g.hostAddress(4 * pageSize)
+	require.True(t, ok)
+	require.Equal(t, uint64(2097152000), addr)
+
+	type part struct {
+		offset, address uint64
+		numPages        int
+	}
+	var parts []part
+	require.NoError(t, g.split(2*pageSize, 3, func(offset, address uint64, numPages int) error {
+		parts = append(parts, part{offset, address, numPages})
+		return nil
+	}))
+	require.Equal(t, []part{
+		{2 * pageSize, 1048576000 + 2*pageSize, 2},
+		{4 * pageSize, 2097152000, 1},
+	}, parts)
+
+	require.Error(t, g.split(5*pageSize, 2, func(uint64, uint64, int) error { return nil }),
+		"Range out of the guest memory must fail")
+
+	_, err = newGuestMemory(handshake, 4*int(pageSize))
+	require.Error(t, err, "Layout larger than the guest memory must fail")
+}
+
+func TestGuestMemoryLegacy(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+	path := filepath.Join(dir, "mem_file")
+	prepareGuestMem(t, path, 4)
+
+	g, err := newGuestMemory(nil, 4*pageSize)
+	require.NoError(t, err)
+	require.True(t, g.isLegacy)
+
+	g.setBase(0x7f0000000000)
+
+	offset, ok := g.fileOffset(0x7f0000000000 + 3*uint64(pageSize))
+	require.True(t, ok)
+	require.Equal(t, 3*uint64(pageSize), offset)
+
+	pages, err := OpenFileSource(SnapshotStateCfg{GuestMemPath: path, GuestMemSize: 4 * pageSize})
+	require.NoError(t, err, "Failed to map the guest memory file")
+	defer pages.Close()
+
+	page, err := pages.Pages(offset, 1)
+	require.NoError(t, err)
+	require.Len(t, page, pageSize)
+	require.Equal(t, byte(4), page[0])
+}
+
+func TestReceiveUFFD(t *testing.T) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	require.NoError(t, err)
+
+	conns := make([]*net.UnixConn, 2)
+	for i, fd := range fds {
+		f := os.NewFile(uintptr(fd), "socket")
+		c, err := net.FileConn(f)
+		require.NoError(t, err)
+		f.Close()
+		conns[i] = c.(*net.UnixConn)
+		defer conns[i].Close()
+	}
+
+	// any file stands for the uffd
+	f, err := os.Open(os.DevNull)
+	require.NoError(t, err)
+	defer f.Close()
+
+	layout := []byte(`[{"base_host_virt_addr": 4096, "size": 4096, "offset": 0}]`)
+	_, _, err = conns[0].WriteMsgUnix(layout, unix.UnixRights(int(f.Fd())), nil)
+	require.NoError(t, err)
+
+	uffd, handshake, err := receiveUFFD(conns[1])
+	require.NoError(t, err, "Failed to receive the uffd")
+	defer uffd.Close()
+	require.Equal(t, layout, handshake)
+}
+
+func TestGuestMemoryRemoveRemap(t *testing.T) {
+	pageSize := uint64(os.Getpagesize())
+	base := uint64(0x7f0000000000)
+
+	g, err := newGuestMemory(nil, 8*int(pageSize))
+	require.NoError(t, err)
+	g.setBase(base)
+
+	g.remove(base+pageSize, base+2*pageSize)
+	g.remove(base+2*pageSize, base+3*pageSize) // merged with the previous range
+	g.remove(base+6*pageSize, base+7*pageSize)
+	require.Len(t, g.removed, 2)
+
+	require.False(t, g.isRemoved(base))
+	require.True(t, g.isRemoved(base+pageSize))
+	require.True(t, g.isRemoved(base+2*pageSize))
+	require.False(t, g.isRemoved(base+3*pageSize))
+	require.True(t, g.overlapsRemoved(base, base+2*pageSize))
+	require.False(t, g.overlapsRemoved(base+3*pageSize, base+6*pageSize))
+
+	// move the middle of the region, including a removed page
+	to := uint64(0x7e0000000000)
+	g.remap(base+2*pageSize, to, 4*pageSize)
+	require.Len(t, g.regions, 3)
+
+	offset, ok := g.fileOffset(to + pageSize)
+	require.True(t, ok)
+	require.Equal(t, 3*pageSize, offset)
+
+	_, ok = g.fileOffset(base + 3*pageSize)
+	require.False(t, ok, "Moved address must be out of the guest memory")
+
+	addr, ok := g.hostAddress(6 * pageSize)
+	require.True(t, ok)
+	require.Equal(t, base+6*pageSize, addr)
+
+	require.True(t, g.isRemoved(base+pageSize))
+	require.False(t, g.isRemoved(base+2*pageSize))
+	require.True(t, g.isRemoved(to))
+	require.True(t, g.isRemoved(base+6*pageSize))
+
+	var parts int
+	require.NoError(t, g.split(0, 8, func(uint64, uint64, int) error {
+		parts++
+		return nil
+	}))
+	require.Equal(t, 3, parts)
+}
+
+func TestHandleEvents(t *testing.T) {
+	pageSize := uint64(os.Getpagesize())
+	base := uint64(0x7f0000000000)
+
+	s := NewSnapshotState(SnapshotStateCfg{VMID: "1", GuestMemSize: 8 * int(pageSize)})
+
+	var err error
+	s.guestMem, err = newGuestMemory(nil, s.GuestMemSize)
+	require.NoError(t, err)
+	s.guestMem.setBase(base)
+
+	msg := func(event uint8, args ...uint64) []byte {
+		m := make([]byte, sizeOfUFFDMsg())
+		m[0] = event
+		for i, arg := range args {
+			binary.LittleEndian.PutUint64(m[8+8*i:], arg)
+		}
+		return m
+	}
+
+	require.NoError(t, s.handleEvent(msg(uffdEventRemove(), base, base+pageSize)))
+	require.True(t, s.guestMem.isRemoved(base))
+
+	require.NoError(t, s.handleEvent(msg(uffdEventUnmap(), base+7*pageSize, base+8*pageSize)))
+	require.True(t, s.guestMem.isRemoved(base+7*pageSize))
+
+	require.NoError(t, s.handleEvent(msg(uffdEventRemap(), base, base+16*pageSize, 8*pageSize)))
+	offset, ok := s.guestMem.fileOffset(base + 17*pageSize)
+	require.True(t, ok)
+	require.Equal(t, pageSize, offset)
+
+	// the uffd of the child is closed
+	var fds [2]int
+	require.NoError(t, unix.Pipe(fds[:]))
+	defer unix.Close(fds[1])
+	require.NoError(t, s.handleEvent(msg(uffdEventFork(), uint64(fds[0]))))
+	require.Error(t, unix.Close(fds[0]), "Uffd of the child must be closed")
+
+	require.Error(t, s.handleEvent(msg(0xff)), "Unknown event must break the VM")
+}
@@ -27,6 +27,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"strconv"
 	"sync"
 	"time"
@@ -39,13 +40,45 @@ import (
 
 const (
 	serveUniqueMetric = "ServeUnique"
-	installWSMetric   = "InstallWS"
+	installWSMetric   = "InstallWS" // until the faulting thread is woken up
+	installWSBgMetric = "InstallWSBackground"
 	fetchStateMetric  = "FetchState"
+	fetchWSMetric     = "FetchWS"   // until the whole working set is fetched
+	fetchWaitMetric   = "FetchWait" // the installation waited for the working set to be fetched
+	// decompressing the working set, summed over the workers
+	decompressWSMetric = "DecompressWS"
 )
 
 // MemoryManagerCfg Global config of the manager
 type MemoryManagerCfg struct {
 	MetricsModeOn bool
+	// Workers Number of goroutines that fetch and install the working set of a VM
+	Workers int
+	// ChunkSize Size of the chunks in which the working set is fetched and installed, in bytes
+	ChunkSize int
+	// MissThreshold Number of the pages missing from the working set per activation,
+	// on average over the last MissWindow activations, above which the missing pages
+	// are merged into the working set. Zero disables the merging.
+	MissThreshold int
+	// PageSource Opens the source of the pages of the guest memory file of a VM,
+	// the file on the local disk if not set
+	PageSource PageSourceFactory
+	// MissWindow Number of the last activations over which the misses are averaged
+	MissWindow int
+	// Recordings Number of the invocations recorded to build the working set
+	Recordings int
+	// PageFrequency Fraction of the recorded invocations that must touch a page
+	// for it to be in the working set. Zero means that one invocation is enough.
+	PageFrequency float64
+	// TrackDirtyPages Records the pages that each activation of a VM writes,
+	// see GetDirtyPages
+	TrackDirtyPages bool
+	// CompressWorkingSet Compresses the working set files in chunks of ChunkSize,
+	// which are fetched and decompressed in parallel
+	CompressWorkingSet bool
+	// ChecksumWorkingSet Stores the checksums of the pages in the working set files,
+	// which are verified when the working set is fetched
+	ChecksumWorkingSet bool
 }
 
 // MemoryManager Serves page faults coming from VMs
@@ -63,6 +96,19 @@ func NewMemoryManager(cfg MemoryManagerCfg) *MemoryManager {
 	m.instances = make(map[string]*SnapshotState)
 	m.MemoryManagerCfg = cfg
 
+	if m.Workers <= 0 {
+		m.Workers = defaultWorkers
+	}
+	if m.ChunkSize <= 0 {
+		m.ChunkSize = defaultChunkSize
+	}
+	if m.MissWindow <= 0 {
+		m.MissWindow = defaultMissWindow
+	}
+	if m.Recordings <= 0 {
+		m.Recordings = 1
+	}
+
 	return m
 }
 
@@ -83,8 +129,26 @@ func (m *MemoryManager) RegisterVM(cfg SnapshotStateCfg) error {
 	}
 
 	cfg.metricsModeOn = m.MetricsModeOn
+	cfg.workers = m.Workers
+	cfg.chunkSize = m.ChunkSize
+	cfg.missThreshold = m.MissThreshold
+	cfg.missWindow = m.MissWindow
+	cfg.numRecordings = m.Recordings
+	cfg.pageFrequency = m.PageFrequency
+	cfg.pageSource = m.PageSource
+	cfg.trackDirty = m.TrackDirtyPages
+	cfg.compressWS = m.CompressWorkingSet
+	cfg.checksumWS = m.ChecksumWorkingSet
 	state := NewSnapshotState(cfg)
 
+	if !state.IsLazyMode {
+		if loaded, err := state.loadRecord(); err != nil {
+			logger.WithError(err).Warn("Failed to load the persisted record, the VM will be recorded anew")
+		} else if loaded {
+			logger.Debug("Loaded the persisted record, the VM will be served in the replay mode")
+		}
+	}
+
 	m.instances[vmID] = state
 
 	return nil
@@ -105,9 +169,19 @@ func (m *MemoryManager) DeregisterVM(vmID string) error {
 		return errors.New("VM is not registered with the memory manager")
 	}
 
+	state.statusMu.Lock()
+	defer state.statusMu.Unlock()
+
 	if state.isActive {
-		logger.Error("Failed to deactivate, VM still active")
-		return errors.New("Failed to deactivate, VM still active")
+		if state.err() == nil {
+			logger.Error("Failed to deactivate, VM still active")
+			return errors.New("Failed to deactivate, VM still active")
+		}
+
+		// the VM failed while active, so it is stopped without the deactivation
+		if err := state.teardown(); err != nil {
+			logger.WithError(err).Warn("Failed to tear down the failed VM")
+		}
 	}
 
 	delete(m.instances, vmID)
@@ -124,7 +198,7 @@ func (m *MemoryManager) Activate(vmID string) error {
 	var (
 		ok      bool
 		state   *SnapshotState
-		readyCh chan int = make(chan int)
+		readyCh chan error = make(chan error)
 	)
 
 	m.Lock()
@@ -138,31 +212,48 @@ func (m *MemoryManager) Activate(vmID string) error {
 
 	m.Unlock()
 
+	state.statusMu.Lock()
+	defer state.statusMu.Unlock()
+
 	if state.isActive {
 		logger.Error("VM already active")
 		return errors.New("VM already active")
 	}
 
-	if err := state.mapGuestMemory(); err != nil {
-		logger.Error("Failed to map guest memory")
+	if err := state.getUFFD(); err != nil {
+		logger.Error("Failed to get uffd")
 		return err
 	}
 
-	if err := state.getUFFD(); err != nil {
-		logger.Error("Failed to get uffd")
+	if err := state.openPageSource(); err != nil {
+		logger.Error("Failed to open guest memory")
+		state.userFaultFD.Close()
 		return err
 	}
 
 	state.setupStateOnActivate()
 
+	if state.trackDirty && !state.guestMem.isLegacy {
+		// otherwise, the guest memory is registered upon the first page fault
+		state.startDirtyTracking()
+	}
+
 	go state.pollUserPageFaults(readyCh)
 
-	<-readyCh
+	if err := <-readyCh; err != nil {
+		logger.WithError(err).Error("Failed to start serving page faults")
+		if err := state.closePageSource(); err != nil {
+			logger.WithError(err).Error("Failed to close guest memory")
+		}
+		state.userFaultFD.Close()
+		state.isActive = false
+		return err
+	}
 
 	return nil
 }
 
-// FetchState Fetches the working set file (or the whole guest memory) and the VMM state file
+// FetchState Fetches the VMM state file and the working set file, unless in the hybrid mode
 func (m *MemoryManager) FetchState(vmID string) error {
 	logger := log.WithFields(log.Fields{"vmID": vmID})
 
@@ -221,6 +312,9 @@ func (m *MemoryManager) Deactivate(vmID string) error {
 
 	m.Unlock()
 
+	state.statusMu.Lock()
+	defer state.statusMu.Unlock()
+
 	if !state.isEverActivated {
 		return nil
 	}
@@ -230,21 +324,45 @@ func (m *MemoryManager) Deactivate(vmID string) error {
 		return errors.New("VM not activated")
 	}
 
-	state.quitCh <- 0
-	if err := state.unmapGuestMemory(); err != nil {
-		logger.Error("Failed to munmap guest memory")
+	if err := state.teardown(); err != nil {
+		logger.Error("Failed to close guest memory")
 		return err
 	}
 
 	state.processMetrics()
+	state.collectDirtyPages()
+	state.pipeline = nil
+
+	if err := state.err(); err != nil {
+		if !state.isRecordReady {
+			// the record is incomplete, the VM will be recorded anew on the next activation
+			state.trace = initTrace()
+		}
+		return fmt.Errorf("VM failed while active: %w", err)
+	}
+
+	if state.isRecordReady && !state.IsLazyMode && state.mergeMisses() {
+		// the old working set file is kept if the new one cannot be written
+		if err := state.processRecord(); err != nil {
+			logger.WithError(err).Error("Failed to update the working set")
+		}
+	}
+
+	if !state.isRecordReady && !state.addRecording() {
+		logger.Debugf("Recorded %d out of %d invocations", len(state.recorded), state.numRecordings)
+		return nil
+	}
 
-	state.userFaultFD.Close()
 	if !state.isRecordReady && !state.IsLazyMode {
-		state.trace.ProcessRecord(state.GuestMemPath, state.WorkingSetPath)
+		if err := state.processRecord(); err != nil {
+			// the VM will be recorded anew on the next activation
+			state.trace = initTrace()
+			logger.WithError(err).Error("Failed to process the record")
+			return err
+		}
 	}
 
 	state.isRecordReady = true
-	state.isActive = false
 
 	return nil
 }
@@ -361,11 +479,17 @@ func getLazyHeaderStats(state *SnapshotState, functionName string) ([]string, []
 		"StdDev",
 		"Unique",
 		"StdDev",
+		"Precision",
+		"StdDev",
+		"Recall",
+		"StdDev",
 	}
 
 	uniqueMean, uniqueStd := stat.MeanStdDev(state.uniquePFServed, nil)
 	totalMean, totalStd := stat.MeanStdDev(state.totalPFServed, nil)
 	reusedMean, reusedStd := stat.MeanStdDev(state.reusedPFServed, nil)
+	precisionMean, precisionStd := formatRatio(state.precision)
+	recallMean, recallStd := formatRatio(state.recall)
 
 	stats := []string{
 		functionName,
@@ -376,11 +500,27 @@ func getLazyHeaderStats(state *SnapshotState, functionName string) ([]string, []
 		fmt.Sprintf("%.1f", reusedStd),
 		strconv.Itoa(int(uniqueMean)), // number of pages not found in the trace
 		fmt.Sprintf("%.1f", uniqueStd),
+		precisionMean, // fraction of the trace that is used
+		precisionStd,
+		recallMean, // fraction of the served pages found in the trace
+		recallStd,
 	}
 
 	return header, stats
 }
 
+// formatRatio Formats the mean and the standard deviation of the ratios,
+// which are left empty if the ratio is not measured
+func formatRatio(ratios []float64) (string, string) {
+	if len(ratios) == 0 {
+		return "", ""
+	}
+
+	mean, std := stat.MeanStdDev(ratios, nil)
+
+	return fmt.Sprintf("%.3f", mean), fmt.Sprintf("%.3f", std)
+}
+
 func getRecRepHeaderStats(state *SnapshotState, functionName string) ([]string, []string) {
 	header := []string{
 		"FuncName",
@@ -388,9 +528,35 @@ func getRecRepHeaderStats(state *SnapshotState, functionName string) ([]string,
 		"RecRegions",
 		"Unique",
 		"StdDev",
+		"ZeroPages",
+		"SavedBytes",
+		"ZeroInstalls",
+		"StdDev",
+		"Avoided",
+		"StdDev",
+		"TraceFaults",
+		"StdDev",
+		"WSBytes",
+		"StoredWSBytes",
+		"Precision",
+		"StdDev",
+		"Recall",
+		"StdDev",
 	}
 
 	uniqueMean, uniqueStd := stat.MeanStdDev(state.uniquePFServed, nil)
+	zeroMean, zeroStd := stat.MeanStdDev(state.zeroPFServed, nil)
+	avoidedMean, avoidedStd := stat.MeanStdDev(state.avoidedPF, nil)
+	traceFaultsMean, traceFaultsStd := stat.MeanStdDev(state.traceFaults, nil)
+	precisionMean, precisionStd := formatRatio(state.precision)
+	recallMean, recallStd := formatRatio(state.recall)
+
+	var zeroPages, wsBytes, storedBytes int
+	if state.wsMeta != nil {
+		zeroPages = state.wsMeta.NumZeroPages()
+		wsBytes = state.wsMeta.DataSize()
+		storedBytes = state.wsMeta.CompressedSize()
+	}
 
 	stats := []string{
 		functionName,
@@ -398,13 +564,30 @@ func getRecRepHeaderStats(state *SnapshotState, functionName string) ([]string,
 		strconv.Itoa(len(state.trace.regions)), // number of contiguous regions in the trace
 		strconv.Itoa(int(uniqueMean)),          // number of pages not found in the trace
 		fmt.Sprintf("%.1f", uniqueStd),
+		strconv.Itoa(zeroPages),                    // number of pages of the trace that are all zeros
+		strconv.Itoa(zeroPages * os.Getpagesize()), // bytes not stored in and not fetched from the working set file
+		strconv.Itoa(int(zeroMean)),                // number of zero pages installed without a copy
+		fmt.Sprintf("%.1f", zeroStd),
+		strconv.Itoa(int(avoidedMean)), // number of pages of the trace installed before the guest faulted on them
+		fmt.Sprintf("%.1f", avoidedStd),
+		strconv.Itoa(int(traceFaultsMean)), // number of faults on the pages of the trace
+		fmt.Sprintf("%.1f", traceFaultsStd),
+		strconv.Itoa(wsBytes),     // pages of the working set file, uncompressed
+		strconv.Itoa(storedBytes), // pages of the working set file as stored, compressed if enabled
+		precisionMean,             // empty, it is unknown which pages of the trace installed ahead of the guest are used
+		precisionStd,
+		recallMean, // fraction of the used pages found in the trace, an upper bound
+		recallStd,
 	}
 
 	return header, stats
 }
 
+// writeUPFPageStats Appends the stats to the csv file. The columns are only ever added
+// at the end of the header, so a file written with an older header is rewritten with
+// the new one, leaving the new columns of its rows empty.
 func writeUPFPageStats(metricsOutFilePath string, statHeader, stats []string) error {
-	csvFile, err := os.OpenFile(metricsOutFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	csvFile, err := os.OpenFile(metricsOutFilePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		log.Error("Failed to create csv file for writing stats")
 		return err
@@ -425,6 +608,26 @@ func writeUPFPageStats(metricsOutFilePath string, statHeader, stats []string) er
 			log.Errorf("Failed to write header to csv file: %v", err)
 			return err
 		}
+	} else {
+		reader := csv.NewReader(csvFile)
+		header, err := reader.Read()
+		if err != nil {
+			log.Errorf("Failed to read header of csv file: %v", err)
+			return err
+		}
+
+		if len(header) > len(statHeader) || !reflect.DeepEqual(header, statHeader[:len(header)]) {
+			log.Error("The csv file has a different header")
+			return errors.New("the csv file has a different header")
+		}
+
+		if len(header) < len(statHeader) {
+			log.Warnf("Rewriting csv file %s with the new columns %v", metricsOutFilePath, statHeader[len(header):])
+			if err := rewriteCSV(csvFile, reader, writer, statHeader); err != nil {
+				log.Errorf("Failed to rewrite csv file: %v", err)
+				return err
+			}
+		}
 	}
 
 	if err := writer.Write(stats); err != nil {
@@ -434,3 +637,29 @@ func writeUPFPageStats(metricsOutFilePath string, statHeader, stats []string) er
 
 	return nil
 }
+
+// rewriteCSV Replaces the header of the csv file, which is read past its header,
+// with the given one, and pads the rows with empty values of the new columns
+func rewriteCSV(csvFile *os.File, reader *csv.Reader, writer *csv.Writer, header []string) error {
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	// the file is opened for appending, so the rows are written from its start
+	if err := csvFile.Truncate(0); err != nil {
+		return err
+	}
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if err := writer.Write(append(row, make([]string, len(header)-len(row))...)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -20,192 +20,364 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
 // SOFTWARE.
 
-//nolint:deadcode,unused
 package manager
 
 import (
+	"encoding/csv"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
 
-	log "github.com/sirupsen/logrus"
-
-	"errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
 )
 
-/*
-func TestSingleClient(t *testing.T) {
-	log.SetFormatter(&log.TextFormatter{
-		TimestampFormat: ctrdlog.RFC3339NanoFixed,
-		FullTimestamp:   true,
-	})
-	var (
-		uffd            int
-		region          []byte
-		regionSize      int    = 4 * os.Getpagesize()
-		uffdFileName    string = "/tmp/uffd_file.file"
-		guestMemoryPath        = "/tmp/guest_mem"
-		vmID            string = "1"
-	)
-
-	log.SetLevel(log.DebugLevel)
-
-	prepareGuestMemoryFile(guestMemoryPath, regionSize)
-
-	region, err := unix.Mmap(-1, 0, regionSize, unix.PROT_READ, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
-	if err != nil {
-		log.Errorf("Failed to mmap: %v", err)
-	}
-
-	defer unix.Munmap(region)
-
-	uffd = registerForUpf(region, uint64(regionSize))
-
-	uffdFile := os.NewFile(uintptr(uffd), uffdFileName)
+// fakeGuestMemBase The address of the guest memory in the VMM, as the fake uffd sees it
+const fakeGuestMemBase = 0x7f0000000000
+
+// testVM A VM served by the manager, whose guest memory is a fake uffd
+type testVM struct {
+	cfg SnapshotStateCfg
+	mem []byte // the guest memory file
+	// the uffd of the current activation
+	uffd *fakeUFFD
+	// setup Prepares the uffd of each activation, e.g., injects the errors
+	setup func(f *fakeUFFD)
+}
 
-	managerCfg := MemoryManagerCfg{}
-	manager := NewMemoryManager(managerCfg)
+// newTestVM Registers a VM with the guest memory of numPages pages, where the first byte
+// of the i-th page is i+1, except for the zero pages
+func newTestVM(t *testing.T, m *MemoryManager, cfg SnapshotStateCfg, numPages int, zeroPages ...int) *testVM {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
 
-	stateCfg := SnapshotStateCfg{
-		VMID:         vmID,
-		BaseDir:      "/tmp/snap_base",
-		GuestMemPath: guestMemoryPath,
-		GuestMemSize: regionSize,
+	vm := &testVM{cfg: cfg, mem: make([]byte, numPages*pageSize)}
+	for i := 0; i < numPages; i++ {
+		vm.mem[i*pageSize] = byte(i + 1)
+	}
+	for _, i := range zeroPages {
+		vm.mem[i*pageSize] = 0
 	}
 
-	err = manager.RegisterVM(stateCfg)
-	require.NoError(t, err, "Failed to register VM")
-
-	err = manager.Activate(vmID, uffdFile)
-	require.NoError(t, err, "Failed to add VM")
-
-	err = validateGuestMemory(region)
-	require.NoError(t, err, "Failed to validate guest memory")
+	vm.cfg.GuestMemPath = filepath.Join(dir, "guest_mem")
+	vm.cfg.VMMStatePath = filepath.Join(dir, "vmm_state")
+	vm.cfg.WorkingSetPath = filepath.Join(dir, "ws")
+	vm.cfg.GuestMemSize = len(vm.mem)
 
-	err = manager.Deactivate(vmID)
-	require.NoError(t, err, "Failed to remove intance")
+	require.NoError(t, os.WriteFile(vm.cfg.GuestMemPath, vm.mem, 0644))
+	require.NoError(t, os.WriteFile(vm.cfg.VMMStatePath, []byte("state"), 0644))
+	vm.register(t, m)
 
-	err = manager.DeregisterVM(vmID)
-	require.NoError(t, err, "Failed to deregister vm")
+	return vm
 }
 
-func TestParallelClients(t *testing.T) {
-	numParallel := 1000
+// register Registers the VM, whose snapshot files exist already
+func (vm *testVM) register(t *testing.T, m *MemoryManager) {
+	vm.cfg.openUFFD = func(string) (userFaultFD, []byte, error) {
+		vm.uffd = newFakeUFFD(t, fakeGuestMemBase, len(vm.mem)/os.Getpagesize())
+		if vm.setup != nil {
+			vm.setup(vm.uffd)
+		}
+		return vm.uffd, vm.uffd.layout(), nil
+	}
 
-	log.SetFormatter(&log.TextFormatter{
-		TimestampFormat: ctrdlog.RFC3339NanoFixed,
-		FullTimestamp:   true,
-	})
-	var (
-		regionSize int = 4 * os.Getpagesize()
-		err        error
-	)
+	require.NoError(t, m.RegisterVM(vm.cfg), "Failed to register VM")
+}
 
-	log.SetLevel(log.DebugLevel)
+// activate Loads the VM and touches the pages, as the guest would
+func (vm *testVM) activate(t *testing.T, m *MemoryManager, pages ...int) {
+	require.NoError(t, m.FetchState(vm.cfg.VMID), "Failed to fetch state")
+	require.NoError(t, m.Activate(vm.cfg.VMID), "Failed to activate VM")
 
-	clients := make(map[int]*upfClient)
+	for _, page := range pages {
+		vm.touch(t, page, false)
+	}
+}
 
-	for i := 0; i < numParallel; i++ {
-		vmID := fmt.Sprintf("%d", i)
-		guestMemoryPath := "/tmp/guest_mem_" + vmID
+// touch Reads or writes the page and checks its contents
+func (vm *testVM) touch(t *testing.T, page int, write bool) {
+	pageSize := os.Getpagesize()
 
-		prepareGuestMemoryFile(guestMemoryPath, regionSize)
+	require.Equal(t, vm.mem[page*pageSize:(page+1)*pageSize], vm.uffd.touch(t, page, write),
+		"Incorrect contents of page %d", page)
+}
 
-		region, err := unix.Mmap(-1, 0, regionSize, unix.PROT_READ, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
-		if err != nil {
-			log.Errorf("Failed to mmap: %v", err)
+func TestRecordReplay(t *testing.T) {
+	for _, noZeroPage := range []bool{false, true} {
+		for _, compress := range []bool{false, true} {
+			t.Run(fmt.Sprintf("noZeroPage=%t,compress=%t", noZeroPage, compress), func(t *testing.T) {
+				testRecordReplay(t, noZeroPage, compress)
+			})
 		}
-		defer unix.Munmap(region)
-
-		uffd := registerForUpf(region, uint64(regionSize))
-		uffdFileName := fmt.Sprintf("file_%s", vmID)
-		uffdFile := os.NewFile(uintptr(uffd), uffdFileName)
-
-		clients[i] = initClient(uffd, region, uffdFileName, guestMemoryPath, vmID, uffdFile)
 	}
+}
 
-	managerCfg := MemoryManagerCfg{}
-	manager := NewMemoryManager(managerCfg)
+func testRecordReplay(t *testing.T, noZeroPage, compress bool) {
+	m := NewMemoryManager(MemoryManagerCfg{MetricsModeOn: true, CompressWorkingSet: compress})
+	vm := newTestVM(t, m, SnapshotStateCfg{VMID: "1"}, 8, 3)
+	vm.setup = func(f *fakeUFFD) { f.noZeroPage = noZeroPage }
+
+	vm.activate(t, m, 1, 3, 5)
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
+
+	info, err := m.GetVMInfo("1")
+	require.NoError(t, err)
+	require.Equal(t, ReplayMode, info.Mode)
+	require.Equal(t, 3, info.TraceLen)
+
+	// the faulting page is installed right away, the rest of the working set in the background
+	vm.activate(t, m, 1)
+	vm.uffd.waitPresent(t, 3, 5)
+	vm.touch(t, 3, false)
+	vm.touch(t, 5, false)
+	// missing from the working set
+	vm.touch(t, 7, false)
+
+	info, err = m.GetVMInfo("1")
+	require.NoError(t, err)
+	require.Equal(t, FaultCounters{Served: 2, Missed: 1, TraceFaults: 1, Prefetched: 2, ZeroPages: 1}, info.Faults)
+
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
+	require.Equal(t, 0, vm.uffd.numCalls(opWriteProtect), "Dirty pages are not tracked")
+
+	stats, err := m.GetUPFLatencyStats("1")
+	require.NoError(t, err)
+	require.Len(t, stats, 1, "Only the replay is measured")
+	require.Contains(t, stats[0].MetricMap, installWSMetric)
+	require.Contains(t, stats[0].MetricMap, fetchWSMetric)
+	require.Contains(t, stats[0].MetricMap, decompressWSMetric)
+
+	statsPath := filepath.Join(t.TempDir(), "stats.csv")
+	require.NoError(t, m.DumpUPFPageStats("1", "fn", statsPath))
+
+	rows := readStats(t, statsPath)
+	require.Len(t, rows, 2)
+	require.Equal(t, []string{"FuncName", "RecPages", "RecRegions", "Unique", "StdDev"}, rows[0][:5],
+		"The original columns must come first")
+
+	stat := make(map[string]string)
+	for i, name := range rows[0] {
+		if _, ok := stat[name]; !ok {
+			stat[name] = rows[1][i]
+		}
+	}
+	require.Equal(t, "3", stat["RecPages"])
+	require.Equal(t, "1", stat["Unique"])
+	require.Equal(t, "1", stat["ZeroPages"])
+	require.Equal(t, "1", stat["ZeroInstalls"])
+	require.Equal(t, "2", stat["Avoided"])
+	require.Equal(t, "1", stat["TraceFaults"])
+	// it is unknown whether the pages installed in the background are used
+	require.Empty(t, stat["Precision"], "The precision is not measured ahead of the guest")
+	require.Equal(t, "0.750", stat["Recall"])
+	require.Equal(t, strconv.Itoa(2*os.Getpagesize()), stat["WSBytes"])
+	if compress {
+		require.Less(t, stat["StoredWSBytes"], stat["WSBytes"], "Mostly zero pages must compress")
+	} else {
+		require.Equal(t, stat["WSBytes"], stat["StoredWSBytes"])
+	}
 
-	var wg sync.WaitGroup
+	require.NoError(t, m.DeregisterVM("1"), "Failed to deregister VM")
+}
 
-	for i := 0; i < numParallel; i++ {
-		c := clients[i]
-		stateCfg := SnapshotStateCfg{
-			VMID:         c.vmID,
-			BaseDir:      "/tmp/snap_base",
-			GuestMemPath: c.guestMemoryPath,
-			GuestMemSize: regionSize,
-		}
+func TestSharedWorkingSet(t *testing.T) {
+	m := NewMemoryManager(MemoryManagerCfg{MissThreshold: 1, MissWindow: 1})
+	golden := newTestVM(t, m, SnapshotStateCfg{VMID: "1"}, 8)
+
+	golden.activate(t, m, 1, 3, 5)
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
+	require.NoError(t, m.DeregisterVM("1"), "Failed to deregister VM")
+
+	shared, err := os.ReadFile(golden.cfg.WorkingSetPath)
+	require.NoError(t, err)
+
+	// the clones of the snapshot are loaded, e.g., after the orchestrator restarted
+	clone := &testVM{cfg: golden.cfg, mem: golden.mem}
+	clone.cfg.VMID = "2"
+	clone.cfg.WorkingSetPath = filepath.Join(t.TempDir(), "ws")
+	clone.cfg.SharedWorkingSetPath = golden.cfg.WorkingSetPath
+	clone.register(t, m)
+
+	info, err := m.GetVMInfo("2")
+	require.NoError(t, err)
+	require.Equal(t, ReplayMode, info.Mode, "The first load must replay the shared working set")
+	require.Equal(t, 3, info.TraceLen)
+
+	clone.activate(t, m, 1)
+	clone.uffd.waitPresent(t, 3, 5)
+	clone.touch(t, 6, false)
+	clone.touch(t, 7, false)
+	require.NoError(t, m.Deactivate("2"), "Failed to deactivate VM")
+
+	// the misses are merged into the working set of the clone
+	require.FileExists(t, clone.cfg.WorkingSetPath)
+	after, err := os.ReadFile(golden.cfg.WorkingSetPath)
+	require.NoError(t, err)
+	require.Equal(t, shared, after, "The shared working set must only be read")
+
+	clone.activate(t, m, 6)
+	clone.uffd.waitPresent(t, 1, 3, 5, 7)
+	require.NoError(t, m.Deactivate("2"), "Failed to deactivate VM")
+	require.NoError(t, m.DeregisterVM("2"), "Failed to deregister VM")
+}
 
-		wg.Add(1)
+// readStats Reads the rows of the page stats file
+func readStats(t *testing.T, path string) [][]string {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
 
-		go func() {
-			defer wg.Done()
+	rows, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
 
-			err = manager.RegisterVM(stateCfg)
-			require.NoError(t, err, "Failed to register VM")
+	return rows
+}
 
-			err = manager.Activate(c.vmID, c.uffdFile)
-			require.NoError(t, err, "Failed to add VM")
+func TestLazyMode(t *testing.T) {
+	m := NewMemoryManager(MemoryManagerCfg{MetricsModeOn: true, MissThreshold: 1, MissWindow: 1})
+	vm := newTestVM(t, m, SnapshotStateCfg{VMID: "1", IsLazyMode: true}, 8)
+
+	vm.activate(t, m, 1, 2, 3)
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
+
+	vm.activate(t, m, 2, 3, 4)
+	require.False(t, vm.uffd.isPresent(1), "The lazy mode does not prefetch")
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
+
+	state := m.instances["1"]
+	require.Equal(t, []float64{3}, state.totalPFServed)
+	require.Equal(t, []float64{1}, state.uniquePFServed)
+	require.Equal(t, []float64{2}, state.reusedPFServed)
+	require.InDeltaSlice(t, []float64{2. / 3}, state.precision, 1e-9)
+	require.InDeltaSlice(t, []float64{2. / 3}, state.recall, 1e-9)
+
+	statsPath := filepath.Join(t.TempDir(), "stats.csv")
+	require.NoError(t, m.DumpUPFPageStats("1", "fn", statsPath))
+	rows := readStats(t, statsPath)
+	require.Equal(t, "Precision", rows[0][8])
+	require.Equal(t, "0.667", rows[1][8], "The unused page of the trace must lower the precision")
+
+	// the lazy mode serves no working set, so the misses are not merged into the trace
+	vm.activate(t, m, 4, 5, 6)
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
+	require.Len(t, state.trace.trace, 3)
+}
 
-			err = validateGuestMemory(c.region)
-			require.NoError(t, err, "Failed to validate guest memory")
+func TestInstallRetry(t *testing.T) {
+	m := NewMemoryManager(MemoryManagerCfg{})
+	vm := newTestVM(t, m, SnapshotStateCfg{VMID: "1"}, 8, 3)
 
-			err = manager.Deactivate(c.vmID)
-			require.NoError(t, err, "Failed to remove intance")
+	// the page is installed by another thread, the faulting one is only woken up
+	vm.setup = func(f *fakeUFFD) { f.inject(opCopy, unix.EEXIST) }
+	vm.activate(t, m, 1, 3, 5)
+	require.Equal(t, 4, vm.uffd.numCalls(opCopy), "The faulting thread must refault")
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
 
-			err = manager.DeregisterVM(c.vmID)
-			require.NoError(t, err, "Failed to deregister vm")
-		}()
+	// the layout of the guest memory is changing while the working set is installed
+	vm.setup = func(f *fakeUFFD) { f.inject(opZeroPage, unix.EAGAIN, unix.EAGAIN) }
+	vm.activate(t, m, 1)
+	vm.uffd.waitPresent(t, 3, 5)
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
 
-	}
+	require.Equal(t, 3, vm.uffd.numCalls(opZeroPage))
 
-	wg.Wait()
+	info, err := m.GetVMInfo("1")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), info.Faults.ZeroPages)
 }
-*/
-
-func prepareGuestMemoryFile(guestFileName string, size int) {
-	toWrite := make([]byte, size)
-	pages := size / os.Getpagesize()
-	for i := 0; i < pages; i++ {
-		for j := os.Getpagesize() * i; j < (i+1)*os.Getpagesize(); j++ {
-			toWrite[j] = byte(48 + i)
-		}
-	}
 
-	err := os.WriteFile(guestFileName, toWrite, 0777)
-	if err != nil {
-		panic(err)
-	}
+func TestFailWhileActive(t *testing.T) {
+	m := NewMemoryManager(MemoryManagerCfg{})
+	vm := newTestVM(t, m, SnapshotStateCfg{VMID: "1"}, 8)
+
+	vm.setup = func(f *fakeUFFD) { f.inject(opCopy, unix.EIO) }
+	vm.activate(t, m)
+
+	vm.uffd.sendPageFault(t, 2, 0)
+	state := m.instances["1"]
+	require.Eventually(t, func() bool { return state.err() != nil }, time.Second, time.Millisecond,
+		"The VM must fail")
+	require.False(t, vm.uffd.isPresent(2))
+
+	err := m.Deactivate("1")
+	require.ErrorIs(t, err, unix.EIO)
+	require.Contains(t, err.Error(), "VM failed while active")
+
+	info, err := m.GetVMInfo("1")
+	require.NoError(t, err)
+	require.Equal(t, RecordMode, info.Mode, "The incomplete record must be dropped")
+	require.Zero(t, info.TraceLen)
+
+	// the VM is recorded anew
+	vm.setup = nil
+	vm.activate(t, m, 2)
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
+
+	info, err = m.GetVMInfo("1")
+	require.NoError(t, err)
+	require.Equal(t, ReplayMode, info.Mode)
+	require.Equal(t, 1, info.TraceLen)
 }
 
-func validateGuestMemory(guestMem []byte) error {
-	pages := len(guestMem) / os.Getpagesize()
-	for i := 0; i < pages; i++ {
-		log.Debugf("Validating page %d's contents...\n", i)
-		j := os.Getpagesize() * i
-		if guestMem[j] != byte(48+i) {
-			return errors.New("Incorrect guest memory")
-		}
-	}
-	return nil
+func TestTrackDirtyPages(t *testing.T) {
+	pageSize := uint64(os.Getpagesize())
+
+	m := NewMemoryManager(MemoryManagerCfg{TrackDirtyPages: true})
+	vm := newTestVM(t, m, SnapshotStateCfg{VMID: "1"}, 8)
+
+	vm.activate(t, m)
+	vm.touch(t, 1, false)
+	vm.touch(t, 1, true)  // write-protect fault
+	vm.touch(t, 2, true)  // missing page fault on write
+	vm.touch(t, 3, false) // stays clean
+	require.True(t, vm.uffd.isWriteProtected(3), "Clean pages must stay write-protected")
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
+
+	dirty, err := m.GetDirtyPages("1")
+	require.NoError(t, err)
+	require.Equal(t, []uint64{1 * pageSize, 2 * pageSize}, dirty)
+
+	// the kernel does not support the write-protect faults
+	vm.setup = func(f *fakeUFFD) { f.noWriteProtect = true }
+	vm.activate(t, m, 1)
+	vm.touch(t, 2, true)
+	require.False(t, vm.uffd.isWriteProtected(1), "Pages cannot be write-protected")
+	require.NoError(t, m.Deactivate("1"), "Failed to deactivate VM")
+
+	_, err = m.GetDirtyPages("1")
+	require.Error(t, err, "Dirty pages were not tracked")
 }
 
-type upfClient struct {
-	uffd                                int
-	region                              []byte
-	uffdFileName, guestMemoryPath, vmID string
-	uffdFile                            *os.File
-}
+func TestPageStatsHeader(t *testing.T) {
+	header := []string{"FuncName", "RecPages", "New", "StdDev"}
+	stats := []string{"fn", "3", "1", "0.0"}
+
+	statsPath := filepath.Join(t.TempDir(), "stats.csv")
+	require.NoError(t, os.WriteFile(statsPath, []byte("FuncName,RecPages\nfn,2\n"), 0644))
+
+	// a file written with the original header is rewritten with the new columns
+	require.NoError(t, writeUPFPageStats(statsPath, header, stats))
+
+	data, err := os.ReadFile(statsPath)
+	require.NoError(t, err)
+	require.Equal(t, "FuncName,RecPages,New,StdDev\nfn,2,,\nfn,3,1,0.0\n", string(data))
+
+	require.NoError(t, writeUPFPageStats(statsPath, header, stats))
+
+	data, err = os.ReadFile(statsPath)
+	require.NoError(t, err)
+	require.Equal(t, "FuncName,RecPages,New,StdDev\nfn,2,,\nfn,3,1,0.0\nfn,3,1,0.0\n", string(data))
 
-func initClient(uffd int, region []byte, uffdFileName, guestMemoryPath, vmID string, uffdFile *os.File) *upfClient {
-	c := new(upfClient)
+	require.Error(t, writeUPFPageStats(statsPath, []string{"FuncName", "Unique"}, stats[:2]),
+		"Stats must not be appended under a different header")
 
-	c.uffd = uffd
-	c.region = region
-	c.uffdFileName = uffdFileName
-	c.guestMemoryPath = guestMemoryPath
-	c.vmID = vmID
-	c.uffdFile = uffdFile
+	statsPath = filepath.Join(t.TempDir(), "stats.csv")
+	require.NoError(t, writeUPFPageStats(statsPath, header, stats))
 
-	return c
+	data, err = os.ReadFile(statsPath)
+	require.NoError(t, err)
+	require.Equal(t, "FuncName,RecPages,New,StdDev\nfn,3,1,0.0\n", string(data))
 }
@@ -0,0 +1,248 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"google.golang.org/grpc"
+
+	"github.com/vhive-serverless/vhive/memory/pageserver"
+	pb "github.com/vhive-serverless/vhive/memory/pageserver/proto"
+)
+
+const (
+	defaultBatchPages = 32
+	remoteTimeout     = 10 * time.Second
+)
+
+// PageSource Provides the pages of the guest memory file of a VM
+type PageSource interface {
+	io.ReaderAt
+	// Pages Returns the pages at the offset in the guest memory file, contiguous and aligned
+	// in memory, so that they can be installed with UFFDIO_COPY. They stay valid until the source is closed.
+	Pages(offset uint64, numPages int) ([]byte, error)
+	Close() error
+}
+
+// PageSourceFactory Opens the page source of a VM, once per activation
+type PageSourceFactory func(cfg SnapshotStateCfg) (PageSource, error)
+
+// fileSource Maps the guest memory file from the local disk
+type fileSource struct {
+	mem []byte
+}
+
+// OpenFileSource Maps the guest memory file of the VM, the default page source
+func OpenFileSource(cfg SnapshotStateCfg) (PageSource, error) {
+	f, err := os.OpenFile(cfg.GuestMemPath, os.O_RDONLY, 0444)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil {
+		return nil, err
+	} else if info.Size() < int64(cfg.GuestMemSize) {
+		return nil, fmt.Errorf("guest memory file of %d bytes, expected %d", info.Size(), cfg.GuestMemSize)
+	}
+
+	mem, err := unix.Mmap(int(f.Fd()), 0, cfg.GuestMemSize, unix.PROT_READ, unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSource{mem: mem}, nil
+}
+
+func (s *fileSource) Pages(offset uint64, numPages int) ([]byte, error) {
+	size := uint64(numPages * os.Getpagesize())
+	if offset%uint64(os.Getpagesize()) != 0 || offset+size > uint64(len(s.mem)) {
+		return nil, fmt.Errorf("%d pages at offset %#x are out of the guest memory", numPages, offset)
+	}
+
+	return s.mem[offset : offset+size], nil
+}
+
+func (s *fileSource) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= int64(len(s.mem)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, s.mem[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (s *fileSource) Close() error {
+	return unix.Munmap(s.mem)
+}
+
+// remoteSource Fetches the pages from a page server in batches of the consecutive pages,
+// and caches them for the activation
+type remoteSource struct {
+	client     pb.PageServerClient
+	snapshot   string
+	batchPages int
+	vmID       string
+
+	sync.Mutex
+	cache  []byte // anonymous mapping of the size of the guest memory, populated on demand
+	cached []bool // per page
+
+	// Stats
+	hits, fetched int
+}
+
+// NewRemoteSourceFactory Returns the factory of the page sources that fetch the pages
+// from the page server at the address. snapshot names the guest memory file of the VM
+// on the page server.
+func NewRemoteSourceFactory(addr string, snapshot func(cfg SnapshotStateCfg) string) (PageSourceFactory, error) {
+	// the connection is shared by all VMs and connects in the background
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial the page server: %w", err)
+	}
+
+	client := pb.NewPageServerClient(conn)
+
+	return func(cfg SnapshotStateCfg) (PageSource, error) {
+		cache, err := unix.Mmap(-1, 0, cfg.GuestMemSize, unix.PROT_READ|unix.PROT_WRITE,
+			unix.MAP_PRIVATE|unix.MAP_ANONYMOUS|unix.MAP_NORESERVE)
+		if err != nil {
+			return nil, err
+		}
+
+		return &remoteSource{
+			client:     client,
+			snapshot:   snapshot(cfg),
+			batchPages: defaultBatchPages,
+			vmID:       cfg.VMID,
+			cache:      cache,
+			cached:     make([]bool, cfg.GuestMemSize/os.Getpagesize()),
+		}, nil
+	}, nil
+}
+
+func (s *remoteSource) Pages(offset uint64, numPages int) ([]byte, error) {
+	pageSize := os.Getpagesize()
+	size := uint64(numPages * pageSize)
+	if offset%uint64(pageSize) != 0 || offset+size > uint64(len(s.cache)) {
+		return nil, fmt.Errorf("%d pages at offset %#x are out of the guest memory", numPages, offset)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	first := int(offset) / pageSize
+	for page := first; page < first+numPages; page++ {
+		if s.cached[page] {
+			s.hits++
+		} else if err := s.fetch(page, first+numPages-page); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.cache[offset : offset+size], nil
+}
+
+// fetch Fetches the wanted pages starting from the page, or the batch of the following pages
+// if fewer are wanted, stopping at the first cached page
+func (s *remoteSource) fetch(page, want int) error {
+	pageSize := os.Getpagesize()
+
+	if want < s.batchPages {
+		want = s.batchPages
+	}
+	if maxPages := pageserver.MaxBatchSize / pageSize; want > maxPages {
+		want = maxPages
+	}
+
+	n := 1
+	for n < want && page+n < len(s.cached) && !s.cached[page+n] {
+		n++
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), remoteTimeout)
+	defer cancel()
+
+	resp, err := s.client.ReadPages(ctx, &pb.ReadPagesReq{
+		Snapshot: s.snapshot,
+		Ranges:   []*pb.Range{{Offset: uint64(page * pageSize), Length: uint64(n * pageSize)}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch %d pages at offset %#x: %w", n, page*pageSize, err)
+	}
+
+	if len(resp.GetData()) != n*pageSize {
+		return fmt.Errorf("page server returned %d bytes, expected %d", len(resp.GetData()), n*pageSize)
+	}
+
+	copy(s.cache[page*pageSize:], resp.GetData())
+	for i := page; i < page+n; i++ {
+		s.cached[i] = true
+	}
+	s.fetched += n
+
+	return nil
+}
+
+func (s *remoteSource) ReadAt(p []byte, off int64) (int, error) {
+	pageSize := int64(os.Getpagesize())
+
+	var n int
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= int64(len(s.cache)) {
+			return n, io.EOF
+		}
+
+		page, err := s.Pages(uint64(pos-pos%pageSize), 1)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], page[pos%pageSize:])
+	}
+
+	return n, nil
+}
+
+func (s *remoteSource) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	log.WithFields(log.Fields{"vmID": s.vmID}).Debugf("Fetched %d pages from the page server, %d pages served from the cache",
+		s.fetched, s.hits)
+
+	return unix.Munmap(s.cache)
+}
@@ -0,0 +1,85 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vhive-serverless/vhive/memory/pageserver"
+)
+
+func TestRemoteSource(t *testing.T) {
+	root := t.TempDir()
+	pageSize := os.Getpagesize()
+	numPages := 2 * defaultBatchPages
+
+	guestMemPath := filepath.Join(root, "vm1", "mem_file")
+	require.NoError(t, os.MkdirAll(filepath.Dir(guestMemPath), 0755))
+	prepareGuestMem(t, guestMemPath, numPages)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go pageserver.Serve(lis, root)
+
+	factory, err := NewRemoteSourceFactory(lis.Addr().String(), func(cfg SnapshotStateCfg) string {
+		rel, _ := filepath.Rel(root, cfg.GuestMemPath)
+		return rel
+	})
+	require.NoError(t, err)
+
+	src, err := factory(SnapshotStateCfg{VMID: "1", GuestMemPath: guestMemPath, GuestMemSize: numPages * pageSize})
+	require.NoError(t, err, "Failed to open the remote source")
+	defer src.Close()
+	remote := src.(*remoteSource)
+
+	page, err := src.Pages(uint64(3*pageSize), 1)
+	require.NoError(t, err, "Failed to fetch a page")
+	require.Equal(t, byte(4), page[0])
+	require.Equal(t, defaultBatchPages, remote.fetched, "The following pages must be fetched in a batch")
+
+	page, err = src.Pages(uint64(4*pageSize), 1)
+	require.NoError(t, err)
+	require.Equal(t, byte(5), page[0])
+	require.Equal(t, 1, remote.hits, "The page must be served from the cache")
+
+	// the pages before the batch and after it are fetched, so that they are contiguous
+	pages, err := src.Pages(0, numPages)
+	require.NoError(t, err)
+	for i := 0; i < numPages; i++ {
+		require.Equal(t, byte(i+1), pages[i*pageSize])
+	}
+	require.Equal(t, numPages, remote.fetched)
+
+	buf := make([]byte, 2)
+	_, err = src.ReadAt(buf, int64(2*pageSize-1))
+	require.NoError(t, err)
+	require.Equal(t, []byte{0, 3}, buf, "Read must span the pages")
+
+	_, err = src.Pages(uint64(numPages*pageSize), 1)
+	require.Error(t, err, "Page out of the guest memory must fail")
+}
@@ -22,45 +22,57 @@
 
 package manager
 
-/*
-#include "user_page_faults.h"
-*/
-import "C"
-
 import (
-	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"net"
+	"math"
 	"os"
-	"path/filepath"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unsafe"
 
-	"github.com/ftrvxmtrx/fd"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 
+	"github.com/vhive-serverless/vhive/memory/wsfile"
 	"github.com/vhive-serverless/vhive/metrics"
-
-	"unsafe"
 )
 
+// defaultMissWindow Number of the last activations over which the misses
+// of the working set are averaged
+const defaultMissWindow = 5
+
 // SnapshotStateCfg Config to initialize SnapshotState
 type SnapshotStateCfg struct {
 	VMID string
 
 	VMMStatePath, GuestMemPath, WorkingSetPath string
+	// working set of the snapshot that the VM shares with other VMs, only read,
+	// replayed if the VM has no working set file of its own
+	SharedWorkingSetPath string
 
 	InstanceSockAddr string
 	BaseDir          string // base directory for the instance
 	MetricsPath      string // path to csv file where the metrics should be stored
 	IsLazyMode       bool
+	IsHybridMode     bool // prefetches the trace from the guest memory file, ignored in the lazy mode
 	GuestMemSize     int
 	metricsModeOn    bool
+	workers          int // goroutines that fetch and install the working set
+	chunkSize        int // in bytes, the working set is fetched and installed in chunks
+	missThreshold    int // misses per activation over the window that trigger a merge, 0 disables
+	missWindow       int // activations
+	numRecordings    int // invocations recorded to build the working set
+	pageFrequency    float64
+	pageSource       PageSourceFactory
+	openUFFD         uffdOpener // receives the uffd from the VMM
+	trackDirty       bool       // registers the guest memory for the write-protect faults
+	compressWS       bool       // compresses the working set file in chunks of chunkSize
+	checksumWS       bool       // stores the checksums of the pages in the working set file
 }
 
 // SnapshotState Stores the state of the snapshot
@@ -68,11 +80,20 @@ type SnapshotStateCfg struct {
 type SnapshotState struct {
 	SnapshotStateCfg
 	firstPageFaultOnce *sync.Once // to initialize the start virtual address and replay
-	startAddress       uint64
-	userFaultFD        *os.File
+	firstFaultTime     time.Time
+	userFaultFD        userFaultFD
 	trace              *Trace
 	epfd               int
-	quitCh             chan int
+	quitFd             int           // eventfd to stop polling
+	pollDone           chan struct{} // closed when the polling stops
+
+	// the first error that broke serving the VM, the VM cannot run any further
+	failMu  sync.Mutex
+	failure error
+
+	// held while the VM is activated or deactivated, so that the introspection
+	// sees a consistent state of the VM
+	statusMu sync.Mutex
 
 	// to indicate whether the instance has even been activated. this is to
 	// get around cases where offload is called for the first time
@@ -81,19 +102,48 @@ type SnapshotState struct {
 	isActive bool
 
 	isRecordReady bool
+	recorded      [][]Record // traces of the recorded invocations, until numRecordings are recorded
 
-	guestMem   []byte
+	// the guest memory is registered for the write-protect faults in the current activation
+	isTrackingDirty bool
+	dirty           map[uint64]struct{} // offsets of the pages written in the current activation
+	dirtyPages      []uint64            // of the last activation, sorted, nil if not tracked
+
+	guestMem   *guestMemory
+	pages      PageSource // of the guest memory file, open while active
 	workingSet []byte
+	wsPath     string             // the working set file that is fetched, the VM's own or the shared one
+	wsMeta     *wsfile.WorkingSet // the layout of the working set file
+	pipeline   *wsPipeline        // fetches the working set of the current activation
+	installWG  sync.WaitGroup     // for the background install of the working set
+
+	// the pages served upon page faults that are missing from the trace
+	misses      []Record   // of the current activation
+	missHistory [][]Record // of the last activations, up to missWindow
 
 	// Stats
 	totalPFServed  []float64
 	uniquePFServed []float64
 	reusedPFServed []float64
+	zeroPFServed   []float64
+	avoidedPF      []float64
+	traceFaults    []float64
+	precision      []float64 // of the trace as the prefetch set, only measured in the lazy mode
+	recall         []float64
 	latencyMetrics []*metrics.Metric
 
-	replayedNum   int // only valid for lazy serving
-	uniqueNum     int
-	currentMetric *metrics.Metric
+	// Counters of the current activation, atomic
+	servedNum       int64 // page faults served
+	dirtyNum        int64 // pages written
+	replayedNum     int64 // only valid for lazy serving
+	uniqueNum       int64
+	zeroNum         int64 // zero pages of the working set installed
+	prefetchedNum   int64 // pages of the working set installed in the background
+	traceFaultNum   int64 // page faults on the pages of the working set before they are installed
+	installWSBgTime time.Duration
+	currentMetric   *metrics.Metric
+
+	faultLatency [numFaultKinds]latencyHistogram // since the VM is registered
 }
 
 // NewSnapshotState Initializes a snapshot state
@@ -101,11 +151,35 @@ func NewSnapshotState(cfg SnapshotStateCfg) *SnapshotState {
 	s := new(SnapshotState)
 	s.SnapshotStateCfg = cfg
 
-	s.trace = initTrace(s.getTraceFile())
+	s.trace = initTrace()
+	s.wsPath = s.WorkingSetPath
+	if s.workers <= 0 {
+		s.workers = defaultWorkers
+	}
+	if s.chunkSize <= 0 {
+		s.chunkSize = defaultChunkSize
+	}
+	if s.missWindow <= 0 {
+		s.missWindow = defaultMissWindow
+	}
+	if s.numRecordings <= 0 {
+		s.numRecordings = 1
+	}
+	if s.pageSource == nil {
+		s.pageSource = OpenFileSource
+	}
+	if s.openUFFD == nil {
+		s.openUFFD = dialUFFD
+	}
 	if s.metricsModeOn {
 		s.totalPFServed = make([]float64, 0)
 		s.uniquePFServed = make([]float64, 0)
 		s.reusedPFServed = make([]float64, 0)
+		s.zeroPFServed = make([]float64, 0)
+		s.avoidedPF = make([]float64, 0)
+		s.traceFaults = make([]float64, 0)
+		s.precision = make([]float64, 0)
+		s.recall = make([]float64, 0)
 		s.latencyMetrics = make([]*metrics.Metric, 0)
 	}
 
@@ -116,45 +190,44 @@ func (s *SnapshotState) setupStateOnActivate() {
 	s.isActive = true
 	s.isEverActivated = true
 	s.firstPageFaultOnce = new(sync.Once)
-	s.quitCh = make(chan int)
+	s.pollDone = make(chan struct{})
+	s.failure = nil
+	s.misses = nil
+	s.isTrackingDirty = false
+	s.dirty = nil
+	if s.trackDirty {
+		s.dirty = make(map[uint64]struct{})
+	}
+
+	atomic.StoreInt64(&s.servedNum, 0)
+	atomic.StoreInt64(&s.dirtyNum, 0)
+	atomic.StoreInt64(&s.uniqueNum, 0)
+	atomic.StoreInt64(&s.zeroNum, 0)
+	atomic.StoreInt64(&s.prefetchedNum, 0)
+	atomic.StoreInt64(&s.traceFaultNum, 0)
+	atomic.StoreInt64(&s.replayedNum, 0)
 
 	if s.metricsModeOn {
-		s.uniqueNum = 0
-		s.replayedNum = 0
 		s.currentMetric = metrics.NewMetric()
 	}
 }
 
 func (s *SnapshotState) getUFFD() error {
-	var d net.Dialer
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
-
-	for {
-		c, err := d.DialContext(ctx, "unix", s.InstanceSockAddr)
-		if err != nil {
-			if ctx.Err() != nil {
-				log.Error("Failed to dial within the context timeout")
-				return err
-			}
-			time.Sleep(1 * time.Millisecond)
-			continue
-		}
-
-		defer c.Close()
-
-		sendfdConn := c.(*net.UnixConn)
+	uffd, handshake, err := s.openUFFD(s.InstanceSockAddr)
+	if err != nil {
+		return err
+	}
 
-		fs, err := fd.Get(sendfdConn, 1, []string{"a file"})
-		if err != nil {
-			log.Error("Failed to receive the uffd")
-			return err
-		}
+	s.guestMem, err = newGuestMemory(handshake, s.GuestMemSize)
+	if err != nil {
+		uffd.Close()
+		log.Errorf("Invalid guest memory layout: %v", err)
+		return err
+	}
 
-		s.userFaultFD = fs[0]
+	s.userFaultFD = uffd
 
-		return nil
-	}
+	return nil
 }
 
 func (s *SnapshotState) processMetrics() {
@@ -169,35 +242,214 @@ func (s *SnapshotState) processMetrics() {
 			)
 		}
 
+		s.processPrefetchMetrics()
+
+		if !s.IsLazyMode {
+			s.zeroPFServed = append(s.zeroPFServed, float64(s.zeroNum))
+			// the guest does not fault on the pages installed in the background
+			s.avoidedPF = append(s.avoidedPF, float64(s.prefetchedNum))
+			s.traceFaults = append(s.traceFaults, float64(s.traceFaultNum))
+			s.currentMetric.MetricMap[installWSBgMetric] = metrics.ToUS(s.installWSBgTime)
+			if s.pipeline != nil {
+				s.currentMetric.MetricMap[fetchWSMetric] = metrics.ToUS(s.pipeline.fetchTime)
+				s.currentMetric.MetricMap[fetchWaitMetric] = metrics.ToUS(time.Duration(s.pipeline.fetchWait))
+				s.currentMetric.MetricMap[decompressWSMetric] = metrics.ToUS(time.Duration(s.pipeline.decompressTime))
+			}
+		}
+
 		s.latencyMetrics = append(s.latencyMetrics, s.currentMetric)
 	}
 }
 
-func (s *SnapshotState) getTraceFile() string {
-	return filepath.Join(s.BaseDir, "trace")
+// processPrefetchMetrics Computes the precision and the recall of the trace as the prefetch set,
+// from the pages of the trace that the guest used and all pages it used. All pages that the guest
+// touches fault in the lazy mode, so both are exact. Otherwise, the guest does not fault on the pages
+// of the trace that are installed ahead of it, so it is unknown which of them it uses: the precision
+// is not measured, and the recall counts them as used, which makes it an upper bound.
+func (s *SnapshotState) processPrefetchMetrics() {
+	var reused, used int64
+	if s.IsLazyMode {
+		reused = s.replayedNum - s.uniqueNum
+		used = s.replayedNum
+	} else {
+		reused = s.traceFaultNum + s.prefetchedNum
+		if traceLen := int64(len(s.trace.trace)); reused > traceLen {
+			reused = traceLen
+		}
+		used = reused + s.uniqueNum
+	}
+
+	if used == 0 || len(s.trace.trace) == 0 {
+		return
+	}
+
+	if s.IsLazyMode {
+		s.precision = append(s.precision, float64(reused)/float64(len(s.trace.trace)))
+	}
+	s.recall = append(s.recall, float64(reused)/float64(used))
+}
+
+// loadRecord Loads the working set file written by an earlier record,
+// so that the VM is served in the replay mode from the first load. If the VM has
+// no working set file of its own, the shared working set of its snapshot is loaded.
+// Returns false if there is nothing to load.
+func (s *SnapshotState) loadRecord() (bool, error) {
+	path := s.WorkingSetPath
+	if _, err := os.Stat(path); os.IsNotExist(err) && s.SharedWorkingSetPath != "" {
+		path = s.SharedWorkingSetPath
+	}
+
+	r, err := wsfile.Open(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer r.Close()
+
+	if r.PageSize != os.Getpagesize() || r.GuestMemSize != s.GuestMemSize {
+		return false, fmt.Errorf("working set of a guest memory of %d bytes in %d-byte pages, expected %d bytes in %d-byte pages",
+			r.GuestMemSize, r.PageSize, s.GuestMemSize, os.Getpagesize())
+	}
+
+	// the file may outlive its snapshot, e.g., if the VM ID is reused for another one
+	if snapshot, err := s.snapshotID(); err != nil {
+		return false, err
+	} else if r.Snapshot != snapshot {
+		return false, fmt.Errorf("working set of another snapshot, recorded from %+v, expected %+v", r.Snapshot, snapshot)
+	}
+
+	s.trace.loadWorkingSet(r.WorkingSet)
+	s.wsPath = path
+	s.wsMeta = r.WorkingSet
+	s.isRecordReady = true
+
+	return true, nil
 }
 
-func (s *SnapshotState) mapGuestMemory() error {
-	fd, err := os.OpenFile(s.GuestMemPath, os.O_RDONLY, 0444)
+// snapshotID Identifies the snapshot of the VM by its guest memory file, or by its VMM state file
+// if the guest memory file is not on the local disk, e.g., as it is served by a page server
+func (s *SnapshotState) snapshotID() (wsfile.SnapshotID, error) {
+	info, err := os.Stat(s.GuestMemPath)
+	if os.IsNotExist(err) {
+		info, err = os.Stat(s.VMMStatePath)
+	}
 	if err != nil {
-		log.Errorf("Failed to open guest memory file: %v", err)
+		return wsfile.SnapshotID{}, fmt.Errorf("failed to identify the snapshot: %w", err)
+	}
+
+	return wsfile.SnapshotID{Size: uint64(info.Size()), Mtime: info.ModTime().UnixNano()}, nil
+}
+
+// addRecording Adds the trace of the recorded invocation. Once numRecordings invocations are
+// recorded, replaces the trace with the pages that at least pageFrequency of them touch.
+// Returns false if more invocations have to be recorded.
+func (s *SnapshotState) addRecording() bool {
+	s.recorded = append(s.recorded, s.trace.trace)
+	if len(s.recorded) < s.numRecordings {
+		s.trace = initTrace()
+		return false
+	}
+
+	minCount := int(math.Ceil(s.pageFrequency * float64(len(s.recorded))))
+	if minCount < 1 {
+		minCount = 1
+	}
+
+	s.trace = mergeTraces(s.recorded, minCount)
+	s.recorded = nil
+
+	return true
+}
+
+// mergeMisses Adds the misses of the activation to the window. If the trace misses more pages
+// per activation than the threshold, on average over the window, the missed pages are appended
+// to the trace in the order of their first touch, and the window starts anew.
+// Returns true if the trace has changed, so that the working set has to be regenerated.
+func (s *SnapshotState) mergeMisses() bool {
+	if s.missThreshold <= 0 {
+		return false
+	}
+
+	s.missHistory = append(s.missHistory, s.misses)
+	s.misses = nil
+	if len(s.missHistory) > s.missWindow {
+		s.missHistory = s.missHistory[1:]
+	}
+
+	var missed []Record
+	for _, misses := range s.missHistory {
+		missed = append(missed, misses...)
+	}
+
+	if len(s.missHistory) < s.missWindow || len(missed) <= s.missThreshold*s.missWindow {
+		return false
+	}
+
+	log.WithFields(log.Fields{"vmID": s.VMID}).Infof("Working set missed %d pages over the last %d activations, merging them",
+		len(missed), len(s.missHistory))
+
+	sort.SliceStable(missed, func(i, j int) bool { return missed[i].timestamp < missed[j].timestamp })
+	for _, rec := range missed {
+		if !s.trace.containsRecord(rec) {
+			s.trace.AppendRecord(rec)
+		}
+	}
+
+	s.missHistory = nil
+
+	return true
+}
+
+// openPageSource Opens the source of the pages of the guest memory file
+func (s *SnapshotState) openPageSource() error {
+	var err error
+	if s.pages, err = s.pageSource(s.SnapshotStateCfg); err != nil {
+		log.Errorf("Failed to open the guest memory pages: %v", err)
 		return err
 	}
 
-	s.guestMem, err = unix.Mmap(int(fd.Fd()), 0, s.GuestMemSize, unix.PROT_READ, unix.MAP_PRIVATE)
-	if err != nil {
-		log.Errorf("Failed to mmap guest memory file: %v", err)
+	return nil
+}
+
+func (s *SnapshotState) closePageSource() error {
+	if err := s.pages.Close(); err != nil {
+		log.Errorf("Failed to close the guest memory pages: %v", err)
 		return err
 	}
 
 	return nil
 }
 
-func (s *SnapshotState) unmapGuestMemory() error {
-	if err := unix.Munmap(s.guestMem); err != nil {
-		log.Errorf("Failed to munmap guest memory file: %v", err)
+// processRecord Prepares the trace and writes the working set file of the VM, never the shared one,
+// reading the pages from a new page source as the VM is not active
+func (s *SnapshotState) processRecord() error {
+	pages, err := s.pageSource(s.SnapshotStateCfg)
+	if err != nil {
 		return err
 	}
+	defer pages.Close()
+
+	var chunkPages int
+	if s.compressWS {
+		chunkPages = s.chunkSize / os.Getpagesize()
+		if chunkPages < 1 {
+			chunkPages = 1
+		}
+	}
+
+	snapshot, err := s.snapshotID()
+	if err != nil {
+		return err
+	}
+
+	ws, err := s.trace.ProcessRecord(pages, s.WorkingSetPath, snapshot, s.GuestMemSize, chunkPages, s.checksumWS)
+	if err != nil {
+		return err
+	}
+
+	s.wsPath = s.WorkingSetPath
+	s.wsMeta = ws
 
 	return nil
 }
@@ -210,6 +462,10 @@ func alignment(block []byte, alignSize int) int {
 	return int(uintptr(unsafe.Pointer(&block[0])) & uintptr(alignSize-1))
 }
 
+// zeroPage The source of the zero pages if UFFDIO_ZEROPAGE is not supported
+// by the guest memory, e.g., if it is backed by shared memory
+var zeroPage = AlignedBlock(os.Getpagesize())
+
 // AlignedBlock returns []byte of size BlockSize aligned to a multiple
 // of alignSize in memory (must be power of two)
 func AlignedBlock(blockSize int) []byte {
@@ -238,101 +494,184 @@ func AlignedBlock(blockSize int) []byte {
 	return block
 }
 
-// fetchState Fetches the working set file (or the whole guest memory) and the VMM state file
+// fetchState Fetches the VMM state file and starts fetching the working set file,
+// unless in the hybrid mode, which prefetches the pages from the guest memory file
 func (s *SnapshotState) fetchState() error {
 	if _, err := os.ReadFile(s.VMMStatePath); err != nil {
 		log.Errorf("Failed to fetch VMM state: %v\n", err)
 		return err
 	}
 
-	size := len(s.trace.trace) * os.Getpagesize()
-
-	// O_DIRECT allows to fully leverage disk bandwidth by bypassing the OS page cache
-	f, err := os.OpenFile(s.WorkingSetPath, os.O_RDONLY|syscall.O_DIRECT, 0600)
-	if err != nil {
-		log.Errorf("Failed to open the working set file for direct-io: %v\n", err)
-		return err
+	if s.IsHybridMode {
+		return nil
 	}
 
-	s.workingSet = AlignedBlock(size) // direct io requires aligned buffer
+	s.workingSet = AlignedBlock(s.wsMeta.DataSize()) // direct io requires aligned buffer
 
-	if n, err := f.Read(s.workingSet); n != size || err != nil {
-		log.Errorf("Reading working set file failed: %v\n", err)
-		return err
-	}
+	// the pages are installed as the chunks arrive
+	s.pipeline = newWSPipeline(s.wsMeta, s.chunkSize)
 
-	log.Debug("Fetched the entire working set")
-	if err := f.Close(); err != nil {
-		log.Errorf("Failed to close the working set file: %v\n", err)
-		return err
+	return s.pipeline.fetch(s.wsPath, s.workingSet, s.workers)
+}
+
+// fail Records the error that broke serving the VM
+func (s *SnapshotState) fail(err error) {
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+
+	if s.failure == nil {
+		log.WithFields(log.Fields{"vmID": s.VMID}).WithError(err).Error("Failed to serve the VM")
+		s.failure = err
 	}
+}
 
-	return nil
+// err Returns the error that broke serving the VM, if any
+func (s *SnapshotState) err() error {
+	s.failMu.Lock()
+	defer s.failMu.Unlock()
+
+	return s.failure
 }
 
-func (s *SnapshotState) pollUserPageFaults(readyCh chan int) {
+// pollUserPageFaults Serves the uffd events until stopped or until an error,
+// which only breaks this VM. Reports to readyCh whether the polling has started.
+func (s *SnapshotState) pollUserPageFaults(readyCh chan error) {
 	logger := log.WithFields(log.Fields{"vmID": s.VMID})
 
-	var events [1]syscall.EpollEvent
+	defer close(s.pollDone)
+
+	var events [2]syscall.EpollEvent
 
 	if err := s.registerEpoller(); err != nil {
-		logger.Fatalf("register_epoller: %v", err)
+		readyCh <- fmt.Errorf("register_epoller: %w", err)
+		return
 	}
 
 	logger.Debug("Starting polling loop")
 
 	defer syscall.Close(s.epfd)
+	defer unix.Close(s.quitFd)
+
+	readyCh <- nil
 
-	readyCh <- 0
+	uffd := int(s.userFaultFD.Fd())
+	goMsg := make([]byte, sizeOfUFFDMsg())
 
 	for {
-		select {
-		case <-s.quitCh:
-			logger.Debug("Handler received a signal to quit")
-			return
-		default:
-			nevents, err := syscall.EpollWait(s.epfd, events[:], -1)
-			if err != nil {
-				logger.Fatalf("epoll_wait: %v", err)
-				break
+		nevents, err := syscall.EpollWait(s.epfd, events[:], -1)
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
 			}
+			s.fail(fmt.Errorf("epoll_wait: %w", err))
+			return
+		}
 
-			if nevents < 1 {
-				panic("Wrong number of events")
+		for i := 0; i < nevents; i++ {
+			fd := int(events[i].Fd)
+
+			if fd == s.quitFd {
+				logger.Debug("Handler received a signal to quit")
+				return
 			}
 
-			for i := 0; i < nevents; i++ {
-				event := events[i]
+			if fd != uffd {
+				s.fail(fmt.Errorf("received event from unknown fd %d", fd))
+				return
+			}
 
-				fd := int(event.Fd)
+			if nread, err := s.userFaultFD.Read(goMsg); err != nil || nread != len(goMsg) {
+				if errors.Is(err, syscall.EAGAIN) {
+					continue // another thread may have woken up the faulting one
+				}
+				s.fail(fmt.Errorf("read uffd_msg failed: %v", err))
+				return
+			}
 
-				stateFd := int(s.userFaultFD.Fd())
+			if err := s.handleEvent(goMsg); err != nil {
+				s.fail(err)
+				return
+			}
+		}
+	}
+}
 
-				if fd != stateFd && stateFd != -1 {
-					logger.Fatalf("Received event from unknown fd")
-				}
+// handleEvent Handles a uffd message, see struct uffd_msg in linux/userfaultfd.h
+func (s *SnapshotState) handleEvent(msg []byte) error {
+	logger := log.WithFields(log.Fields{"vmID": s.VMID})
 
-				goMsg := make([]byte, sizeOfUFFDMsg())
+	switch event := msg[0]; event {
+	case uffdPageFault():
+		flags, address := binary.LittleEndian.Uint64(msg[8:]), binary.LittleEndian.Uint64(msg[16:])
 
-				if nread, err := syscall.Read(fd, goMsg); err != nil || nread != len(goMsg) {
-					if !errors.Is(err, syscall.EBADF) {
-						log.Fatalf("Read uffd_msg failed: %v", err)
-					}
-					break
-				}
+		if flags&uffdFlagWP() != 0 {
+			if err := s.serveWriteProtectFault(address); err != nil {
+				return fmt.Errorf("failed to serve write-protect fault at %#x: %w", address, err)
+			}
+			break
+		}
 
-				if event := uint8(goMsg[0]); event != uffdPageFault() {
-					log.Fatal("Received wrong event type")
-				}
+		write := flags&uffdFlagWrite() != 0
+		if err := s.servePageFault(address, write); err != nil {
+			return fmt.Errorf("failed to serve page fault at %#x: %w", address, err)
+		}
+	case uffdEventRemove(), uffdEventUnmap():
+		// e.g., the balloon device frees the guest memory
+		start, end := binary.LittleEndian.Uint64(msg[8:]), binary.LittleEndian.Uint64(msg[16:])
+		logger.Debugf("Guest memory range [%#x, %#x) removed", start, end)
+
+		s.guestMem.remove(start, end)
+	case uffdEventRemap():
+		from, to, length := binary.LittleEndian.Uint64(msg[8:]), binary.LittleEndian.Uint64(msg[16:]), binary.LittleEndian.Uint64(msg[24:])
+		logger.Debugf("Guest memory range [%#x, %#x) remapped to %#x", from, from+length, to)
+
+		s.guestMem.remap(from, to, length)
+	case uffdEventFork():
+		// the child process gets its own uffd, which we do not serve
+		ufd := binary.LittleEndian.Uint32(msg[8:])
+		logger.Warn("VMM forked, the page faults of the child are not served")
+
+		if err := unix.Close(int(ufd)); err != nil {
+			logger.WithError(err).Warn("Failed to close the uffd of the child")
+		}
+	default:
+		return fmt.Errorf("received unknown uffd event %#x", event)
+	}
 
-				address := binary.LittleEndian.Uint64(goMsg[16:])
+	return nil
+}
 
-				if err := s.servePageFault(fd, address); err != nil {
-					log.Fatalf("Failed to serve page fault")
-				}
-			}
+// stopPolling Stops serving the uffd events and waits for the polling to stop
+func (s *SnapshotState) stopPolling() {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], 1)
+
+	select {
+	case <-s.pollDone:
+		// the polling stopped upon an error
+	default:
+		if _, err := unix.Write(s.quitFd, buf[:]); err != nil {
+			log.WithFields(log.Fields{"vmID": s.VMID}).WithError(err).Error("Failed to stop polling")
 		}
 	}
+
+	<-s.pollDone
+}
+
+// teardown Stops serving the VM and releases the uffd and the guest memory
+func (s *SnapshotState) teardown() error {
+	s.stopPolling()
+	s.installWG.Wait()
+	if s.pipeline != nil {
+		s.pipeline.wait()
+	}
+
+	err := s.closePageSource()
+
+	s.userFaultFD.Close()
+	s.isActive = false
+
+	return err
 }
 
 func (s *SnapshotState) registerEpoller() error {
@@ -362,72 +701,134 @@ func (s *SnapshotState) registerEpoller() error {
 		&event,
 	); err != nil {
 		logger.Errorf("Failed to subscribe VM %v", err)
+		syscall.Close(s.epfd)
+		return err
+	}
+
+	s.quitFd, err = unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		logger.Errorf("Failed to create eventfd %v", err)
+		syscall.Close(s.epfd)
+		return err
+	}
+
+	event.Fd = int32(s.quitFd)
+	if err := syscall.EpollCtl(s.epfd, syscall.EPOLL_CTL_ADD, s.quitFd, &event); err != nil {
+		logger.Errorf("Failed to subscribe eventfd %v", err)
+		unix.Close(s.quitFd)
+		syscall.Close(s.epfd)
 		return err
 	}
 
 	return nil
 }
 
-func (s *SnapshotState) servePageFault(fd int, address uint64) error {
+// servePageFault Installs the missing page. If the dirty pages are tracked, the page is
+// write-protected, unless the fault is a write, which dirties the page right away.
+func (s *SnapshotState) servePageFault(address uint64, write bool) error {
 	var (
-		tStart              time.Time
-		workingSetInstalled bool
+		tStart     time.Time
+		firstFault bool
+		tFault     = time.Now()
+		kind       = faultGuestMem
 	)
 
+	defer func() {
+		s.faultLatency[kind].observe(time.Since(tFault))
+	}()
+
+	atomic.AddInt64(&s.servedNum, 1)
+
+	dst := uint64(int64(address) & ^(int64(os.Getpagesize()) - 1))
+
 	s.firstPageFaultOnce.Do(
 		func() {
-			s.startAddress = address
+			s.guestMem.setBase(dst)
+			s.firstFaultTime = time.Now()
+			firstFault = true
+			if s.trackDirty && s.guestMem.isLegacy {
+				// the guest memory is known only now
+				s.startDirtyTracking()
+			}
+		})
 
-			if s.isRecordReady && !s.IsLazyMode {
-				if s.metricsModeOn {
-					tStart = time.Now()
-				}
-				s.installWorkingSetPages(fd)
+	offset, ok := s.guestMem.fileOffset(dst)
+	if !ok {
+		return fmt.Errorf("page fault at %#x is out of the guest memory", address)
+	}
+
+	var mode installMode
+	if s.isTrackingDirty && !write {
+		mode = installWriteProtect
+	} else if s.isTrackingDirty {
+		s.markDirty(offset)
+	}
+
+	if s.isRecordReady && !s.IsLazyMode {
+		if firstFault {
+			if s.metricsModeOn {
+				tStart = time.Now()
+			}
+			// the rest of the working set is installed in the background,
+			// after the faulting thread is woken up
+			s.installWG.Add(1)
+			defer func() {
 				if s.metricsModeOn {
 					s.currentMetric.MetricMap[installWSMetric] = metrics.ToUS(time.Since(tStart))
 				}
+				go s.installWorkingSetPages()
+			}()
+		}
 
-				workingSetInstalled = true
-			}
-		})
+	}
 
-	if workingSetInstalled {
-		return nil
+	if s.guestMem.isRemoved(dst) {
+		// the VMM has freed the page, it reads as zeros
+		kind = faultZero
+		return installFaultingZeroPage(s.userFaultFD, dst, mode)
 	}
 
-	offset := address - s.startAddress
+	if s.isRecordReady && !s.IsLazyMode {
+		if idx, ok := s.trace.pageIndex(offset); ok {
+			kind = faultWorkingSet
+			return s.installWorkingSetPage(idx, offset, dst, mode)
+		}
 
-	src := uint64(uintptr(unsafe.Pointer(&s.guestMem[offset])))
-	dst := uint64(int64(address) & ^(int64(os.Getpagesize()) - 1))
-	mode := uint64(0)
+		log.Debug("Serving a page that is missing from the working set")
+	}
+
+	page, err := s.pages.Pages(offset, 1)
+	if err != nil {
+		return err
+	}
 
 	rec := Record{
-		offset: offset,
+		offset:    offset,
+		timestamp: time.Since(s.firstFaultTime),
 	}
 
 	if !s.isRecordReady {
 		s.trace.AppendRecord(rec)
-	} else {
-		log.Debug("Serving a page that is missing from the working set")
+	} else if !s.trace.containsRecord(rec) {
+		s.misses = append(s.misses, rec)
 	}
 
-	if s.metricsModeOn {
-		if s.isRecordReady {
-			if s.IsLazyMode {
-				if !s.trace.containsRecord(rec) {
-					s.uniqueNum++
-				}
-				s.replayedNum++
-			} else {
-				s.uniqueNum++
+	if s.isRecordReady {
+		if s.IsLazyMode {
+			if !s.trace.containsRecord(rec) {
+				atomic.AddInt64(&s.uniqueNum, 1)
 			}
-
+			atomic.AddInt64(&s.replayedNum, 1)
+		} else {
+			atomic.AddInt64(&s.uniqueNum, 1)
 		}
+	}
 
+	if s.metricsModeOn {
 		tStart = time.Now()
 	}
 
-	err := installRegion(fd, src, dst, mode, 1)
+	err = installFaultingPage(s.userFaultFD, page, dst, mode)
 
 	if s.metricsModeOn {
 		s.currentMetric.MetricMap[serveUniqueMetric] += metrics.ToUS(time.Since(tStart))
@@ -436,92 +837,252 @@ func (s *SnapshotState) servePageFault(fd int, address uint64) error {
 	return err
 }
 
-func (s *SnapshotState) installWorkingSetPages(fd int) {
-	log.Debug("Installing the working set pages")
+// installFaultingPage Installs the page and wakes up the faulting thread.
+// If the page is already installed or the layout of the guest memory is changing,
+// only wakes up the thread, which faults again if the page is still missing.
+func installFaultingPage(uffd userFaultFD, page []byte, dst uint64, mode installMode) error {
+	err := uffd.copy(dst, page, mode)
+	if errors.Is(err, unix.EEXIST) || errors.Is(err, unix.EAGAIN) {
+		return uffd.wake(dst, os.Getpagesize())
+	}
 
-	// build a list of sorted regions
-	keys := make([]uint64, 0)
-	for k := range s.trace.regions {
-		keys = append(keys, k)
+	return err
+}
+
+// installFaultingZeroPage Installs a zero page and wakes up the faulting thread,
+// like installFaultingPage
+func installFaultingZeroPage(uffd userFaultFD, dst uint64, mode installMode) error {
+	err := installZeroRegion(uffd, dst, 1, mode)
+	if errors.Is(err, unix.EEXIST) || errors.Is(err, unix.EAGAIN) {
+		return uffd.wake(dst, os.Getpagesize())
+	}
+
+	return err
+}
+
+// installWorkingSetPage Installs the faulting page from the working set and wakes up
+// the faulting thread. The page may be already installed in the background.
+// If the page has not been fetched yet, it is served from the guest memory file right away.
+func (s *SnapshotState) installWorkingSetPage(idx int, offset, dst uint64, mode installMode) error {
+	atomic.AddInt64(&s.traceFaultNum, 1)
+
+	if idx == zeroPageIndex {
+		return installFaultingZeroPage(s.userFaultFD, dst, mode)
 	}
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
 
 	var (
-		srcOffset uint64
+		page []byte
+		err  error
 	)
+	if s.pipeline != nil && s.pipeline.isFetched(idx) {
+		page = s.workingSet[idx*os.Getpagesize() : (idx+1)*os.Getpagesize()]
+	} else if page, err = s.pages.Pages(offset, 1); err != nil {
+		return err
+	}
 
-	for _, offset := range keys {
-		regLength := s.trace.regions[offset]
-		regAddress := s.startAddress + offset
-		mode := uint64(C.const_UFFDIO_COPY_MODE_DONTWAKE)
-		src := uint64(uintptr(unsafe.Pointer(&s.workingSet[srcOffset])))
-		dst := regAddress
+	return installFaultingPage(s.userFaultFD, page[:os.Getpagesize()], dst, mode)
+}
 
-		if err := installRegion(fd, src, dst, mode, uint64(regLength)); err != nil {
-			log.Fatalf("install_region: %v", err)
-		}
+// installWorkingSetPages Installs the working set pages in the order of the first touch
+// with several workers, each installing a chunk of the working set as soon as it is fetched.
+// Meanwhile, the zero pages are installed, which do not need to be fetched.
+func (s *SnapshotState) installWorkingSetPages() {
+	defer s.installWG.Done()
+
+	log.Debug("Installing the working set pages")
 
-		srcOffset += uint64(regLength) * 4096
+	tStart := time.Now()
+
+	pipeline := s.pipeline
+	if pipeline == nil {
+		// the working set has not been fetched, serve it from the guest memory file
+		pipeline = newWSPipeline(s.wsMeta, defaultChunkSize)
 	}
 
-	wake(fd, s.startAddress, os.Getpagesize())
-}
+	queue := make(chan *wsChunk, len(pipeline.chunks))
+	for _, c := range pipeline.chunks {
+		queue <- c
+	}
+	close(queue)
+
+	var wg sync.WaitGroup
+	for i := 0; i < s.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 
-func installRegion(fd int, src, dst, mode, len uint64) error {
-	cUC := C.struct_uffdio_copy{
-		mode: C.ulonglong(mode),
-		copy: 0,
-		src:  C.ulonglong(src),
-		dst:  C.ulonglong(dst),
-		len:  C.ulonglong(uint64(os.Getpagesize()) * len),
+			for c := range queue {
+				if !s.isPolling() {
+					return
+				}
+				if err := s.installChunk(c); err != nil {
+					s.fail(fmt.Errorf("install_region: %w", err))
+					return
+				}
+			}
+		}()
 	}
 
-	err := ioctl(uintptr(fd), int(C.const_UFFDIO_COPY), unsafe.Pointer(&cUC))
-	if err != nil {
-		return err
+	if err := s.installZeroRegions(); err != nil {
+		s.fail(fmt.Errorf("install_zero_region: %w", err))
+	}
+
+	wg.Wait()
+
+	s.installWSBgTime = time.Since(tStart)
+}
+
+// installChunk Installs the pages of the chunk once it is fetched, waking up the threads
+// that fault on them. If the fetch failed, the pages are installed from the guest memory file.
+func (s *SnapshotState) installChunk(c *wsChunk) error {
+	pageSize := uint64(os.Getpagesize())
+
+	fromWS := s.pipeline != nil && s.pipeline.waitChunk(c) == nil
+
+	for _, seg := range c.segments {
+		// a region of the working set may span several regions of the guest memory
+		err := s.guestMem.split(seg.offset, seg.numPages, func(offset, dst uint64, numPages int) error {
+			var (
+				page []byte
+				err  error
+			)
+			if fromWS {
+				idx := seg.page + int((offset-seg.offset)/pageSize)
+				page = s.workingSet[uint64(idx)*pageSize:]
+			} else if page, err = s.pages.Pages(offset, numPages); err != nil {
+				return err
+			}
+
+			mode := s.installMode(installDontWake)
+
+			installed, err := s.installPages(dst, numPages, func(i, n uint64) error {
+				return s.userFaultFD.copy(dst+i*pageSize, page[i*pageSize:(i+n)*pageSize], mode)
+			})
+			atomic.AddInt64(&s.prefetchedNum, int64(installed))
+			if err != nil {
+				return err
+			}
+
+			return s.userFaultFD.wake(dst, numPages*int(pageSize))
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func ioctl(fd uintptr, request int, argp unsafe.Pointer) error {
-	_, _, errno := unix.Syscall(
-		unix.SYS_IOCTL,
-		fd,
-		uintptr(request),
-		// Note that the conversion from unsafe.Pointer to uintptr _must_
-		// occur in the call expression.  See the package unsafe documentation
-		// for more details.
-		uintptr(argp),
-	)
-	if errno != 0 {
-		return os.NewSyscallError("ioctl", fmt.Errorf("%d", int(errno)))
+// installZeroRegions Installs the zero pages of the working set, waking up the threads
+// that fault on them
+func (s *SnapshotState) installZeroRegions() error {
+	pageSize := uint64(os.Getpagesize())
+	mode := s.installMode(installDontWake)
+
+	for _, r := range s.wsMeta.ZeroRegions {
+		if !s.isPolling() {
+			return nil
+		}
+
+		err := s.guestMem.split(r.Offset, r.NumPages, func(_, dst uint64, numPages int) error {
+			installed, err := s.installPages(dst, numPages, func(i, n uint64) error {
+				return installZeroRegion(s.userFaultFD, dst+i*pageSize, int(n), mode)
+			})
+			atomic.AddInt64(&s.prefetchedNum, int64(installed))
+			atomic.AddInt64(&s.zeroNum, int64(installed))
+			if err != nil {
+				return err
+			}
+
+			return s.userFaultFD.wake(dst, numPages*int(pageSize))
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func wake(fd int, startAddress uint64, len int) {
-	cUR := C.struct_uffdio_range{
-		start: C.ulonglong(startAddress),
-		len:   C.ulonglong(len),
+// installPages Installs the pages at dst with install, which installs n pages starting
+// from the i-th one without waking up the faulting threads. Skips the pages that have
+// been installed upon page faults, or that the VMM has removed or unmapped.
+// Returns the number of the installed pages.
+func (s *SnapshotState) installPages(dst uint64, numPages int, install func(i, n uint64) error) (int, error) {
+	var installed int
+
+	pageSize := uint64(os.Getpagesize())
+
+	if !s.guestMem.overlapsRemoved(dst, dst+uint64(numPages)*pageSize) {
+		err := install(0, uint64(numPages))
+		if err == nil {
+			return numPages, nil
+		}
+		if !errors.Is(err, unix.EEXIST) && !errors.Is(err, unix.EAGAIN) && !errors.Is(err, unix.ENOENT) {
+			return 0, err
+		}
 	}
 
-	err := ioctl(uintptr(fd), int(C.const_UFFDIO_WAKE), unsafe.Pointer(&cUR))
-	if err != nil {
-		log.Fatalf("ioctl failed: %v", err)
+	// install page by page, as some pages of the range are present or gone
+	for i := uint64(0); i < uint64(numPages); i++ {
+		for !s.guestMem.isRemoved(dst + i*pageSize) {
+			err := install(i, 1)
+			if errors.Is(err, unix.EAGAIN) {
+				// the layout of the guest memory is changing, retry once the event is handled
+				if !s.isPolling() {
+					return installed, nil
+				}
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			if err == nil {
+				installed++
+			} else if !errors.Is(err, unix.EEXIST) && !errors.Is(err, unix.ENOENT) {
+				return installed, err
+			}
+			break
+		}
 	}
+
+	return installed, nil
 }
 
-//nolint:deadcode,unused
-func registerForUpf(startAddress []byte, len uint64) int {
-	return int(C.register_for_upf(unsafe.Pointer(&startAddress[0]), C.ulong(len)))
+// isPolling Returns true if the uffd events are being served
+func (s *SnapshotState) isPolling() bool {
+	select {
+	case <-s.pollDone:
+		return false
+	default:
+		return true
+	}
 }
 
-func sizeOfUFFDMsg() int {
-	return C.sizeof_struct_uffd_msg
+// installMode Returns the mode, in which the pages are also write-protected
+// if the dirty pages are tracked
+func (s *SnapshotState) installMode(mode installMode) installMode {
+	if s.isTrackingDirty {
+		mode |= installWriteProtect
+	}
+
+	return mode
 }
 
-func uffdPageFault() uint8 {
-	return uint8(C.const_UFFD_EVENT_PAGEFAULT)
+// installZeroRegion Installs numPages zero pages at dst. If the guest memory does not support
+// UFFDIO_ZEROPAGE, or the pages are to be write-protected, which UFFDIO_ZEROPAGE cannot do,
+// copies the pages from a zero page instead.
+func installZeroRegion(uffd userFaultFD, dst uint64, numPages int, mode installMode) error {
+	if mode&installWriteProtect == 0 {
+		err := uffd.zeroPage(dst, numPages, mode)
+		if !errors.Is(err, unix.EINVAL) {
+			return err
+		}
+	}
+
+	for i := 0; i < numPages; i++ {
+		if err := uffd.copy(dst+uint64(i*os.Getpagesize()), zeroPage, mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -23,36 +23,45 @@
 package manager
 
 import (
-	"encoding/csv"
+	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"sort"
-	"strconv"
 	"sync"
+	"time"
 
 	log "github.com/sirupsen/logrus"
+
+	"github.com/vhive-serverless/vhive/memory/wsfile"
 )
 
-// Record A tuple with an address
+// Record A tuple with an address and the time of its first touch since the first page fault
 type Record struct {
-	offset uint64
+	offset    uint64
+	timestamp time.Duration
 }
 
-// Trace Contains records
+// zeroPageIndex The index of the pages of the working set that are all zeros,
+// which are not stored in the working set file
+const zeroPageIndex = -1
+
+// Trace Contains records in the order of the first touch
 type Trace struct {
 	sync.Mutex
-	traceFileName string
 
-	containedOffsets map[uint64]int
+	containedOffsets map[uint64]int // offset to the index of the record
 	trace            []Record
 	regions          map[uint64]int
+	wsPages          map[uint64]int // offset to the index of the page in the working set file
 }
 
-func initTrace(traceFileName string) *Trace {
+func initTrace() *Trace {
 	t := new(Trace)
 
-	t.traceFileName = traceFileName
 	t.regions = make(map[uint64]int)
 	t.containedOffsets = make(map[uint64]int)
+	t.wsPages = make(map[uint64]int)
 	t.trace = make([]Record, 0)
 
 	return t
@@ -64,145 +73,191 @@ func (t *Trace) AppendRecord(r Record) {
 	defer t.Unlock()
 
 	t.trace = append(t.trace, r)
-	t.containedOffsets[r.offset] = 0
+	t.containedOffsets[r.offset] = len(t.trace) - 1
 }
 
-// WriteTrace Writes all the records to a file
-func (t *Trace) WriteTrace() {
-	t.Lock()
-	defer t.Unlock()
+// Search trace for the record with the same offset
+func (t *Trace) containsRecord(rec Record) bool {
+	_, ok := t.containedOffsets[rec.offset]
 
-	file, err := os.Create(t.traceFileName)
-	if err != nil {
-		log.Fatalf("Failed to open trace file for writing: %v", err)
-	}
-	defer file.Close()
+	return ok
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+// mergeTraces Returns the trace of the pages that at least minCount of the traces contain.
+// The pages are ordered by the first touch, on average over the traces that contain them.
+func mergeTraces(traces [][]Record, minCount int) *Trace {
+	type pageStats struct {
+		order     int // of the first appearance, to break the ties
+		count     int
+		timestamp time.Duration // sum of the first-touch timestamps
+	}
 
-	for _, rec := range t.trace {
-		err := writer.Write([]string{
-			strconv.FormatUint(rec.offset, 16)})
-		if err != nil {
-			log.Fatalf("Failed to write trace: %v", err)
+	pages := make(map[uint64]*pageStats)
+	for _, trace := range traces {
+		seen := make(map[uint64]bool, len(trace))
+		for _, rec := range trace {
+			if seen[rec.offset] {
+				continue
+			}
+			seen[rec.offset] = true
+
+			p, ok := pages[rec.offset]
+			if !ok {
+				p = &pageStats{order: len(pages)}
+				pages[rec.offset] = p
+			}
+			p.count++
+			p.timestamp += rec.timestamp
 		}
 	}
-}
 
-// readTrace Reads all the records from a CSV file
-//nolint:deadcode,unused
-func (t *Trace) readTrace() {
-	f, err := os.Open(t.traceFileName)
-	if err != nil {
-		log.Fatalf("Failed to open trace file for reading: %v", err)
+	records := make([]Record, 0, len(pages))
+	for offset, p := range pages {
+		if p.count >= minCount {
+			records = append(records, Record{offset: offset, timestamp: p.timestamp / time.Duration(p.count)})
+		}
 	}
-	defer f.Close()
 
-	lines, err := csv.NewReader(f).ReadAll()
-	if err != nil {
-		log.Fatalf("Failed to read from the trace file: %v", err)
-	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].timestamp != records[j].timestamp {
+			return records[i].timestamp < records[j].timestamp
+		}
+		return pages[records[i].offset].order < pages[records[j].offset].order
+	})
 
-	for _, line := range lines {
-		rec := readRecord(line)
+	t := initTrace()
+	for _, rec := range records {
 		t.AppendRecord(rec)
 	}
-}
 
-// readRecord Parses a record from a line
-//nolint:deadcode,unused
-func readRecord(line []string) Record {
-	offset, err := strconv.ParseUint(line[0], 16, 64)
-	if err != nil {
-		log.Fatalf("Failed to convert string to offset: %v", err)
-	}
-
-	rec := Record{
-		offset: offset,
-	}
-	return rec
+	return t
 }
 
-// Search trace for the record with the same offset
-func (t *Trace) containsRecord(rec Record) bool {
-	_, ok := t.containedOffsets[rec.offset]
+// pageIndex Returns the index of the page at the offset in the working set file,
+// or zeroPageIndex if the page is all zeros
+func (t *Trace) pageIndex(offset uint64) (int, bool) {
+	idx, ok := t.wsPages[offset]
 
-	return ok
+	return idx, ok
 }
 
-// ProcessRecord Prepares the trace, the regions map, and the working set file for replay
+// ProcessRecord Prepares the trace, the regions map, and the working set file for replay.
+// The records keep the order of the first touch, so that the replay installs the pages
+// in the order in which the guest needs them. The pages that are all zeros are not
+// stored in the working set file but installed as zero pages. The pages are compressed
+// in chunks of chunkPages pages, unless it is zero, and their checksums are stored if withChecksums.
+// The file is tied to the snapshot, so that it is not loaded for another one.
 // Must be called when record is done (i.e., it is not concurrency-safe vs. AppendRecord)
-func (t *Trace) ProcessRecord(GuestMemPath, WorkingSetPath string) {
+func (t *Trace) ProcessRecord(guestMem io.ReaderAt, WorkingSetPath string, snapshot wsfile.SnapshotID, guestMemSize, chunkPages int, withChecksums bool) (*wsfile.WorkingSet, error) {
 	log.Debug("Preparing replay structures")
 
-	// sort trace records in the ascending order by offset
-	sort.Slice(t.trace, func(i, j int) bool {
-		return t.trace[i].offset < t.trace[j].offset
-	})
+	// drop the repeated records, keeping the first touch
+	records := t.trace
+	t.trace = make([]Record, 0, len(records))
+	t.containedOffsets = make(map[uint64]int)
+	for _, rec := range records {
+		if !t.containsRecord(rec) {
+			t.AppendRecord(rec)
+		}
+	}
+
+	ws := &wsfile.WorkingSet{
+		PageSize:     os.Getpagesize(),
+		GuestMemSize: guestMemSize,
+		Snapshot:     snapshot,
+		Timestamps:   make([]time.Duration, 0, len(t.trace)),
+		ChunkPages:   chunkPages,
+	}
 
-	// build the map of contiguous regions from the trace records
-	var last, regionStart uint64
+	var (
+		page      = make([]byte, ws.PageSize)
+		zeros     = make([]byte, ws.PageSize)
+		zeroPages []uint64
+		last      uint64
+	)
+	// build the regions from the runs of the contiguous non-zero pages touched one after another
 	for _, rec := range t.trace {
-		if rec.offset != last+uint64(os.Getpagesize()) {
-			regionStart = rec.offset
-			t.regions[regionStart] = 1
-		} else {
-			t.regions[regionStart]++
+		if _, err := guestMem.ReadAt(page, int64(rec.offset)); err != nil {
+			return nil, fmt.Errorf("failed to read the page at offset %#x: %w", rec.offset, err)
 		}
 
-		last = rec.offset
-	}
+		if bytes.Equal(page, zeros) {
+			zeroPages = append(zeroPages, rec.offset)
+			continue
+		}
 
-	t.writeWorkingSetPagesToFile(GuestMemPath, WorkingSetPath)
-}
+		if len(ws.Regions) == 0 || rec.offset != last+uint64(ws.PageSize) {
+			ws.Regions = append(ws.Regions, wsfile.Region{Offset: rec.offset})
+		}
+		ws.Regions[len(ws.Regions)-1].NumPages++
+		ws.Timestamps = append(ws.Timestamps, rec.timestamp)
 
-func (t *Trace) writeWorkingSetPagesToFile(guestMemFileName, WorkingSetPath string) {
-	log.Debug("Writing the working set pages to a disk")
+		last = rec.offset
+	}
 
-	fSrc, err := os.Open(guestMemFileName)
-	if err != nil {
-		log.Fatalf("Failed to open guest memory file for reading")
+	// the zero pages are cheap to install, so their order does not matter
+	sort.Slice(zeroPages, func(i, j int) bool { return zeroPages[i] < zeroPages[j] })
+	for i, offset := range zeroPages {
+		if i == 0 || offset != zeroPages[i-1]+uint64(ws.PageSize) {
+			ws.ZeroRegions = append(ws.ZeroRegions, wsfile.Region{Offset: offset})
+		}
+		ws.ZeroRegions[len(ws.ZeroRegions)-1].NumPages++
 	}
-	defer fSrc.Close()
-	fDst, err := os.Create(WorkingSetPath)
-	if err != nil {
-		log.Fatalf("Failed to open ws file for writing")
+
+	if withChecksums {
+		ws.Checksums = make([]uint32, ws.NumPages())
 	}
-	defer fDst.Close()
 
-	var (
-		dstOffset int64
-		count     int
-	)
+	log.Debugf("Writing the working set pages to a disk, skipping %d zero pages", len(zeroPages))
 
-	// Form a sorted slice of keys to access the map in a predetermined order
-	keys := make([]uint64, 0)
-	for k := range t.regions {
-		keys = append(keys, k)
+	if err := wsfile.Write(WorkingSetPath, ws, guestMem); err != nil {
+		return nil, err
 	}
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
 
-	for _, offset := range keys {
-		regLength := t.regions[offset]
-		copyLen := regLength * os.Getpagesize()
+	if ws.IsCompressed() {
+		log.Debugf("Compressed the working set of %d bytes to %d bytes", ws.DataSize(), ws.CompressedSize())
+	}
+
+	t.indexWorkingSet(ws)
 
-		buf := make([]byte, copyLen)
+	return ws, nil
+}
 
-		if n, err := fSrc.ReadAt(buf, int64(offset)); n != copyLen || err != nil {
-			log.Fatalf("Read file failed for src")
+// loadWorkingSet Rebuilds the trace and the regions map from a working set file.
+// The zero pages have no timestamps and follow the other pages.
+func (t *Trace) loadWorkingSet(ws *wsfile.WorkingSet) {
+	for i, offset := range ws.PageOffsets() {
+		rec := Record{offset: offset}
+		if ws.Timestamps != nil {
+			rec.timestamp = ws.Timestamps[i]
 		}
+		t.AppendRecord(rec)
+	}
 
-		if n, err := fDst.WriteAt(buf, dstOffset); n != copyLen || err != nil {
-			log.Fatalf("Write file failed for dst")
+	for _, r := range ws.ZeroRegions {
+		for i := 0; i < r.NumPages; i++ {
+			t.AppendRecord(Record{offset: r.Offset + uint64(i*ws.PageSize)})
 		}
+	}
 
-		dstOffset += int64(copyLen)
+	t.indexWorkingSet(ws)
+}
 
-		count += regLength
+// indexWorkingSet Builds the regions map and the index of the pages in the working set file
+func (t *Trace) indexWorkingSet(ws *wsfile.WorkingSet) {
+	t.wsPages = make(map[uint64]int, len(t.trace))
+	for i, offset := range ws.PageOffsets() {
+		t.wsPages[offset] = i
+	}
+
+	for _, r := range ws.ZeroRegions {
+		for i := 0; i < r.NumPages; i++ {
+			t.wsPages[r.Offset+uint64(i*ws.PageSize)] = zeroPageIndex
+		}
 	}
 
-	if err := fDst.Sync(); err != nil {
-		log.Fatalf("Sync file failed for dst")
+	t.regions = make(map[uint64]int, len(ws.Regions))
+	for _, r := range ws.Regions {
+		t.regions[r.Offset] = r.NumPages
 	}
 }
@@ -0,0 +1,275 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vhive-serverless/vhive/memory/wsfile"
+)
+
+func prepareGuestMem(t *testing.T, path string, numPages int) {
+	pageSize := os.Getpagesize()
+
+	mem := make([]byte, numPages*pageSize)
+	for i := 0; i < numPages; i++ {
+		mem[i*pageSize] = byte(i + 1)
+	}
+
+	require.NoError(t, os.WriteFile(path, mem, 0644))
+}
+
+func openGuestMem(t *testing.T, path string) *os.File {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+
+	return f
+}
+
+// snapshotOf Returns the identity of the snapshot of the VM, which its working set file is tied to
+func snapshotOf(t *testing.T, cfg SnapshotStateCfg) wsfile.SnapshotID {
+	snapshot, err := NewSnapshotState(cfg).snapshotID()
+	require.NoError(t, err)
+
+	return snapshot
+}
+
+func TestLoadRecord(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+
+	cfg := SnapshotStateCfg{
+		VMID:           "1",
+		BaseDir:        dir,
+		GuestMemPath:   filepath.Join(dir, "mem_file"),
+		WorkingSetPath: filepath.Join(dir, "working_set_pages"),
+		GuestMemSize:   16 * pageSize,
+	}
+	prepareGuestMem(t, cfg.GuestMemPath, 16)
+
+	state := NewSnapshotState(cfg)
+
+	loaded, err := state.loadRecord()
+	require.NoError(t, err, "Nothing to load must not be an error")
+	require.False(t, loaded)
+
+	for i, page := range []uint64{9, 1, 2, 10, 1, 3, 0, 7} {
+		state.trace.AppendRecord(Record{offset: page * uint64(pageSize), timestamp: time.Duration(i)})
+	}
+
+	ws, err := state.trace.ProcessRecord(openGuestMem(t, cfg.GuestMemPath), cfg.WorkingSetPath, snapshotOf(t, cfg), cfg.GuestMemSize, 0, false)
+	require.NoError(t, err, "Failed to process the record")
+
+	// the pages keep the order of the first touch
+	require.Equal(t, []wsfile.Region{
+		{Offset: uint64(9 * pageSize), NumPages: 1},
+		{Offset: uint64(pageSize), NumPages: 2},
+		{Offset: uint64(10 * pageSize), NumPages: 1},
+		{Offset: uint64(3 * pageSize), NumPages: 1},
+		{Offset: 0, NumPages: 1},
+		{Offset: uint64(7 * pageSize), NumPages: 1},
+	}, ws.Regions)
+	require.Equal(t, []time.Duration{0, 1, 2, 3, 5, 6, 7}, ws.Timestamps)
+
+	idx, ok := state.trace.pageIndex(uint64(3 * pageSize))
+	require.True(t, ok)
+	require.Equal(t, 4, idx)
+
+	restarted := NewSnapshotState(cfg)
+	loaded, err = restarted.loadRecord()
+	require.NoError(t, err, "Failed to load the record")
+	require.True(t, loaded)
+	require.True(t, restarted.isRecordReady)
+	require.Equal(t, state.trace.trace, restarted.trace.trace)
+	require.Equal(t, state.trace.regions, restarted.trace.regions)
+	require.True(t, restarted.trace.containsRecord(Record{offset: uint64(10 * pageSize)}))
+
+	cfg.GuestMemSize *= 2
+	resized := NewSnapshotState(cfg)
+	_, err = resized.loadRecord()
+	require.Error(t, err, "Working set of another guest memory must not be loaded")
+	require.False(t, resized.isRecordReady)
+
+	// another snapshot of the same size is taken, e.g., for a reused VM ID
+	cfg.GuestMemSize /= 2
+	prepareGuestMem(t, cfg.GuestMemPath, 16)
+	mtime := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(cfg.GuestMemPath, mtime, mtime))
+	resnapshotted := NewSnapshotState(cfg)
+	_, err = resnapshotted.loadRecord()
+	require.Error(t, err, "Working set of another snapshot must not be loaded")
+	require.False(t, resnapshotted.isRecordReady)
+}
+
+func TestZeroPages(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+
+	cfg := SnapshotStateCfg{
+		VMID:           "1",
+		BaseDir:        dir,
+		GuestMemPath:   filepath.Join(dir, "mem_file"),
+		WorkingSetPath: filepath.Join(dir, "working_set_pages"),
+		GuestMemSize:   16 * pageSize,
+	}
+
+	// only the pages 1, 2, and 8 are not zeros
+	mem := make([]byte, cfg.GuestMemSize)
+	for _, page := range []int{1, 2, 8} {
+		mem[(page+1)*pageSize-1] = 1
+	}
+	require.NoError(t, os.WriteFile(cfg.GuestMemPath, mem, 0644))
+
+	state := NewSnapshotState(cfg)
+	for i, page := range []uint64{5, 1, 4, 2, 6, 8, 12} {
+		state.trace.AppendRecord(Record{offset: page * uint64(pageSize), timestamp: time.Duration(i)})
+	}
+
+	ws, err := state.trace.ProcessRecord(openGuestMem(t, cfg.GuestMemPath), cfg.WorkingSetPath, snapshotOf(t, cfg), cfg.GuestMemSize, 0, false)
+	require.NoError(t, err, "Failed to process the record")
+
+	// the zero pages touched in between do not break the regions
+	require.Equal(t, []wsfile.Region{
+		{Offset: uint64(pageSize), NumPages: 2},
+		{Offset: uint64(8 * pageSize), NumPages: 1},
+	}, ws.Regions)
+	require.Equal(t, []wsfile.Region{
+		{Offset: uint64(4 * pageSize), NumPages: 3},
+		{Offset: uint64(12 * pageSize), NumPages: 1},
+	}, ws.ZeroRegions)
+	require.Equal(t, []time.Duration{1, 3, 5}, ws.Timestamps)
+
+	info, err := os.Stat(cfg.WorkingSetPath)
+	require.NoError(t, err)
+	require.Equal(t, ws.DataOffset+int64(3*pageSize), info.Size(), "Zero pages must not be stored")
+
+	for offset, expected := range map[int]int{1: 0, 2: 1, 8: 2, 5: zeroPageIndex, 12: zeroPageIndex} {
+		idx, ok := state.trace.pageIndex(uint64(offset * pageSize))
+		require.True(t, ok)
+		require.Equal(t, expected, idx)
+	}
+	_, ok := state.trace.pageIndex(uint64(3 * pageSize))
+	require.False(t, ok)
+
+	restarted := NewSnapshotState(cfg)
+	loaded, err := restarted.loadRecord()
+	require.NoError(t, err, "Failed to load the record")
+	require.True(t, loaded)
+	require.Equal(t, state.trace.wsPages, restarted.trace.wsPages)
+	require.Len(t, restarted.trace.trace, 7)
+}
+
+func TestMergeMisses(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+
+	cfg := SnapshotStateCfg{
+		VMID:           "1",
+		BaseDir:        dir,
+		GuestMemPath:   filepath.Join(dir, "mem_file"),
+		WorkingSetPath: filepath.Join(dir, "working_set_pages"),
+		GuestMemSize:   16 * pageSize,
+		missThreshold:  1,
+		missWindow:     2,
+	}
+	prepareGuestMem(t, cfg.GuestMemPath, 16)
+
+	state := NewSnapshotState(cfg)
+	for _, page := range []uint64{0, 1} {
+		state.trace.AppendRecord(Record{offset: page * uint64(pageSize)})
+	}
+	_, err := state.trace.ProcessRecord(openGuestMem(t, cfg.GuestMemPath), cfg.WorkingSetPath, wsfile.SnapshotID{}, cfg.GuestMemSize, 0, false)
+	require.NoError(t, err, "Failed to process the record")
+
+	miss := func(page uint64, ts time.Duration) Record {
+		return Record{offset: page * uint64(pageSize), timestamp: ts}
+	}
+
+	state.misses = []Record{miss(5, 2), miss(7, 3)}
+	require.False(t, state.mergeMisses(), "The window is not full yet")
+
+	state.misses = nil
+	require.False(t, state.mergeMisses(), "Misses are below the threshold")
+
+	state.misses = []Record{miss(9, 1), miss(5, 2)}
+	require.False(t, state.mergeMisses(), "Misses are below the threshold")
+
+	state.misses = []Record{miss(9, 1)}
+	require.True(t, state.mergeMisses(), "Misses are above the threshold")
+	require.Empty(t, state.missHistory, "The window must start anew")
+
+	ws, err := state.trace.ProcessRecord(openGuestMem(t, cfg.GuestMemPath), cfg.WorkingSetPath, wsfile.SnapshotID{}, cfg.GuestMemSize, 0, false)
+	require.NoError(t, err, "Failed to update the working set")
+	// the missed pages follow the recorded ones, in the order of their first touch
+	require.Equal(t, []uint64{0, uint64(pageSize), uint64(9 * pageSize), uint64(5 * pageSize)}, ws.PageOffsets())
+	require.Len(t, state.trace.regions, 3)
+
+	state.missThreshold = 0
+	state.misses = []Record{miss(10, 1), miss(11, 1), miss(12, 1)}
+	require.False(t, state.mergeMisses(), "Merging is disabled")
+}
+
+func TestMergeTraces(t *testing.T) {
+	rec := func(offset uint64, ts time.Duration) Record {
+		return Record{offset: offset, timestamp: ts}
+	}
+
+	traces := [][]Record{
+		{rec(1, 0), rec(2, 10), rec(3, 20), rec(1, 30)},
+		{rec(2, 0), rec(1, 10), rec(4, 20)},
+		{rec(1, 0), rec(2, 10), rec(5, 40)},
+	}
+
+	offsets := func(tr *Trace) []uint64 {
+		var offsets []uint64
+		for _, r := range tr.trace {
+			offsets = append(offsets, r.offset)
+		}
+		return offsets
+	}
+
+	// ordered by the average first touch, the ties are broken by the first appearance
+	require.Equal(t, []uint64{1, 2, 3, 4, 5}, offsets(mergeTraces(traces, 1)))
+	require.Equal(t, []uint64{1, 2}, offsets(mergeTraces(traces, 2)))
+	require.Empty(t, offsets(mergeTraces(traces, 4)))
+
+	merged := mergeTraces(traces, 3)
+	require.Equal(t, []Record{rec(1, 3), rec(2, 6)}, merged.trace)
+	require.True(t, merged.containsRecord(rec(2, 0)))
+
+	state := NewSnapshotState(SnapshotStateCfg{VMID: "1", numRecordings: 3, pageFrequency: 0.5})
+	for i, trace := range traces {
+		for _, r := range trace {
+			state.trace.AppendRecord(r)
+		}
+		require.Equal(t, i == len(traces)-1, state.addRecording())
+	}
+	require.Equal(t, []uint64{1, 2}, offsets(state.trace))
+	require.Nil(t, state.recorded)
+}
@@ -0,0 +1,259 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+/*
+#include "user_page_faults.h"
+*/
+import "C"
+
+import (
+	"context"
+	"net"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+// installMode How the pages are installed into the guest memory
+type installMode int
+
+const (
+	// installDontWake The threads that fault on the pages are woken up separately
+	installDontWake installMode = 1 << iota
+	// installWriteProtect The pages are write-protected, to track the dirty pages
+	installWriteProtect
+)
+
+// userFaultFD The operations on the uffd of a VM, see linux/userfaultfd.h.
+// The addresses are in the address space of the VMM.
+type userFaultFD interface {
+	// Fd Returns the file descriptor to poll for the events
+	Fd() uintptr
+	// Read Reads a uffd_msg
+	Read(msg []byte) (int, error)
+	Close() error
+
+	// copy Installs the pages of src at dst (UFFDIO_COPY)
+	copy(dst uint64, src []byte, mode installMode) error
+	// zeroPage Installs numPages zero pages at dst (UFFDIO_ZEROPAGE),
+	// which cannot be write-protected
+	zeroPage(dst uint64, numPages int, mode installMode) error
+	// wake Wakes up the threads that fault on the range (UFFDIO_WAKE)
+	wake(start uint64, len int) error
+	// registerWriteProtect Registers the range, which the VMM has registered for the missing
+	// page faults, for the write-protect faults too (UFFDIO_REGISTER)
+	registerWriteProtect(start, len uint64) error
+	// writeProtect Write-protects the range if wp is set, otherwise removes the protection
+	// and wakes up the threads that fault on the range (UFFDIO_WRITEPROTECT)
+	writeProtect(start, len uint64, wp bool) error
+}
+
+// uffdOpener Connects to the VMM at the socket address and receives the uffd
+// and the guest memory layout, if any
+type uffdOpener func(sockAddr string) (userFaultFD, []byte, error)
+
+// kernelUFFD The uffd that the VMM has created
+type kernelUFFD struct {
+	file *os.File
+	fd   int
+}
+
+func newKernelUFFD(file *os.File) *kernelUFFD {
+	return &kernelUFFD{file: file, fd: int(file.Fd())}
+}
+
+// dialUFFD Receives the uffd from the VMM, retrying until the VMM listens on the socket
+func dialUFFD(sockAddr string) (userFaultFD, []byte, error) {
+	var d net.Dialer
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	for {
+		c, err := d.DialContext(ctx, "unix", sockAddr)
+		if err != nil {
+			if ctx.Err() != nil {
+				log.Error("Failed to dial within the context timeout")
+				return nil, nil, err
+			}
+			time.Sleep(1 * time.Millisecond)
+			continue
+		}
+
+		defer c.Close()
+
+		sendfdConn := c.(*net.UnixConn)
+
+		uffd, handshake, err := receiveUFFD(sendfdConn)
+		if err != nil {
+			log.Error("Failed to receive the uffd")
+			return nil, nil, err
+		}
+
+		return newKernelUFFD(uffd), handshake, nil
+	}
+}
+
+func (u *kernelUFFD) Fd() uintptr {
+	return uintptr(u.fd)
+}
+
+func (u *kernelUFFD) Read(msg []byte) (int, error) {
+	return syscall.Read(u.fd, msg)
+}
+
+func (u *kernelUFFD) Close() error {
+	return u.file.Close()
+}
+
+func (u *kernelUFFD) copy(dst uint64, src []byte, mode installMode) error {
+	var copyMode uint64
+	if mode&installDontWake != 0 {
+		copyMode |= uint64(C.const_UFFDIO_COPY_MODE_DONTWAKE)
+	}
+	if mode&installWriteProtect != 0 {
+		copyMode |= uint64(C.const_UFFDIO_COPY_MODE_WP)
+	}
+
+	cUC := C.struct_uffdio_copy{
+		mode: C.ulonglong(copyMode),
+		copy: 0,
+		src:  C.ulonglong(uintptr(unsafe.Pointer(&src[0]))),
+		dst:  C.ulonglong(dst),
+		len:  C.ulonglong(len(src)),
+	}
+
+	return ioctl(uintptr(u.fd), int(C.const_UFFDIO_COPY), unsafe.Pointer(&cUC))
+}
+
+func (u *kernelUFFD) zeroPage(dst uint64, numPages int, mode installMode) error {
+	var zeroMode uint64
+	if mode&installDontWake != 0 {
+		zeroMode = uint64(C.const_UFFDIO_ZEROPAGE_MODE_DONTWAKE)
+	}
+
+	cUZ := C.struct_uffdio_zeropage{
+		_range: C.struct_uffdio_range{
+			start: C.ulonglong(dst),
+			len:   C.ulonglong(numPages * os.Getpagesize()),
+		},
+		mode: C.ulonglong(zeroMode),
+	}
+
+	return ioctl(uintptr(u.fd), int(C.const_UFFDIO_ZEROPAGE), unsafe.Pointer(&cUZ))
+}
+
+func (u *kernelUFFD) wake(start uint64, len int) error {
+	cUR := C.struct_uffdio_range{
+		start: C.ulonglong(start),
+		len:   C.ulonglong(len),
+	}
+
+	return ioctl(uintptr(u.fd), int(C.const_UFFDIO_WAKE), unsafe.Pointer(&cUR))
+}
+
+func (u *kernelUFFD) registerWriteProtect(start, len uint64) error {
+	cUR := C.struct_uffdio_register{
+		_range: C.struct_uffdio_range{
+			start: C.ulonglong(start),
+			len:   C.ulonglong(len),
+		},
+		mode: C.ulonglong(C.const_UFFDIO_REGISTER_MODE_MISSING | C.const_UFFDIO_REGISTER_MODE_WP),
+	}
+
+	return ioctl(uintptr(u.fd), int(C.const_UFFDIO_REGISTER), unsafe.Pointer(&cUR))
+}
+
+func (u *kernelUFFD) writeProtect(start, len uint64, wp bool) error {
+	cWP := C.struct_uffdio_writeprotect{
+		_range: C.struct_uffdio_range{
+			start: C.ulonglong(start),
+			len:   C.ulonglong(len),
+		},
+	}
+	if wp {
+		cWP.mode = C.ulonglong(C.const_UFFDIO_WRITEPROTECT_MODE_WP)
+	}
+
+	return ioctl(uintptr(u.fd), int(C.const_UFFDIO_WRITEPROTECT), unsafe.Pointer(&cWP))
+}
+
+func ioctl(fd uintptr, request int, argp unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(
+		unix.SYS_IOCTL,
+		fd,
+		uintptr(request),
+		// Note that the conversion from unsafe.Pointer to uintptr _must_
+		// occur in the call expression.  See the package unsafe documentation
+		// for more details.
+		uintptr(argp),
+	)
+	if errno != 0 {
+		return os.NewSyscallError("ioctl", errno)
+	}
+
+	return nil
+}
+
+//nolint:deadcode,unused
+func registerForUpf(startAddress []byte, len uint64) int {
+	return int(C.register_for_upf(unsafe.Pointer(&startAddress[0]), C.ulong(len)))
+}
+
+func sizeOfUFFDMsg() int {
+	return C.sizeof_struct_uffd_msg
+}
+
+func uffdPageFault() uint8 {
+	return uint8(C.const_UFFD_EVENT_PAGEFAULT)
+}
+
+func uffdEventFork() uint8 {
+	return uint8(C.const_UFFD_EVENT_FORK)
+}
+
+func uffdEventRemap() uint8 {
+	return uint8(C.const_UFFD_EVENT_REMAP)
+}
+
+func uffdEventRemove() uint8 {
+	return uint8(C.const_UFFD_EVENT_REMOVE)
+}
+
+func uffdEventUnmap() uint8 {
+	return uint8(C.const_UFFD_EVENT_UNMAP)
+}
+
+// uffdFlagWrite The page fault is a write
+func uffdFlagWrite() uint64 {
+	return uint64(C.const_UFFD_PAGEFAULT_FLAG_WRITE)
+}
+
+// uffdFlagWP The page fault is a write to a write-protected page
+func uffdFlagWP() uint64 {
+	return uint64(C.const_UFFD_PAGEFAULT_FLAG_WP)
+}
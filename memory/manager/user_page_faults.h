@@ -36,7 +36,21 @@
 int const_UFFDIO_WAKE = UFFDIO_WAKE;
 int const_UFFDIO_COPY = UFFDIO_COPY;
 int const_UFFD_EVENT_PAGEFAULT = UFFD_EVENT_PAGEFAULT;
+int const_UFFD_EVENT_FORK = UFFD_EVENT_FORK;
+int const_UFFD_EVENT_REMAP = UFFD_EVENT_REMAP;
+int const_UFFD_EVENT_REMOVE = UFFD_EVENT_REMOVE;
+int const_UFFD_EVENT_UNMAP = UFFD_EVENT_UNMAP;
 int const_UFFDIO_COPY_MODE_DONTWAKE = UFFDIO_COPY_MODE_DONTWAKE;
+int const_UFFDIO_ZEROPAGE = UFFDIO_ZEROPAGE;
+int const_UFFDIO_ZEROPAGE_MODE_DONTWAKE = UFFDIO_ZEROPAGE_MODE_DONTWAKE;
+int const_UFFDIO_REGISTER = UFFDIO_REGISTER;
+int const_UFFDIO_REGISTER_MODE_MISSING = UFFDIO_REGISTER_MODE_MISSING;
+int const_UFFDIO_REGISTER_MODE_WP = UFFDIO_REGISTER_MODE_WP;
+int const_UFFDIO_COPY_MODE_WP = UFFDIO_COPY_MODE_WP;
+int const_UFFDIO_WRITEPROTECT = UFFDIO_WRITEPROTECT;
+int const_UFFDIO_WRITEPROTECT_MODE_WP = UFFDIO_WRITEPROTECT_MODE_WP;
+int const_UFFD_PAGEFAULT_FLAG_WRITE = UFFD_PAGEFAULT_FLAG_WRITE;
+int const_UFFD_PAGEFAULT_FLAG_WP = UFFD_PAGEFAULT_FLAG_WP;
 
 #define errExit(msg) \
     do { perror(msg); exit(EXIT_FAILURE); } while (0)
@@ -0,0 +1,207 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"errors"
+	"math/bits"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// Modes of a VM in the memory manager
+const (
+	RecordMode = "record" // the pages the VM touches are recorded
+	ReplayMode = "replay" // the recorded pages are installed upon the first page fault
+)
+
+// faultKind Where the page that a page fault is served with comes from
+type faultKind int
+
+const (
+	faultWorkingSet faultKind = iota // the working set, or the trace in the hybrid mode
+	faultGuestMem                    // the guest memory file, i.e., a page missing from the working set
+	faultZero                        // a zero page in place of a page that the VMM has freed
+	numFaultKinds
+)
+
+var faultKindNames = [numFaultKinds]string{"WorkingSet", "GuestMemory", "Zero"}
+
+// latencyBuckets Number of the buckets of a fault-latency histogram. The upper bound
+// of the i-th bucket is 2^i microseconds, the last bucket has no upper bound.
+const latencyBuckets = 22
+
+// latencyHistogram Distribution of the latencies of the page faults,
+// updated by the goroutine that serves the VM and read while it runs
+type latencyHistogram struct {
+	counts [latencyBuckets]uint64 // atomic
+	sum    int64                  // in nanoseconds, atomic
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	bucket := bits.Len64(uint64(d / time.Microsecond))
+	if bucket >= latencyBuckets {
+		bucket = latencyBuckets - 1
+	}
+
+	atomic.AddUint64(&h.counts[bucket], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// LatencyHistogram Distribution of the latencies of the page faults of one kind
+type LatencyHistogram struct {
+	Name string
+	// Bounds Exclusive upper bounds of the buckets, the last bucket has no upper bound
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+func (h *latencyHistogram) export(name string) LatencyHistogram {
+	out := LatencyHistogram{
+		Name:   name,
+		Bounds: make([]time.Duration, latencyBuckets-1),
+		Counts: make([]uint64, latencyBuckets),
+		Sum:    time.Duration(atomic.LoadInt64(&h.sum)),
+	}
+
+	for i := range out.Counts {
+		out.Counts[i] = atomic.LoadUint64(&h.counts[i])
+		out.Count += out.Counts[i]
+	}
+	for i := range out.Bounds {
+		out.Bounds[i] = time.Duration(1<<i) * time.Microsecond
+	}
+
+	return out
+}
+
+// FaultCounters Counters of the current activation of a VM, or of the last one
+// if the VM is not active
+type FaultCounters struct {
+	Served      int64 // page faults served
+	Missed      int64 // pages served that are missing from the trace, in the replay mode
+	TraceFaults int64 // page faults on the pages of the working set before they are installed
+	Prefetched  int64 // pages of the working set installed in the background
+	ZeroPages   int64 // zero pages of the working set installed
+	Dirtied     int64 // pages written, if the dirty pages are tracked
+}
+
+// VMInfo The state of a VM registered with the memory manager
+type VMInfo struct {
+	VMID         string
+	IsActive     bool
+	Mode         string // RecordMode or ReplayMode
+	IsLazyMode   bool
+	IsHybridMode bool
+	// IsTrackingDirty The dirty pages are tracked, unless the kernel does not support it
+	IsTrackingDirty bool
+	// Recordings Number of the invocations recorded so far to build the working set
+	Recordings      int
+	TraceLen        int // pages
+	NumRegions      int // contiguous regions of the trace
+	WorkingSetBytes int // stored in the working set file, without the zero pages
+	Faults          FaultCounters
+	Latency         []LatencyHistogram // since the VM is registered, by the kind of the page fault
+}
+
+// info Returns the state of the VM, the VM may be running
+func (s *SnapshotState) info() *VMInfo {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+
+	info := &VMInfo{
+		VMID:            s.VMID,
+		IsActive:        s.isActive,
+		Mode:            RecordMode,
+		IsLazyMode:      s.IsLazyMode,
+		IsHybridMode:    s.IsHybridMode,
+		Recordings:      len(s.recorded),
+		IsTrackingDirty: s.trackDirty,
+		Faults: FaultCounters{
+			Served:      atomic.LoadInt64(&s.servedNum),
+			Missed:      atomic.LoadInt64(&s.uniqueNum),
+			TraceFaults: atomic.LoadInt64(&s.traceFaultNum),
+			Prefetched:  atomic.LoadInt64(&s.prefetchedNum),
+			ZeroPages:   atomic.LoadInt64(&s.zeroNum),
+			Dirtied:     atomic.LoadInt64(&s.dirtyNum),
+		},
+	}
+
+	if s.isRecordReady {
+		info.Mode = ReplayMode
+	}
+
+	// the trace grows while the VM is recorded
+	s.trace.Lock()
+	info.TraceLen = len(s.trace.trace)
+	info.NumRegions = len(s.trace.regions)
+	s.trace.Unlock()
+
+	if s.wsMeta != nil {
+		info.WorkingSetBytes = s.wsMeta.DataSize()
+	}
+
+	for kind := range s.faultLatency {
+		info.Latency = append(info.Latency, s.faultLatency[kind].export(faultKindNames[kind]))
+	}
+
+	return info
+}
+
+// GetVMInfo Returns the state of the VM. Safe to call while the VM is active.
+func (m *MemoryManager) GetVMInfo(vmID string) (*VMInfo, error) {
+	m.Lock()
+	state, ok := m.instances[vmID]
+	m.Unlock()
+
+	if !ok {
+		return nil, errors.New("VM not registered with the memory manager")
+	}
+
+	return state.info(), nil
+}
+
+// ListVMs Returns the state of all VMs registered with the memory manager,
+// sorted by the VM ID. Safe to call while the VMs are active.
+func (m *MemoryManager) ListVMs() []*VMInfo {
+	m.Lock()
+	states := make([]*SnapshotState, 0, len(m.instances))
+	for _, state := range m.instances {
+		states = append(states, state)
+	}
+	m.Unlock()
+
+	infos := make([]*VMInfo, 0, len(states))
+	for _, state := range states {
+		infos = append(infos, state.info())
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].VMID < infos[j].VMID
+	})
+
+	return infos
+}
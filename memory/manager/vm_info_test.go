@@ -0,0 +1,120 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+
+	h.observe(500 * time.Nanosecond)
+	h.observe(3 * time.Microsecond)
+	h.observe(time.Hour)
+
+	out := h.export("Test")
+	require.Len(t, out.Counts, len(out.Bounds)+1, "The last bucket must have no upper bound")
+	require.Equal(t, uint64(3), out.Count)
+	require.Equal(t, time.Hour+3*time.Microsecond+500*time.Nanosecond, out.Sum)
+	require.Equal(t, uint64(1), out.Counts[0], "Below 1us")
+	require.Equal(t, uint64(1), out.Counts[2], "In [2us, 4us)")
+	require.Equal(t, 4*time.Microsecond, out.Bounds[2])
+	require.Equal(t, uint64(1), out.Counts[latencyBuckets-1], "Beyond the last bound")
+}
+
+func TestVMInfo(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+
+	cfg := SnapshotStateCfg{
+		VMID:           "2",
+		BaseDir:        dir,
+		GuestMemPath:   filepath.Join(dir, "mem_file"),
+		WorkingSetPath: filepath.Join(dir, "working_set_pages"),
+		GuestMemSize:   16 * pageSize,
+	}
+	prepareGuestMem(t, cfg.GuestMemPath, 16)
+
+	// pages 0 and 1, then 4, are contiguous in the guest memory
+	trace := initTrace()
+	for _, page := range []uint64{0, 1, 4} {
+		trace.AppendRecord(Record{offset: page * uint64(pageSize)})
+	}
+	_, err := trace.ProcessRecord(openGuestMem(t, cfg.GuestMemPath), cfg.WorkingSetPath, snapshotOf(t, cfg), cfg.GuestMemSize, 0, false)
+	require.NoError(t, err, "Failed to process the record")
+
+	m := NewMemoryManager(MemoryManagerCfg{})
+	require.NoError(t, m.RegisterVM(cfg), "Failed to register the recorded VM")
+
+	recording := cfg
+	recording.VMID = "1"
+	recording.WorkingSetPath = filepath.Join(dir, "missing")
+	require.NoError(t, m.RegisterVM(recording), "Failed to register the VM")
+
+	_, err = m.GetVMInfo("3")
+	require.Error(t, err, "VM is not registered")
+
+	state := m.instances["2"]
+	state.isActive = true
+
+	// the VM is being served while it is introspected
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			atomic.AddInt64(&state.servedNum, 1)
+			state.faultLatency[faultWorkingSet].observe(time.Microsecond)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		_, err := m.GetVMInfo("2")
+		require.NoError(t, err)
+	}
+	wg.Wait()
+
+	infos := m.ListVMs()
+	require.Len(t, infos, 2)
+	require.Equal(t, "1", infos[0].VMID, "VMs must be sorted by the ID")
+	require.Equal(t, RecordMode, infos[0].Mode)
+	require.False(t, infos[0].IsActive)
+
+	info := infos[1]
+	require.True(t, info.IsActive)
+	require.Equal(t, ReplayMode, info.Mode)
+	require.Equal(t, 3, info.TraceLen)
+	require.Equal(t, 2, info.NumRegions)
+	require.Equal(t, 3*pageSize, info.WorkingSetBytes)
+	require.Equal(t, int64(100), info.Faults.Served)
+	require.Len(t, info.Latency, int(numFaultKinds))
+	require.Equal(t, faultKindNames[faultWorkingSet], info.Latency[faultWorkingSet].Name)
+	require.Equal(t, uint64(100), info.Latency[faultWorkingSet].Count)
+}
@@ -0,0 +1,255 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vhive-serverless/vhive/memory/wsfile"
+)
+
+const (
+	defaultWorkers   = 4
+	defaultChunkSize = 2 * 1024 * 1024
+)
+
+// wsSegment A part of a region of the working set that lies within a chunk
+type wsSegment struct {
+	offset   uint64 // in the guest memory file
+	page     int    // index of the first page in the working set
+	numPages int
+}
+
+// wsChunk A part of the working set that is fetched and installed as a whole
+type wsChunk struct {
+	start, end int // pages of the working set
+	segments   []wsSegment
+	fetched    chan struct{}
+	err        error // valid once fetched is closed
+}
+
+// wsPipeline Fetches the working set in chunks, so that the installation of a chunk
+// overlaps with the fetching of the next ones. If the working set file is compressed,
+// the chunks are those of the file, each decompressed by the worker that fetched it.
+type wsPipeline struct {
+	ws         *wsfile.WorkingSet
+	pageSize   int
+	chunkPages int
+	chunks     []*wsChunk
+	done       chan struct{} // closed once all chunks are fetched
+
+	// Stats
+	fetchTime time.Duration // until all chunks are fetched
+	fetchWait int64         // ns the installation waited for the chunks, atomic
+	// ns spent decompressing the chunks, summed over the workers, atomic
+	decompressTime int64
+}
+
+// newWSPipeline Splits the working set into chunks of the given size in bytes,
+// unless the working set file is compressed in chunks of its own.
+// The chunks follow the order of the pages in the working set file.
+func newWSPipeline(ws *wsfile.WorkingSet, chunkSize int) *wsPipeline {
+	p := &wsPipeline{
+		ws:         ws,
+		pageSize:   ws.PageSize,
+		chunkPages: chunkSize / ws.PageSize,
+		done:       make(chan struct{}),
+	}
+	if ws.IsCompressed() {
+		p.chunkPages = ws.ChunkPages
+	}
+	if p.chunkPages < 1 {
+		p.chunkPages = 1
+	}
+
+	numPages := ws.NumPages()
+	for start := 0; start < numPages; start += p.chunkPages {
+		end := start + p.chunkPages
+		if end > numPages {
+			end = numPages
+		}
+		p.chunks = append(p.chunks, &wsChunk{start: start, end: end, fetched: make(chan struct{})})
+	}
+
+	var page int
+	for _, r := range ws.Regions {
+		offset := r.Offset
+		for left := r.NumPages; left > 0; {
+			c := p.chunks[p.chunkOf(page)]
+			n := c.end - page
+			if n > left {
+				n = left
+			}
+			c.segments = append(c.segments, wsSegment{offset: offset, page: page, numPages: n})
+
+			offset += uint64(n * ws.PageSize)
+			page += n
+			left -= n
+		}
+	}
+
+	return p
+}
+
+// chunkOf Returns the index of the chunk with the page of the working set
+func (p *wsPipeline) chunkOf(page int) int {
+	return page / p.chunkPages
+}
+
+// fetch Starts fetching the chunks of the working set file into the buffer
+// with the given number of workers, in the order of the chunks. If the file
+// cannot be opened, all chunks fail, so that their pages are installed from
+// the guest memory file instead.
+func (p *wsPipeline) fetch(path string, buf []byte, workers int) error {
+	// O_DIRECT allows to fully leverage disk bandwidth by bypassing the OS page cache
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_DIRECT, 0600)
+	if err != nil {
+		log.Errorf("Failed to open the working set file for direct-io: %v\n", err)
+		for _, c := range p.chunks {
+			c.err = err
+			close(c.fetched)
+		}
+		close(p.done)
+		return err
+	}
+
+	tStart := time.Now()
+	pageSize := p.pageSize
+
+	queue := make(chan *wsChunk, len(p.chunks))
+	for _, c := range p.chunks {
+		queue <- c
+	}
+	close(queue)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for c := range queue {
+				// direct io requires aligned buffer, the chunks are page-aligned
+				dst := buf[c.start*pageSize : c.end*pageSize]
+				if p.ws.IsCompressed() {
+					c.err = p.fetchCompressed(f, p.chunkOf(c.start), dst)
+				} else if n, err := f.ReadAt(dst, p.ws.DataOffset+int64(c.start*pageSize)); n != len(dst) {
+					c.err = fmt.Errorf("reading working set file failed: %v", err)
+				}
+				if c.err == nil {
+					c.err = p.verify(c, dst)
+				}
+				if c.err != nil {
+					log.Error(c.err)
+				}
+				close(c.fetched)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		p.fetchTime = time.Since(tStart)
+
+		if err := f.Close(); err != nil {
+			log.Errorf("Failed to close the working set file: %v\n", err)
+		}
+		close(p.done)
+	}()
+
+	return nil
+}
+
+// fetchCompressed Reads the i-th compressed chunk with the padding that follows it,
+// as direct io reads whole pages, and decompresses it into dst
+func (p *wsPipeline) fetchCompressed(f *os.File, i int, dst []byte) error {
+	c := p.ws.Chunks[i]
+
+	src := AlignedBlock((c.Size + p.pageSize - 1) / p.pageSize * p.pageSize)
+	if n, err := f.ReadAt(src, c.Offset); n < c.Size {
+		return fmt.Errorf("reading working set file failed: %v", err)
+	}
+
+	tStart := time.Now()
+	defer func() {
+		atomic.AddInt64(&p.decompressTime, int64(time.Since(tStart)))
+	}()
+
+	return p.ws.DecompressChunk(i, src, dst)
+}
+
+// verify Checks the pages of the fetched chunk against their checksums, if the file has them,
+// so that the pages of a corrupted chunk are installed from the guest memory file instead
+func (p *wsPipeline) verify(c *wsChunk, buf []byte) error {
+	if p.ws.Checksums == nil {
+		return nil
+	}
+
+	for i := c.start; i < c.end; i++ {
+		page := buf[(i-c.start)*p.pageSize : (i-c.start+1)*p.pageSize]
+		if err := p.ws.VerifyPage(i, page); err != nil {
+			return fmt.Errorf("corrupted working set file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// waitChunk Waits until the chunk is fetched
+func (p *wsPipeline) waitChunk(c *wsChunk) error {
+	select {
+	case <-c.fetched:
+		return c.err
+	default:
+	}
+
+	tStart := time.Now()
+	<-c.fetched
+	atomic.AddInt64(&p.fetchWait, int64(time.Since(tStart)))
+
+	return c.err
+}
+
+// isFetched Returns true if the page of the working set has been fetched successfully
+func (p *wsPipeline) isFetched(page int) bool {
+	c := p.chunks[p.chunkOf(page)]
+
+	select {
+	case <-c.fetched:
+		return c.err == nil
+	default:
+		return false
+	}
+}
+
+// wait Waits until all chunks are fetched
+func (p *wsPipeline) wait() {
+	<-p.done
+}
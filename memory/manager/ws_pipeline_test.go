@@ -0,0 +1,209 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package manager
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/vhive-serverless/vhive/memory/wsfile"
+)
+
+func TestWSPipelineChunks(t *testing.T) {
+	pageSize := os.Getpagesize()
+
+	ws := &wsfile.WorkingSet{
+		PageSize:     pageSize,
+		GuestMemSize: 16 * pageSize,
+		Regions: []wsfile.Region{
+			{Offset: uint64(8 * pageSize), NumPages: 3},
+			{Offset: 0, NumPages: 2},
+		},
+	}
+
+	p := newWSPipeline(ws, 2*pageSize)
+	require.Len(t, p.chunks, 3)
+
+	// the regions are split at the chunk boundaries
+	require.Equal(t, []wsSegment{{offset: uint64(8 * pageSize), page: 0, numPages: 2}}, p.chunks[0].segments)
+	require.Equal(t, []wsSegment{
+		{offset: uint64(10 * pageSize), page: 2, numPages: 1},
+		{offset: 0, page: 3, numPages: 1},
+	}, p.chunks[1].segments)
+	require.Equal(t, []wsSegment{{offset: uint64(pageSize), page: 4, numPages: 1}}, p.chunks[2].segments)
+	require.Equal(t, 2, p.chunkOf(4))
+}
+
+func TestWSPipelineFetch(t *testing.T) {
+	t.Run("raw", func(t *testing.T) { testWSPipelineFetch(t, 0, false) })
+	t.Run("compressed", func(t *testing.T) { testWSPipelineFetch(t, 3, false) })
+	t.Run("checksums", func(t *testing.T) { testWSPipelineFetch(t, 0, true) })
+	t.Run("compressed checksums", func(t *testing.T) { testWSPipelineFetch(t, 3, true) })
+}
+
+func testWSPipelineFetch(t *testing.T, chunkPages int, withChecksums bool) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+	guestMemPath := filepath.Join(dir, "mem_file")
+	wsPath := filepath.Join(dir, "working_set_pages")
+	prepareGuestMem(t, guestMemPath, 16)
+
+	// O_DIRECT is not supported by some file systems, e.g., tmpfs
+	if f, err := os.OpenFile(guestMemPath, os.O_RDONLY|syscall.O_DIRECT, 0600); err != nil {
+		t.Skipf("Direct I/O is not supported in %s: %v", dir, err)
+	} else {
+		f.Close()
+	}
+
+	trace := initTrace()
+	for _, page := range []uint64{3, 4, 5, 12, 0, 1, 9} {
+		trace.AppendRecord(Record{offset: page * uint64(pageSize)})
+	}
+	ws, err := trace.ProcessRecord(openGuestMem(t, guestMemPath), wsPath, wsfile.SnapshotID{}, 16*pageSize, chunkPages, withChecksums)
+	require.NoError(t, err, "Failed to process the record")
+	require.Equal(t, withChecksums, ws.Checksums != nil)
+
+	buf := AlignedBlock(ws.DataSize())
+	p := newWSPipeline(ws, 2*pageSize)
+	if chunkPages > 0 {
+		require.Len(t, p.chunks, 3, "The chunks of the compressed file must be kept")
+	}
+	require.NoError(t, p.fetch(wsPath, buf, 3), "Failed to start fetching")
+
+	for _, c := range p.chunks {
+		require.NoError(t, p.waitChunk(c), "Failed to fetch a chunk")
+	}
+	p.wait()
+
+	for i := 0; i < ws.NumPages(); i++ {
+		require.True(t, p.isFetched(i))
+	}
+
+	mem, err := os.ReadFile(guestMemPath)
+	require.NoError(t, err)
+
+	for i, offset := range ws.PageOffsets() {
+		require.True(t, bytes.Equal(mem[offset:offset+uint64(pageSize)], buf[i*pageSize:(i+1)*pageSize]),
+			"Page %d differs from the guest memory", i)
+	}
+}
+
+func TestWSPipelineFetchCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+	guestMemPath := filepath.Join(dir, "mem_file")
+	wsPath := filepath.Join(dir, "working_set_pages")
+	prepareGuestMem(t, guestMemPath, 16)
+
+	// O_DIRECT is not supported by some file systems, e.g., tmpfs
+	if f, err := os.OpenFile(guestMemPath, os.O_RDONLY|syscall.O_DIRECT, 0600); err != nil {
+		t.Skipf("Direct I/O is not supported in %s: %v", dir, err)
+	} else {
+		f.Close()
+	}
+
+	trace := initTrace()
+	for _, page := range []uint64{3, 4, 5, 12} {
+		trace.AppendRecord(Record{offset: page * uint64(pageSize)})
+	}
+	ws, err := trace.ProcessRecord(openGuestMem(t, guestMemPath), wsPath, wsfile.SnapshotID{}, 16*pageSize, 0, true)
+	require.NoError(t, err, "Failed to process the record")
+
+	// flip a byte of the third page, which belongs to the second chunk
+	f, err := os.OpenFile(wsPath, os.O_RDWR, 0600)
+	require.NoError(t, err)
+	b := make([]byte, 1)
+	offset := ws.DataOffset + int64(2*pageSize)
+	_, err = f.ReadAt(b, offset)
+	require.NoError(t, err)
+	b[0] ^= 0xff
+	_, err = f.WriteAt(b, offset)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	buf := AlignedBlock(ws.DataSize())
+	p := newWSPipeline(ws, 2*pageSize)
+	require.NoError(t, p.fetch(wsPath, buf, 2), "Failed to start fetching")
+
+	require.NoError(t, p.waitChunk(p.chunks[0]), "The intact chunk must be fetched")
+	require.Error(t, p.waitChunk(p.chunks[1]), "The corrupted chunk must be rejected")
+	p.wait()
+}
+
+func TestWSPipelineFetchMissing(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+	guestMemPath := filepath.Join(dir, "mem_file")
+	wsPath := filepath.Join(dir, "working_set_pages")
+	prepareGuestMem(t, guestMemPath, 16)
+
+	trace := initTrace()
+	for _, page := range []uint64{3, 4, 5, 12} {
+		trace.AppendRecord(Record{offset: page * uint64(pageSize)})
+	}
+	ws, err := trace.ProcessRecord(openGuestMem(t, guestMemPath), wsPath, wsfile.SnapshotID{}, 16*pageSize, 0, false)
+	require.NoError(t, err, "Failed to process the record")
+	require.NoError(t, os.Remove(wsPath))
+
+	buf := AlignedBlock(ws.DataSize())
+	p := newWSPipeline(ws, 2*pageSize)
+	require.Error(t, p.fetch(wsPath, buf, 2), "The missing file must not be fetched")
+
+	for i, c := range p.chunks {
+		require.Error(t, p.waitChunk(c), "Chunk %d of the missing file must fail", i)
+	}
+	for i := 0; i < ws.NumPages(); i++ {
+		require.False(t, p.isFetched(i))
+	}
+	p.wait()
+}
+
+func TestFetchStateHybrid(t *testing.T) {
+	dir := t.TempDir()
+	pageSize := os.Getpagesize()
+
+	cfg := SnapshotStateCfg{
+		VMID:           "1",
+		VMMStatePath:   filepath.Join(dir, "snap_file"),
+		WorkingSetPath: filepath.Join(dir, "working_set_pages"),
+		GuestMemSize:   4 * pageSize,
+		IsHybridMode:   true,
+	}
+	require.NoError(t, os.WriteFile(cfg.VMMStatePath, []byte("state"), 0644))
+
+	state := NewSnapshotState(cfg)
+	state.wsMeta = &wsfile.WorkingSet{
+		PageSize:     pageSize,
+		GuestMemSize: cfg.GuestMemSize,
+		Regions:      []wsfile.Region{{Offset: 0, NumPages: 2}},
+	}
+
+	// the working set file does not exist, it must not be fetched
+	require.NoError(t, state.fetchState())
+	require.Nil(t, state.pipeline, "Hybrid mode must prefetch from the guest memory file")
+}
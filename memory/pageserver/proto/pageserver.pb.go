@@ -0,0 +1,291 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: pageserver.proto
+
+package proto
+
+import (
+	context "context"
+	fmt "fmt"
+	math "math"
+
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+// A range of a guest memory file, in bytes
+type Range struct {
+	Offset               uint64   `protobuf:"varint,1,opt,name=offset,proto3" json:"offset,omitempty"`
+	Length               uint64   `protobuf:"varint,2,opt,name=length,proto3" json:"length,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Range) Reset()         { *m = Range{} }
+func (m *Range) String() string { return proto.CompactTextString(m) }
+func (*Range) ProtoMessage()    {}
+func (*Range) Descriptor() ([]byte, []int) {
+	return fileDescriptor_119d6a6e88e71f5f, []int{0}
+}
+
+func (m *Range) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Range.Unmarshal(m, b)
+}
+func (m *Range) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Range.Marshal(b, m, deterministic)
+}
+func (m *Range) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Range.Merge(m, src)
+}
+func (m *Range) XXX_Size() int {
+	return xxx_messageInfo_Range.Size(m)
+}
+func (m *Range) XXX_DiscardUnknown() {
+	xxx_messageInfo_Range.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Range proto.InternalMessageInfo
+
+func (m *Range) GetOffset() uint64 {
+	if m != nil {
+		return m.Offset
+	}
+	return 0
+}
+
+func (m *Range) GetLength() uint64 {
+	if m != nil {
+		return m.Length
+	}
+	return 0
+}
+
+type ReadPagesReq struct {
+	// Path of the guest memory file, relative to the root of the server
+	Snapshot             string   `protobuf:"bytes,1,opt,name=snapshot,proto3" json:"snapshot,omitempty"`
+	Ranges               []*Range `protobuf:"bytes,2,rep,name=ranges,proto3" json:"ranges,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReadPagesReq) Reset()         { *m = ReadPagesReq{} }
+func (m *ReadPagesReq) String() string { return proto.CompactTextString(m) }
+func (*ReadPagesReq) ProtoMessage()    {}
+func (*ReadPagesReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_119d6a6e88e71f5f, []int{1}
+}
+
+func (m *ReadPagesReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReadPagesReq.Unmarshal(m, b)
+}
+func (m *ReadPagesReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReadPagesReq.Marshal(b, m, deterministic)
+}
+func (m *ReadPagesReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReadPagesReq.Merge(m, src)
+}
+func (m *ReadPagesReq) XXX_Size() int {
+	return xxx_messageInfo_ReadPagesReq.Size(m)
+}
+func (m *ReadPagesReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReadPagesReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReadPagesReq proto.InternalMessageInfo
+
+func (m *ReadPagesReq) GetSnapshot() string {
+	if m != nil {
+		return m.Snapshot
+	}
+	return ""
+}
+
+func (m *ReadPagesReq) GetRanges() []*Range {
+	if m != nil {
+		return m.Ranges
+	}
+	return nil
+}
+
+type ReadPagesResp struct {
+	// The contents of the ranges, one after another
+	Data                 []byte   `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReadPagesResp) Reset()         { *m = ReadPagesResp{} }
+func (m *ReadPagesResp) String() string { return proto.CompactTextString(m) }
+func (*ReadPagesResp) ProtoMessage()    {}
+func (*ReadPagesResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_119d6a6e88e71f5f, []int{2}
+}
+
+func (m *ReadPagesResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReadPagesResp.Unmarshal(m, b)
+}
+func (m *ReadPagesResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReadPagesResp.Marshal(b, m, deterministic)
+}
+func (m *ReadPagesResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReadPagesResp.Merge(m, src)
+}
+func (m *ReadPagesResp) XXX_Size() int {
+	return xxx_messageInfo_ReadPagesResp.Size(m)
+}
+func (m *ReadPagesResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReadPagesResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReadPagesResp proto.InternalMessageInfo
+
+func (m *ReadPagesResp) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*Range)(nil), "pageserver.Range")
+	proto.RegisterType((*ReadPagesReq)(nil), "pageserver.ReadPagesReq")
+	proto.RegisterType((*ReadPagesResp)(nil), "pageserver.ReadPagesResp")
+}
+
+func init() { proto.RegisterFile("pageserver.proto", fileDescriptor_119d6a6e88e71f5f) }
+
+var fileDescriptor_119d6a6e88e71f5f = []byte{
+	// 240 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x90, 0x31, 0x4f, 0xc3, 0x30,
+	0x10, 0x85, 0x69, 0x29, 0x11, 0x3d, 0x8a, 0x04, 0x37, 0xa0, 0xd0, 0xa9, 0x0a, 0x4b, 0x19, 0x48,
+	0xa4, 0x32, 0x30, 0x30, 0x20, 0xfa, 0x0b, 0x2a, 0x23, 0x16, 0x36, 0x97, 0x5e, 0xed, 0x4a, 0x4d,
+	0x6c, 0x7c, 0x26, 0x12, 0xff, 0x1e, 0xd9, 0xae, 0x9a, 0x30, 0xb0, 0xd8, 0x7e, 0xcf, 0xcf, 0xdf,
+	0x3d, 0x19, 0xae, 0xac, 0x54, 0xc4, 0xe4, 0x5a, 0x72, 0xa5, 0x75, 0xc6, 0x1b, 0x84, 0xce, 0x29,
+	0x9e, 0xe0, 0x4c, 0xc8, 0x46, 0x11, 0xde, 0x40, 0x66, 0xb6, 0x5b, 0x26, 0x9f, 0x0f, 0x66, 0x83,
+	0xf9, 0x48, 0x1c, 0x54, 0xf0, 0xf7, 0xd4, 0x28, 0xaf, 0xf3, 0x61, 0xf2, 0x93, 0x2a, 0xde, 0x61,
+	0x22, 0x48, 0x6e, 0x56, 0x01, 0x25, 0xe8, 0x0b, 0xa7, 0x70, 0xce, 0x8d, 0xb4, 0xac, 0x4d, 0x22,
+	0x8c, 0xc5, 0x51, 0xe3, 0x3d, 0x64, 0x2e, 0x0c, 0xe1, 0x7c, 0x38, 0x3b, 0x9d, 0x5f, 0x2c, 0xae,
+	0xcb, 0x5e, 0xa7, 0x38, 0x5e, 0x1c, 0x02, 0xc5, 0x1d, 0x5c, 0xf6, 0xb0, 0x6c, 0x11, 0x61, 0xb4,
+	0x91, 0x5e, 0x46, 0xe6, 0x44, 0xc4, 0xf3, 0x62, 0x05, 0x10, 0x02, 0x6f, 0x11, 0x80, 0x4b, 0x18,
+	0x1f, 0x9f, 0x60, 0xfe, 0x07, 0xdd, 0x2b, 0x38, 0xbd, 0xfd, 0xe7, 0x86, 0x6d, 0x71, 0xb2, 0x7c,
+	0xfd, 0x78, 0x51, 0x3b, 0xaf, 0xbf, 0xd7, 0xe5, 0xa7, 0xa9, 0xab, 0x56, 0xef, 0x5a, 0x7a, 0x48,
+	0xd1, 0x3d, 0x31, 0x27, 0xa3, 0xaa, 0xa9, 0x36, 0xee, 0xa7, 0xea, 0x30, 0x55, 0xfc, 0xcf, 0xe7,
+	0xb8, 0xae, 0xb3, 0xb8, 0x3d, 0xfe, 0x0e, 0x00, 0xb6, 0x34, 0x93, 0x24, 0x70, 0x01, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// PageServerClient is the client API for PageServer service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type PageServerClient interface {
+	ReadPages(ctx context.Context, in *ReadPagesReq, opts ...grpc.CallOption) (*ReadPagesResp, error)
+}
+
+type pageServerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPageServerClient(cc grpc.ClientConnInterface) PageServerClient {
+	return &pageServerClient{cc}
+}
+
+func (c *pageServerClient) ReadPages(ctx context.Context, in *ReadPagesReq, opts ...grpc.CallOption) (*ReadPagesResp, error) {
+	out := new(ReadPagesResp)
+	err := c.cc.Invoke(ctx, "/pageserver.PageServer/ReadPages", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PageServerServer is the server API for PageServer service.
+type PageServerServer interface {
+	ReadPages(context.Context, *ReadPagesReq) (*ReadPagesResp, error)
+}
+
+// UnimplementedPageServerServer can be embedded to have forward compatible implementations.
+type UnimplementedPageServerServer struct {
+}
+
+func (*UnimplementedPageServerServer) ReadPages(ctx context.Context, req *ReadPagesReq) (*ReadPagesResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReadPages not implemented")
+}
+
+func RegisterPageServerServer(s *grpc.Server, srv PageServerServer) {
+	s.RegisterService(&_PageServer_serviceDesc, srv)
+}
+
+func _PageServer_ReadPages_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReadPagesReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PageServerServer).ReadPages(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pageserver.PageServer/ReadPages",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PageServerServer).ReadPages(ctx, req.(*ReadPagesReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _PageServer_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "pageserver.PageServer",
+	HandlerType: (*PageServerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ReadPages",
+			Handler:    _PageServer_ReadPages_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "pageserver.proto",
+}
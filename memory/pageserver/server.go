@@ -0,0 +1,99 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package pageserver Serves the pages of the guest memory files of the snapshots over gRPC,
+// e.g., to restore the VMs on the nodes that do not hold the snapshots
+package pageserver
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/vhive-serverless/vhive/memory/pageserver/proto"
+)
+
+// MaxBatchSize The largest number of bytes served in one request,
+// within the default gRPC message size limit
+const MaxBatchSize = 2 * 1024 * 1024
+
+// Server Serves the guest memory files under the root directory
+type Server struct {
+	pb.UnimplementedPageServerServer
+	root string
+}
+
+// NewServer Returns the server of the guest memory files under the root directory
+func NewServer(root string) *Server {
+	return &Server{root: root}
+}
+
+// Serve Serves the guest memory files under the root directory on the listener
+// until it fails
+func Serve(lis net.Listener, root string) error {
+	s := grpc.NewServer()
+	pb.RegisterPageServerServer(s, NewServer(root))
+
+	log.Infof("Serving the pages of the snapshots in %s on %s", root, lis.Addr())
+
+	return s.Serve(lis)
+}
+
+// ReadPages Returns the contents of the ranges of a guest memory file
+func (s *Server) ReadPages(ctx context.Context, req *pb.ReadPagesReq) (*pb.ReadPagesResp, error) {
+	var size uint64
+	for _, r := range req.GetRanges() {
+		size += r.GetLength()
+		if r.GetLength() > MaxBatchSize || size > MaxBatchSize {
+			return nil, status.Errorf(codes.InvalidArgument, "ranges of more than %d bytes", MaxBatchSize)
+		}
+	}
+
+	// the snapshot must not escape the root
+	path := filepath.Join(s.root, filepath.Clean("/"+req.GetSnapshot()))
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, status.Errorf(codes.NotFound, "snapshot %s not found", req.GetSnapshot())
+	} else if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to open snapshot %s: %v", req.GetSnapshot(), err)
+	}
+	defer f.Close()
+
+	data := make([]byte, size)
+	var pos uint64
+	for _, r := range req.GetRanges() {
+		if _, err := f.ReadAt(data[pos:pos+r.GetLength()], int64(r.GetOffset())); err != nil {
+			return nil, status.Errorf(codes.OutOfRange, "failed to read %d bytes at offset %#x of snapshot %s: %v",
+				r.GetLength(), r.GetOffset(), req.GetSnapshot(), err)
+		}
+		pos += r.GetLength()
+	}
+
+	return &pb.ReadPagesResp{Data: data}, nil
+}
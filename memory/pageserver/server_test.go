@@ -0,0 +1,83 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package pageserver
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/vhive-serverless/vhive/memory/pageserver/proto"
+)
+
+func TestReadPages(t *testing.T) {
+	root := t.TempDir()
+
+	mem := make([]byte, 4*4096)
+	for i := range mem {
+		mem[i] = byte(i / 4096)
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "vm1"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "vm1", "mem_file"), mem, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(root), "secret"), mem, 0644))
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go Serve(lis, root)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	client := pb.NewPageServerClient(conn)
+	ctx := context.Background()
+
+	resp, err := client.ReadPages(ctx, &pb.ReadPagesReq{
+		Snapshot: "vm1/mem_file",
+		Ranges:   []*pb.Range{{Offset: 3 * 4096, Length: 4096}, {Offset: 0, Length: 2 * 4096}},
+	})
+	require.NoError(t, err, "Failed to read pages")
+	require.Equal(t, append(append([]byte{}, mem[3*4096:]...), mem[:2*4096]...), resp.GetData())
+
+	for snapshot, code := range map[string]codes.Code{
+		"vm2/mem_file":     codes.NotFound,
+		"../secret":        codes.NotFound,
+		"vm1/../../secret": codes.NotFound,
+	} {
+		_, err = client.ReadPages(ctx, &pb.ReadPagesReq{Snapshot: snapshot, Ranges: []*pb.Range{{Length: 4096}}})
+		require.Equal(t, code, status.Code(err), snapshot)
+	}
+
+	_, err = client.ReadPages(ctx, &pb.ReadPagesReq{Snapshot: "vm1/mem_file", Ranges: []*pb.Range{{Offset: 4 * 4096, Length: 4096}}})
+	require.Equal(t, codes.OutOfRange, status.Code(err), "Read past the end must fail")
+
+	_, err = client.ReadPages(ctx, &pb.ReadPagesReq{Snapshot: "vm1/mem_file", Ranges: []*pb.Range{{Length: MaxBatchSize + 1}}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "Too large batch must fail")
+}
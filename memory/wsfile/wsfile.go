@@ -0,0 +1,708 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package wsfile Reads and writes the working set files of the REAP snapshots.
+//
+// A working set file starts with a fixed-size header, which identifies the snapshot
+// the working set was recorded from, followed by the region table,
+// the zero region table, the optional per-page first-touch timestamps and checksums,
+// and the pages themselves. The pages of the zero regions are all zeros and are not stored.
+// The pages start at a page-aligned offset, so that they can be read with direct I/O.
+// The pages are stored in the order of the region table, which does not have to be
+// sorted by the guest memory offset. All integers are little-endian.
+//
+// The pages may be compressed with zstd in chunks of a fixed number of pages, so that
+// the chunks can be fetched and decompressed in parallel. Then, the chunk table follows
+// the checksums, and each compressed chunk starts at a page-aligned offset.
+package wsfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Version The version of the format, must be bumped on any change of the layout,
+// so that the files of an older version are not loaded
+const Version = 4
+
+const (
+	// FlagTimestamps The file contains the first-touch timestamps of the pages
+	FlagTimestamps uint32 = 1 << iota
+	// FlagChecksums The file contains the CRC-32C checksums of the pages
+	FlagChecksums
+	// FlagCompressed The pages are compressed in chunks, see the chunk table
+	FlagCompressed
+)
+
+var (
+	magic = [8]byte{'V', 'H', 'I', 'V', 'E', 'W', 'S', 0}
+
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// the decoder is safe for concurrent use by DecodeAll
+	decoder     *zstd.Decoder
+	decoderOnce sync.Once
+)
+
+// header The on-disk header of the file
+type header struct {
+	Magic          [8]byte
+	Version        uint32
+	Flags          uint32
+	PageSize       uint32
+	ChunkPages     uint32
+	GuestMemSize   uint64
+	NumRegions     uint64
+	NumPages       uint64
+	DataOffset     uint64
+	NumZeroRegions uint64
+	SnapshotSize   uint64
+	SnapshotMtime  int64
+}
+
+// regionEntry The on-disk entry of the region table
+type regionEntry struct {
+	Offset   uint64
+	NumPages uint64
+}
+
+// chunkEntry The on-disk entry of the chunk table
+type chunkEntry struct {
+	Offset uint64
+	Size   uint64
+}
+
+var (
+	headerSize = binary.Size(header{})
+	regionSize = binary.Size(regionEntry{})
+	chunkSize  = binary.Size(chunkEntry{})
+)
+
+// Region A contiguous range of the guest memory pages in the working set
+type Region struct {
+	Offset   uint64 // offset in the guest memory, in bytes
+	NumPages int
+}
+
+// Chunk A compressed chunk of the pages in the file
+type Chunk struct {
+	Offset int64 // in the file, page-aligned
+	Size   int   // compressed, in bytes
+}
+
+// SnapshotID Identifies the snapshot that a working set was recorded from,
+// by the size and the modification time of its guest memory file
+type SnapshotID struct {
+	Size  uint64 // in bytes
+	Mtime int64  // in nanoseconds since the epoch
+}
+
+// WorkingSet Describes the contents of a working set file
+type WorkingSet struct {
+	PageSize     int
+	GuestMemSize int
+	Snapshot     SnapshotID
+	Regions      []Region
+	// Pages that are all zeros, they are not stored in the file
+	ZeroRegions []Region
+	// Per page, in the order of the pages in the file; nil if not recorded
+	Timestamps []time.Duration
+	// Per page, like the timestamps; Write computes them if set to NumPages entries
+	Checksums []uint32
+	// Offset of the first page in the file, set by Write and ReadMetadata
+	DataOffset int64
+	// Number of the pages compressed together, 0 if the pages are not compressed
+	ChunkPages int
+	// In the order of the pages, set by Write and ReadMetadata
+	Chunks []Chunk
+}
+
+// NumPages Returns the number of the pages in the working set
+func (ws *WorkingSet) NumPages() int {
+	var n int
+	for _, r := range ws.Regions {
+		n += r.NumPages
+	}
+
+	return n
+}
+
+// NumZeroPages Returns the number of the pages in the zero regions
+func (ws *WorkingSet) NumZeroPages() int {
+	var n int
+	for _, r := range ws.ZeroRegions {
+		n += r.NumPages
+	}
+
+	return n
+}
+
+// DataSize Returns the size of the pages in the file, in bytes
+func (ws *WorkingSet) DataSize() int {
+	return ws.NumPages() * ws.PageSize
+}
+
+// IsCompressed Returns true if the pages are compressed in chunks
+func (ws *WorkingSet) IsCompressed() bool {
+	return ws.ChunkPages > 0
+}
+
+// NumChunks Returns the number of the compressed chunks
+func (ws *WorkingSet) NumChunks() int {
+	if !ws.IsCompressed() {
+		return 0
+	}
+
+	return (ws.NumPages() + ws.ChunkPages - 1) / ws.ChunkPages
+}
+
+// ChunkPageRange Returns the pages of the i-th chunk, from start to end
+func (ws *WorkingSet) ChunkPageRange(i int) (start, end int) {
+	start = i * ws.ChunkPages
+	end = start + ws.ChunkPages
+	if numPages := ws.NumPages(); end > numPages {
+		end = numPages
+	}
+
+	return start, end
+}
+
+// StoredSize Returns the size of the pages as stored in the file, in bytes,
+// i.e., the size of the compressed chunks with the padding that aligns them
+func (ws *WorkingSet) StoredSize() int {
+	if !ws.IsCompressed() || len(ws.Chunks) == 0 {
+		return ws.DataSize()
+	}
+
+	last := ws.Chunks[len(ws.Chunks)-1]
+
+	return int(alignUp(last.Offset+int64(last.Size), ws.PageSize) - ws.DataOffset)
+}
+
+// CompressedSize Returns the size of the compressed chunks, in bytes
+func (ws *WorkingSet) CompressedSize() int {
+	if !ws.IsCompressed() {
+		return ws.DataSize()
+	}
+
+	var n int
+	for _, c := range ws.Chunks {
+		n += c.Size
+	}
+
+	return n
+}
+
+// PageOffsets Returns the guest memory offsets of the pages, in the order of the pages in the file
+func (ws *WorkingSet) PageOffsets() []uint64 {
+	offsets := make([]uint64, 0, ws.NumPages())
+	for _, r := range ws.Regions {
+		for i := 0; i < r.NumPages; i++ {
+			offsets = append(offsets, r.Offset+uint64(i*ws.PageSize))
+		}
+	}
+
+	return offsets
+}
+
+// Validate Checks that the regions and the zero regions are page-aligned, fit into
+// the guest memory, and do not overlap, and that the per-page tables match the number of the pages
+func (ws *WorkingSet) Validate() error {
+	if ws.PageSize <= 0 || ws.PageSize&(ws.PageSize-1) != 0 {
+		return fmt.Errorf("invalid page size %d", ws.PageSize)
+	}
+
+	if ws.GuestMemSize <= 0 || ws.GuestMemSize%ws.PageSize != 0 {
+		return fmt.Errorf("invalid guest memory size %d", ws.GuestMemSize)
+	}
+
+	if ws.ChunkPages < 0 || uint64(ws.ChunkPages) > math.MaxUint32 {
+		return fmt.Errorf("invalid chunk of %d pages", ws.ChunkPages)
+	}
+
+	regions := make([]Region, 0, len(ws.Regions)+len(ws.ZeroRegions))
+	regions = append(regions, ws.Regions...)
+	regions = append(regions, ws.ZeroRegions...)
+	sort.Slice(regions, func(i, j int) bool { return regions[i].Offset < regions[j].Offset })
+
+	var end uint64
+	for _, r := range regions {
+		if r.NumPages <= 0 || r.Offset%uint64(ws.PageSize) != 0 {
+			return fmt.Errorf("invalid region of %d pages at offset %#x", r.NumPages, r.Offset)
+		}
+		if r.Offset < end {
+			return fmt.Errorf("region at offset %#x overlaps with the previous one", r.Offset)
+		}
+
+		end = r.Offset + uint64(r.NumPages*ws.PageSize)
+		if end > uint64(ws.GuestMemSize) {
+			return fmt.Errorf("region at offset %#x is out of the guest memory", r.Offset)
+		}
+	}
+
+	numPages := ws.NumPages()
+	if ws.Timestamps != nil && len(ws.Timestamps) != numPages {
+		return fmt.Errorf("%d timestamps for %d pages", len(ws.Timestamps), numPages)
+	}
+	if ws.Checksums != nil && len(ws.Checksums) != numPages {
+		return fmt.Errorf("%d checksums for %d pages", len(ws.Checksums), numPages)
+	}
+
+	return nil
+}
+
+// VerifyPage Checks the page against its checksum, if the file has checksums
+func (ws *WorkingSet) VerifyPage(i int, page []byte) error {
+	if ws.Checksums == nil {
+		return nil
+	}
+
+	if sum := crc32.Checksum(page, crcTable); sum != ws.Checksums[i] {
+		return fmt.Errorf("checksum mismatch of page %d: %#x, expected %#x", i, sum, ws.Checksums[i])
+	}
+
+	return nil
+}
+
+func (ws *WorkingSet) flags() uint32 {
+	var flags uint32
+	if ws.Timestamps != nil {
+		flags |= FlagTimestamps
+	}
+	if ws.Checksums != nil {
+		flags |= FlagChecksums
+	}
+	if ws.IsCompressed() {
+		flags |= FlagCompressed
+	}
+
+	return flags
+}
+
+// metadataSize Returns the size of the header and the tables
+func (ws *WorkingSet) metadataSize() int {
+	size := headerSize + (len(ws.Regions)+len(ws.ZeroRegions))*regionSize
+	if ws.Timestamps != nil {
+		size += ws.NumPages() * 8
+	}
+	if ws.Checksums != nil {
+		size += ws.NumPages() * 4
+	}
+	size += ws.NumChunks() * chunkSize
+
+	return size
+}
+
+// Write Writes the working set file, copying the pages of the regions (but not of the zero regions)
+// from the guest memory. The checksums of the pages are only computed if Checksums is set to
+// NumPages entries. If ChunkPages is set, the pages are compressed in chunks of ChunkPages pages.
+// The file is replaced atomically, so a crash never leaves a partial file behind.
+func Write(path string, ws *WorkingSet, guestMem io.ReaderAt) error {
+	if err := ws.Validate(); err != nil {
+		return err
+	}
+
+	// the pages start at the first page boundary after the metadata
+	ws.DataOffset = int64((ws.metadataSize() + ws.PageSize - 1) / ws.PageSize * ws.PageSize)
+
+	tmpPath := path + ".tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create the working set file: %w", err)
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	w := &chunkWriter{f: f, ws: ws, pos: ws.DataOffset}
+	ws.Chunks = nil
+	if ws.IsCompressed() {
+		if w.enc, err = zstd.NewWriter(nil); err != nil {
+			return err
+		}
+		defer w.enc.Close()
+		ws.Chunks = make([]Chunk, 0, ws.NumChunks())
+	}
+
+	var idx int
+	for _, r := range ws.Regions {
+		buf := make([]byte, r.NumPages*ws.PageSize)
+		if _, err := guestMem.ReadAt(buf, int64(r.Offset)); err != nil {
+			return fmt.Errorf("failed to read the region at offset %#x: %w", r.Offset, err)
+		}
+
+		if ws.Checksums != nil {
+			for i := 0; i < r.NumPages; i++ {
+				ws.Checksums[idx] = crc32.Checksum(buf[i*ws.PageSize:(i+1)*ws.PageSize], crcTable)
+				idx++
+			}
+		}
+
+		if err := w.write(buf); err != nil {
+			return fmt.Errorf("failed to write the working set file: %w", err)
+		}
+	}
+
+	if err := w.flush(); err != nil {
+		return fmt.Errorf("failed to write the working set file: %w", err)
+	}
+
+	if _, err := f.WriteAt(ws.marshalMetadata(), 0); err != nil {
+		return fmt.Errorf("failed to write the working set file: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync the working set file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close the working set file: %w", err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// chunkWriter Writes the pages to the file, compressing them in chunks if needed
+type chunkWriter struct {
+	f       *os.File
+	ws      *WorkingSet
+	enc     *zstd.Encoder // nil if the pages are not compressed
+	pos     int64         // in the file
+	pending []byte        // the pages of the chunk being filled
+}
+
+func (w *chunkWriter) write(pages []byte) error {
+	if w.enc == nil {
+		if _, err := w.f.WriteAt(pages, w.pos); err != nil {
+			return err
+		}
+		w.pos += int64(len(pages))
+
+		return nil
+	}
+
+	chunkBytes := w.ws.ChunkPages * w.ws.PageSize
+	for len(pages) > 0 {
+		n := chunkBytes - len(w.pending)
+		if n > len(pages) {
+			n = len(pages)
+		}
+		w.pending = append(w.pending, pages[:n]...)
+		pages = pages[n:]
+
+		if len(w.pending) == chunkBytes {
+			if err := w.flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// flush Compresses and writes the pending chunk, padding the file to the next page boundary
+func (w *chunkWriter) flush() error {
+	if w.enc == nil || len(w.pending) == 0 {
+		return nil
+	}
+
+	compressed := w.enc.EncodeAll(w.pending, nil)
+	w.pending = w.pending[:0]
+
+	if _, err := w.f.WriteAt(compressed, w.pos); err != nil {
+		return err
+	}
+	w.ws.Chunks = append(w.ws.Chunks, Chunk{Offset: w.pos, Size: len(compressed)})
+
+	w.pos = alignUp(w.pos+int64(len(compressed)), w.ws.PageSize)
+
+	// so that the last chunk can be read with direct I/O as well
+	return w.f.Truncate(w.pos)
+}
+
+// alignUp Returns the offset rounded up to a multiple of the page size
+func alignUp(offset int64, pageSize int) int64 {
+	return (offset + int64(pageSize) - 1) / int64(pageSize) * int64(pageSize)
+}
+
+func (ws *WorkingSet) marshalMetadata() []byte {
+	var buf bytes.Buffer
+
+	hdr := header{
+		Magic:          magic,
+		Version:        Version,
+		Flags:          ws.flags(),
+		PageSize:       uint32(ws.PageSize),
+		ChunkPages:     uint32(ws.ChunkPages),
+		GuestMemSize:   uint64(ws.GuestMemSize),
+		NumRegions:     uint64(len(ws.Regions)),
+		NumPages:       uint64(ws.NumPages()),
+		DataOffset:     uint64(ws.DataOffset),
+		NumZeroRegions: uint64(len(ws.ZeroRegions)),
+		SnapshotSize:   ws.Snapshot.Size,
+		SnapshotMtime:  ws.Snapshot.Mtime,
+	}
+	// writing to a bytes.Buffer does not fail
+	_ = binary.Write(&buf, binary.LittleEndian, hdr)
+
+	for _, regions := range [][]Region{ws.Regions, ws.ZeroRegions} {
+		for _, r := range regions {
+			_ = binary.Write(&buf, binary.LittleEndian, regionEntry{Offset: r.Offset, NumPages: uint64(r.NumPages)})
+		}
+	}
+
+	for _, ts := range ws.Timestamps {
+		_ = binary.Write(&buf, binary.LittleEndian, int64(ts))
+	}
+
+	if ws.Checksums != nil {
+		_ = binary.Write(&buf, binary.LittleEndian, ws.Checksums)
+	}
+
+	for _, c := range ws.Chunks {
+		_ = binary.Write(&buf, binary.LittleEndian, chunkEntry{Offset: uint64(c.Offset), Size: uint64(c.Size)})
+	}
+
+	return buf.Bytes()
+}
+
+// ReadMetadata Reads the header and the tables of a working set file
+func ReadMetadata(r io.ReaderAt) (*WorkingSet, error) {
+	var hdr header
+	if err := binary.Read(io.NewSectionReader(r, 0, int64(headerSize)), binary.LittleEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("failed to read the header: %w", err)
+	}
+
+	if hdr.Magic != magic {
+		return nil, fmt.Errorf("not a working set file")
+	}
+
+	if hdr.Version != Version {
+		return nil, fmt.Errorf("working set file of version %d, expected %d", hdr.Version, Version)
+	}
+
+	// bound the tables by the guest memory size, so that a corrupted header
+	// does not make us allocate arbitrary amounts of memory
+	if hdr.PageSize == 0 || hdr.DataOffset < uint64(headerSize) || hdr.NumPages > hdr.GuestMemSize/uint64(hdr.PageSize) || hdr.NumRegions > hdr.NumPages ||
+		hdr.NumZeroRegions > hdr.GuestMemSize/uint64(hdr.PageSize) {
+		return nil, fmt.Errorf("corrupted header")
+	}
+
+	ws := &WorkingSet{
+		PageSize:     int(hdr.PageSize),
+		GuestMemSize: int(hdr.GuestMemSize),
+		Snapshot:     SnapshotID{Size: hdr.SnapshotSize, Mtime: hdr.SnapshotMtime},
+		Regions:      make([]Region, hdr.NumRegions),
+		DataOffset:   int64(hdr.DataOffset),
+		ChunkPages:   int(hdr.ChunkPages),
+	}
+
+	tables := io.NewSectionReader(r, int64(headerSize), int64(hdr.DataOffset)-int64(headerSize))
+
+	entries := make([]regionEntry, hdr.NumRegions+hdr.NumZeroRegions)
+	if err := binary.Read(tables, binary.LittleEndian, entries); err != nil {
+		return nil, fmt.Errorf("failed to read the region tables: %w", err)
+	}
+	for i, e := range entries {
+		r := Region{Offset: e.Offset, NumPages: int(e.NumPages)}
+		if i < len(ws.Regions) {
+			ws.Regions[i] = r
+		} else {
+			ws.ZeroRegions = append(ws.ZeroRegions, r)
+		}
+	}
+
+	if hdr.Flags&FlagTimestamps != 0 {
+		timestamps := make([]int64, hdr.NumPages)
+		if err := binary.Read(tables, binary.LittleEndian, timestamps); err != nil {
+			return nil, fmt.Errorf("failed to read the timestamps: %w", err)
+		}
+
+		ws.Timestamps = make([]time.Duration, hdr.NumPages)
+		for i, ts := range timestamps {
+			ws.Timestamps[i] = time.Duration(ts)
+		}
+	}
+
+	if hdr.Flags&FlagChecksums != 0 {
+		ws.Checksums = make([]uint32, hdr.NumPages)
+		if err := binary.Read(tables, binary.LittleEndian, ws.Checksums); err != nil {
+			return nil, fmt.Errorf("failed to read the checksums: %w", err)
+		}
+	}
+
+	if err := ws.Validate(); err != nil {
+		return nil, err
+	}
+
+	if hdr.Flags&FlagCompressed != 0 {
+		if !ws.IsCompressed() || ws.NumPages() != int(hdr.NumPages) {
+			return nil, fmt.Errorf("corrupted header")
+		}
+
+		entries := make([]chunkEntry, ws.NumChunks())
+		if err := binary.Read(tables, binary.LittleEndian, entries); err != nil {
+			return nil, fmt.Errorf("failed to read the chunk table: %w", err)
+		}
+
+		end := ws.DataOffset
+		for i, e := range entries {
+			// bound the size by the worst case of zstd, so that a corrupted table
+			// does not make us allocate arbitrary amounts of memory
+			start, stop := ws.ChunkPageRange(i)
+			if int64(e.Offset) < end || e.Offset%uint64(ws.PageSize) != 0 || e.Size == 0 ||
+				e.Size > uint64(maxCompressedSize((stop-start)*ws.PageSize)) {
+				return nil, fmt.Errorf("corrupted chunk table")
+			}
+
+			ws.Chunks = append(ws.Chunks, Chunk{Offset: int64(e.Offset), Size: int(e.Size)})
+			end = int64(e.Offset + e.Size)
+		}
+	} else if ws.IsCompressed() {
+		return nil, fmt.Errorf("corrupted header")
+	}
+
+	if ws.NumPages() != int(hdr.NumPages) || ws.DataOffset < int64(ws.metadataSize()) || ws.DataOffset%int64(ws.PageSize) != 0 {
+		return nil, fmt.Errorf("corrupted header")
+	}
+
+	return ws, nil
+}
+
+// Reader Reads the pages of a working set file, e.g., for analysis tools
+type Reader struct {
+	*WorkingSet
+	f *os.File
+}
+
+// Open Opens a working set file and reads its metadata
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := ReadMetadata(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if size := ws.DataOffset + int64(ws.StoredSize()); stat.Size() != size {
+		f.Close()
+		return nil, fmt.Errorf("%s is of size %d, expected %d", path, stat.Size(), size)
+	}
+
+	return &Reader{WorkingSet: ws, f: f}, nil
+}
+
+// ReadPage Reads the i-th page of the file into the buffer of the page size
+func (r *Reader) ReadPage(i int, page []byte) error {
+	if i < 0 || i >= r.NumPages() || len(page) != r.PageSize {
+		return fmt.Errorf("invalid page %d", i)
+	}
+
+	if r.IsCompressed() {
+		chunk := i / r.ChunkPages
+		start, end := r.ChunkPageRange(chunk)
+
+		src := make([]byte, r.Chunks[chunk].Size)
+		if _, err := r.f.ReadAt(src, r.Chunks[chunk].Offset); err != nil {
+			return err
+		}
+
+		pages := make([]byte, (end-start)*r.PageSize)
+		if err := r.DecompressChunk(chunk, src, pages); err != nil {
+			return err
+		}
+
+		copy(page, pages[(i-start)*r.PageSize:])
+	} else if _, err := r.f.ReadAt(page, r.DataOffset+int64(i*r.PageSize)); err != nil {
+		return err
+	}
+
+	return r.VerifyPage(i, page)
+}
+
+// Verify Checks all pages against their checksums
+func (r *Reader) Verify() error {
+	page := make([]byte, r.PageSize)
+	for i := 0; i < r.NumPages(); i++ {
+		if err := r.ReadPage(i, page); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DecompressChunk Decompresses the i-th chunk read from the file, which may be followed
+// by the padding, into the buffer of the size of the pages of the chunk.
+// Safe for concurrent use.
+func (ws *WorkingSet) DecompressChunk(i int, src, dst []byte) error {
+	if start, end := ws.ChunkPageRange(i); len(dst) != (end-start)*ws.PageSize || len(src) < ws.Chunks[i].Size {
+		return fmt.Errorf("invalid chunk %d", i)
+	}
+
+	decoderOnce.Do(func() {
+		// fails only with invalid options
+		decoder, _ = zstd.NewReader(nil)
+	})
+
+	// capping the capacity makes DecodeAll allocate a new buffer
+	// instead of writing past dst if the chunk is larger than expected
+	out, err := decoder.DecodeAll(src[:ws.Chunks[i].Size], dst[:0:len(dst)])
+	if err != nil {
+		return fmt.Errorf("failed to decompress chunk %d: %w", i, err)
+	}
+
+	if len(out) != len(dst) {
+		return fmt.Errorf("chunk %d decompressed to %d bytes, expected %d", i, len(out), len(dst))
+	}
+
+	return nil
+}
+
+// maxCompressedSize Returns the upper bound of the size of n compressed bytes
+func maxCompressedSize(n int) int {
+	return n + n/128 + 64*1024
+}
+
+// Close Closes the file
+func (r *Reader) Close() error {
+	return r.f.Close()
+}
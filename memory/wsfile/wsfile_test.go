@@ -0,0 +1,198 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package wsfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPageSize = 4096
+
+func testGuestMem(numPages int) []byte {
+	mem := make([]byte, numPages*testPageSize)
+	for i := range mem {
+		mem[i] = byte(i / testPageSize)
+	}
+
+	return mem
+}
+
+func TestWriteRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "working_set_pages")
+	mem := testGuestMem(16)
+
+	ws := &WorkingSet{
+		PageSize:     testPageSize,
+		GuestMemSize: len(mem),
+		Snapshot:     SnapshotID{Size: uint64(len(mem)), Mtime: 42},
+		// not sorted by offset
+		Regions: []Region{
+			{Offset: 9 * testPageSize, NumPages: 2},
+			{Offset: 0, NumPages: 3},
+		},
+		ZeroRegions: []Region{{Offset: 4 * testPageSize, NumPages: 3}},
+		Timestamps:  []time.Duration{0, 1, 2, 3, 4},
+		Checksums:   make([]uint32, 5),
+	}
+	require.NoError(t, Write(path, ws, bytes.NewReader(mem)), "Failed to write")
+	require.Zero(t, ws.DataOffset%testPageSize, "Pages must be page-aligned")
+
+	r, err := Open(path)
+	require.NoError(t, err, "Failed to open")
+	defer r.Close()
+
+	require.Equal(t, ws.Snapshot, r.Snapshot)
+	require.Equal(t, ws.Regions, r.Regions)
+	require.Equal(t, ws.ZeroRegions, r.ZeroRegions)
+	require.Equal(t, 3, r.NumZeroPages())
+	require.Equal(t, 5*testPageSize, r.DataSize(), "Zero pages must not be stored")
+	require.Equal(t, ws.Timestamps, r.Timestamps)
+	require.Equal(t, ws.Checksums, r.Checksums)
+	require.NotContains(t, r.Checksums, uint32(0), "Checksums must be computed")
+	require.Equal(t, []uint64{9 * testPageSize, 10 * testPageSize, 0, testPageSize, 2 * testPageSize}, r.PageOffsets())
+	require.NoError(t, r.Verify(), "Checksums must match")
+
+	page := make([]byte, testPageSize)
+	require.NoError(t, r.ReadPage(1, page))
+	require.Equal(t, mem[10*testPageSize:11*testPageSize], page)
+}
+
+func TestCompressed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "working_set_pages")
+	mem := testGuestMem(16)
+
+	ws := &WorkingSet{
+		PageSize:     testPageSize,
+		GuestMemSize: len(mem),
+		Regions: []Region{
+			{Offset: 9 * testPageSize, NumPages: 2},
+			{Offset: 0, NumPages: 3},
+		},
+		ChunkPages: 2,
+	}
+	require.NoError(t, Write(path, ws, bytes.NewReader(mem)), "Failed to write")
+	require.Nil(t, ws.Checksums, "Checksums must be optional")
+	require.Len(t, ws.Chunks, 3, "The last chunk must be partial")
+	require.Less(t, ws.CompressedSize(), ws.DataSize(), "Pages of the same bytes must compress")
+
+	r, err := Open(path)
+	require.NoError(t, err, "Failed to open")
+	defer r.Close()
+
+	require.Equal(t, ws.Chunks, r.Chunks)
+	require.Equal(t, 2, r.ChunkPages)
+	require.Equal(t, 3*testPageSize, r.StoredSize(), "Chunks must be page-aligned")
+	require.Nil(t, r.Checksums, "Checksums must be optional")
+	require.NoError(t, r.Verify(), "Pages must decompress")
+
+	page := make([]byte, testPageSize)
+	require.NoError(t, r.ReadPage(3, page))
+	require.Equal(t, mem[testPageSize:2*testPageSize], page)
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// the whole chunk is read with direct I/O, including the padding
+	c := r.Chunks[2]
+	dst := make([]byte, testPageSize)
+	require.NoError(t, r.DecompressChunk(2, content[c.Offset:c.Offset+testPageSize], dst))
+	require.Equal(t, mem[2*testPageSize:3*testPageSize], dst)
+
+	require.Error(t, r.DecompressChunk(1, content[c.Offset:c.Offset+testPageSize], make([]byte, 2*testPageSize)),
+		"Chunk decompressed to a wrong size must fail")
+}
+
+func TestCorruptedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "working_set_pages")
+	mem := testGuestMem(4)
+
+	ws := &WorkingSet{
+		PageSize:     testPageSize,
+		GuestMemSize: len(mem),
+		Regions:      []Region{{Offset: testPageSize, NumPages: 2}},
+		Checksums:    make([]uint32, 2),
+	}
+	require.NoError(t, Write(path, ws, bytes.NewReader(mem)), "Failed to write")
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// flip a byte of the last page
+	corrupted := append([]byte{}, content...)
+	corrupted[len(corrupted)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, corrupted, 0644))
+
+	r, err := Open(path)
+	require.NoError(t, err, "Failed to open")
+	require.Error(t, r.Verify(), "Corrupted page must fail the checksum")
+	r.Close()
+
+	// bump the version
+	stale := append([]byte{}, content...)
+	stale[8]++
+	require.NoError(t, os.WriteFile(path, stale, 0644))
+
+	_, err = Open(path)
+	require.Error(t, err, "File of another version must not be opened")
+
+	// truncate the pages
+	require.NoError(t, os.WriteFile(path, content[:len(content)-1], 0644))
+
+	_, err = Open(path)
+	require.Error(t, err, "Truncated file must not be opened")
+}
+
+func TestValidate(t *testing.T) {
+	for name, ws := range map[string]*WorkingSet{
+		"overlap": {
+			PageSize: testPageSize, GuestMemSize: 8 * testPageSize,
+			Regions: []Region{{Offset: 0, NumPages: 2}, {Offset: testPageSize, NumPages: 1}},
+		},
+		"out of bounds": {
+			PageSize: testPageSize, GuestMemSize: 8 * testPageSize,
+			Regions: []Region{{Offset: 7 * testPageSize, NumPages: 2}},
+		},
+		"unaligned": {
+			PageSize: testPageSize, GuestMemSize: 8 * testPageSize,
+			Regions: []Region{{Offset: 1, NumPages: 1}},
+		},
+		"zero region overlap": {
+			PageSize: testPageSize, GuestMemSize: 8 * testPageSize,
+			Regions:     []Region{{Offset: 0, NumPages: 2}},
+			ZeroRegions: []Region{{Offset: testPageSize, NumPages: 2}},
+		},
+		"timestamps": {
+			PageSize: testPageSize, GuestMemSize: 8 * testPageSize,
+			Regions:    []Region{{Offset: 0, NumPages: 2}},
+			Timestamps: []time.Duration{0},
+		},
+	} {
+		require.Error(t, ws.Validate(), name)
+	}
+}
@@ -32,3 +32,10 @@ type NonExistErr string
 func (e NonExistErr) Error() string {
 	return fmt.Sprintf("%v does not exist", string(e))
 }
+
+// AlreadyExistErr VM, tap, etc already exists.
+type AlreadyExistErr string
+
+func (e AlreadyExistErr) Error() string {
+	return fmt.Sprintf("%v already exists", string(e))
+}
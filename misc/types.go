@@ -38,6 +38,8 @@ type VM struct {
 	Task      *containerd.Task
 	TaskCh    <-chan containerd.ExitStatus
 	Ni        *taps.NetworkInterface
+	// set if the VM runs in its own network namespace
+	Net *taps.VMNetwork
 }
 
 // VMPool Pool of active VMs (can be in several states though)
@@ -44,7 +44,8 @@ func (p *VMPool) Allocate(vmID, hostIface string) (*VM, error) {
 	logger.Debug("Allocating a VM instance")
 
 	if _, isPresent := p.vmMap.Load(vmID); isPresent {
-		logger.Panic("Allocate (VM): VM exists in the map")
+		logger.Error("Allocate (VM): VM exists in the map")
+		return nil, AlreadyExistErr("Allocate (VM): VM")
 	}
 
 	vm := NewVM(vmID)
@@ -61,19 +62,51 @@ func (p *VMPool) Allocate(vmID, hostIface string) (*VM, error) {
 	return vm, nil
 }
 
+// AllocateWithNetNS Initializes a VM that runs in its own network namespace
+// with the given guest network interface, and adds it to VM map
+func (p *VMPool) AllocateWithNetNS(vmID string, guestNi *taps.NetworkInterface, hostIface string) (*VM, error) {
+	logger := log.WithFields(log.Fields{"vmID": vmID})
+
+	logger.Debug("Allocating a VM instance with its own network namespace")
+
+	if _, isPresent := p.vmMap.Load(vmID); isPresent {
+		logger.Error("Allocate (VM): VM exists in the map")
+		return nil, AlreadyExistErr("Allocate (VM): VM")
+	}
+
+	vm := NewVM(vmID)
+
+	var err error
+	vm.Net, err = p.tapManager.AddVMNetwork(vmID, guestNi, hostIface)
+	if err != nil {
+		logger.Warn("VM network allocation failed")
+		return nil, err
+	}
+	vm.Ni = guestNi
+
+	p.vmMap.Store(vmID, vm)
+
+	return vm, nil
+}
+
 // Free Removes a VM from the pool and transitions it to Deactivating
 func (p *VMPool) Free(vmID string) error {
 	logger := log.WithFields(log.Fields{"vmID": vmID})
 
 	logger.Debug("Freeing a VM instance")
 
-	_, isPresent := p.vmMap.Load(vmID)
+	vm, isPresent := p.vmMap.Load(vmID)
 	if !isPresent {
 		logger.Warn("VM does not exist in the map")
 		return nil
 	}
 
-	if err := p.tapManager.RemoveTap(vmID + "_tap"); err != nil {
+	if vmNet := vm.(*VM).Net; vmNet != nil {
+		if err := p.tapManager.RemoveVMNetwork(vmNet); err != nil {
+			logger.Error("Could not delete VM network")
+			return err
+		}
+	} else if err := p.tapManager.RemoveTap(vmID + "_tap"); err != nil {
 		logger.Error("Could not delete tap")
 		return err
 	}
@@ -89,12 +122,17 @@ func (p *VMPool) RecreateTap(vmID, hostIface string) error {
 
 	logger.Debug("Recreating tap")
 
-	_, isPresent := p.vmMap.Load(vmID)
+	vm, isPresent := p.vmMap.Load(vmID)
 	if !isPresent {
-		log.WithFields(log.Fields{"vmID": vmID}).Panic("RecreateTap: VM does not exist in the map")
+		logger.Error("RecreateTap: VM does not exist in the map")
 		return NonExistErr("RecreateTap: VM does not exist when recreating its tap")
 	}
 
+	if vm.(*VM).Net != nil {
+		// the tap in the VM's network namespace is not shared with other VMs
+		return nil
+	}
+
 	if err := p.tapManager.RemoveTap(vmID + "_tap"); err != nil {
 		logger.Error("Failed to delete tap")
 		return err
@@ -131,6 +169,12 @@ func (p *VMPool) GetVM(vmID string) (*VM, error) {
 	return vm.(*VM), nil
 }
 
+// SetVMNetworkRanges Sets the address ranges of the networks of the VMs
+// that run in their own network namespaces
+func (p *VMPool) SetVMNetworkRanges(vethCIDR, cloneCIDR string) error {
+	return p.tapManager.SetVMNetworkRanges(vethCIDR, cloneCIDR)
+}
+
 // RemoveBridges Removes the bridges created by the tap manager
 func (p *VMPool) RemoveBridges() {
 	p.tapManager.RemoveBridges()
@@ -37,6 +37,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/vhive-serverless/vhive/keepalive"
 	"github.com/vhive-serverless/vhive/metrics"
 	"github.com/vhive-serverless/vhive/profile"
 	"github.com/montanaflynn/stats"
@@ -92,7 +93,7 @@ func TestProfileIncrementConfiguration(t *testing.T) {
 		idx, rps      int
 		pinnedFuncNum int
 		startVMID     int
-		servedTh      uint64
+		keepAlive     keepalive.PolicyFactory
 		isSyncOffload bool = true
 		metrFile           = "bench.csv"
 		images             = getImages(t)
@@ -104,7 +105,7 @@ func TestProfileIncrementConfiguration(t *testing.T) {
 
 	createResultsDir()
 
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	cores, err := cpuNum()
 	require.NoError(t, err, "Cannot get the number of CPU")
@@ -137,7 +138,7 @@ func TestProfileSingleConfiguration(t *testing.T) {
 	t.Skip("Skipping TestProfileSingleConfiguration")
 
 	var (
-		servedTh      uint64
+		keepAlive     keepalive.PolicyFactory
 		pinnedFuncNum int
 		isSyncOffload bool = true
 		images             = getImages(t)
@@ -149,7 +150,7 @@ func TestProfileSingleConfiguration(t *testing.T) {
 
 	createResultsDir()
 
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	bootVMs(t, images, 0, *vmNum)
 
@@ -164,7 +165,7 @@ func TestProfileSingleConfiguration(t *testing.T) {
 // controlled by *profileCoreID
 func TestColocateVMsOnSameCPU(t *testing.T) {
 	var (
-		servedTh      uint64
+		keepAlive     keepalive.PolicyFactory
 		pinnedFuncNum int
 		isSyncOffload bool = true
 		metrFile           = "bench.csv"
@@ -178,7 +179,7 @@ func TestColocateVMsOnSameCPU(t *testing.T) {
 
 	createResultsDir()
 
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	bootVMs(t, images, 0, 2)
 
@@ -213,7 +214,7 @@ func TestColocateVMsOnSameCPU(t *testing.T) {
 func TestBindSocket(t *testing.T) {
 	var (
 		procStr, sep  string
-		servedTh      uint64
+		keepAlive     keepalive.PolicyFactory
 		pinnedFuncNum int
 		isSyncOffload bool = true
 		testImage          = []string{"ghcr.io/ease-lab/helloworld:var_workload"}
@@ -242,7 +243,7 @@ func TestBindSocket(t *testing.T) {
 		{vmNum: 4, expected: []string{strconv.Itoa(*profileCPUID), procStr}},
 	}
 
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	for _, tCase := range cases {
 		testName := fmt.Sprintf("vmNum=%d", tCase.vmNum)
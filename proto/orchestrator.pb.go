@@ -47,9 +47,43 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type InstanceState int32
+
+const (
+	InstanceState_INACTIVE  InstanceState = 0
+	InstanceState_RUNNING   InstanceState = 1
+	InstanceState_OFFLOADED InstanceState = 2
+	// An operation on the instance failed, the instance is recreated when it starts next time
+	InstanceState_UNHEALTHY InstanceState = 3
+)
+
+var InstanceState_name = map[int32]string{
+	0: "INACTIVE",
+	1: "RUNNING",
+	2: "OFFLOADED",
+	3: "UNHEALTHY",
+}
+
+var InstanceState_value = map[string]int32{
+	"INACTIVE":  0,
+	"RUNNING":   1,
+	"OFFLOADED": 2,
+	"UNHEALTHY": 3,
+}
+
+func (x InstanceState) String() string {
+	return proto.EnumName(InstanceState_name, int32(x))
+}
+
+func (InstanceState) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{0}
+}
+
 type StartVMReq struct {
-	Image                string   `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
-	Id                   string   `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	Image string `protobuf:"bytes,1,opt,name=image,proto3" json:"image,omitempty"`
+	Id    string `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	// Spec of the function's VMs, the defaults are used if not set
+	VmSpec               *VMSpec  `protobuf:"bytes,3,opt,name=vm_spec,json=vmSpec,proto3" json:"vm_spec,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -94,6 +128,77 @@ func (m *StartVMReq) GetId() string {
 	return ""
 }
 
+func (m *StartVMReq) GetVmSpec() *VMSpec {
+	if m != nil {
+		return m.VmSpec
+	}
+	return nil
+}
+
+// Zero fields take the default values
+type VMSpec struct {
+	VcpuCount            uint32   `protobuf:"varint,1,opt,name=vcpu_count,json=vcpuCount,proto3" json:"vcpu_count,omitempty"`
+	MemSizeMib           uint32   `protobuf:"varint,2,opt,name=mem_size_mib,json=memSizeMib,proto3" json:"mem_size_mib,omitempty"`
+	KernelArgs           string   `protobuf:"bytes,3,opt,name=kernel_args,json=kernelArgs,proto3" json:"kernel_args,omitempty"`
+	TimeoutSeconds       uint32   `protobuf:"varint,4,opt,name=timeout_seconds,json=timeoutSeconds,proto3" json:"timeout_seconds,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *VMSpec) Reset()         { *m = VMSpec{} }
+func (m *VMSpec) String() string { return proto.CompactTextString(m) }
+func (*VMSpec) ProtoMessage()    {}
+func (*VMSpec) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{1}
+}
+
+func (m *VMSpec) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_VMSpec.Unmarshal(m, b)
+}
+func (m *VMSpec) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_VMSpec.Marshal(b, m, deterministic)
+}
+func (m *VMSpec) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_VMSpec.Merge(m, src)
+}
+func (m *VMSpec) XXX_Size() int {
+	return xxx_messageInfo_VMSpec.Size(m)
+}
+func (m *VMSpec) XXX_DiscardUnknown() {
+	xxx_messageInfo_VMSpec.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_VMSpec proto.InternalMessageInfo
+
+func (m *VMSpec) GetVcpuCount() uint32 {
+	if m != nil {
+		return m.VcpuCount
+	}
+	return 0
+}
+
+func (m *VMSpec) GetMemSizeMib() uint32 {
+	if m != nil {
+		return m.MemSizeMib
+	}
+	return 0
+}
+
+func (m *VMSpec) GetKernelArgs() string {
+	if m != nil {
+		return m.KernelArgs
+	}
+	return ""
+}
+
+func (m *VMSpec) GetTimeoutSeconds() uint32 {
+	if m != nil {
+		return m.TimeoutSeconds
+	}
+	return 0
+}
+
 type StopVMsReq struct {
 	AllVms               bool     `protobuf:"varint,1,opt,name=all_vms,json=allVms,proto3" json:"all_vms,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -105,7 +210,7 @@ func (m *StopVMsReq) Reset()         { *m = StopVMsReq{} }
 func (m *StopVMsReq) String() string { return proto.CompactTextString(m) }
 func (*StopVMsReq) ProtoMessage()    {}
 func (*StopVMsReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_96b6e6782baaa298, []int{1}
+	return fileDescriptor_96b6e6782baaa298, []int{2}
 }
 
 func (m *StopVMsReq) XXX_Unmarshal(b []byte) error {
@@ -144,7 +249,7 @@ func (m *StopSingleVMReq) Reset()         { *m = StopSingleVMReq{} }
 func (m *StopSingleVMReq) String() string { return proto.CompactTextString(m) }
 func (*StopSingleVMReq) ProtoMessage()    {}
 func (*StopSingleVMReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_96b6e6782baaa298, []int{2}
+	return fileDescriptor_96b6e6782baaa298, []int{3}
 }
 
 func (m *StopSingleVMReq) XXX_Unmarshal(b []byte) error {
@@ -183,7 +288,7 @@ func (m *Status) Reset()         { *m = Status{} }
 func (m *Status) String() string { return proto.CompactTextString(m) }
 func (*Status) ProtoMessage()    {}
 func (*Status) Descriptor() ([]byte, []int) {
-	return fileDescriptor_96b6e6782baaa298, []int{3}
+	return fileDescriptor_96b6e6782baaa298, []int{4}
 }
 
 func (m *Status) XXX_Unmarshal(b []byte) error {
@@ -212,18 +317,19 @@ func (m *Status) GetMessage() string {
 }
 
 type StartVMResp struct {
-	Message              string   `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
-	Profile              string   `protobuf:"bytes,2,opt,name=profile,proto3" json:"profile,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Message              string        `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Profile              string        `protobuf:"bytes,2,opt,name=profile,proto3" json:"profile,omitempty"`
+	Function             *FunctionInfo `protobuf:"bytes,3,opt,name=function,proto3" json:"function,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
 }
 
 func (m *StartVMResp) Reset()         { *m = StartVMResp{} }
 func (m *StartVMResp) String() string { return proto.CompactTextString(m) }
 func (*StartVMResp) ProtoMessage()    {}
 func (*StartVMResp) Descriptor() ([]byte, []int) {
-	return fileDescriptor_96b6e6782baaa298, []int{4}
+	return fileDescriptor_96b6e6782baaa298, []int{5}
 }
 
 func (m *StartVMResp) XXX_Unmarshal(b []byte) error {
@@ -258,185 +364,2014 @@ func (m *StartVMResp) GetProfile() string {
 	return ""
 }
 
-func init() {
-	proto.RegisterType((*StartVMReq)(nil), "proto.StartVMReq")
-	proto.RegisterType((*StopVMsReq)(nil), "proto.StopVMsReq")
-	proto.RegisterType((*StopSingleVMReq)(nil), "proto.StopSingleVMReq")
-	proto.RegisterType((*Status)(nil), "proto.Status")
-	proto.RegisterType((*StartVMResp)(nil), "proto.StartVMResp")
+func (m *StartVMResp) GetFunction() *FunctionInfo {
+	if m != nil {
+		return m.Function
+	}
+	return nil
 }
 
-func init() { proto.RegisterFile("orchestrator.proto", fileDescriptor_96b6e6782baaa298) }
+type FunctionInfo struct {
+	Id    string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Image string `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	// Running if any instance is running
+	State InstanceState `protobuf:"varint,3,opt,name=state,proto3,enum=proto.InstanceState" json:"state,omitempty"`
+	// VM ID, guest IP and snapshot readiness of the first instance
+	VmId            string `protobuf:"bytes,4,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	GuestIp         string `protobuf:"bytes,5,opt,name=guest_ip,json=guestIp,proto3" json:"guest_ip,omitempty"`
+	IsPinned        bool   `protobuf:"varint,6,opt,name=is_pinned,json=isPinned,proto3" json:"is_pinned,omitempty"`
+	IsSnapshotReady bool   `protobuf:"varint,7,opt,name=is_snapshot_ready,json=isSnapshotReady,proto3" json:"is_snapshot_ready,omitempty"`
+	Served          uint64 `protobuf:"varint,8,opt,name=served,proto3" json:"served,omitempty"`
+	Started         uint64 `protobuf:"varint,9,opt,name=started,proto3" json:"started,omitempty"`
+	// Breakdown (in microseconds) of the last cold start of the function
+	ColdStartMetrics map[string]float64 `protobuf:"bytes,10,rep,name=cold_start_metrics,json=coldStartMetrics,proto3" json:"cold_start_metrics,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"fixed64,2,opt,name=value,proto3"`
+	VmSpec           *VMSpec            `protobuf:"bytes,11,opt,name=vm_spec,json=vmSpec,proto3" json:"vm_spec,omitempty"`
+	MaxInstances     uint32             `protobuf:"varint,12,opt,name=max_instances,json=maxInstances,proto3" json:"max_instances,omitempty"`
+	Instances        []*InstanceInfo    `protobuf:"bytes,13,rep,name=instances,proto3" json:"instances,omitempty"`
+	// Timeout (in milliseconds) of the requests to the function when the client sets no deadline
+	TimeoutMs uint64 `protobuf:"varint,14,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	// Number of failed operations on the function's instances
+	Failed               uint64   `protobuf:"varint,15,opt,name=failed,proto3" json:"failed,omitempty"`
+	Port                 uint32   `protobuf:"varint,16,opt,name=port,proto3" json:"port,omitempty"`
+	Protocol             string   `protobuf:"bytes,17,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
 
-var fileDescriptor_96b6e6782baaa298 = []byte{
-	// 281 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x74, 0x91, 0x51, 0x4b, 0xfb, 0x30,
-	0x14, 0xc5, 0xd7, 0xc1, 0xda, 0xff, 0xff, 0x3a, 0x95, 0x5d, 0x44, 0xcb, 0x40, 0xd0, 0x80, 0xe0,
-	0x8b, 0x7d, 0xa8, 0x82, 0xcf, 0xee, 0x7d, 0x38, 0x5a, 0xe8, 0xab, 0xc4, 0x2d, 0xd6, 0x40, 0x6a,
-	0x62, 0x6e, 0x26, 0x7e, 0x26, 0x3f, 0xa5, 0xa4, 0x5d, 0xd7, 0xa0, 0xf8, 0x14, 0xee, 0xcd, 0xfd,
-	0x9d, 0xdc, 0x73, 0x02, 0xa8, 0xed, 0xfa, 0x55, 0x90, 0xb3, 0xdc, 0x69, 0x9b, 0x19, 0xab, 0x9d,
-	0xc6, 0x49, 0x7b, 0xb0, 0x1c, 0xa0, 0x74, 0xdc, 0xba, 0x6a, 0x59, 0x88, 0x77, 0x3c, 0x81, 0x89,
-	0x6c, 0x78, 0x2d, 0xd2, 0xe8, 0x22, 0xba, 0xfe, 0x5f, 0x74, 0x05, 0x1e, 0xc1, 0x58, 0x6e, 0xd2,
-	0x71, 0xdb, 0x1a, 0xcb, 0x0d, 0xbb, 0xf2, 0x8c, 0x36, 0xd5, 0x92, 0x3c, 0x73, 0x06, 0x09, 0x57,
-	0xea, 0xe9, 0xa3, 0xa1, 0x96, 0xfa, 0x57, 0xc4, 0x5c, 0xa9, 0xaa, 0x21, 0x76, 0x09, 0xc7, 0x7e,
-	0xac, 0x94, 0x6f, 0xb5, 0x12, 0x9d, 0x7e, 0xa7, 0x14, 0xed, 0x95, 0x18, 0xc4, 0xa5, 0xe3, 0x6e,
-	0x4b, 0x98, 0x42, 0xd2, 0x08, 0xa2, 0xe1, 0xed, 0xbe, 0x64, 0x0f, 0x70, 0xb0, 0xdf, 0x90, 0xcc,
-	0xdf, 0x83, 0xfe, 0xc6, 0x58, 0xfd, 0x22, 0x95, 0xd8, 0xed, 0xda, 0x97, 0xf9, 0x57, 0x04, 0xd3,
-	0xc7, 0x20, 0x02, 0xcc, 0x21, 0xd9, 0x69, 0xe2, 0xac, 0xcb, 0x23, 0x1b, 0x52, 0x98, 0xe3, 0xcf,
-	0x16, 0x19, 0x36, 0xc2, 0x1b, 0xcf, 0xb4, 0xae, 0x03, 0xa6, 0x4f, 0x61, 0x7e, 0x38, 0x30, 0x6e,
-	0x4b, 0x6c, 0x84, 0xf7, 0x30, 0x0d, 0xdd, 0xe3, 0x69, 0xc0, 0x04, 0x91, 0xfc, 0x02, 0x17, 0x77,
-	0x70, 0x2e, 0x75, 0x56, 0x5b, 0xb3, 0xce, 0xc4, 0x27, 0x6f, 0x8c, 0x12, 0x94, 0x85, 0xff, 0xb7,
-	0x98, 0x85, 0x56, 0x56, 0x1e, 0x5e, 0x45, 0xcf, 0x71, 0xab, 0x72, 0xfb, 0x1d, 0x00, 0x00, 0xff,
-	0xff, 0x9e, 0x34, 0x34, 0xa7, 0xeb, 0x01, 0x00, 0x00,
+func (m *FunctionInfo) Reset()         { *m = FunctionInfo{} }
+func (m *FunctionInfo) String() string { return proto.CompactTextString(m) }
+func (*FunctionInfo) ProtoMessage()    {}
+func (*FunctionInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{6}
 }
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConnInterface
+func (m *FunctionInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FunctionInfo.Unmarshal(m, b)
+}
+func (m *FunctionInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FunctionInfo.Marshal(b, m, deterministic)
+}
+func (m *FunctionInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FunctionInfo.Merge(m, src)
+}
+func (m *FunctionInfo) XXX_Size() int {
+	return xxx_messageInfo_FunctionInfo.Size(m)
+}
+func (m *FunctionInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_FunctionInfo.DiscardUnknown(m)
+}
 
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion6
+var xxx_messageInfo_FunctionInfo proto.InternalMessageInfo
 
-// OrchestratorClient is the client API for Orchestrator service.
-//
-// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
-type OrchestratorClient interface {
-	StartVM(ctx context.Context, in *StartVMReq, opts ...grpc.CallOption) (*StartVMResp, error)
-	StopVMs(ctx context.Context, in *StopVMsReq, opts ...grpc.CallOption) (*Status, error)
-	StopSingleVM(ctx context.Context, in *StopSingleVMReq, opts ...grpc.CallOption) (*Status, error)
+func (m *FunctionInfo) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
 }
 
-type orchestratorClient struct {
-	cc grpc.ClientConnInterface
+func (m *FunctionInfo) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
 }
 
-func NewOrchestratorClient(cc grpc.ClientConnInterface) OrchestratorClient {
-	return &orchestratorClient{cc}
+func (m *FunctionInfo) GetState() InstanceState {
+	if m != nil {
+		return m.State
+	}
+	return InstanceState_INACTIVE
 }
 
-func (c *orchestratorClient) StartVM(ctx context.Context, in *StartVMReq, opts ...grpc.CallOption) (*StartVMResp, error) {
-	out := new(StartVMResp)
-	err := c.cc.Invoke(ctx, "/proto.Orchestrator/StartVM", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (m *FunctionInfo) GetVmId() string {
+	if m != nil {
+		return m.VmId
 	}
-	return out, nil
+	return ""
 }
 
-func (c *orchestratorClient) StopVMs(ctx context.Context, in *StopVMsReq, opts ...grpc.CallOption) (*Status, error) {
-	out := new(Status)
-	err := c.cc.Invoke(ctx, "/proto.Orchestrator/StopVMs", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (m *FunctionInfo) GetGuestIp() string {
+	if m != nil {
+		return m.GuestIp
 	}
-	return out, nil
+	return ""
 }
 
-func (c *orchestratorClient) StopSingleVM(ctx context.Context, in *StopSingleVMReq, opts ...grpc.CallOption) (*Status, error) {
-	out := new(Status)
-	err := c.cc.Invoke(ctx, "/proto.Orchestrator/StopSingleVM", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (m *FunctionInfo) GetIsPinned() bool {
+	if m != nil {
+		return m.IsPinned
 	}
-	return out, nil
+	return false
 }
 
-// OrchestratorServer is the server API for Orchestrator service.
-type OrchestratorServer interface {
-	StartVM(context.Context, *StartVMReq) (*StartVMResp, error)
-	StopVMs(context.Context, *StopVMsReq) (*Status, error)
-	StopSingleVM(context.Context, *StopSingleVMReq) (*Status, error)
+func (m *FunctionInfo) GetIsSnapshotReady() bool {
+	if m != nil {
+		return m.IsSnapshotReady
+	}
+	return false
 }
 
-// UnimplementedOrchestratorServer can be embedded to have forward compatible implementations.
-type UnimplementedOrchestratorServer struct {
+func (m *FunctionInfo) GetServed() uint64 {
+	if m != nil {
+		return m.Served
+	}
+	return 0
 }
 
-func (*UnimplementedOrchestratorServer) StartVM(ctx context.Context, req *StartVMReq) (*StartVMResp, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method StartVM not implemented")
+func (m *FunctionInfo) GetStarted() uint64 {
+	if m != nil {
+		return m.Started
+	}
+	return 0
 }
-func (*UnimplementedOrchestratorServer) StopVMs(ctx context.Context, req *StopVMsReq) (*Status, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method StopVMs not implemented")
+
+func (m *FunctionInfo) GetColdStartMetrics() map[string]float64 {
+	if m != nil {
+		return m.ColdStartMetrics
+	}
+	return nil
 }
-func (*UnimplementedOrchestratorServer) StopSingleVM(ctx context.Context, req *StopSingleVMReq) (*Status, error) {
-	return nil, status.Errorf(codes.Unimplemented, "method StopSingleVM not implemented")
+
+func (m *FunctionInfo) GetVmSpec() *VMSpec {
+	if m != nil {
+		return m.VmSpec
+	}
+	return nil
 }
 
-func RegisterOrchestratorServer(s *grpc.Server, srv OrchestratorServer) {
-	s.RegisterService(&_Orchestrator_serviceDesc, srv)
+func (m *FunctionInfo) GetMaxInstances() uint32 {
+	if m != nil {
+		return m.MaxInstances
+	}
+	return 0
 }
 
-func _Orchestrator_StartVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(StartVMReq)
-	if err := dec(in); err != nil {
-		return nil, err
+func (m *FunctionInfo) GetInstances() []*InstanceInfo {
+	if m != nil {
+		return m.Instances
 	}
-	if interceptor == nil {
-		return srv.(OrchestratorServer).StartVM(ctx, in)
+	return nil
+}
+
+func (m *FunctionInfo) GetTimeoutMs() uint64 {
+	if m != nil {
+		return m.TimeoutMs
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/proto.Orchestrator/StartVM",
+	return 0
+}
+
+func (m *FunctionInfo) GetFailed() uint64 {
+	if m != nil {
+		return m.Failed
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(OrchestratorServer).StartVM(ctx, req.(*StartVMReq))
+	return 0
+}
+
+func (m *FunctionInfo) GetPort() uint32 {
+	if m != nil {
+		return m.Port
 	}
-	return interceptor(ctx, in, info, handler)
+	return 0
 }
 
-func _Orchestrator_StopVMs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(StopVMsReq)
-	if err := dec(in); err != nil {
-		return nil, err
+func (m *FunctionInfo) GetProtocol() string {
+	if m != nil {
+		return m.Protocol
 	}
-	if interceptor == nil {
-		return srv.(OrchestratorServer).StopVMs(ctx, in)
+	return ""
+}
+
+type InstanceInfo struct {
+	Id              uint32        `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	State           InstanceState `protobuf:"varint,2,opt,name=state,proto3,enum=proto.InstanceState" json:"state,omitempty"`
+	VmId            string        `protobuf:"bytes,3,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	GuestIp         string        `protobuf:"bytes,4,opt,name=guest_ip,json=guestIp,proto3" json:"guest_ip,omitempty"`
+	IsSnapshotReady bool          `protobuf:"varint,5,opt,name=is_snapshot_ready,json=isSnapshotReady,proto3" json:"is_snapshot_ready,omitempty"`
+	// Number of requests assigned to the instance
+	Outstanding int64  `protobuf:"varint,6,opt,name=outstanding,proto3" json:"outstanding,omitempty"`
+	Served      uint64 `protobuf:"varint,7,opt,name=served,proto3" json:"served,omitempty"`
+	Started     uint64 `protobuf:"varint,8,opt,name=started,proto3" json:"started,omitempty"`
+	// Number of failed operations on the instance
+	Failed               uint64   `protobuf:"varint,9,opt,name=failed,proto3" json:"failed,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InstanceInfo) Reset()         { *m = InstanceInfo{} }
+func (m *InstanceInfo) String() string { return proto.CompactTextString(m) }
+func (*InstanceInfo) ProtoMessage()    {}
+func (*InstanceInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{7}
+}
+
+func (m *InstanceInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InstanceInfo.Unmarshal(m, b)
+}
+func (m *InstanceInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InstanceInfo.Marshal(b, m, deterministic)
+}
+func (m *InstanceInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InstanceInfo.Merge(m, src)
+}
+func (m *InstanceInfo) XXX_Size() int {
+	return xxx_messageInfo_InstanceInfo.Size(m)
+}
+func (m *InstanceInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_InstanceInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InstanceInfo proto.InternalMessageInfo
+
+func (m *InstanceInfo) GetId() uint32 {
+	if m != nil {
+		return m.Id
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/proto.Orchestrator/StopVMs",
+	return 0
+}
+
+func (m *InstanceInfo) GetState() InstanceState {
+	if m != nil {
+		return m.State
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(OrchestratorServer).StopVMs(ctx, req.(*StopVMsReq))
+	return InstanceState_INACTIVE
+}
+
+func (m *InstanceInfo) GetVmId() string {
+	if m != nil {
+		return m.VmId
 	}
-	return interceptor(ctx, in, info, handler)
+	return ""
 }
 
-func _Orchestrator_StopSingleVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(StopSingleVMReq)
-	if err := dec(in); err != nil {
-		return nil, err
+func (m *InstanceInfo) GetGuestIp() string {
+	if m != nil {
+		return m.GuestIp
 	}
-	if interceptor == nil {
-		return srv.(OrchestratorServer).StopSingleVM(ctx, in)
+	return ""
+}
+
+func (m *InstanceInfo) GetIsSnapshotReady() bool {
+	if m != nil {
+		return m.IsSnapshotReady
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/proto.Orchestrator/StopSingleVM",
+	return false
+}
+
+func (m *InstanceInfo) GetOutstanding() int64 {
+	if m != nil {
+		return m.Outstanding
 	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(OrchestratorServer).StopSingleVM(ctx, req.(*StopSingleVMReq))
+	return 0
+}
+
+func (m *InstanceInfo) GetServed() uint64 {
+	if m != nil {
+		return m.Served
 	}
-	return interceptor(ctx, in, info, handler)
+	return 0
 }
 
-var _Orchestrator_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "proto.Orchestrator",
-	HandlerType: (*OrchestratorServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "StartVM",
-			Handler:    _Orchestrator_StartVM_Handler,
-		},
-		{
-			MethodName: "StopVMs",
-			Handler:    _Orchestrator_StopVMs_Handler,
-		},
+func (m *InstanceInfo) GetStarted() uint64 {
+	if m != nil {
+		return m.Started
+	}
+	return 0
+}
+
+func (m *InstanceInfo) GetFailed() uint64 {
+	if m != nil {
+		return m.Failed
+	}
+	return 0
+}
+
+type InvokeReq struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Image                string   `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	Payload              string   `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *InvokeReq) Reset()         { *m = InvokeReq{} }
+func (m *InvokeReq) String() string { return proto.CompactTextString(m) }
+func (*InvokeReq) ProtoMessage()    {}
+func (*InvokeReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{8}
+}
+
+func (m *InvokeReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InvokeReq.Unmarshal(m, b)
+}
+func (m *InvokeReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InvokeReq.Marshal(b, m, deterministic)
+}
+func (m *InvokeReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InvokeReq.Merge(m, src)
+}
+func (m *InvokeReq) XXX_Size() int {
+	return xxx_messageInfo_InvokeReq.Size(m)
+}
+func (m *InvokeReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_InvokeReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InvokeReq proto.InternalMessageInfo
+
+func (m *InvokeReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *InvokeReq) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *InvokeReq) GetPayload() string {
+	if m != nil {
+		return m.Payload
+	}
+	return ""
+}
+
+type InvokeResp struct {
+	Payload     string `protobuf:"bytes,1,opt,name=payload,proto3" json:"payload,omitempty"`
+	IsColdStart bool   `protobuf:"varint,2,opt,name=is_cold_start,json=isColdStart,proto3" json:"is_cold_start,omitempty"`
+	// Breakdown (in microseconds) of this invocation
+	Metrics              map[string]float64 `protobuf:"bytes,3,rep,name=metrics,proto3" json:"metrics,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"fixed64,2,opt,name=value,proto3"`
+	Function             *FunctionInfo      `protobuf:"bytes,4,opt,name=function,proto3" json:"function,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *InvokeResp) Reset()         { *m = InvokeResp{} }
+func (m *InvokeResp) String() string { return proto.CompactTextString(m) }
+func (*InvokeResp) ProtoMessage()    {}
+func (*InvokeResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{9}
+}
+
+func (m *InvokeResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_InvokeResp.Unmarshal(m, b)
+}
+func (m *InvokeResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_InvokeResp.Marshal(b, m, deterministic)
+}
+func (m *InvokeResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_InvokeResp.Merge(m, src)
+}
+func (m *InvokeResp) XXX_Size() int {
+	return xxx_messageInfo_InvokeResp.Size(m)
+}
+func (m *InvokeResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_InvokeResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_InvokeResp proto.InternalMessageInfo
+
+func (m *InvokeResp) GetPayload() string {
+	if m != nil {
+		return m.Payload
+	}
+	return ""
+}
+
+func (m *InvokeResp) GetIsColdStart() bool {
+	if m != nil {
+		return m.IsColdStart
+	}
+	return false
+}
+
+func (m *InvokeResp) GetMetrics() map[string]float64 {
+	if m != nil {
+		return m.Metrics
+	}
+	return nil
+}
+
+func (m *InvokeResp) GetFunction() *FunctionInfo {
+	if m != nil {
+		return m.Function
+	}
+	return nil
+}
+
+type RegisterFunctionReq struct {
+	Id    string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Image string `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	// Spec of the function's VMs, the defaults are used if not set
+	VmSpec *VMSpec `protobuf:"bytes,3,opt,name=vm_spec,json=vmSpec,proto3" json:"vm_spec,omitempty"`
+	// Maximum number of instances the function scales out to, the orchestrator's default if not set
+	MaxInstances uint32 `protobuf:"varint,4,opt,name=max_instances,json=maxInstances,proto3" json:"max_instances,omitempty"`
+	// Timeout (in milliseconds) of the requests to the function when the client sets no deadline,
+	// the orchestrator's default if not set
+	TimeoutMs uint64 `protobuf:"varint,5,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	// Port the function's server listens on in the instance, 50051 if not set
+	Port uint32 `protobuf:"varint,6,opt,name=port,proto3" json:"port,omitempty"`
+	// Protocol the function's server speaks, "grpc" (default) or "http"
+	Protocol             string   `protobuf:"bytes,7,opt,name=protocol,proto3" json:"protocol,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RegisterFunctionReq) Reset()         { *m = RegisterFunctionReq{} }
+func (m *RegisterFunctionReq) String() string { return proto.CompactTextString(m) }
+func (*RegisterFunctionReq) ProtoMessage()    {}
+func (*RegisterFunctionReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{10}
+}
+
+func (m *RegisterFunctionReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RegisterFunctionReq.Unmarshal(m, b)
+}
+func (m *RegisterFunctionReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RegisterFunctionReq.Marshal(b, m, deterministic)
+}
+func (m *RegisterFunctionReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RegisterFunctionReq.Merge(m, src)
+}
+func (m *RegisterFunctionReq) XXX_Size() int {
+	return xxx_messageInfo_RegisterFunctionReq.Size(m)
+}
+func (m *RegisterFunctionReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_RegisterFunctionReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RegisterFunctionReq proto.InternalMessageInfo
+
+func (m *RegisterFunctionReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+func (m *RegisterFunctionReq) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *RegisterFunctionReq) GetVmSpec() *VMSpec {
+	if m != nil {
+		return m.VmSpec
+	}
+	return nil
+}
+
+func (m *RegisterFunctionReq) GetMaxInstances() uint32 {
+	if m != nil {
+		return m.MaxInstances
+	}
+	return 0
+}
+
+func (m *RegisterFunctionReq) GetTimeoutMs() uint64 {
+	if m != nil {
+		return m.TimeoutMs
+	}
+	return 0
+}
+
+func (m *RegisterFunctionReq) GetPort() uint32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
+}
+
+func (m *RegisterFunctionReq) GetProtocol() string {
+	if m != nil {
+		return m.Protocol
+	}
+	return ""
+}
+
+type DeregisterFunctionReq struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeregisterFunctionReq) Reset()         { *m = DeregisterFunctionReq{} }
+func (m *DeregisterFunctionReq) String() string { return proto.CompactTextString(m) }
+func (*DeregisterFunctionReq) ProtoMessage()    {}
+func (*DeregisterFunctionReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{11}
+}
+
+func (m *DeregisterFunctionReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeregisterFunctionReq.Unmarshal(m, b)
+}
+func (m *DeregisterFunctionReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeregisterFunctionReq.Marshal(b, m, deterministic)
+}
+func (m *DeregisterFunctionReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeregisterFunctionReq.Merge(m, src)
+}
+func (m *DeregisterFunctionReq) XXX_Size() int {
+	return xxx_messageInfo_DeregisterFunctionReq.Size(m)
+}
+func (m *DeregisterFunctionReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeregisterFunctionReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeregisterFunctionReq proto.InternalMessageInfo
+
+func (m *DeregisterFunctionReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type ListFunctionsReq struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListFunctionsReq) Reset()         { *m = ListFunctionsReq{} }
+func (m *ListFunctionsReq) String() string { return proto.CompactTextString(m) }
+func (*ListFunctionsReq) ProtoMessage()    {}
+func (*ListFunctionsReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{12}
+}
+
+func (m *ListFunctionsReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFunctionsReq.Unmarshal(m, b)
+}
+func (m *ListFunctionsReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFunctionsReq.Marshal(b, m, deterministic)
+}
+func (m *ListFunctionsReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFunctionsReq.Merge(m, src)
+}
+func (m *ListFunctionsReq) XXX_Size() int {
+	return xxx_messageInfo_ListFunctionsReq.Size(m)
+}
+func (m *ListFunctionsReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFunctionsReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFunctionsReq proto.InternalMessageInfo
+
+type ListFunctionsResp struct {
+	Functions            []*FunctionInfo `protobuf:"bytes,1,rep,name=functions,proto3" json:"functions,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *ListFunctionsResp) Reset()         { *m = ListFunctionsResp{} }
+func (m *ListFunctionsResp) String() string { return proto.CompactTextString(m) }
+func (*ListFunctionsResp) ProtoMessage()    {}
+func (*ListFunctionsResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{13}
+}
+
+func (m *ListFunctionsResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListFunctionsResp.Unmarshal(m, b)
+}
+func (m *ListFunctionsResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListFunctionsResp.Marshal(b, m, deterministic)
+}
+func (m *ListFunctionsResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListFunctionsResp.Merge(m, src)
+}
+func (m *ListFunctionsResp) XXX_Size() int {
+	return xxx_messageInfo_ListFunctionsResp.Size(m)
+}
+func (m *ListFunctionsResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListFunctionsResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListFunctionsResp proto.InternalMessageInfo
+
+func (m *ListFunctionsResp) GetFunctions() []*FunctionInfo {
+	if m != nil {
+		return m.Functions
+	}
+	return nil
+}
+
+type GetFunctionReq struct {
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetFunctionReq) Reset()         { *m = GetFunctionReq{} }
+func (m *GetFunctionReq) String() string { return proto.CompactTextString(m) }
+func (*GetFunctionReq) ProtoMessage()    {}
+func (*GetFunctionReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{14}
+}
+
+func (m *GetFunctionReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetFunctionReq.Unmarshal(m, b)
+}
+func (m *GetFunctionReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetFunctionReq.Marshal(b, m, deterministic)
+}
+func (m *GetFunctionReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetFunctionReq.Merge(m, src)
+}
+func (m *GetFunctionReq) XXX_Size() int {
+	return xxx_messageInfo_GetFunctionReq.Size(m)
+}
+func (m *GetFunctionReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetFunctionReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetFunctionReq proto.InternalMessageInfo
+
+func (m *GetFunctionReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+type SnapshotInfo struct {
+	VmId  string `protobuf:"bytes,1,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	Image string `protobuf:"bytes,2,opt,name=image,proto3" json:"image,omitempty"`
+	// Creation time in nanoseconds since the Unix epoch
+	CreatedAt int64 `protobuf:"varint,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// Total size of the snapshot files in bytes
+	Size                 int64    `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	SnapFileSize         int64    `protobuf:"varint,5,opt,name=snap_file_size,json=snapFileSize,proto3" json:"snap_file_size,omitempty"`
+	MemFileSize          int64    `protobuf:"varint,6,opt,name=mem_file_size,json=memFileSize,proto3" json:"mem_file_size,omitempty"`
+	WorkingSetSize       int64    `protobuf:"varint,7,opt,name=working_set_size,json=workingSetSize,proto3" json:"working_set_size,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *SnapshotInfo) Reset()         { *m = SnapshotInfo{} }
+func (m *SnapshotInfo) String() string { return proto.CompactTextString(m) }
+func (*SnapshotInfo) ProtoMessage()    {}
+func (*SnapshotInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{15}
+}
+
+func (m *SnapshotInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_SnapshotInfo.Unmarshal(m, b)
+}
+func (m *SnapshotInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_SnapshotInfo.Marshal(b, m, deterministic)
+}
+func (m *SnapshotInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_SnapshotInfo.Merge(m, src)
+}
+func (m *SnapshotInfo) XXX_Size() int {
+	return xxx_messageInfo_SnapshotInfo.Size(m)
+}
+func (m *SnapshotInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_SnapshotInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_SnapshotInfo proto.InternalMessageInfo
+
+func (m *SnapshotInfo) GetVmId() string {
+	if m != nil {
+		return m.VmId
+	}
+	return ""
+}
+
+func (m *SnapshotInfo) GetImage() string {
+	if m != nil {
+		return m.Image
+	}
+	return ""
+}
+
+func (m *SnapshotInfo) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return 0
+}
+
+func (m *SnapshotInfo) GetSize() int64 {
+	if m != nil {
+		return m.Size
+	}
+	return 0
+}
+
+func (m *SnapshotInfo) GetSnapFileSize() int64 {
+	if m != nil {
+		return m.SnapFileSize
+	}
+	return 0
+}
+
+func (m *SnapshotInfo) GetMemFileSize() int64 {
+	if m != nil {
+		return m.MemFileSize
+	}
+	return 0
+}
+
+func (m *SnapshotInfo) GetWorkingSetSize() int64 {
+	if m != nil {
+		return m.WorkingSetSize
+	}
+	return 0
+}
+
+type ListSnapshotsReq struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListSnapshotsReq) Reset()         { *m = ListSnapshotsReq{} }
+func (m *ListSnapshotsReq) String() string { return proto.CompactTextString(m) }
+func (*ListSnapshotsReq) ProtoMessage()    {}
+func (*ListSnapshotsReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{16}
+}
+
+func (m *ListSnapshotsReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListSnapshotsReq.Unmarshal(m, b)
+}
+func (m *ListSnapshotsReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListSnapshotsReq.Marshal(b, m, deterministic)
+}
+func (m *ListSnapshotsReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListSnapshotsReq.Merge(m, src)
+}
+func (m *ListSnapshotsReq) XXX_Size() int {
+	return xxx_messageInfo_ListSnapshotsReq.Size(m)
+}
+func (m *ListSnapshotsReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListSnapshotsReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListSnapshotsReq proto.InternalMessageInfo
+
+type ListSnapshotsResp struct {
+	Snapshots            []*SnapshotInfo `protobuf:"bytes,1,rep,name=snapshots,proto3" json:"snapshots,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *ListSnapshotsResp) Reset()         { *m = ListSnapshotsResp{} }
+func (m *ListSnapshotsResp) String() string { return proto.CompactTextString(m) }
+func (*ListSnapshotsResp) ProtoMessage()    {}
+func (*ListSnapshotsResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{17}
+}
+
+func (m *ListSnapshotsResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListSnapshotsResp.Unmarshal(m, b)
+}
+func (m *ListSnapshotsResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListSnapshotsResp.Marshal(b, m, deterministic)
+}
+func (m *ListSnapshotsResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListSnapshotsResp.Merge(m, src)
+}
+func (m *ListSnapshotsResp) XXX_Size() int {
+	return xxx_messageInfo_ListSnapshotsResp.Size(m)
+}
+func (m *ListSnapshotsResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListSnapshotsResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListSnapshotsResp proto.InternalMessageInfo
+
+func (m *ListSnapshotsResp) GetSnapshots() []*SnapshotInfo {
+	if m != nil {
+		return m.Snapshots
+	}
+	return nil
+}
+
+type GetSnapshotReq struct {
+	VmId                 string   `protobuf:"bytes,1,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetSnapshotReq) Reset()         { *m = GetSnapshotReq{} }
+func (m *GetSnapshotReq) String() string { return proto.CompactTextString(m) }
+func (*GetSnapshotReq) ProtoMessage()    {}
+func (*GetSnapshotReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{18}
+}
+
+func (m *GetSnapshotReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetSnapshotReq.Unmarshal(m, b)
+}
+func (m *GetSnapshotReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetSnapshotReq.Marshal(b, m, deterministic)
+}
+func (m *GetSnapshotReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetSnapshotReq.Merge(m, src)
+}
+func (m *GetSnapshotReq) XXX_Size() int {
+	return xxx_messageInfo_GetSnapshotReq.Size(m)
+}
+func (m *GetSnapshotReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetSnapshotReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetSnapshotReq proto.InternalMessageInfo
+
+func (m *GetSnapshotReq) GetVmId() string {
+	if m != nil {
+		return m.VmId
+	}
+	return ""
+}
+
+type DeleteSnapshotReq struct {
+	VmId                 string   `protobuf:"bytes,1,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeleteSnapshotReq) Reset()         { *m = DeleteSnapshotReq{} }
+func (m *DeleteSnapshotReq) String() string { return proto.CompactTextString(m) }
+func (*DeleteSnapshotReq) ProtoMessage()    {}
+func (*DeleteSnapshotReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{19}
+}
+
+func (m *DeleteSnapshotReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeleteSnapshotReq.Unmarshal(m, b)
+}
+func (m *DeleteSnapshotReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeleteSnapshotReq.Marshal(b, m, deterministic)
+}
+func (m *DeleteSnapshotReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeleteSnapshotReq.Merge(m, src)
+}
+func (m *DeleteSnapshotReq) XXX_Size() int {
+	return xxx_messageInfo_DeleteSnapshotReq.Size(m)
+}
+func (m *DeleteSnapshotReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeleteSnapshotReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeleteSnapshotReq proto.InternalMessageInfo
+
+func (m *DeleteSnapshotReq) GetVmId() string {
+	if m != nil {
+		return m.VmId
+	}
+	return ""
+}
+
+type CreateSnapshotReq struct {
+	// ID of the function whose running instance is to be snapshotted
+	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CreateSnapshotReq) Reset()         { *m = CreateSnapshotReq{} }
+func (m *CreateSnapshotReq) String() string { return proto.CompactTextString(m) }
+func (*CreateSnapshotReq) ProtoMessage()    {}
+func (*CreateSnapshotReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{20}
+}
+
+func (m *CreateSnapshotReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CreateSnapshotReq.Unmarshal(m, b)
+}
+func (m *CreateSnapshotReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CreateSnapshotReq.Marshal(b, m, deterministic)
+}
+func (m *CreateSnapshotReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CreateSnapshotReq.Merge(m, src)
+}
+func (m *CreateSnapshotReq) XXX_Size() int {
+	return xxx_messageInfo_CreateSnapshotReq.Size(m)
+}
+func (m *CreateSnapshotReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_CreateSnapshotReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CreateSnapshotReq proto.InternalMessageInfo
+
+func (m *CreateSnapshotReq) GetId() string {
+	if m != nil {
+		return m.Id
+	}
+	return ""
+}
+
+// Counters of the current activation of a VM, or of the last one if the VM is not active
+type FaultCounters struct {
+	Served int64 `protobuf:"varint,1,opt,name=served,proto3" json:"served,omitempty"`
+	// Pages served that are missing from the trace, in the replay mode
+	Missed int64 `protobuf:"varint,2,opt,name=missed,proto3" json:"missed,omitempty"`
+	// Page faults on the pages of the working set before they are installed
+	TraceFaults int64 `protobuf:"varint,3,opt,name=trace_faults,json=traceFaults,proto3" json:"trace_faults,omitempty"`
+	// Pages of the working set installed in the background
+	Prefetched int64 `protobuf:"varint,4,opt,name=prefetched,proto3" json:"prefetched,omitempty"`
+	ZeroPages  int64 `protobuf:"varint,5,opt,name=zero_pages,json=zeroPages,proto3" json:"zero_pages,omitempty"`
+	// Pages written, if the dirty pages are tracked
+	Dirtied              int64    `protobuf:"varint,6,opt,name=dirtied,proto3" json:"dirtied,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *FaultCounters) Reset()         { *m = FaultCounters{} }
+func (m *FaultCounters) String() string { return proto.CompactTextString(m) }
+func (*FaultCounters) ProtoMessage()    {}
+func (*FaultCounters) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{21}
+}
+
+func (m *FaultCounters) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_FaultCounters.Unmarshal(m, b)
+}
+func (m *FaultCounters) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_FaultCounters.Marshal(b, m, deterministic)
+}
+func (m *FaultCounters) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_FaultCounters.Merge(m, src)
+}
+func (m *FaultCounters) XXX_Size() int {
+	return xxx_messageInfo_FaultCounters.Size(m)
+}
+func (m *FaultCounters) XXX_DiscardUnknown() {
+	xxx_messageInfo_FaultCounters.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_FaultCounters proto.InternalMessageInfo
+
+func (m *FaultCounters) GetServed() int64 {
+	if m != nil {
+		return m.Served
+	}
+	return 0
+}
+
+func (m *FaultCounters) GetMissed() int64 {
+	if m != nil {
+		return m.Missed
+	}
+	return 0
+}
+
+func (m *FaultCounters) GetTraceFaults() int64 {
+	if m != nil {
+		return m.TraceFaults
+	}
+	return 0
+}
+
+func (m *FaultCounters) GetPrefetched() int64 {
+	if m != nil {
+		return m.Prefetched
+	}
+	return 0
+}
+
+func (m *FaultCounters) GetZeroPages() int64 {
+	if m != nil {
+		return m.ZeroPages
+	}
+	return 0
+}
+
+func (m *FaultCounters) GetDirtied() int64 {
+	if m != nil {
+		return m.Dirtied
+	}
+	return 0
+}
+
+type LatencyHistogram struct {
+	// Kind of the page faults, e.g., WorkingSet or GuestMemory
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Exclusive upper bounds of the buckets in microseconds, the last bucket has no upper bound
+	BoundsUs             []int64  `protobuf:"varint,2,rep,packed,name=bounds_us,json=boundsUs,proto3" json:"bounds_us,omitempty"`
+	Counts               []uint64 `protobuf:"varint,3,rep,packed,name=counts,proto3" json:"counts,omitempty"`
+	Count                uint64   `protobuf:"varint,4,opt,name=count,proto3" json:"count,omitempty"`
+	SumUs                int64    `protobuf:"varint,5,opt,name=sum_us,json=sumUs,proto3" json:"sum_us,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *LatencyHistogram) Reset()         { *m = LatencyHistogram{} }
+func (m *LatencyHistogram) String() string { return proto.CompactTextString(m) }
+func (*LatencyHistogram) ProtoMessage()    {}
+func (*LatencyHistogram) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{22}
+}
+
+func (m *LatencyHistogram) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_LatencyHistogram.Unmarshal(m, b)
+}
+func (m *LatencyHistogram) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_LatencyHistogram.Marshal(b, m, deterministic)
+}
+func (m *LatencyHistogram) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_LatencyHistogram.Merge(m, src)
+}
+func (m *LatencyHistogram) XXX_Size() int {
+	return xxx_messageInfo_LatencyHistogram.Size(m)
+}
+func (m *LatencyHistogram) XXX_DiscardUnknown() {
+	xxx_messageInfo_LatencyHistogram.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_LatencyHistogram proto.InternalMessageInfo
+
+func (m *LatencyHistogram) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *LatencyHistogram) GetBoundsUs() []int64 {
+	if m != nil {
+		return m.BoundsUs
+	}
+	return nil
+}
+
+func (m *LatencyHistogram) GetCounts() []uint64 {
+	if m != nil {
+		return m.Counts
+	}
+	return nil
+}
+
+func (m *LatencyHistogram) GetCount() uint64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func (m *LatencyHistogram) GetSumUs() int64 {
+	if m != nil {
+		return m.SumUs
+	}
+	return 0
+}
+
+type MemoryVMInfo struct {
+	VmId     string `protobuf:"bytes,1,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	IsActive bool   `protobuf:"varint,2,opt,name=is_active,json=isActive,proto3" json:"is_active,omitempty"`
+	// "record" or "replay"
+	Mode         string `protobuf:"bytes,3,opt,name=mode,proto3" json:"mode,omitempty"`
+	IsLazyMode   bool   `protobuf:"varint,4,opt,name=is_lazy_mode,json=isLazyMode,proto3" json:"is_lazy_mode,omitempty"`
+	IsHybridMode bool   `protobuf:"varint,5,opt,name=is_hybrid_mode,json=isHybridMode,proto3" json:"is_hybrid_mode,omitempty"`
+	// Invocations recorded so far to build the working set
+	Recordings int32 `protobuf:"varint,6,opt,name=recordings,proto3" json:"recordings,omitempty"`
+	// Pages of the trace
+	TraceLen        int32               `protobuf:"varint,7,opt,name=trace_len,json=traceLen,proto3" json:"trace_len,omitempty"`
+	NumRegions      int32               `protobuf:"varint,8,opt,name=num_regions,json=numRegions,proto3" json:"num_regions,omitempty"`
+	WorkingSetBytes int64               `protobuf:"varint,9,opt,name=working_set_bytes,json=workingSetBytes,proto3" json:"working_set_bytes,omitempty"`
+	Faults          *FaultCounters      `protobuf:"bytes,10,opt,name=faults,proto3" json:"faults,omitempty"`
+	Latency         []*LatencyHistogram `protobuf:"bytes,11,rep,name=latency,proto3" json:"latency,omitempty"`
+	// The dirty pages are tracked, unless the kernel does not support it
+	IsTrackingDirty      bool     `protobuf:"varint,12,opt,name=is_tracking_dirty,json=isTrackingDirty,proto3" json:"is_tracking_dirty,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MemoryVMInfo) Reset()         { *m = MemoryVMInfo{} }
+func (m *MemoryVMInfo) String() string { return proto.CompactTextString(m) }
+func (*MemoryVMInfo) ProtoMessage()    {}
+func (*MemoryVMInfo) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{23}
+}
+
+func (m *MemoryVMInfo) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MemoryVMInfo.Unmarshal(m, b)
+}
+func (m *MemoryVMInfo) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MemoryVMInfo.Marshal(b, m, deterministic)
+}
+func (m *MemoryVMInfo) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MemoryVMInfo.Merge(m, src)
+}
+func (m *MemoryVMInfo) XXX_Size() int {
+	return xxx_messageInfo_MemoryVMInfo.Size(m)
+}
+func (m *MemoryVMInfo) XXX_DiscardUnknown() {
+	xxx_messageInfo_MemoryVMInfo.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MemoryVMInfo proto.InternalMessageInfo
+
+func (m *MemoryVMInfo) GetVmId() string {
+	if m != nil {
+		return m.VmId
+	}
+	return ""
+}
+
+func (m *MemoryVMInfo) GetIsActive() bool {
+	if m != nil {
+		return m.IsActive
+	}
+	return false
+}
+
+func (m *MemoryVMInfo) GetMode() string {
+	if m != nil {
+		return m.Mode
+	}
+	return ""
+}
+
+func (m *MemoryVMInfo) GetIsLazyMode() bool {
+	if m != nil {
+		return m.IsLazyMode
+	}
+	return false
+}
+
+func (m *MemoryVMInfo) GetIsHybridMode() bool {
+	if m != nil {
+		return m.IsHybridMode
+	}
+	return false
+}
+
+func (m *MemoryVMInfo) GetRecordings() int32 {
+	if m != nil {
+		return m.Recordings
+	}
+	return 0
+}
+
+func (m *MemoryVMInfo) GetTraceLen() int32 {
+	if m != nil {
+		return m.TraceLen
+	}
+	return 0
+}
+
+func (m *MemoryVMInfo) GetNumRegions() int32 {
+	if m != nil {
+		return m.NumRegions
+	}
+	return 0
+}
+
+func (m *MemoryVMInfo) GetWorkingSetBytes() int64 {
+	if m != nil {
+		return m.WorkingSetBytes
+	}
+	return 0
+}
+
+func (m *MemoryVMInfo) GetFaults() *FaultCounters {
+	if m != nil {
+		return m.Faults
+	}
+	return nil
+}
+
+func (m *MemoryVMInfo) GetLatency() []*LatencyHistogram {
+	if m != nil {
+		return m.Latency
+	}
+	return nil
+}
+
+func (m *MemoryVMInfo) GetIsTrackingDirty() bool {
+	if m != nil {
+		return m.IsTrackingDirty
+	}
+	return false
+}
+
+type ListMemoryVMsReq struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListMemoryVMsReq) Reset()         { *m = ListMemoryVMsReq{} }
+func (m *ListMemoryVMsReq) String() string { return proto.CompactTextString(m) }
+func (*ListMemoryVMsReq) ProtoMessage()    {}
+func (*ListMemoryVMsReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{24}
+}
+
+func (m *ListMemoryVMsReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListMemoryVMsReq.Unmarshal(m, b)
+}
+func (m *ListMemoryVMsReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListMemoryVMsReq.Marshal(b, m, deterministic)
+}
+func (m *ListMemoryVMsReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListMemoryVMsReq.Merge(m, src)
+}
+func (m *ListMemoryVMsReq) XXX_Size() int {
+	return xxx_messageInfo_ListMemoryVMsReq.Size(m)
+}
+func (m *ListMemoryVMsReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListMemoryVMsReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListMemoryVMsReq proto.InternalMessageInfo
+
+type ListMemoryVMsResp struct {
+	Vms                  []*MemoryVMInfo `protobuf:"bytes,1,rep,name=vms,proto3" json:"vms,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *ListMemoryVMsResp) Reset()         { *m = ListMemoryVMsResp{} }
+func (m *ListMemoryVMsResp) String() string { return proto.CompactTextString(m) }
+func (*ListMemoryVMsResp) ProtoMessage()    {}
+func (*ListMemoryVMsResp) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{25}
+}
+
+func (m *ListMemoryVMsResp) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListMemoryVMsResp.Unmarshal(m, b)
+}
+func (m *ListMemoryVMsResp) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListMemoryVMsResp.Marshal(b, m, deterministic)
+}
+func (m *ListMemoryVMsResp) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListMemoryVMsResp.Merge(m, src)
+}
+func (m *ListMemoryVMsResp) XXX_Size() int {
+	return xxx_messageInfo_ListMemoryVMsResp.Size(m)
+}
+func (m *ListMemoryVMsResp) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListMemoryVMsResp.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListMemoryVMsResp proto.InternalMessageInfo
+
+func (m *ListMemoryVMsResp) GetVms() []*MemoryVMInfo {
+	if m != nil {
+		return m.Vms
+	}
+	return nil
+}
+
+type GetMemoryVMReq struct {
+	VmId                 string   `protobuf:"bytes,1,opt,name=vm_id,json=vmId,proto3" json:"vm_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetMemoryVMReq) Reset()         { *m = GetMemoryVMReq{} }
+func (m *GetMemoryVMReq) String() string { return proto.CompactTextString(m) }
+func (*GetMemoryVMReq) ProtoMessage()    {}
+func (*GetMemoryVMReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_96b6e6782baaa298, []int{26}
+}
+
+func (m *GetMemoryVMReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetMemoryVMReq.Unmarshal(m, b)
+}
+func (m *GetMemoryVMReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetMemoryVMReq.Marshal(b, m, deterministic)
+}
+func (m *GetMemoryVMReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetMemoryVMReq.Merge(m, src)
+}
+func (m *GetMemoryVMReq) XXX_Size() int {
+	return xxx_messageInfo_GetMemoryVMReq.Size(m)
+}
+func (m *GetMemoryVMReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetMemoryVMReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetMemoryVMReq proto.InternalMessageInfo
+
+func (m *GetMemoryVMReq) GetVmId() string {
+	if m != nil {
+		return m.VmId
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterEnum("proto.InstanceState", InstanceState_name, InstanceState_value)
+	proto.RegisterType((*StartVMReq)(nil), "proto.StartVMReq")
+	proto.RegisterType((*VMSpec)(nil), "proto.VMSpec")
+	proto.RegisterType((*StopVMsReq)(nil), "proto.StopVMsReq")
+	proto.RegisterType((*StopSingleVMReq)(nil), "proto.StopSingleVMReq")
+	proto.RegisterType((*Status)(nil), "proto.Status")
+	proto.RegisterType((*StartVMResp)(nil), "proto.StartVMResp")
+	proto.RegisterType((*FunctionInfo)(nil), "proto.FunctionInfo")
+	proto.RegisterMapType((map[string]float64)(nil), "proto.FunctionInfo.ColdStartMetricsEntry")
+	proto.RegisterType((*InstanceInfo)(nil), "proto.InstanceInfo")
+	proto.RegisterType((*InvokeReq)(nil), "proto.InvokeReq")
+	proto.RegisterType((*InvokeResp)(nil), "proto.InvokeResp")
+	proto.RegisterMapType((map[string]float64)(nil), "proto.InvokeResp.MetricsEntry")
+	proto.RegisterType((*RegisterFunctionReq)(nil), "proto.RegisterFunctionReq")
+	proto.RegisterType((*DeregisterFunctionReq)(nil), "proto.DeregisterFunctionReq")
+	proto.RegisterType((*ListFunctionsReq)(nil), "proto.ListFunctionsReq")
+	proto.RegisterType((*ListFunctionsResp)(nil), "proto.ListFunctionsResp")
+	proto.RegisterType((*GetFunctionReq)(nil), "proto.GetFunctionReq")
+	proto.RegisterType((*SnapshotInfo)(nil), "proto.SnapshotInfo")
+	proto.RegisterType((*ListSnapshotsReq)(nil), "proto.ListSnapshotsReq")
+	proto.RegisterType((*ListSnapshotsResp)(nil), "proto.ListSnapshotsResp")
+	proto.RegisterType((*GetSnapshotReq)(nil), "proto.GetSnapshotReq")
+	proto.RegisterType((*DeleteSnapshotReq)(nil), "proto.DeleteSnapshotReq")
+	proto.RegisterType((*CreateSnapshotReq)(nil), "proto.CreateSnapshotReq")
+	proto.RegisterType((*FaultCounters)(nil), "proto.FaultCounters")
+	proto.RegisterType((*LatencyHistogram)(nil), "proto.LatencyHistogram")
+	proto.RegisterType((*MemoryVMInfo)(nil), "proto.MemoryVMInfo")
+	proto.RegisterType((*ListMemoryVMsReq)(nil), "proto.ListMemoryVMsReq")
+	proto.RegisterType((*ListMemoryVMsResp)(nil), "proto.ListMemoryVMsResp")
+	proto.RegisterType((*GetMemoryVMReq)(nil), "proto.GetMemoryVMReq")
+}
+
+func init() { proto.RegisterFile("orchestrator.proto", fileDescriptor_96b6e6782baaa298) }
+
+var fileDescriptor_96b6e6782baaa298 = []byte{
+	// 1725 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x9c, 0x58, 0x4b, 0x73, 0xdb, 0xc8,
+	0x11, 0x16, 0x08, 0x3e, 0x9b, 0x0f, 0x91, 0xe3, 0xf5, 0x2e, 0xc2, 0xc4, 0x0e, 0x17, 0xbb, 0xce,
+	0x2a, 0xae, 0x44, 0x5b, 0xab, 0xa4, 0x2a, 0x5b, 0xce, 0x49, 0xd6, 0x63, 0xc5, 0x8a, 0x24, 0xbb,
+	0x46, 0xb6, 0x52, 0xc9, 0x05, 0x05, 0x01, 0x23, 0x7a, 0xca, 0x78, 0x19, 0x33, 0x60, 0x4c, 0xfd,
+	0x82, 0x1c, 0x53, 0xc9, 0x4f, 0xc9, 0x31, 0x3f, 0x24, 0xd7, 0xfc, 0x85, 0x5c, 0x72, 0x4e, 0xcd,
+	0x60, 0x86, 0x1c, 0x52, 0xa0, 0xed, 0xe4, 0x24, 0xf6, 0x87, 0xc6, 0x3c, 0xbe, 0xee, 0xaf, 0xbb,
+	0x21, 0x40, 0x69, 0x1e, 0xbc, 0x21, 0x8c, 0xe7, 0x3e, 0x4f, 0xf3, 0xfd, 0x2c, 0x4f, 0x79, 0x8a,
+	0x1a, 0xf2, 0x8f, 0xfb, 0x47, 0x80, 0x2b, 0xee, 0xe7, 0xfc, 0xfa, 0x02, 0x93, 0x77, 0xe8, 0x33,
+	0x68, 0xd0, 0xd8, 0x9f, 0x11, 0xc7, 0x9a, 0x58, 0x7b, 0x1d, 0x5c, 0x1a, 0x68, 0x00, 0x35, 0x1a,
+	0x3a, 0x35, 0x09, 0xd5, 0x68, 0x88, 0x7e, 0x06, 0xad, 0x79, 0xec, 0xb1, 0x8c, 0x04, 0x8e, 0x3d,
+	0xb1, 0xf6, 0xba, 0x07, 0xfd, 0x72, 0xcd, 0xfd, 0xeb, 0x8b, 0xab, 0x8c, 0x04, 0xb8, 0x39, 0x8f,
+	0xc5, 0x5f, 0xf7, 0x6f, 0x16, 0x34, 0x4b, 0x08, 0x3d, 0x02, 0x98, 0x07, 0x59, 0xe1, 0x05, 0x69,
+	0x91, 0x70, 0xb9, 0x7a, 0x1f, 0x77, 0x04, 0x72, 0x24, 0x00, 0x34, 0x81, 0x5e, 0x4c, 0x62, 0x8f,
+	0xd1, 0x3b, 0xe2, 0xc5, 0xf4, 0x46, 0xee, 0xd5, 0xc7, 0x10, 0x93, 0xf8, 0x8a, 0xde, 0x91, 0x0b,
+	0x7a, 0x83, 0x7e, 0x0a, 0xdd, 0xb7, 0x24, 0x4f, 0x48, 0xe4, 0xf9, 0xf9, 0x8c, 0xc9, 0x7d, 0x3b,
+	0x18, 0x4a, 0xe8, 0x30, 0x9f, 0x31, 0xf4, 0x0d, 0xec, 0x72, 0x1a, 0x93, 0xb4, 0xe0, 0x1e, 0x23,
+	0x41, 0x9a, 0x84, 0xcc, 0xa9, 0xcb, 0x55, 0x06, 0x0a, 0xbe, 0x2a, 0x51, 0xf7, 0x89, 0xb8, 0x71,
+	0x9a, 0x5d, 0x5f, 0x30, 0x71, 0xe3, 0x2f, 0xa0, 0xe5, 0x47, 0x91, 0x37, 0x8f, 0x99, 0x3c, 0x55,
+	0x1b, 0x37, 0xfd, 0x28, 0xba, 0x8e, 0x99, 0xfb, 0x25, 0xec, 0x0a, 0xb7, 0x2b, 0x9a, 0xcc, 0x22,
+	0x52, 0xb2, 0x53, 0xf2, 0x60, 0x69, 0x1e, 0x5c, 0x17, 0x9a, 0x57, 0xdc, 0xe7, 0x05, 0x43, 0x0e,
+	0xb4, 0x62, 0xc2, 0xd8, 0x8a, 0x39, 0x6d, 0xba, 0x39, 0x74, 0x97, 0xfc, 0xb2, 0x6c, 0xbb, 0xa3,
+	0x78, 0x92, 0xe5, 0xe9, 0x2d, 0x8d, 0x88, 0x62, 0x5a, 0x9b, 0xe8, 0x5b, 0x68, 0xdf, 0x16, 0x49,
+	0xc0, 0x69, 0x9a, 0x28, 0xbe, 0x1f, 0x28, 0xbe, 0x4f, 0x15, 0x3c, 0x4d, 0x6e, 0x53, 0xbc, 0x74,
+	0x72, 0xff, 0xd2, 0x80, 0x9e, 0xf9, 0x68, 0xf3, 0xe0, 0xab, 0x30, 0xd7, 0xcc, 0x30, 0x3f, 0x85,
+	0x06, 0xe3, 0x3e, 0x27, 0x72, 0x93, 0xc1, 0xc1, 0x67, 0x6a, 0x93, 0x69, 0xc2, 0xb8, 0x9f, 0x04,
+	0x44, 0x5c, 0x95, 0xe0, 0xd2, 0x05, 0x3d, 0x80, 0xc6, 0x3c, 0xf6, 0x68, 0x28, 0x39, 0xee, 0xe0,
+	0xfa, 0x3c, 0x9e, 0x86, 0xe8, 0x47, 0xd0, 0x9e, 0x15, 0x84, 0x71, 0x8f, 0x66, 0x4e, 0xa3, 0xbc,
+	0x83, 0xb4, 0xa7, 0x19, 0xfa, 0x31, 0x74, 0x28, 0xf3, 0x32, 0x9a, 0x24, 0x24, 0x74, 0x9a, 0x92,
+	0xe8, 0x36, 0x65, 0x2f, 0xa5, 0x8d, 0x9e, 0xc2, 0x88, 0x32, 0x8f, 0x25, 0x7e, 0xc6, 0xde, 0xa4,
+	0xdc, 0xcb, 0x89, 0x1f, 0x2e, 0x9c, 0x96, 0x74, 0xda, 0xa5, 0xec, 0x4a, 0xe1, 0x58, 0xc0, 0xe8,
+	0x73, 0x68, 0x32, 0x92, 0xcf, 0x49, 0xe8, 0xb4, 0x27, 0xd6, 0x5e, 0x1d, 0x2b, 0x4b, 0xd0, 0xc7,
+	0x04, 0xcf, 0x24, 0x74, 0x3a, 0xf2, 0x81, 0x36, 0xd1, 0xef, 0x01, 0x05, 0x69, 0x14, 0x7a, 0xd2,
+	0xf6, 0x62, 0xc2, 0x73, 0x1a, 0x30, 0x07, 0x26, 0xf6, 0x5e, 0xf7, 0xe0, 0xe7, 0x15, 0x44, 0xee,
+	0x1f, 0xa5, 0x51, 0x28, 0x63, 0x76, 0x51, 0xfa, 0x9e, 0x24, 0x3c, 0x5f, 0xe0, 0x61, 0xb0, 0x01,
+	0x9b, 0x32, 0xe8, 0x7e, 0x40, 0x06, 0xe8, 0x2b, 0xe8, 0xc7, 0xfe, 0x7b, 0x8f, 0x2a, 0x1e, 0x99,
+	0xd3, 0x93, 0x79, 0xd9, 0x8b, 0xfd, 0xf7, 0x9a, 0x5b, 0x86, 0xbe, 0x83, 0xce, 0xca, 0xa1, 0x3f,
+	0xb1, 0x8d, 0x28, 0x6b, 0x27, 0x19, 0xe5, 0x95, 0x97, 0xd0, 0x94, 0xce, 0xf8, 0x98, 0x39, 0x03,
+	0x79, 0xeb, 0x8e, 0x42, 0x2e, 0x98, 0x60, 0xea, 0xd6, 0xa7, 0x11, 0x09, 0x9d, 0xdd, 0x92, 0xa9,
+	0xd2, 0x42, 0x08, 0xea, 0x59, 0x9a, 0x73, 0x67, 0x28, 0x4f, 0x21, 0x7f, 0xa3, 0x31, 0xb4, 0xe5,
+	0x5e, 0x41, 0x1a, 0x39, 0x23, 0x19, 0xb9, 0xa5, 0x3d, 0x3e, 0x82, 0x87, 0x95, 0x8c, 0xa0, 0x21,
+	0xd8, 0x6f, 0xc9, 0x42, 0xa5, 0x95, 0xf8, 0x29, 0xf2, 0x6a, 0xee, 0x47, 0x45, 0x99, 0x57, 0x16,
+	0x2e, 0x8d, 0x67, 0xb5, 0xef, 0x2d, 0xf7, 0xaf, 0x35, 0xe8, 0x99, 0xf7, 0x30, 0x52, 0xb2, 0x2f,
+	0x53, 0x72, 0x99, 0x7c, 0xb5, 0xff, 0x21, 0xf9, 0xec, 0x2d, 0xc9, 0x57, 0x5f, 0x4f, 0xbe, 0xca,
+	0xfc, 0x6a, 0x54, 0xe7, 0xd7, 0x04, 0xba, 0x69, 0xc1, 0xc5, 0xa6, 0x21, 0x4d, 0x66, 0x32, 0x55,
+	0x6d, 0x6c, 0x42, 0x46, 0x06, 0xb6, 0xb6, 0x65, 0x60, 0x7b, 0x3d, 0x03, 0x57, 0x91, 0xe8, 0x98,
+	0x91, 0x70, 0x7f, 0x07, 0x9d, 0x69, 0x32, 0x4f, 0xdf, 0x92, 0x8a, 0xe2, 0xb2, 0x45, 0xa3, 0xa2,
+	0x4a, 0xf8, 0x8b, 0x28, 0xf5, 0xf5, 0xe5, 0xb5, 0xe9, 0xfe, 0xdb, 0x02, 0xd0, 0xab, 0x95, 0x85,
+	0x46, 0x3b, 0x5a, 0x6b, 0x8e, 0xc8, 0x85, 0x3e, 0x65, 0xde, 0x4a, 0x12, 0x72, 0x83, 0x36, 0xee,
+	0x52, 0xb6, 0x0c, 0x33, 0xfa, 0x5e, 0x94, 0xa9, 0x52, 0x28, 0xb6, 0xcc, 0xc5, 0xc7, 0xcb, 0x78,
+	0xe8, 0x1d, 0xf6, 0xd7, 0xd4, 0xa1, 0xdd, 0xd7, 0x8a, 0x55, 0xfd, 0x13, 0x8a, 0xd5, 0xf8, 0x19,
+	0xf4, 0xfe, 0xef, 0xac, 0xfa, 0xa7, 0x05, 0x0f, 0x30, 0x99, 0x51, 0xc6, 0x49, 0xae, 0x97, 0xff,
+	0x74, 0x2e, 0x3f, 0xb1, 0x8d, 0xdd, 0xd7, 0x6f, 0xbd, 0x42, 0xbf, 0xeb, 0x62, 0x6c, 0x6c, 0x8a,
+	0x51, 0x8b, 0xae, 0xb9, 0x45, 0x74, 0xad, 0x75, 0xd1, 0xb9, 0xdf, 0xc0, 0xc3, 0x63, 0x92, 0x7f,
+	0xfc, 0x6a, 0x2e, 0x82, 0xe1, 0x39, 0x65, 0x5c, 0xbb, 0x88, 0x9e, 0xe6, 0x9e, 0xc2, 0x68, 0x03,
+	0x63, 0x99, 0x28, 0x30, 0x9a, 0x73, 0xd1, 0xea, 0xec, 0x6d, 0x91, 0x59, 0x79, 0xb9, 0x13, 0x18,
+	0xfc, 0x40, 0xf8, 0x87, 0x76, 0xff, 0x97, 0x05, 0x3d, 0xad, 0x1f, 0x29, 0xeb, 0xa5, 0x34, 0x2d,
+	0x43, 0x9a, 0xd5, 0xf4, 0x3f, 0x02, 0x08, 0x72, 0xe2, 0x73, 0x12, 0x7a, 0x3e, 0x97, 0x11, 0xb0,
+	0x71, 0x47, 0x21, 0x87, 0x5c, 0x30, 0x26, 0xc6, 0x01, 0x49, 0xb6, 0x8d, 0xe5, 0x6f, 0xf4, 0x35,
+	0x0c, 0x84, 0x8a, 0x3d, 0xd1, 0x16, 0xe5, 0xb0, 0x20, 0x89, 0xb6, 0x71, 0x4f, 0xa0, 0xa7, 0x34,
+	0x22, 0x62, 0x5a, 0x10, 0x09, 0x2e, 0x86, 0x89, 0x95, 0x93, 0x12, 0x71, 0x4c, 0xe2, 0xa5, 0xcf,
+	0x1e, 0x0c, 0xff, 0x94, 0xe6, 0x6f, 0x69, 0x32, 0xf3, 0x18, 0xe1, 0xa5, 0x5b, 0x4b, 0xba, 0x0d,
+	0x14, 0x7e, 0x45, 0xb8, 0xf0, 0xd4, 0x04, 0xeb, 0x5b, 0x9a, 0x04, 0x1b, 0x58, 0x49, 0xb0, 0x2e,
+	0x31, 0x9b, 0x04, 0x9b, 0x14, 0xe1, 0x95, 0x97, 0xfb, 0x44, 0x12, 0xbc, 0x2a, 0x40, 0xef, 0x2a,
+	0xf9, 0x73, 0xf7, 0x60, 0x74, 0x4c, 0x22, 0xc2, 0xc9, 0x47, 0x3d, 0xbf, 0x82, 0xd1, 0x91, 0x64,
+	0xd0, 0xf4, 0xdc, 0x0c, 0xda, 0x3f, 0x2c, 0xe8, 0x9f, 0xfa, 0x45, 0xc4, 0xe5, 0xec, 0x45, 0x72,
+	0x66, 0x94, 0x34, 0x4b, 0x72, 0xa0, 0x2c, 0x81, 0xc7, 0x94, 0x31, 0x52, 0x0e, 0x7f, 0x36, 0x56,
+	0x16, 0xfa, 0x12, 0x7a, 0x3c, 0xf7, 0x03, 0xe2, 0xdd, 0x8a, 0x65, 0x98, 0x0a, 0x5e, 0x57, 0x62,
+	0x72, 0x65, 0x86, 0x1e, 0x03, 0x64, 0x39, 0xb9, 0x25, 0x3c, 0x78, 0x43, 0x42, 0x15, 0x44, 0x03,
+	0x11, 0xd1, 0xbf, 0x23, 0x79, 0xea, 0x65, 0xfe, 0x8c, 0x30, 0x15, 0xc6, 0x8e, 0x40, 0x5e, 0x0a,
+	0x40, 0x94, 0xaf, 0x90, 0xe6, 0x9c, 0xaa, 0x69, 0xc1, 0xc6, 0xda, 0x74, 0xff, 0x6c, 0xc1, 0xf0,
+	0xdc, 0xe7, 0x24, 0x09, 0x16, 0x67, 0x94, 0xf1, 0x74, 0x96, 0xfb, 0xb1, 0x48, 0x96, 0xc4, 0x8f,
+	0xf5, 0x4c, 0x25, 0x7f, 0x8b, 0x91, 0xe3, 0x26, 0x2d, 0x92, 0x90, 0x79, 0x05, 0x73, 0x6a, 0x13,
+	0x7b, 0xcf, 0xc6, 0xed, 0x12, 0x78, 0x2d, 0x6f, 0x2c, 0x47, 0xd1, 0xb2, 0xbe, 0xd5, 0xb1, 0xb2,
+	0x44, 0xaa, 0xca, 0x5f, 0xf2, 0xc4, 0x75, 0x5c, 0x1a, 0xe8, 0x21, 0x34, 0x59, 0x11, 0x7b, 0x85,
+	0x3e, 0x68, 0x83, 0x15, 0xf1, 0x6b, 0xe6, 0xfe, 0xdd, 0x16, 0xb5, 0x2b, 0x4e, 0xf3, 0xc5, 0xf5,
+	0xc5, 0xf6, 0xec, 0x2f, 0x47, 0x1f, 0x3f, 0xe0, 0x74, 0x4e, 0x54, 0xad, 0x6d, 0x53, 0x76, 0x28,
+	0x6d, 0x71, 0xf0, 0x38, 0x0d, 0x89, 0xee, 0x64, 0xe2, 0xb7, 0x18, 0x86, 0x29, 0xf3, 0x22, 0xff,
+	0x6e, 0xe1, 0xc9, 0x67, 0x75, 0xf9, 0x0e, 0x50, 0x76, 0xee, 0xdf, 0x2d, 0x2e, 0x84, 0xc7, 0xd7,
+	0x30, 0xa0, 0xcc, 0x7b, 0xb3, 0xb8, 0xc9, 0x69, 0x58, 0xfa, 0x94, 0xdd, 0xac, 0x47, 0xd9, 0x99,
+	0x04, 0xa5, 0xd7, 0x63, 0x80, 0x9c, 0x04, 0x69, 0x2e, 0xba, 0x16, 0x93, 0x34, 0x36, 0xb0, 0x81,
+	0x88, 0x83, 0x95, 0x51, 0x8c, 0x48, 0x22, 0x93, 0xbf, 0x81, 0xdb, 0x12, 0x38, 0x27, 0x89, 0x98,
+	0xb7, 0x93, 0x22, 0xf6, 0x44, 0x09, 0x12, 0x05, 0xa3, 0x5d, 0xbe, 0x9d, 0x14, 0x31, 0x2e, 0x11,
+	0xd1, 0x54, 0x4d, 0x05, 0xdd, 0x2c, 0x38, 0x61, 0xb2, 0xbf, 0xd9, 0x78, 0x77, 0x25, 0xa1, 0xe7,
+	0x02, 0x46, 0xbf, 0x10, 0x0d, 0x50, 0x66, 0x0a, 0xc8, 0x42, 0xab, 0xbb, 0xfb, 0x5a, 0x16, 0x62,
+	0xe5, 0x83, 0xbe, 0x83, 0x56, 0x54, 0x06, 0xd8, 0xe9, 0x4a, 0x19, 0x7d, 0xa1, 0xdc, 0x37, 0xc3,
+	0x8e, 0xb5, 0x9f, 0xea, 0xf0, 0xe2, 0xf0, 0xf2, 0x40, 0x22, 0x57, 0x16, 0x4e, 0x4f, 0x77, 0xf8,
+	0x57, 0x0a, 0x3f, 0x16, 0xb0, 0x16, 0xb4, 0x0e, 0x9c, 0x14, 0xf4, 0x33, 0x18, 0x6d, 0x60, 0x2c,
+	0x43, 0x4f, 0xc0, 0x2e, 0x3f, 0x0b, 0x4c, 0x29, 0x9b, 0xf1, 0xc6, 0xe2, 0xb9, 0x12, 0xb1, 0xc6,
+	0xb7, 0x49, 0xf3, 0xe9, 0x19, 0xf4, 0xd7, 0x86, 0x19, 0xd4, 0x83, 0xf6, 0xf4, 0xf2, 0xf0, 0xe8,
+	0xd5, 0xf4, 0xfa, 0x64, 0xb8, 0x83, 0xba, 0xd0, 0xc2, 0xaf, 0x2f, 0x2f, 0xa7, 0x97, 0x3f, 0x0c,
+	0x2d, 0xd4, 0x87, 0xce, 0x8b, 0xd3, 0xd3, 0xf3, 0x17, 0x87, 0xc7, 0x27, 0xc7, 0xc3, 0x9a, 0x30,
+	0x5f, 0x5f, 0x9e, 0x9d, 0x1c, 0x9e, 0xbf, 0x3a, 0xfb, 0xc3, 0xd0, 0x3e, 0xf8, 0x4f, 0x13, 0x7a,
+	0x2f, 0x8c, 0x0f, 0x3a, 0x74, 0x00, 0x2d, 0xf5, 0x8d, 0x81, 0x46, 0xba, 0xe2, 0x2c, 0xbf, 0xe9,
+	0xc6, 0x68, 0x13, 0x62, 0x99, 0xbb, 0x83, 0x7e, 0x09, 0x2d, 0xf5, 0x15, 0x64, 0xbc, 0xa3, 0xbf,
+	0x8a, 0xc6, 0xfd, 0xd5, 0x3b, 0xbc, 0x60, 0xee, 0x0e, 0xfa, 0x0d, 0xf4, 0xcc, 0xaf, 0x21, 0xf4,
+	0xb9, 0xf1, 0x8e, 0xf1, 0x89, 0x74, 0xff, 0xc5, 0x6f, 0xa1, 0x59, 0xce, 0x0c, 0x68, 0xb8, 0x31,
+	0x42, 0xbc, 0x1b, 0x8f, 0xee, 0x0d, 0x15, 0xee, 0x0e, 0x3a, 0x81, 0xe1, 0x66, 0x4b, 0x47, 0x63,
+	0xe5, 0x58, 0xd1, 0xeb, 0xc7, 0x55, 0x4d, 0xcc, 0xdd, 0x41, 0x53, 0x40, 0xf7, 0x1b, 0x28, 0xfa,
+	0x89, 0x72, 0xae, 0xec, 0xad, 0xdb, 0x96, 0x3a, 0x86, 0xfe, 0x5a, 0x3b, 0x45, 0xcb, 0x7c, 0xdc,
+	0x68, 0xbc, 0x63, 0xa7, 0xfa, 0x81, 0xbc, 0xd7, 0x6f, 0xa1, 0x6b, 0x34, 0x53, 0xf4, 0x50, 0xb9,
+	0xae, 0x37, 0xd8, 0x8f, 0x1c, 0x61, 0xd9, 0x70, 0xd6, 0x8e, 0x60, 0xb6, 0xa6, 0xb1, 0x53, 0xfd,
+	0xc0, 0x38, 0x82, 0x46, 0xcd, 0x23, 0x18, 0xed, 0x62, 0x5c, 0xd5, 0xb4, 0xe4, 0xcb, 0x83, 0xf5,
+	0x26, 0x84, 0x9c, 0x25, 0x99, 0x1b, 0xbd, 0xe9, 0x7e, 0x16, 0x1c, 0xc2, 0x60, 0xbd, 0x2f, 0x2d,
+	0x5f, 0xbe, 0xd7, 0xae, 0xb6, 0xed, 0xaf, 0x28, 0x58, 0x4a, 0x74, 0x8d, 0x02, 0x53, 0xcc, 0x63,
+	0xa7, 0xfa, 0x81, 0x41, 0x81, 0x46, 0x4d, 0x0a, 0x0c, 0x01, 0x8f, 0xab, 0xc4, 0xee, 0xee, 0x3c,
+	0xff, 0x35, 0x3c, 0xa2, 0xe9, 0xfe, 0x2c, 0xcf, 0x82, 0x7d, 0xf2, 0xde, 0x8f, 0xb3, 0x88, 0xb0,
+	0x7d, 0xf3, 0x3f, 0x2b, 0xcf, 0x47, 0xa6, 0x2c, 0x5f, 0x8a, 0x25, 0x5e, 0x5a, 0x37, 0x4d, 0xb9,
+	0xd6, 0xaf, 0xfe, 0x3b, 0x00, 0xc3, 0x02, 0x35, 0x11, 0x85, 0x11, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConnInterface
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion6
+
+// OrchestratorClient is the client API for Orchestrator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type OrchestratorClient interface {
+	StartVM(ctx context.Context, in *StartVMReq, opts ...grpc.CallOption) (*StartVMResp, error)
+	StopVMs(ctx context.Context, in *StopVMsReq, opts ...grpc.CallOption) (*Status, error)
+	StopSingleVM(ctx context.Context, in *StopSingleVMReq, opts ...grpc.CallOption) (*Status, error)
+	Invoke(ctx context.Context, in *InvokeReq, opts ...grpc.CallOption) (*InvokeResp, error)
+	RegisterFunction(ctx context.Context, in *RegisterFunctionReq, opts ...grpc.CallOption) (*FunctionInfo, error)
+	DeregisterFunction(ctx context.Context, in *DeregisterFunctionReq, opts ...grpc.CallOption) (*FunctionInfo, error)
+	ListFunctions(ctx context.Context, in *ListFunctionsReq, opts ...grpc.CallOption) (*ListFunctionsResp, error)
+	GetFunction(ctx context.Context, in *GetFunctionReq, opts ...grpc.CallOption) (*FunctionInfo, error)
+	ListSnapshots(ctx context.Context, in *ListSnapshotsReq, opts ...grpc.CallOption) (*ListSnapshotsResp, error)
+	GetSnapshot(ctx context.Context, in *GetSnapshotReq, opts ...grpc.CallOption) (*SnapshotInfo, error)
+	DeleteSnapshot(ctx context.Context, in *DeleteSnapshotReq, opts ...grpc.CallOption) (*Status, error)
+	CreateSnapshot(ctx context.Context, in *CreateSnapshotReq, opts ...grpc.CallOption) (*SnapshotInfo, error)
+	ListMemoryVMs(ctx context.Context, in *ListMemoryVMsReq, opts ...grpc.CallOption) (*ListMemoryVMsResp, error)
+	GetMemoryVM(ctx context.Context, in *GetMemoryVMReq, opts ...grpc.CallOption) (*MemoryVMInfo, error)
+}
+
+type orchestratorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewOrchestratorClient(cc grpc.ClientConnInterface) OrchestratorClient {
+	return &orchestratorClient{cc}
+}
+
+func (c *orchestratorClient) StartVM(ctx context.Context, in *StartVMReq, opts ...grpc.CallOption) (*StartVMResp, error) {
+	out := new(StartVMResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/StartVM", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) StopVMs(ctx context.Context, in *StopVMsReq, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/StopVMs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) StopSingleVM(ctx context.Context, in *StopSingleVMReq, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/StopSingleVM", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) Invoke(ctx context.Context, in *InvokeReq, opts ...grpc.CallOption) (*InvokeResp, error) {
+	out := new(InvokeResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/Invoke", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) RegisterFunction(ctx context.Context, in *RegisterFunctionReq, opts ...grpc.CallOption) (*FunctionInfo, error) {
+	out := new(FunctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/RegisterFunction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) DeregisterFunction(ctx context.Context, in *DeregisterFunctionReq, opts ...grpc.CallOption) (*FunctionInfo, error) {
+	out := new(FunctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/DeregisterFunction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) ListFunctions(ctx context.Context, in *ListFunctionsReq, opts ...grpc.CallOption) (*ListFunctionsResp, error) {
+	out := new(ListFunctionsResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/ListFunctions", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) GetFunction(ctx context.Context, in *GetFunctionReq, opts ...grpc.CallOption) (*FunctionInfo, error) {
+	out := new(FunctionInfo)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/GetFunction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) ListSnapshots(ctx context.Context, in *ListSnapshotsReq, opts ...grpc.CallOption) (*ListSnapshotsResp, error) {
+	out := new(ListSnapshotsResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/ListSnapshots", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) GetSnapshot(ctx context.Context, in *GetSnapshotReq, opts ...grpc.CallOption) (*SnapshotInfo, error) {
+	out := new(SnapshotInfo)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/GetSnapshot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) DeleteSnapshot(ctx context.Context, in *DeleteSnapshotReq, opts ...grpc.CallOption) (*Status, error) {
+	out := new(Status)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/DeleteSnapshot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) CreateSnapshot(ctx context.Context, in *CreateSnapshotReq, opts ...grpc.CallOption) (*SnapshotInfo, error) {
+	out := new(SnapshotInfo)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/CreateSnapshot", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) ListMemoryVMs(ctx context.Context, in *ListMemoryVMsReq, opts ...grpc.CallOption) (*ListMemoryVMsResp, error) {
+	out := new(ListMemoryVMsResp)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/ListMemoryVMs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *orchestratorClient) GetMemoryVM(ctx context.Context, in *GetMemoryVMReq, opts ...grpc.CallOption) (*MemoryVMInfo, error) {
+	out := new(MemoryVMInfo)
+	err := c.cc.Invoke(ctx, "/proto.Orchestrator/GetMemoryVM", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OrchestratorServer is the server API for Orchestrator service.
+type OrchestratorServer interface {
+	StartVM(context.Context, *StartVMReq) (*StartVMResp, error)
+	StopVMs(context.Context, *StopVMsReq) (*Status, error)
+	StopSingleVM(context.Context, *StopSingleVMReq) (*Status, error)
+	Invoke(context.Context, *InvokeReq) (*InvokeResp, error)
+	RegisterFunction(context.Context, *RegisterFunctionReq) (*FunctionInfo, error)
+	DeregisterFunction(context.Context, *DeregisterFunctionReq) (*FunctionInfo, error)
+	ListFunctions(context.Context, *ListFunctionsReq) (*ListFunctionsResp, error)
+	GetFunction(context.Context, *GetFunctionReq) (*FunctionInfo, error)
+	ListSnapshots(context.Context, *ListSnapshotsReq) (*ListSnapshotsResp, error)
+	GetSnapshot(context.Context, *GetSnapshotReq) (*SnapshotInfo, error)
+	DeleteSnapshot(context.Context, *DeleteSnapshotReq) (*Status, error)
+	CreateSnapshot(context.Context, *CreateSnapshotReq) (*SnapshotInfo, error)
+	ListMemoryVMs(context.Context, *ListMemoryVMsReq) (*ListMemoryVMsResp, error)
+	GetMemoryVM(context.Context, *GetMemoryVMReq) (*MemoryVMInfo, error)
+}
+
+// UnimplementedOrchestratorServer can be embedded to have forward compatible implementations.
+type UnimplementedOrchestratorServer struct {
+}
+
+func (*UnimplementedOrchestratorServer) StartVM(ctx context.Context, req *StartVMReq) (*StartVMResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartVM not implemented")
+}
+func (*UnimplementedOrchestratorServer) StopVMs(ctx context.Context, req *StopVMsReq) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopVMs not implemented")
+}
+func (*UnimplementedOrchestratorServer) StopSingleVM(ctx context.Context, req *StopSingleVMReq) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StopSingleVM not implemented")
+}
+func (*UnimplementedOrchestratorServer) Invoke(ctx context.Context, req *InvokeReq) (*InvokeResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Invoke not implemented")
+}
+func (*UnimplementedOrchestratorServer) RegisterFunction(ctx context.Context, req *RegisterFunctionReq) (*FunctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RegisterFunction not implemented")
+}
+func (*UnimplementedOrchestratorServer) DeregisterFunction(ctx context.Context, req *DeregisterFunctionReq) (*FunctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeregisterFunction not implemented")
+}
+func (*UnimplementedOrchestratorServer) ListFunctions(ctx context.Context, req *ListFunctionsReq) (*ListFunctionsResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListFunctions not implemented")
+}
+func (*UnimplementedOrchestratorServer) GetFunction(ctx context.Context, req *GetFunctionReq) (*FunctionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetFunction not implemented")
+}
+func (*UnimplementedOrchestratorServer) ListSnapshots(ctx context.Context, req *ListSnapshotsReq) (*ListSnapshotsResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSnapshots not implemented")
+}
+func (*UnimplementedOrchestratorServer) GetSnapshot(ctx context.Context, req *GetSnapshotReq) (*SnapshotInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSnapshot not implemented")
+}
+func (*UnimplementedOrchestratorServer) DeleteSnapshot(ctx context.Context, req *DeleteSnapshotReq) (*Status, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSnapshot not implemented")
+}
+func (*UnimplementedOrchestratorServer) CreateSnapshot(ctx context.Context, req *CreateSnapshotReq) (*SnapshotInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateSnapshot not implemented")
+}
+func (*UnimplementedOrchestratorServer) ListMemoryVMs(ctx context.Context, req *ListMemoryVMsReq) (*ListMemoryVMsResp, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMemoryVMs not implemented")
+}
+func (*UnimplementedOrchestratorServer) GetMemoryVM(ctx context.Context, req *GetMemoryVMReq) (*MemoryVMInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMemoryVM not implemented")
+}
+
+func RegisterOrchestratorServer(s *grpc.Server, srv OrchestratorServer) {
+	s.RegisterService(&_Orchestrator_serviceDesc, srv)
+}
+
+func _Orchestrator_StartVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartVMReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).StartVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/StartVM",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).StartVM(ctx, req.(*StartVMReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_StopVMs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopVMsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).StopVMs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/StopVMs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).StopVMs(ctx, req.(*StopVMsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_StopSingleVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StopSingleVMReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).StopSingleVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/StopSingleVM",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).StopSingleVM(ctx, req.(*StopSingleVMReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_Invoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InvokeReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).Invoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/Invoke",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).Invoke(ctx, req.(*InvokeReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_RegisterFunction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterFunctionReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).RegisterFunction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/RegisterFunction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).RegisterFunction(ctx, req.(*RegisterFunctionReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_DeregisterFunction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeregisterFunctionReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).DeregisterFunction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/DeregisterFunction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).DeregisterFunction(ctx, req.(*DeregisterFunctionReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_ListFunctions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFunctionsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).ListFunctions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/ListFunctions",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).ListFunctions(ctx, req.(*ListFunctionsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_GetFunction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetFunctionReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).GetFunction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/GetFunction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).GetFunction(ctx, req.(*GetFunctionReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_ListSnapshots_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSnapshotsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).ListSnapshots(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/ListSnapshots",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).ListSnapshots(ctx, req.(*ListSnapshotsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_GetSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSnapshotReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).GetSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/GetSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).GetSnapshot(ctx, req.(*GetSnapshotReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_DeleteSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteSnapshotReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).DeleteSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/DeleteSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).DeleteSnapshot(ctx, req.(*DeleteSnapshotReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_CreateSnapshot_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateSnapshotReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).CreateSnapshot(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/CreateSnapshot",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).CreateSnapshot(ctx, req.(*CreateSnapshotReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_ListMemoryVMs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMemoryVMsReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).ListMemoryVMs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/ListMemoryVMs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).ListMemoryVMs(ctx, req.(*ListMemoryVMsReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Orchestrator_GetMemoryVM_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMemoryVMReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(OrchestratorServer).GetMemoryVM(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/proto.Orchestrator/GetMemoryVM",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(OrchestratorServer).GetMemoryVM(ctx, req.(*GetMemoryVMReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _Orchestrator_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "proto.Orchestrator",
+	HandlerType: (*OrchestratorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "StartVM",
+			Handler:    _Orchestrator_StartVM_Handler,
+		},
+		{
+			MethodName: "StopVMs",
+			Handler:    _Orchestrator_StopVMs_Handler,
+		},
 		{
 			MethodName: "StopSingleVM",
 			Handler:    _Orchestrator_StopSingleVM_Handler,
 		},
+		{
+			MethodName: "Invoke",
+			Handler:    _Orchestrator_Invoke_Handler,
+		},
+		{
+			MethodName: "RegisterFunction",
+			Handler:    _Orchestrator_RegisterFunction_Handler,
+		},
+		{
+			MethodName: "DeregisterFunction",
+			Handler:    _Orchestrator_DeregisterFunction_Handler,
+		},
+		{
+			MethodName: "ListFunctions",
+			Handler:    _Orchestrator_ListFunctions_Handler,
+		},
+		{
+			MethodName: "GetFunction",
+			Handler:    _Orchestrator_GetFunction_Handler,
+		},
+		{
+			MethodName: "ListSnapshots",
+			Handler:    _Orchestrator_ListSnapshots_Handler,
+		},
+		{
+			MethodName: "GetSnapshot",
+			Handler:    _Orchestrator_GetSnapshot_Handler,
+		},
+		{
+			MethodName: "DeleteSnapshot",
+			Handler:    _Orchestrator_DeleteSnapshot_Handler,
+		},
+		{
+			MethodName: "CreateSnapshot",
+			Handler:    _Orchestrator_CreateSnapshot_Handler,
+		},
+		{
+			MethodName: "ListMemoryVMs",
+			Handler:    _Orchestrator_ListMemoryVMs_Handler,
+		},
+		{
+			MethodName: "GetMemoryVM",
+			Handler:    _Orchestrator_GetMemoryVM_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "orchestrator.proto",
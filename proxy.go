@@ -0,0 +1,81 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"context"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/vhive-serverless/vhive/proxy"
+)
+
+// proxyGRPC Forwards the calls of the methods that the forwarding server does not implement
+// to the function named in the call's metadata
+func proxyGRPC(srv interface{}, stream grpc.ServerStream) error {
+	method, ok := grpc.MethodFromServerStream(stream)
+	if !ok {
+		return status.Error(codes.Internal, "failed to get the method of the call")
+	}
+
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	fIDs := md.Get(proxy.FunctionIDKey)
+	if len(fIDs) == 0 {
+		return status.Errorf(codes.InvalidArgument, "no %s in the call's metadata", proxy.FunctionIDKey)
+	}
+
+	log.WithFields(log.Fields{"fID": fIDs[0], "method": method}).Debug("Received gRPC call to forward")
+
+	return funcPool.ServeGRPC(fIDs[0], method, stream)
+}
+
+// proxyHTTP Forwards the HTTP requests to the function named in the request's header
+func proxyHTTP(w http.ResponseWriter, r *http.Request) {
+	fID := r.Header.Get(proxy.FunctionIDKey)
+	if fID == "" {
+		http.Error(w, "no "+proxy.FunctionIDKey+" header in the request", http.StatusBadRequest)
+		return
+	}
+
+	log.WithFields(log.Fields{"fID": fID, "path": r.URL.Path}).Debug("Received HTTP request to forward")
+
+	funcPool.ServeHTTP(fID, w, r)
+}
+
+// proxyStream Forwards the call between the client and the instance, message by message.
+// Must be called with the instance's read lock held.
+func (i *Instance) proxyStream(ctx context.Context, method string, serverStream grpc.ServerStream) error {
+	return proxy.Stream(ctx, i.conn, method, serverStream)
+}
+
+// proxyHTTP Forwards the HTTP request to the instance and its response back.
+// Returns Unavailable if the instance does not respond.
+// Must be called with the instance's read lock held.
+func (i *Instance) proxyHTTP(w http.ResponseWriter, r *http.Request) error {
+	return proxy.HTTP(w, r, i.address())
+}
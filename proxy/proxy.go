@@ -0,0 +1,321 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"sync/atomic"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// FunctionIDKey The gRPC metadata key or the HTTP header that names the function
+// the forwarded request is for
+const FunctionIDKey = "vhive-function-id"
+
+// UnreachableError The server at the other end of the connection did not respond, e.g., it could
+// not be reached or the connection broke. It tells the failures of the server from the errors that
+// the server responds with, which may have any status, Unavailable included
+type UnreachableError struct {
+	Err error
+}
+
+func (e *UnreachableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnreachableError) Unwrap() error {
+	return e.Err
+}
+
+// GRPCStatus Returns the status of the wrapped error, so that the client gets it as is
+func (e *UnreachableError) GRPCStatus() *status.Status {
+	return status.Convert(e.Err)
+}
+
+// IsUnreachable Returns true if the server did not respond to the call or the request
+func IsUnreachable(err error) bool {
+	var unreachable *UnreachableError
+	return errors.As(err, &unreachable)
+}
+
+// respondedKey The context key of the flag that is set once the server responds to the call
+type respondedKey struct{}
+
+// trackResponse Returns the context of a call, which sets the returned flag once the server responds
+func trackResponse(ctx context.Context) (context.Context, *int32) {
+	responded := new(int32)
+	return context.WithValue(ctx, respondedKey{}, responded), responded
+}
+
+// responseHandler Sets the flag of the call once the server responds with a header or a status
+type responseHandler struct{}
+
+func (responseHandler) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context {
+	return ctx
+}
+
+func (responseHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	switch s.(type) {
+	case *stats.InHeader, *stats.InTrailer:
+		if responded, ok := ctx.Value(respondedKey{}).(*int32); ok {
+			atomic.StoreInt32(responded, 1)
+		}
+	}
+}
+
+func (responseHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (responseHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+// callError Returns the error of the call, which is unreachable if the server responded
+// with neither a header nor a status, unless the context of the call is done
+func callError(ctx context.Context, responded *int32, err error) error {
+	if ctx.Err() != nil || atomic.LoadInt32(responded) != 0 {
+		return err
+	}
+
+	return &UnreachableError{Err: err}
+}
+
+// unaryInterceptor Returns an UnreachableError if the server does not respond to the unary call
+func unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx, responded := trackResponse(ctx)
+	if err := invoker(ctx, method, req, reply, cc, opts...); err != nil {
+		return callError(ctx, responded, err)
+	}
+
+	return nil
+}
+
+// DialOptions Returns the options to dial the servers that the calls are forwarded to,
+// so that the calls return an UnreachableError if the server does not respond
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithStatsHandler(responseHandler{}),
+		grpc.WithUnaryInterceptor(unaryInterceptor),
+	}
+}
+
+// rawFrame A gRPC message that is forwarded as is, without decoding it
+type rawFrame struct {
+	payload []byte
+}
+
+// RawCodec Passes raw frames through and (un)marshals the other messages as protobuf,
+// so that the forwarding server serves its own services alongside the forwarded ones
+type RawCodec struct{}
+
+func (RawCodec) Marshal(v interface{}) ([]byte, error) {
+	if f, ok := v.(*rawFrame); ok {
+		return f.payload, nil
+	}
+
+	return proto.Marshal(v.(proto.Message))
+}
+
+func (RawCodec) Unmarshal(data []byte, v interface{}) error {
+	if f, ok := v.(*rawFrame); ok {
+		f.payload = append(f.payload[:0], data...)
+		return nil
+	}
+
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+// Name Returns the content subtype of the codec, the forwarded messages are usually protobuf
+func (RawCodec) Name() string {
+	return "proto"
+}
+
+func (c RawCodec) String() string {
+	return c.Name()
+}
+
+// Stream Forwards the call between the client and the server at the other end
+// of the connection, message by message. Returns an UnreachableError if the server does not respond,
+// the connection must be dialed with DialOptions
+func Stream(ctx context.Context, conn *grpc.ClientConn, method string, serverStream grpc.ServerStream) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	md, _ := metadata.FromIncomingContext(serverStream.Context())
+	md = md.Copy()
+	delete(md, FunctionIDKey)
+	ctx = metadata.NewOutgoingContext(ctx, md)
+	ctx, responded := trackResponse(ctx)
+
+	desc := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+	clientStream, err := conn.NewStream(ctx, desc, method, grpc.ForceCodec(RawCodec{}))
+	if err != nil {
+		return callError(ctx, responded, err)
+	}
+
+	fromClient := forwardFrames(serverStream, clientStream, nil)
+	fromServer := forwardFrames(clientStream, serverStream, func() error {
+		header, err := clientStream.Header()
+		if err != nil {
+			return err
+		}
+		return serverStream.SendHeader(header)
+	})
+
+	for {
+		select {
+		case err := <-fromClient:
+			if sendErr, ok := err.(*sendError); ok {
+				if sendErr.err != io.EOF {
+					return callError(ctx, responded, sendErr.err)
+				}
+				// the server ended the call, its status is received from it
+				fromClient = nil
+				continue
+			}
+			if err != io.EOF {
+				if _, ok := status.FromError(err); ok {
+					return err
+				}
+				return status.Errorf(codes.Internal, "failed to forward the call to the instance: %v", err)
+			}
+			// the client is done sending, the instance may still respond
+			if err := clientStream.CloseSend(); err != nil {
+				return err
+			}
+			fromClient = nil
+		case err := <-fromServer:
+			serverStream.SetTrailer(clientStream.Trailer())
+			if sendErr, ok := err.(*sendError); ok {
+				// the client failed, not the server
+				return sendErr.err
+			}
+			if err != io.EOF {
+				return callError(ctx, responded, err)
+			}
+			return nil
+		}
+	}
+}
+
+// sendError The error of sending a message to dst, as opposed to receiving it from src
+type sendError struct {
+	err error
+}
+
+func (e *sendError) Error() string {
+	return e.err.Error()
+}
+
+// forwardFrames Forwards the messages from src to dst until src or dst fails.
+// onFirst is called before the first message is forwarded, unless it is nil.
+// Returns a channel that receives the error, io.EOF if src is done,
+// or a sendError if dst fails.
+func forwardFrames(src, dst grpc.Stream, onFirst func() error) <-chan error {
+	errCh := make(chan error, 1)
+
+	go func() {
+		frame := &rawFrame{}
+		for isFirst := true; ; isFirst = false {
+			if err := src.RecvMsg(frame); err != nil {
+				errCh <- err
+				return
+			}
+
+			if isFirst && onFirst != nil {
+				if err := onFirst(); err != nil {
+					errCh <- err
+					return
+				}
+			}
+
+			if err := dst.SendMsg(frame); err != nil {
+				errCh <- &sendError{err: err}
+				return
+			}
+		}
+	}()
+
+	return errCh
+}
+
+// HTTP Forwards the HTTP request to the server at the address and its response back.
+// Returns an UnreachableError with the Unavailable status if the server does not respond.
+func HTTP(w http.ResponseWriter, r *http.Request, address string) error {
+	var proxyErr error
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = address
+			req.Header.Del(FunctionIDKey)
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			if req.Context().Err() != nil {
+				proxyErr = ContextError(req.Context())
+			} else {
+				proxyErr = &UnreachableError{Err: status.Error(codes.Unavailable, err.Error())}
+			}
+			w.WriteHeader(HTTPStatusFromCode(status.Code(proxyErr)))
+		},
+	}
+
+	proxy.ServeHTTP(w, r)
+
+	return proxyErr
+}
+
+// ContextError Returns the gRPC status error of the done context,
+// so that the client can tell if the request timed out or was cancelled
+func ContextError(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return status.Error(codes.DeadlineExceeded, ctx.Err().Error())
+	}
+	return status.Error(codes.Canceled, ctx.Err().Error())
+}
+
+// HTTPStatusFromCode Returns the HTTP status for the gRPC status code of a failed request
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.Unavailable, codes.Canceled:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,210 @@
+// MIT License
+//
+// Copyright (c) 2020 Dmitrii Ustiugov, Plamen Petrov and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	hpb "github.com/vhive-serverless/vhive/examples/protobuf/helloworld"
+)
+
+type testGreeter struct {
+	hpb.UnimplementedGreeterServer
+}
+
+func (s *testGreeter) SayHello(ctx context.Context, in *hpb.HelloRequest) (*hpb.HelloReply, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get(FunctionIDKey)) > 0 {
+		return nil, status.Error(codes.InvalidArgument, "function ID must not be forwarded")
+	}
+
+	if in.GetName() == "unavailable" {
+		return nil, status.Error(codes.Unavailable, "function is overloaded")
+	}
+
+	return &hpb.HelloReply{Message: "Hello, " + in.GetName() + "!"}, nil
+}
+
+func TestRawCodec(t *testing.T) {
+	codec := RawCodec{}
+
+	data, err := codec.Marshal(&hpb.HelloRequest{Name: "world"})
+	require.NoError(t, err, "Failed to marshal protobuf message")
+
+	frame := &rawFrame{}
+	require.NoError(t, codec.Unmarshal(data, frame), "Failed to unmarshal raw frame")
+	require.Equal(t, data, frame.payload, "Raw frame must not be decoded")
+
+	raw, err := codec.Marshal(frame)
+	require.NoError(t, err, "Failed to marshal raw frame")
+
+	req := &hpb.HelloRequest{}
+	require.NoError(t, codec.Unmarshal(raw, req), "Failed to unmarshal protobuf message")
+	require.Equal(t, "world", req.GetName(), "Raw frame must be forwarded as is")
+}
+
+func TestStream(t *testing.T) {
+	backendLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen")
+	backend := grpc.NewServer()
+	hpb.RegisterGreeterServer(backend, &testGreeter{})
+	go backend.Serve(backendLis)
+	defer backend.Stop()
+
+	backendConn, err := grpc.Dial(backendLis.Addr().String(), append(DialOptions(), grpc.WithInsecure())...)
+	require.NoError(t, err, "Failed to dial backend")
+	defer backendConn.Close()
+
+	frontLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen")
+	proxyErr := make(chan error, 1)
+	front := grpc.NewServer(grpc.CustomCodec(RawCodec{}), grpc.UnknownServiceHandler(
+		func(srv interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			err := Stream(stream.Context(), backendConn, method, stream)
+			proxyErr <- err
+			return err
+		}))
+	go front.Serve(frontLis)
+	defer front.Stop()
+
+	conn, err := grpc.Dial(frontLis.Addr().String(), grpc.WithInsecure())
+	require.NoError(t, err, "Failed to dial front")
+	defer conn.Close()
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), FunctionIDKey, "proxy-1")
+	resp, err := hpb.NewGreeterClient(conn).SayHello(ctx, &hpb.HelloRequest{Name: "world"})
+	require.NoError(t, err, "Forwarded call failed")
+	require.Equal(t, "Hello, world!", resp.GetMessage())
+	require.NoError(t, <-proxyErr)
+
+	_, err = hpb.NewGreeterClient(conn).FwdHello(ctx, &hpb.FwdHelloReq{})
+	require.Equal(t, codes.Unimplemented, status.Code(err), "Status of the backend must be forwarded")
+	require.False(t, IsUnreachable(<-proxyErr))
+
+	_, err = hpb.NewGreeterClient(conn).SayHello(ctx, &hpb.HelloRequest{Name: "unavailable"})
+	require.Equal(t, codes.Unavailable, status.Code(err), "Status of the backend must be forwarded")
+	require.False(t, IsUnreachable(<-proxyErr), "The backend returning Unavailable is reachable")
+
+	backend.Stop()
+
+	_, err = hpb.NewGreeterClient(conn).SayHello(ctx, &hpb.HelloRequest{Name: "world"})
+	require.Equal(t, codes.Unavailable, status.Code(err), "Unreachable backend must be unavailable")
+	require.True(t, IsUnreachable(<-proxyErr), "The stopped backend must be unreachable")
+}
+
+func TestUnaryUnreachable(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "Failed to listen")
+	backend := grpc.NewServer()
+	hpb.RegisterGreeterServer(backend, &testGreeter{})
+	go backend.Serve(lis)
+	defer backend.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), append(DialOptions(), grpc.WithInsecure())...)
+	require.NoError(t, err, "Failed to dial backend")
+	defer conn.Close()
+	client := hpb.NewGreeterClient(conn)
+
+	resp, err := client.SayHello(context.Background(), &hpb.HelloRequest{Name: "world"})
+	require.NoError(t, err, "Call failed")
+	require.Equal(t, "Hello, world!", resp.GetMessage())
+
+	_, err = client.SayHello(context.Background(), &hpb.HelloRequest{Name: "unavailable"})
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.False(t, IsUnreachable(err), "The backend returning Unavailable is reachable")
+
+	_, err = client.FwdHello(context.Background(), &hpb.FwdHelloReq{})
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+	require.False(t, IsUnreachable(err))
+
+	backend.Stop()
+
+	_, err = client.SayHello(context.Background(), &hpb.HelloRequest{Name: "world"})
+	require.Equal(t, codes.Unavailable, status.Code(err), "Unreachable backend must be unavailable")
+	require.True(t, IsUnreachable(err), "The stopped backend must be unreachable")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.SayHello(ctx, &hpb.HelloRequest{Name: "world"})
+	require.Equal(t, codes.Canceled, status.Code(err))
+	require.False(t, IsUnreachable(err), "The cancelled call must not make the backend unreachable")
+}
+
+func TestHTTP(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(FunctionIDKey) != "" {
+			http.Error(w, "function ID must not be forwarded", http.StatusBadRequest)
+			return
+		}
+		if name := r.URL.Query().Get("name"); name == "unavailable" {
+			http.Error(w, "function is overloaded", http.StatusServiceUnavailable)
+		} else {
+			fmt.Fprintf(w, "Hello, %s!", name)
+		}
+	}))
+	address := backend.Listener.Addr().String()
+
+	req := httptest.NewRequest(http.MethodGet, "/hello?name=world", nil)
+	req.Header.Set(FunctionIDKey, "proxy-1")
+	w := httptest.NewRecorder()
+	require.NoError(t, HTTP(w, req, address), "Forwarded request failed")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "Hello, world!", w.Body.String())
+
+	w = httptest.NewRecorder()
+	require.NoError(t, HTTP(w, httptest.NewRequest(http.MethodGet, "/hello?name=unavailable", nil), address),
+		"The response of the backend is not an error of the proxy")
+	require.Equal(t, http.StatusServiceUnavailable, w.Code, "Status of the backend must be forwarded")
+
+	backend.Close()
+
+	w = httptest.NewRecorder()
+	err := HTTP(w, httptest.NewRequest(http.MethodGet, "/hello", nil), address)
+	require.Equal(t, codes.Unavailable, status.Code(err), "Unreachable backend must be unavailable")
+	require.True(t, IsUnreachable(err))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestContextError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	require.Equal(t, codes.DeadlineExceeded, status.Code(ContextError(ctx)), "Wrong status of the expired context")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	require.Equal(t, codes.Canceled, status.Code(ContextError(ctx)), "Wrong status of the cancelled context")
+}
@@ -27,17 +27,28 @@ import (
 	"fmt"
 	"sort"
 	"strconv"
+	"sync"
 	"sync/atomic"
 )
 
 // FuncStat Per-function stats
 type FuncStat struct {
+	served    uint64
+	started   uint64
+	failed    uint64
+	instances map[int]*InstanceStat // indexed by instance ID, protected by the lock of Stats
+}
+
+// InstanceStat Per-instance stats of a function
+type InstanceStat struct {
 	served  uint64
 	started uint64
+	failed  uint64
 }
 
 // Stats Stats for the cold functions in the function pool
 type Stats struct {
+	sync.RWMutex
 	statMap map[string]*FuncStat
 }
 
@@ -51,29 +62,134 @@ func NewStats() *Stats {
 
 // CreateStats Creates stats for a function
 func (cs *Stats) CreateStats(fID string) error {
+	cs.Lock()
+	defer cs.Unlock()
+
 	if _, isPresent := cs.statMap[fID]; isPresent {
 		return errors.New("Stat exists")
 	}
 
-	cs.statMap[fID] = new(FuncStat)
+	cs.statMap[fID] = &FuncStat{instances: make(map[int]*InstanceStat)}
 
 	return nil
 }
 
+// RemoveStats Removes stats of a function
+func (cs *Stats) RemoveStats(fID string) error {
+	cs.Lock()
+	defer cs.Unlock()
+
+	if _, isPresent := cs.statMap[fID]; !isPresent {
+		return errors.New("Stat does not exist")
+	}
+
+	delete(cs.statMap, fID)
+
+	return nil
+}
+
+// getStat Returns the stat of a function. For a function that has been
+// removed, returns a detached stat so that in-flight requests do not fail.
+func (cs *Stats) getStat(fID string) *FuncStat {
+	cs.RLock()
+	defer cs.RUnlock()
+
+	stat, isPresent := cs.statMap[fID]
+	if !isPresent {
+		return &FuncStat{instances: make(map[int]*InstanceStat)}
+	}
+
+	return stat
+}
+
+// getInstanceStat Returns the stat of an instance of a function, creating it if necessary
+func (cs *Stats) getInstanceStat(fID string, instID int) *InstanceStat {
+	stat := cs.getStat(fID)
+
+	cs.Lock()
+	defer cs.Unlock()
+
+	instStat, isPresent := stat.instances[instID]
+	if !isPresent {
+		instStat = new(InstanceStat)
+		stat.instances[instID] = instStat
+	}
+
+	return instStat
+}
+
 // IncStarted Increments per-function instance-started counter
 func (cs *Stats) IncStarted(fID string) {
-	atomic.AddUint64(&cs.statMap[fID].started, 1)
+	atomic.AddUint64(&cs.getStat(fID).started, 1)
 }
 
 // IncServed Increments per-function requests-served counter
 func (cs *Stats) IncServed(fID string) {
-	atomic.AddUint64(&cs.statMap[fID].served, 1)
+	atomic.AddUint64(&cs.getStat(fID).served, 1)
+}
+
+// IncFailed Increments per-function instance-failed counter
+func (cs *Stats) IncFailed(fID string) {
+	atomic.AddUint64(&cs.getStat(fID).failed, 1)
+}
+
+// IncInstanceStarted Increments per-instance instance-started counter
+func (cs *Stats) IncInstanceStarted(fID string, instID int) {
+	atomic.AddUint64(&cs.getInstanceStat(fID, instID).started, 1)
+}
+
+// IncInstanceServed Increments per-instance requests-served counter
+func (cs *Stats) IncInstanceServed(fID string, instID int) {
+	atomic.AddUint64(&cs.getInstanceStat(fID, instID).served, 1)
+}
+
+// IncInstanceFailed Increments per-instance instance-failed counter
+func (cs *Stats) IncInstanceFailed(fID string, instID int) {
+	atomic.AddUint64(&cs.getInstanceStat(fID, instID).failed, 1)
+}
+
+// GetInstanceStarted Returns per-instance instance-started counter
+func (cs *Stats) GetInstanceStarted(fID string, instID int) uint64 {
+	return atomic.LoadUint64(&cs.getInstanceStat(fID, instID).started)
+}
+
+// GetInstanceServed Returns per-instance requests-served counter
+func (cs *Stats) GetInstanceServed(fID string, instID int) uint64 {
+	return atomic.LoadUint64(&cs.getInstanceStat(fID, instID).served)
+}
+
+// GetInstanceFailed Returns per-instance instance-failed counter
+func (cs *Stats) GetInstanceFailed(fID string, instID int) uint64 {
+	return atomic.LoadUint64(&cs.getInstanceStat(fID, instID).failed)
+}
+
+// GetStarted Returns per-function instance-started counter
+func (cs *Stats) GetStarted(fID string) uint64 {
+	return atomic.LoadUint64(&cs.getStat(fID).started)
+}
+
+// GetServed Returns per-function requests-served counter
+func (cs *Stats) GetServed(fID string) uint64 {
+	return atomic.LoadUint64(&cs.getStat(fID).served)
+}
+
+// GetFailed Returns per-function instance-failed counter
+func (cs *Stats) GetFailed(fID string) uint64 {
+	return atomic.LoadUint64(&cs.getStat(fID).failed)
+}
+
+// ZeroServed Zeroes per-function requests-served counter
+func (cs *Stats) ZeroServed(fID string) {
+	atomic.StoreUint64(&cs.getStat(fID).served, 0)
 }
 
 // SprintStats Prints all stats
 func (cs *Stats) SprintStats() string {
+	cs.RLock()
+	defer cs.RUnlock()
+
 	var s = "==== Stats by cold functions ====\n"
-	s += "fID, #started, #served\n"
+	s += "fID, #started, #served, #failed\n"
 
 	funcs := make([]string, 0, len(cs.statMap))
 	for fID := range cs.statMap {
@@ -86,9 +202,28 @@ func (cs *Stats) SprintStats() string {
 	})
 
 	for _, fID := range funcs {
-		s += fmt.Sprintf("%s, %d, %d\n", fID,
+		s += fmt.Sprintf("%s, %d, %d, %d\n", fID,
 			atomic.LoadUint64(&cs.statMap[fID].started),
-			atomic.LoadUint64(&cs.statMap[fID].served))
+			atomic.LoadUint64(&cs.statMap[fID].served),
+			atomic.LoadUint64(&cs.statMap[fID].failed))
+
+		instances := cs.statMap[fID].instances
+		if len(instances) < 2 {
+			continue
+		}
+
+		instIDs := make([]int, 0, len(instances))
+		for instID := range instances {
+			instIDs = append(instIDs, instID)
+		}
+		sort.Ints(instIDs)
+
+		for _, instID := range instIDs {
+			s += fmt.Sprintf("  instance %d, %d, %d, %d\n", instID,
+				atomic.LoadUint64(&instances[instID].started),
+				atomic.LoadUint64(&instances[instID].served),
+				atomic.LoadUint64(&instances[instID].failed))
+		}
 	}
 
 	s += "==================================="
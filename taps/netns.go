@@ -0,0 +1,418 @@
+// MIT License
+//
+// Copyright (c) 2021 Plamen Petrov, Amory Hoste and EASE lab
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package taps
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	log "github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+const netNSDir = "/run/netns"
+
+// SetVMNetworkRanges Sets the address ranges of the veth pairs and of the clone addresses
+// of the VM networks, which must not clash with the other networks of the host
+func (tm *TapManager) SetVMNetworkRanges(vethCIDR, cloneCIDR string) error {
+	vethNet, err := parseVMNetworkRange(vethCIDR, MaxVMNetworks*4)
+	if err != nil {
+		return err
+	}
+
+	cloneNet, err := parseVMNetworkRange(cloneCIDR, MaxVMNetworks+1)
+	if err != nil {
+		return err
+	}
+
+	if vethNet.Contains(cloneNet.IP) || cloneNet.Contains(vethNet.IP) {
+		return fmt.Errorf("veth range %s overlaps with clone range %s", vethCIDR, cloneCIDR)
+	}
+
+	tm.Lock()
+	defer tm.Unlock()
+
+	tm.vethNet, tm.cloneNet = vethNet, cloneNet
+
+	return nil
+}
+
+// parseVMNetworkRange Parses the IPv4 range, which must have room for the given number of addresses
+func parseVMNetworkRange(cidr string, numAddrs int) (*net.IPNet, error) {
+	_, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+
+	ones, bits := ipNet.Mask.Size()
+	if ipNet.IP.To4() == nil || bits != 32 {
+		return nil, fmt.Errorf("range %s is not IPv4", cidr)
+	}
+
+	if 1<<(bits-ones) < numAddrs {
+		return nil, fmt.Errorf("range %s is too small for %d VM networks", cidr, MaxVMNetworks)
+	}
+
+	return ipNet, nil
+}
+
+// addrInRange Returns the i-th address of the range
+func addrInRange(ipNet *net.IPNet, i int) string {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, binary.BigEndian.Uint32(ipNet.IP.To4())+uint32(i))
+
+	return ip.String()
+}
+
+// getCloneAddress Creates the address at which the host reaches a VM in its own network namespace
+func (tm *TapManager) getCloneAddress(id int) string {
+	tm.Lock()
+	defer tm.Unlock()
+
+	return addrInRange(tm.cloneNet, id+1)
+}
+
+// getVethAddresses Creates the addresses of the host and the namespace ends
+// of the veth pair that connects the network namespace of a VM to the host
+func (tm *TapManager) getVethAddresses(id int) (string, string) {
+	tm.Lock()
+	defer tm.Unlock()
+
+	base := id * 4
+	return addrInRange(tm.vethNet, base+1), addrInRange(tm.vethNet, base+2)
+}
+
+// NetNSPath Returns the path of the network namespace of the VM
+func (vn *VMNetwork) NetNSPath() string {
+	return filepath.Join(netNSDir, vn.NetNSName)
+}
+
+func (tm *TapManager) allocateVMNetworkID() (int, error) {
+	tm.Lock()
+	defer tm.Unlock()
+
+	if n := len(tm.freeVMNetworkIDs); n > 0 {
+		id := tm.freeVMNetworkIDs[n-1]
+		tm.freeVMNetworkIDs = tm.freeVMNetworkIDs[:n-1]
+		return id, nil
+	}
+
+	if tm.nextVMNetworkID >= MaxVMNetworks {
+		return 0, errors.New("No space for creating VM networks")
+	}
+
+	id := tm.nextVMNetworkID
+	tm.nextVMNetworkID++
+
+	return id, nil
+}
+
+func (tm *TapManager) freeVMNetworkID(id int) {
+	tm.Lock()
+	defer tm.Unlock()
+
+	tm.freeVMNetworkIDs = append(tm.freeVMNetworkIDs, id)
+}
+
+// AddVMNetwork Creates a network namespace for a VM with a tap that has the name and
+// the gateway of the guest network interface, so that many VMs loaded from the same
+// snapshot can run at the same time. The namespace is connected to the host with
+// a veth pair, and the guest address is translated to the clone address of the VM.
+func (tm *TapManager) AddVMNetwork(vmID string, guestNi *NetworkInterface, hostIface string) (_ *VMNetwork, retErr error) {
+	id, err := tm.allocateVMNetworkID()
+	if err != nil {
+		return nil, err
+	}
+
+	vn := &VMNetwork{
+		ID:           id,
+		NetNSName:    "vhive-" + vmID,
+		GuestNi:      guestNi,
+		CloneAddress: tm.getCloneAddress(id),
+		HostVethName: fmt.Sprintf("veth%d-0", id),
+	}
+	nsVethName := fmt.Sprintf("veth%d-1", id)
+	hostVethAddr, nsVethAddr := tm.getVethAddresses(id)
+
+	logger := log.WithFields(log.Fields{"vmID": vmID, "netns": vn.NetNSName})
+	logger.Debug("Creating VM network")
+
+	defer func() {
+		if retErr != nil {
+			if err := tm.RemoveVMNetwork(vn); err != nil {
+				logger.WithError(err).Error("Failed to remove VM network after failure")
+			}
+		}
+	}()
+
+	// Switching network namespaces affects only the current thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	hostNS, err := netns.Get()
+	if err != nil {
+		return nil, err
+	}
+	defer hostNS.Close()
+	defer func() {
+		if err := netns.Set(hostNS); err != nil {
+			logger.WithError(err).Panic("Could not switch back to the host network namespace")
+		}
+	}()
+
+	// NewNamed switches the thread to the new namespace
+	vmNS, err := netns.NewNamed(vn.NetNSName)
+	if err != nil {
+		logger.Error("Could not create network namespace")
+		return nil, err
+	}
+	defer vmNS.Close()
+
+	if err := setupVMNetNS(vn); err != nil {
+		return nil, err
+	}
+
+	if err := netns.Set(hostNS); err != nil {
+		return nil, err
+	}
+
+	veth := &netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: vn.HostVethName},
+		PeerName:  nsVethName,
+	}
+	if err := netlink.LinkAdd(veth); err != nil {
+		logger.Error("Veth pair could not be created")
+		return nil, err
+	}
+
+	peer, err := netlink.LinkByName(nsVethName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := netlink.LinkSetNsFd(peer, int(vmNS)); err != nil {
+		logger.Error("Could not move veth to the network namespace")
+		return nil, err
+	}
+
+	if err := setLinkAddrUp(veth, hostVethAddr+"/30"); err != nil {
+		return nil, err
+	}
+
+	// The host reaches the VM at the clone address through the veth pair
+	route := &netlink.Route{
+		LinkIndex: veth.Attrs().Index,
+		Dst:       &net.IPNet{IP: net.ParseIP(vn.CloneAddress), Mask: net.CIDRMask(32, 32)},
+		Gw:        net.ParseIP(nsVethAddr),
+	}
+	if err := netlink.RouteAdd(route); err != nil {
+		logger.Error("Could not add route to the clone address")
+		return nil, err
+	}
+
+	if err := netns.Set(vmNS); err != nil {
+		return nil, err
+	}
+
+	nsVeth, err := netlink.LinkByName(nsVethName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setLinkAddrUp(nsVeth, nsVethAddr+"/30"); err != nil {
+		return nil, err
+	}
+
+	if err := netlink.RouteAdd(&netlink.Route{LinkIndex: nsVeth.Attrs().Index, Gw: net.ParseIP(hostVethAddr)}); err != nil {
+		logger.Error("Could not add default route in the network namespace")
+		return nil, err
+	}
+
+	if err := setupCloneNAT(int(vmNS), nsVethName, guestNi.PrimaryAddress, vn.CloneAddress); err != nil {
+		logger.Error("Could not set up address translation in the network namespace")
+		return nil, err
+	}
+
+	if err := setupForwardRules(vn.HostVethName, hostIface); err != nil {
+		return nil, err
+	}
+
+	return vn, nil
+}
+
+// setupVMNetNS Creates the tap of the guest in the network namespace
+// that the calling thread is in, and enables forwarding there
+func setupVMNetNS(vn *VMNetwork) error {
+	logger := log.WithFields(log.Fields{"tap": vn.GuestNi.HostDevName, "netns": vn.NetNSName})
+
+	lo, err := netlink.LinkByName("lo")
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetUp(lo); err != nil {
+		return err
+	}
+
+	tap := &netlink.Tuntap{
+		LinkAttrs: netlink.LinkAttrs{Name: vn.GuestNi.HostDevName},
+		Mode:      netlink.TUNTAP_MODE_TAP,
+	}
+	if err := netlink.LinkAdd(tap); err != nil {
+		logger.Error("Tap could not be created")
+		return err
+	}
+
+	hwAddr, err := net.ParseMAC(vn.GuestNi.MacAddress)
+	if err != nil {
+		logger.Error("Could not parse MAC")
+		return err
+	}
+
+	if err := netlink.LinkSetHardwareAddr(tap, hwAddr); err != nil {
+		logger.Error("Could not set MAC address")
+		return err
+	}
+
+	// The tap acts as the gateway of the guest
+	if err := setLinkAddrUp(tap, vn.GuestNi.GatewayAddress+vn.GuestNi.Subnet); err != nil {
+		return err
+	}
+
+	return os.WriteFile("/proc/sys/net/ipv4/ip_forward", []byte("1"), 0644)
+}
+
+func setLinkAddrUp(link netlink.Link, cidr string) error {
+	addr, err := netlink.ParseAddr(cidr)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.AddrAdd(link, addr); err != nil {
+		return err
+	}
+
+	return netlink.LinkSetUp(link)
+}
+
+// setupCloneNAT Translates the clone address to the guest address for the traffic
+// that enters the network namespace, and vice versa for the traffic that leaves it
+func setupCloneNAT(nsFd int, nsVethName, guestAddr, cloneAddr string) error {
+	conn := nftables.Conn{NetNS: nsFd}
+
+	guestIP := net.ParseIP(guestAddr).To4()
+	cloneIP := net.ParseIP(cloneAddr).To4()
+
+	// nft add table ip nat
+	natTable := conn.AddTable(&nftables.Table{
+		Name:   "nat",
+		Family: nftables.TableFamilyIPv4,
+	})
+
+	// nft add chain ip nat PREROUTING { type nat hook prerouting priority -100; }
+	preCh := conn.AddChain(&nftables.Chain{
+		Name:     "PREROUTING",
+		Table:    natTable,
+		Type:     nftables.ChainTypeNAT,
+		Priority: nftables.ChainPriorityNATDest,
+		Hooknum:  nftables.ChainHookPrerouting,
+	})
+
+	// nft add chain ip nat POSTROUTING { type nat hook postrouting priority 100; }
+	postCh := conn.AddChain(&nftables.Chain{
+		Name:     "POSTROUTING",
+		Table:    natTable,
+		Type:     nftables.ChainTypeNAT,
+		Priority: nftables.ChainPriorityNATSource,
+		Hooknum:  nftables.ChainHookPostrouting,
+	})
+
+	// nft add rule ip nat PREROUTING ip daddr cloneAddr dnat to guestAddr
+	conn.AddRule(&nftables.Rule{
+		Table: natTable,
+		Chain: preCh,
+		Exprs: []expr.Any{
+			// Load the destination address in register 1
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: 16, Len: 4},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: cloneIP},
+			&expr.Immediate{Register: 1, Data: guestIP},
+			&expr.NAT{Type: expr.NATTypeDestNAT, Family: unix.NFPROTO_IPV4, RegAddrMin: 1},
+		},
+	})
+
+	// nft add rule ip nat POSTROUTING oifname nsVethName ip saddr guestAddr snat to cloneAddr
+	conn.AddRule(&nftables.Rule{
+		Table: natTable,
+		Chain: postCh,
+		Exprs: []expr.Any{
+			&expr.Meta{Key: expr.MetaKeyOIFNAME, Register: 1},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte(fmt.Sprintf("%s\x00", nsVethName))},
+			// Load the source address in register 1
+			&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: 12, Len: 4},
+			&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: guestIP},
+			&expr.Immediate{Register: 1, Data: cloneIP},
+			&expr.NAT{Type: expr.NATTypeSourceNAT, Family: unix.NFPROTO_IPV4, RegAddrMin: 1},
+		},
+	})
+
+	return conn.Flush()
+}
+
+// RemoveVMNetwork Removes the network namespace of the VM, together with
+// the tap inside it, and the veth pair that connects it to the host
+func (tm *TapManager) RemoveVMNetwork(vn *VMNetwork) error {
+	logger := log.WithFields(log.Fields{"netns": vn.NetNSName})
+
+	logger.Debug("Removing VM network")
+
+	// Removing one end of the veth pair removes the other end and the route
+	if veth, err := netlink.LinkByName(vn.HostVethName); err == nil {
+		if err := netlink.LinkDel(veth); err != nil {
+			logger.Error("Veth pair could not be removed")
+			return err
+		}
+	}
+
+	if err := netns.DeleteNamed(vn.NetNSName); err != nil && !os.IsNotExist(err) {
+		logger.Error("Network namespace could not be removed")
+		return err
+	}
+
+	if err := removeForwardRules(vn.HostVethName); err != nil {
+		logger.Error("Forwarding rules could not be removed")
+		return err
+	}
+
+	tm.freeVMNetworkID(vn.ID)
+
+	return nil
+}
@@ -38,6 +38,7 @@ import (
 	"net"
 
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 // getGatewayAddr Creates the gateway address (first address in pool)
@@ -62,6 +63,9 @@ func NewTapManager() *TapManager {
 	tm.numBridges = NumBridges
 	tm.TapCountsPerBridge = make([]int64, NumBridges)
 	tm.createdTaps = make(map[string]*NetworkInterface)
+	if err := tm.SetVMNetworkRanges(DefaultVethCIDR, DefaultCloneCIDR); err != nil {
+		log.Panic(err)
+	}
 
 	log.Info("Registering bridges for tap manager")
 
@@ -213,6 +217,25 @@ func setupForwardRules(tapName, hostIface string) error {
 	return nil
 }
 
+// removeForwardRules Removes the forwarding rules set up for the tap, if any
+func removeForwardRules(tapName string) error {
+	conn := nftables.Conn{}
+
+	conn.DelChain(&nftables.Chain{
+		Name: fmt.Sprintf("FORWARD%s", tapName),
+		Table: &nftables.Table{
+			Name:   "filter",
+			Family: nftables.TableFamilyIPv4,
+		},
+	})
+
+	if err := conn.Flush(); err != nil && !errors.Is(err, unix.ENOENT) {
+		log.Warnf("Failed to remove forwarding rules of tap %v\n%s\n", tapName, err)
+		return err
+	}
+	return nil
+}
+
 // AddTap Creates a new tap and returns the corresponding network interface
 func (tm *TapManager) AddTap(tapName, hostIface string) (*NetworkInterface, error) {
 	tm.Lock()
@@ -103,3 +103,21 @@ func TestCreateRemoveExtra(t *testing.T) {
 		_ = tm.RemoveTap(fmt.Sprintf("tap_%d", i))
 	}
 }
+
+func TestVMNetworkRanges(t *testing.T) {
+	tm := new(TapManager)
+	require.NoError(t, tm.SetVMNetworkRanges(DefaultVethCIDR, DefaultCloneCIDR))
+
+	hostAddr, nsAddr := tm.getVethAddresses(64)
+	require.Equal(t, "10.200.1.1", hostAddr)
+	require.Equal(t, "10.200.1.2", nsAddr)
+	require.Equal(t, "10.201.0.1", tm.getCloneAddress(0))
+	require.Equal(t, "10.201.1.0", tm.getCloneAddress(255))
+
+	hostAddr, _ = tm.getVethAddresses(MaxVMNetworks - 1)
+	require.Equal(t, "10.200.255.253", hostAddr, "The last VM network must fit into the range")
+
+	require.Error(t, tm.SetVMNetworkRanges("10.200.0.0/17", DefaultCloneCIDR), "Range is too small")
+	require.Error(t, tm.SetVMNetworkRanges(DefaultVethCIDR, "10.200.128.0/17"), "Ranges overlap")
+	require.Error(t, tm.SetVMNetworkRanges("fd00::/64", DefaultCloneCIDR), "Range is not IPv4")
+}
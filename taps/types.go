@@ -23,6 +23,7 @@
 package taps
 
 import (
+	"net"
 	"sync"
 )
 
@@ -33,6 +34,13 @@ const (
 	TapsPerBridge = 1000
 	// NumBridges is the number of bridges for the TapManager
 	NumBridges = 2
+	// MaxVMNetworks Number of VMs that can have their own network namespace
+	MaxVMNetworks = 16384
+	// DefaultVethCIDR Addresses of the veth pairs that connect the network namespaces
+	// of the VMs to the host, 4 per VM. Unlike 172.17.0.0/16, does not clash with Docker.
+	DefaultVethCIDR = "10.200.0.0/16"
+	// DefaultCloneCIDR Addresses at which the host reaches the VMs in their own network namespaces
+	DefaultCloneCIDR = "10.201.0.0/16"
 )
 
 // TapManager A Tap Manager
@@ -41,6 +49,10 @@ type TapManager struct {
 	numBridges         int
 	TapCountsPerBridge []int64
 	createdTaps        map[string]*NetworkInterface
+	nextVMNetworkID    int
+	freeVMNetworkIDs   []int
+	vethNet            *net.IPNet
+	cloneNet           *net.IPNet
 }
 
 // NetworkInterface Network interface type, NI names are generated based on expected tap names
@@ -52,3 +64,14 @@ type NetworkInterface struct {
 	Subnet         string
 	GatewayAddress string
 }
+
+// VMNetwork Network of a VM that is isolated in its own network namespace.
+// Inside the namespace, the VM keeps the network interface it was snapshotted with,
+// while the host reaches the VM at a clone address that is unique to the VM
+type VMNetwork struct {
+	ID           int
+	NetNSName    string
+	GuestNi      *NetworkInterface
+	CloneAddress string
+	HostVethName string
+}
@@ -28,23 +28,40 @@ import (
 	"fmt"
 
 	"net"
+	"net/http"
 	"os"
 	"runtime"
+	"sort"
+	"strings"
+	"time"
 
 	ctrdlog "github.com/containerd/containerd/log"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/vhive-serverless/vhive/cri"
 	fccri "github.com/vhive-serverless/vhive/cri/firecracker"
 	gvcri "github.com/vhive-serverless/vhive/cri/gvisor"
 	ctriface "github.com/vhive-serverless/vhive/ctriface"
 	hpb "github.com/vhive-serverless/vhive/examples/protobuf/helloworld"
+	"github.com/vhive-serverless/vhive/keepalive"
+	"github.com/vhive-serverless/vhive/memory/manager"
+	"github.com/vhive-serverless/vhive/memory/pageserver"
+	"github.com/vhive-serverless/vhive/metrics"
 	pb "github.com/vhive-serverless/vhive/proto"
+	"github.com/vhive-serverless/vhive/proxy"
+	"github.com/vhive-serverless/vhive/taps"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
-	port    = ":3333"
-	fwdPort = ":3334"
+	port        = ":3333"
+	fwdPort     = ":3334"
+	httpFwdPort = ":3335"
+	memInfoPort = ":3336"
 
 	testImageName = "ghcr.io/ease-lab/helloworld:var_workload"
 )
@@ -58,11 +75,28 @@ var (
 	isSnapshotsEnabled *bool
 	isUPFEnabled       *bool
 	isLazyMode         *bool
+	isHybridMode       *bool
 	isMetricsMode      *bool
-	servedThreshold    *uint64
+	isSnapshotsCleanup *bool
+	wsWorkers          *int
+	wsMissThreshold    *int
+	wsMissWindow       *int
+	wsRecordings       *int
+	wsPageFrequency    *float64
+	pageServer         *string
+	trackDirty         *bool
+	compressWS         *bool
+	checksumWS         *bool
+	servePages         *string
+	keepAlivePolicy    *string
+	keepAlive          *time.Duration
 	pinnedFuncNum      *int
+	maxInstances       *int
+	fwdTimeout         *time.Duration
 	criSock            *string
 	hostIface          *string
+	vethCIDR           *string
+	cloneCIDR          *string
 )
 
 func main() {
@@ -76,11 +110,28 @@ func main() {
 	isSnapshotsEnabled = flag.Bool("snapshots", false, "Use VM snapshots when adding function instances")
 	isUPFEnabled = flag.Bool("upf", false, "Enable user-level page faults guest memory management")
 	isMetricsMode = flag.Bool("metrics", false, "Calculate UPF metrics")
-	servedThreshold = flag.Uint64("st", 1000*1000, "Functions serves X RPCs before it shuts down (if saveMemory=true)")
+	isSnapshotsCleanup = flag.Bool("snapsCleanup", false, "Remove all snapshots, including the snapshot catalog, upon exit")
+	wsWorkers = flag.Int("wsWorkers", 4, "Number of goroutines that fetch and install the working set of a VM when UPFs are enabled")
+	wsMissThreshold = flag.Int("wsMissThreshold", 0, "Pages missing from the working set per invocation, on average over the window, above which they are merged into the working set (0 disables)")
+	wsMissWindow = flag.Int("wsMissWindow", 5, "Number of the last invocations over which the working set misses are averaged")
+	wsRecordings = flag.Int("wsRecordings", 1, "Number of the invocations recorded to build the working set")
+	wsPageFrequency = flag.Float64("wsPageFrequency", 0, "Fraction of the recorded invocations that must touch a page for it to be in the working set (0 means any)")
+	pageServer = flag.String("pageServer", "", "Address of the page server to fetch the guest memory of the snapshots from, instead of the local disk, when UPFs are enabled")
+	trackDirty = flag.Bool("trackDirty", false, "Record the pages that each activation of a VM writes, using write-protect faults, when UPFs are enabled")
+	compressWS = flag.Bool("compressWS", false, "Compress the working set files in chunks, which are fetched and decompressed in parallel, when UPFs are enabled")
+	checksumWS = flag.Bool("checksumWS", false, "Store the checksums of the working set pages and verify them when fetching the working set, when UPFs are enabled")
+	servePages = flag.String("servePages", "", "Address to serve the guest memory of the local snapshots on, for the page server mode of other nodes")
+	keepAlivePolicy = flag.String("keepAlivePolicy", keepalive.Fixed, "Policy that decides when idle function instances are removed (if saveMemory=true), valid options: fixed, hybrid")
+	keepAlive = flag.Duration("keepAlive", keepalive.DefaultWindow, "Time an idle function instance is kept with the fixed policy, the hybrid policy falls back to it")
 	pinnedFuncNum = flag.Int("hn", 0, "Number of functions pinned in memory (IDs from 0 to X)")
+	maxInstances = flag.Int("maxInstances", 1, "Maximum number of instances a function scales out to, unless set upon registration")
+	fwdTimeout = flag.Duration("fwdTimeout", defaultTimeout, "Timeout of the requests to a function when the client sets no deadline, unless set upon registration")
 	isLazyMode = flag.Bool("lazy", false, "Enable lazy serving mode when UPFs are enabled")
+	isHybridMode = flag.Bool("hybrid", false, "Enable hybrid serving mode, which prefetches the recorded pages in the background, when UPFs are enabled")
 	criSock = flag.String("criSock", "/etc/vhive-cri/vhive-cri.sock", "Socket address for CRI service")
 	hostIface = flag.String("hostIface", "", "Host net-interface for the VMs to bind to for internet access")
+	vethCIDR = flag.String("vethCIDR", taps.DefaultVethCIDR, "Address range of the veth pairs that connect the network namespaces of the VMs loaded from a shared snapshot to the host")
+	cloneCIDR = flag.String("cloneCIDR", taps.DefaultCloneCIDR, "Address range at which the host reaches the VMs loaded from a shared snapshot")
 	sandbox := flag.String("sandbox", "firecracker", "Sandbox tech to use, valid options: firecracker, gvisor")
 	flag.Parse()
 
@@ -89,16 +140,77 @@ func main() {
 		return
 	}
 
+	newKeepAlivePolicy, err := keepalive.NewPolicyFactory(*keepAlivePolicy, *keepAlive)
+	if err != nil {
+		log.Fatalln(err)
+		return
+	}
+
+	if *maxInstances < 1 {
+		log.Fatalln("The maximum number of instances must be positive")
+		return
+	}
+
+	if *fwdTimeout <= 0 {
+		log.Fatalln("The timeout of the requests to a function must be positive")
+		return
+	}
+
 	if *isUPFEnabled && !*isSnapshotsEnabled {
 		log.Error("User-level page faults are not supported without snapshots")
 		return
 	}
 
+	if *wsWorkers < 1 {
+		log.Fatalln("The number of working set workers must be positive")
+		return
+	}
+
+	if *wsMissThreshold < 0 || *wsMissWindow < 1 {
+		log.Fatalln("The working set miss threshold must be non-negative and the window must be positive")
+		return
+	}
+
+	if *wsRecordings < 1 || *wsPageFrequency < 0 || *wsPageFrequency > 1 {
+		log.Fatalln("The number of working set recordings must be positive and the page frequency must be in [0, 1]")
+		return
+	}
+
 	if !*isUPFEnabled && *isLazyMode {
 		log.Error("Lazy page fault serving mode is not supported without user-level page faults")
 		return
 	}
 
+	if !*isUPFEnabled && *isHybridMode {
+		log.Error("Hybrid page fault serving mode is not supported without user-level page faults")
+		return
+	}
+
+	if !*isUPFEnabled && *pageServer != "" {
+		log.Error("Page server mode is not supported without user-level page faults")
+		return
+	}
+
+	if !*isUPFEnabled && *trackDirty {
+		log.Error("Dirty page tracking is not supported without user-level page faults")
+		return
+	}
+
+	if !*isUPFEnabled && *compressWS {
+		log.Error("Working set compression is not supported without user-level page faults")
+		return
+	}
+
+	if !*isUPFEnabled && *checksumWS {
+		log.Error("Working set checksums are not supported without user-level page faults")
+		return
+	}
+
+	if *isLazyMode && *isHybridMode {
+		log.Error("Lazy and hybrid page fault serving modes are mutually exclusive")
+		return
+	}
+
 	if flog, err = os.Create("/tmp/fccd.log"); err != nil {
 		panic(err)
 	}
@@ -134,10 +246,27 @@ func main() {
 			ctriface.WithUPF(*isUPFEnabled),
 			ctriface.WithMetricsMode(*isMetricsMode),
 			ctriface.WithLazyMode(*isLazyMode),
+			ctriface.WithHybridMode(*isHybridMode),
+			ctriface.WithMemoryManagerWorkers(*wsWorkers),
+			ctriface.WithWorkingSetMissThreshold(*wsMissThreshold, *wsMissWindow),
+			ctriface.WithWorkingSetRecordings(*wsRecordings, *wsPageFrequency),
+			ctriface.WithPageServer(*pageServer),
+			ctriface.WithDirtyPageTracking(*trackDirty),
+			ctriface.WithWorkingSetCompression(*compressWS),
+			ctriface.WithWorkingSetChecksums(*checksumWS),
+			ctriface.WithSnapshotsCleanup(*isSnapshotsCleanup),
+			ctriface.WithVMNetworkRanges(*vethCIDR, *cloneCIDR),
 		)
-		funcPool = NewFuncPool(*isSaveMemory, *servedThreshold, *pinnedFuncNum, testModeOn)
+		funcPool = NewFuncPool(*isSaveMemory, newKeepAlivePolicy, *pinnedFuncNum, testModeOn, WithMaxInstances(*maxInstances), WithTimeout(*fwdTimeout))
 		go setupFirecrackerCRI()
 		go orchServe()
+		if *servePages != "" {
+			go pageServe()
+		}
+		go httpFwdServe()
+		if *isUPFEnabled {
+			go memInfoServe()
+		}
 		fwdServe()
 	case "gvisor":
 		setupGVisorCRI()
@@ -191,12 +320,26 @@ func orchServe() {
 	}
 }
 
+// pageServe Serves the guest memory of the local snapshots to the nodes in the page server mode
+func pageServe() {
+	lis, err := net.Listen("tcp", *servePages)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	log.Println("Serving pages on " + *servePages)
+	if err := pageserver.Serve(lis, orch.GetSnapshotsDir()); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
 func fwdServe() {
 	lis, err := net.Listen("tcp", fwdPort)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
+	// the calls of the other methods are forwarded to the functions as is
+	s := grpc.NewServer(grpc.CustomCodec(proxy.RawCodec{}), grpc.UnknownServiceHandler(proxyGRPC))
 	hpb.RegisterFwdGreeterServer(s, &fwdServer{})
 
 	log.Println("Listening on port" + fwdPort)
@@ -205,6 +348,68 @@ func fwdServe() {
 	}
 }
 
+func httpFwdServe() {
+	lis, err := net.Listen("tcp", httpFwdPort)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	log.Println("Listening on port" + httpFwdPort)
+	if err := http.Serve(lis, http.HandlerFunc(proxyHTTP)); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// memInfoServe Serves the state of the VMs in the memory manager as JSON,
+// the same as ListMemoryVMs and GetMemoryVM do over gRPC
+func memInfoServe() {
+	lis, err := net.Listen("tcp", memInfoPort)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(memInfoPath, memInfoHandler)
+
+	log.Println("Listening on port" + memInfoPort)
+	if err := http.Serve(lis, mux); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// memInfoPath Lists the VMs, memInfoPath + <vmID> returns the VM
+const memInfoPath = "/memory/vms/"
+
+func memInfoHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var msg proto.Message
+	if vmID := strings.TrimPrefix(r.URL.Path, memInfoPath); vmID == "" {
+		vms, err := orch.ListMemoryVMs()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		msg = toListMemoryVMsResp(vms)
+	} else {
+		vm, err := orch.GetMemoryVM(vmID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		msg = toMemoryVMInfo(vm)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	marshaler := jsonpb.Marshaler{OrigName: true, EmitDefaults: true, Indent: "  "}
+	if err := marshaler.Marshal(w, msg); err != nil {
+		log.WithError(err).Error("Failed to write the memory manager state")
+	}
+}
+
 // StartVM, StopSingleVM and StopVMs are legacy functions that manage functions and VMs
 // Should be used only to bootstrap an experiment (e.g., quick parallel start of many functions)
 func (s *server) StartVM(ctx context.Context, in *pb.StartVMReq) (*pb.StartVMResp, error) {
@@ -212,14 +417,24 @@ func (s *server) StartVM(ctx context.Context, in *pb.StartVMReq) (*pb.StartVMRes
 	imageName := in.GetImage()
 	log.WithFields(log.Fields{"fID": fID, "image": imageName}).Info("Received direct StartVM")
 
-	tProfile := "not supported anymore"
+	if in.GetVmSpec() != nil {
+		if _, err := funcPool.RegisterFunction(fID, imageName, FunctionConfig{VMSpec: toVMSpec(in.GetVmSpec())}); err != nil {
+			return &pb.StartVMResp{Message: "Registering the function failed"}, err
+		}
+	}
 
-	_, _, err := funcPool.Serve(ctx, fID, imageName, "record")
+	_, metr, err := funcPool.Serve(ctx, fID, imageName, "record")
+	tProfile := sprintMetric(metr)
 	if err != nil {
-		return &pb.StartVMResp{Message: "First serve failed", Profile: tProfile}, err
+		return &pb.StartVMResp{Message: "First serve failed", Profile: tProfile}, toStatusError(err)
+	}
+
+	resp := &pb.StartVMResp{Message: "started VM instance for a function " + fID, Profile: tProfile}
+	if f, err := funcPool.GetFunction(fID); err == nil {
+		resp.Function = toFunctionInfo(f.GetInfo())
 	}
 
-	return &pb.StartVMResp{Message: "started VM instance for a function " + fID, Profile: tProfile}, nil
+	return resp, nil
 }
 
 func (s *server) StopSingleVM(ctx context.Context, in *pb.StopSingleVMReq) (*pb.Status, error) {
@@ -231,7 +446,7 @@ func (s *server) StopSingleVM(ctx context.Context, in *pb.StopSingleVMReq) (*pb.
 		log.Warn(message, err)
 	}
 
-	return &pb.Status{Message: message}, err
+	return &pb.Status{Message: message}, toStatusError(err)
 }
 
 // Note: this function is to be used only before tearing down the whole orchestrator
@@ -246,6 +461,374 @@ func (s *server) StopVMs(ctx context.Context, in *pb.StopVMsReq) (*pb.Status, er
 	return &pb.Status{Message: "Stopped VMs"}, nil
 }
 
+// Invoke Serves a request with the function, starting its instance if necessary
+func (s *server) Invoke(ctx context.Context, in *pb.InvokeReq) (*pb.InvokeResp, error) {
+	fID := in.GetId()
+	imageName := in.GetImage()
+
+	logger := log.WithFields(log.Fields{"fID": fID, "image": imageName})
+	logger.Debug("Received Invoke")
+
+	if imageName == "" {
+		f, err := funcPool.GetFunction(fID)
+		if err != nil {
+			return nil, toStatusError(err)
+		}
+		imageName = f.GetInfo().ImageName
+	}
+
+	fwdResp, metr, err := funcPool.Serve(ctx, fID, imageName, in.GetPayload())
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	resp := &pb.InvokeResp{
+		Payload:     fwdResp.GetPayload(),
+		IsColdStart: fwdResp.GetIsColdStart(),
+	}
+	if metr != nil {
+		resp.Metrics = metr.MetricMap
+	}
+	if f, err := funcPool.GetFunction(fID); err == nil {
+		resp.Function = toFunctionInfo(f.GetInfo())
+	}
+
+	return resp, nil
+}
+
+// RegisterFunction Adds a function to the pool without starting its instance
+func (s *server) RegisterFunction(ctx context.Context, in *pb.RegisterFunctionReq) (*pb.FunctionInfo, error) {
+	fID := in.GetId()
+	imageName := in.GetImage()
+	log.WithFields(log.Fields{"fID": fID, "image": imageName}).Info("Received RegisterFunction")
+
+	f, err := funcPool.RegisterFunction(fID, imageName, FunctionConfig{
+		VMSpec:       toVMSpec(in.GetVmSpec()),
+		MaxInstances: int(in.GetMaxInstances()),
+		Timeout:      time.Duration(in.GetTimeoutMs()) * time.Millisecond,
+		Port:         int(in.GetPort()),
+		Protocol:     in.GetProtocol(),
+	})
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	return toFunctionInfo(f.GetInfo()), nil
+}
+
+// DeregisterFunction Stops the instance of the function and removes the function from the pool
+func (s *server) DeregisterFunction(ctx context.Context, in *pb.DeregisterFunctionReq) (*pb.FunctionInfo, error) {
+	fID := in.GetId()
+	log.WithFields(log.Fields{"fID": fID}).Info("Received DeregisterFunction")
+
+	info, err := funcPool.DeregisterFunction(fID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	return toFunctionInfo(info), nil
+}
+
+// ListFunctions Lists all functions in the pool
+func (s *server) ListFunctions(ctx context.Context, in *pb.ListFunctionsReq) (*pb.ListFunctionsResp, error) {
+	log.Debug("Received ListFunctions")
+
+	resp := &pb.ListFunctionsResp{}
+	for _, f := range funcPool.ListFunctions() {
+		resp.Functions = append(resp.Functions, toFunctionInfo(f.GetInfo()))
+	}
+
+	return resp, nil
+}
+
+// GetFunction Returns the state of a function
+func (s *server) GetFunction(ctx context.Context, in *pb.GetFunctionReq) (*pb.FunctionInfo, error) {
+	fID := in.GetId()
+	log.WithFields(log.Fields{"fID": fID}).Debug("Received GetFunction")
+
+	f, err := funcPool.GetFunction(fID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	return toFunctionInfo(f.GetInfo()), nil
+}
+
+// ListSnapshots Lists all snapshots stored by the orchestrator
+func (s *server) ListSnapshots(ctx context.Context, in *pb.ListSnapshotsReq) (*pb.ListSnapshotsResp, error) {
+	log.Debug("Received ListSnapshots")
+
+	snapshots, err := orch.ListSnapshots()
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	resp := &pb.ListSnapshotsResp{}
+	for _, si := range snapshots {
+		resp.Snapshots = append(resp.Snapshots, toSnapshotInfo(si))
+	}
+
+	return resp, nil
+}
+
+// GetSnapshot Returns the description of a VM's snapshot
+func (s *server) GetSnapshot(ctx context.Context, in *pb.GetSnapshotReq) (*pb.SnapshotInfo, error) {
+	vmID := in.GetVmId()
+	log.WithFields(log.Fields{"vmID": vmID}).Debug("Received GetSnapshot")
+
+	si, err := orch.GetSnapshot(vmID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	return toSnapshotInfo(si), nil
+}
+
+// DeleteSnapshot Removes a VM's snapshot from disk
+func (s *server) DeleteSnapshot(ctx context.Context, in *pb.DeleteSnapshotReq) (*pb.Status, error) {
+	vmID := in.GetVmId()
+	log.WithFields(log.Fields{"vmID": vmID}).Info("Received DeleteSnapshot")
+
+	if err := orch.DeleteSnapshot(vmID); err != nil {
+		return &pb.Status{Message: "Failed to delete snapshot"}, toStatusError(err)
+	}
+
+	return &pb.Status{Message: "Deleted snapshot of VM " + vmID}, nil
+}
+
+// CreateSnapshot Creates a snapshot of a function's running instance
+func (s *server) CreateSnapshot(ctx context.Context, in *pb.CreateSnapshotReq) (*pb.SnapshotInfo, error) {
+	fID := in.GetId()
+	log.WithFields(log.Fields{"fID": fID}).Info("Received CreateSnapshot")
+
+	vmID, err := funcPool.CreateSnapshot(fID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	si, err := orch.GetSnapshot(vmID)
+	if err != nil {
+		return nil, toStatusError(err)
+	}
+
+	return toSnapshotInfo(si), nil
+}
+
+// ListMemoryVMs Lists the VMs in the memory manager, safe while the VMs are running
+func (s *server) ListMemoryVMs(ctx context.Context, in *pb.ListMemoryVMsReq) (*pb.ListMemoryVMsResp, error) {
+	log.Debug("Received ListMemoryVMs")
+
+	vms, err := orch.ListMemoryVMs()
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return toListMemoryVMsResp(vms), nil
+}
+
+// GetMemoryVM Returns the state of a VM in the memory manager, safe while the VM is running
+func (s *server) GetMemoryVM(ctx context.Context, in *pb.GetMemoryVMReq) (*pb.MemoryVMInfo, error) {
+	vmID := in.GetVmId()
+	log.WithFields(log.Fields{"vmID": vmID}).Debug("Received GetMemoryVM")
+
+	vm, err := orch.GetMemoryVM(vmID)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	return toMemoryVMInfo(vm), nil
+}
+
+func toListMemoryVMsResp(vms []*manager.VMInfo) *pb.ListMemoryVMsResp {
+	resp := &pb.ListMemoryVMsResp{}
+	for _, vm := range vms {
+		resp.Vms = append(resp.Vms, toMemoryVMInfo(vm))
+	}
+
+	return resp
+}
+
+func toMemoryVMInfo(vm *manager.VMInfo) *pb.MemoryVMInfo {
+	info := &pb.MemoryVMInfo{
+		VmId:            vm.VMID,
+		IsActive:        vm.IsActive,
+		Mode:            vm.Mode,
+		IsLazyMode:      vm.IsLazyMode,
+		IsHybridMode:    vm.IsHybridMode,
+		Recordings:      int32(vm.Recordings),
+		TraceLen:        int32(vm.TraceLen),
+		NumRegions:      int32(vm.NumRegions),
+		WorkingSetBytes: int64(vm.WorkingSetBytes),
+		Faults: &pb.FaultCounters{
+			Served:      vm.Faults.Served,
+			Missed:      vm.Faults.Missed,
+			TraceFaults: vm.Faults.TraceFaults,
+			Prefetched:  vm.Faults.Prefetched,
+			ZeroPages:   vm.Faults.ZeroPages,
+			Dirtied:     vm.Faults.Dirtied,
+		},
+		IsTrackingDirty: vm.IsTrackingDirty,
+	}
+
+	for _, h := range vm.Latency {
+		hist := &pb.LatencyHistogram{
+			Name:   h.Name,
+			Counts: h.Counts,
+			Count:  h.Count,
+			SumUs:  h.Sum.Microseconds(),
+		}
+		for _, bound := range h.Bounds {
+			hist.BoundsUs = append(hist.BoundsUs, bound.Microseconds())
+		}
+		info.Latency = append(info.Latency, hist)
+	}
+
+	return info
+}
+
+func toSnapshotInfo(si *ctriface.SnapshotInfo) *pb.SnapshotInfo {
+	return &pb.SnapshotInfo{
+		VmId:           si.VMID,
+		Image:          si.Image,
+		CreatedAt:      si.CreatedAt.UnixNano(),
+		Size:           si.Size(),
+		SnapFileSize:   si.SnapFileSize,
+		MemFileSize:    si.MemFileSize,
+		WorkingSetSize: si.WorkingSetSize,
+	}
+}
+
+// toVMSpec Returns the VM spec given in a request, nil if none is given
+func toVMSpec(spec *pb.VMSpec) *ctriface.VMSpec {
+	if spec == nil {
+		return nil
+	}
+
+	return &ctriface.VMSpec{
+		VcpuCount:      spec.GetVcpuCount(),
+		MemSizeMib:     spec.GetMemSizeMib(),
+		KernelArgs:     spec.GetKernelArgs(),
+		TimeoutSeconds: spec.GetTimeoutSeconds(),
+	}
+}
+
+func fromVMSpec(spec *ctriface.VMSpec) *pb.VMSpec {
+	if spec == nil {
+		return nil
+	}
+
+	return &pb.VMSpec{
+		VcpuCount:      spec.VcpuCount,
+		MemSizeMib:     spec.MemSizeMib,
+		KernelArgs:     spec.KernelArgs,
+		TimeoutSeconds: spec.TimeoutSeconds,
+	}
+}
+
+func toFunctionInfo(info *FunctionInfo) *pb.FunctionInfo {
+	pbInfo := &pb.FunctionInfo{
+		Id:              info.FID,
+		Image:           info.ImageName,
+		VmId:            info.VMID,
+		GuestIp:         info.GuestIP,
+		IsPinned:        info.IsPinned,
+		IsSnapshotReady: info.IsSnapshotReady,
+		Served:          info.Served,
+		Started:         info.Started,
+		Failed:          info.Failed,
+		VmSpec:          fromVMSpec(info.VMSpec),
+		MaxInstances:    uint32(info.MaxInstances),
+		TimeoutMs:       uint64(info.Timeout.Milliseconds()),
+		Port:            uint32(info.Port),
+		Protocol:        info.Protocol,
+	}
+
+	pbInfo.State = toInstanceState(info.State)
+
+	for _, instInfo := range info.Instances {
+		pbInfo.Instances = append(pbInfo.Instances, &pb.InstanceInfo{
+			Id:              uint32(instInfo.ID),
+			State:           toInstanceState(instInfo.State),
+			VmId:            instInfo.VMID,
+			GuestIp:         instInfo.GuestIP,
+			IsSnapshotReady: instInfo.IsSnapshotReady,
+			Outstanding:     instInfo.Outstanding,
+			Served:          instInfo.Served,
+			Started:         instInfo.Started,
+			Failed:          instInfo.Failed,
+		})
+	}
+
+	if info.ColdStartMetric != nil {
+		pbInfo.ColdStartMetrics = info.ColdStartMetric.MetricMap
+	}
+
+	return pbInfo
+}
+
+func toInstanceState(state InstanceState) pb.InstanceState {
+	switch state {
+	case InstanceRunning:
+		return pb.InstanceState_RUNNING
+	case InstanceOffloaded:
+		return pb.InstanceState_OFFLOADED
+	case InstanceUnhealthy:
+		return pb.InstanceState_UNHEALTHY
+	default:
+		return pb.InstanceState_INACTIVE
+	}
+}
+
+// toStatusError Returns the gRPC status error for the error of the function pool
+// or of the orchestrator. A failed operation on an instance is reported as Unavailable,
+// since the instance is recreated and the client may retry.
+func toStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	var instErr *InstanceError
+	switch {
+	case errors.As(err, &instErr):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, ErrFunctionNotFound), errors.Is(err, ctriface.ErrSnapshotNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrInvalidFunctionConfig), errors.Is(err, ctriface.ErrInvalidVMSpec):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrFunctionConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, ErrNoRunningInstance), errors.Is(err, ctriface.ErrSnapshotInUse):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return err
+}
+
+// sprintMetric Formats the breakdown of a metric, one component per line
+func sprintMetric(m *metrics.Metric) string {
+	if m == nil {
+		return ""
+	}
+
+	keys := make([]string, 0, len(m.MetricMap))
+	for k := range m.MetricMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var s string
+	for _, k := range keys {
+		s += fmt.Sprintf("%s:\t%.1f\n", k, m.MetricMap[k])
+	}
+	s += fmt.Sprintf("Total:\t%.1f\n", m.Total())
+
+	return s
+}
+
 func (s *fwdServer) FwdHello(ctx context.Context, in *hpb.FwdHelloReq) (*hpb.FwdHelloResp, error) {
 	fID := in.GetId()
 	imageName := in.GetImage()
@@ -255,7 +838,7 @@ func (s *fwdServer) FwdHello(ctx context.Context, in *hpb.FwdHelloReq) (*hpb.Fwd
 	logger.Debug("Received FwdHelloVM")
 
 	resp, _, err := funcPool.Serve(ctx, fID, imageName, payload)
-	return resp, err
+	return resp, toStatusError(err)
 }
 
 func setupGVisorCRI() {
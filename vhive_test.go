@@ -24,21 +24,29 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"os"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	ctrdlog "github.com/containerd/containerd/log"
 	ctriface "github.com/vhive-serverless/vhive/ctriface"
+	"github.com/vhive-serverless/vhive/keepalive"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
 	isTestModeConst   = true
 	isSaveMemoryConst = true
+	// testKeepAlive The keep-alive window of the tests in which the idle instances retire
+	testKeepAlive = 500 * time.Millisecond
 )
 
 var (
@@ -80,6 +88,7 @@ func TestMain(m *testing.M) {
 		ctriface.WithUPF(*isUPFEnabledTest),
 		ctriface.WithMetricsMode(*isMetricsModeTest),
 		ctriface.WithLazyMode(*isLazyModeTest),
+		ctriface.WithSnapshotsCleanup(true),
 	)
 
 	ret := m.Run()
@@ -97,10 +106,10 @@ func TestMain(m *testing.M) {
 func TestSendToFunctionSerial(t *testing.T) {
 	fID := "1"
 	var (
-		servedTh      uint64
+		keepAlive     keepalive.PolicyFactory
 		pinnedFuncNum int
 	)
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	for i := 0; i < 2; i++ {
 		resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
@@ -119,10 +128,10 @@ func TestSendToFunctionSerial(t *testing.T) {
 func TestSendToFunctionParallel(t *testing.T) {
 	fID := "2"
 	var (
-		servedTh      uint64
+		keepAlive     keepalive.PolicyFactory
 		pinnedFuncNum int
 	)
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	var vmGroup sync.WaitGroup
 	for i := 0; i < 100; i++ {
@@ -145,10 +154,10 @@ func TestSendToFunctionParallel(t *testing.T) {
 func TestStartSendStopTwice(t *testing.T) {
 	fID := "3"
 	var (
-		servedTh      uint64 = 1
-		pinnedFuncNum int    = 2
+		keepAlive     keepalive.PolicyFactory = keepalive.NewFixedPolicy(0)
+		pinnedFuncNum int                     = 2
 	)
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	for i := 0; i < 2; i++ {
 		for k := 0; k < 2; k++ {
@@ -170,10 +179,10 @@ func TestStartSendStopTwice(t *testing.T) {
 func TestStatsNotNumericFunction(t *testing.T) {
 	fID := "not-cld"
 	var (
-		servedTh      uint64 = 1
-		pinnedFuncNum int    = 2
+		keepAlive     keepalive.PolicyFactory = keepalive.NewFixedPolicy(0)
+		pinnedFuncNum int                     = 2
 	)
-	funcPool = NewFuncPool(isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
 	require.NoError(t, err, "Function returned error")
@@ -191,10 +200,10 @@ func TestStatsNotNumericFunction(t *testing.T) {
 func TestStatsNotColdFunction(t *testing.T) {
 	fID := "4"
 	var (
-		servedTh      uint64 = 1
-		pinnedFuncNum int    = 4
+		keepAlive     keepalive.PolicyFactory = keepalive.NewFixedPolicy(0)
+		pinnedFuncNum int                     = 4
 	)
-	funcPool = NewFuncPool(isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
 	require.NoError(t, err, "Function returned error")
@@ -212,15 +221,21 @@ func TestStatsNotColdFunction(t *testing.T) {
 func TestSaveMemorySerial(t *testing.T) {
 	fID := "5"
 	var (
-		servedTh      uint64 = 40
-		pinnedFuncNum int    = 2
+		keepAlive     keepalive.PolicyFactory = keepalive.NewFixedPolicy(testKeepAlive)
+		pinnedFuncNum int                     = 2
 	)
-	funcPool = NewFuncPool(isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
-	for i := 0; i < 100; i++ {
-		resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
-		require.NoError(t, err, "Function returned error")
-		require.Equal(t, resp.Payload, "Hello, world!")
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			requireRetired(t, fID)
+		}
+
+		for k := 0; k < 10; k++ {
+			resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
+			require.NoError(t, err, "Function returned error")
+			require.Equal(t, resp.Payload, "Hello, world!")
+		}
 	}
 
 	startsGot := funcPool.stats.statMap[fID].started
@@ -233,25 +248,30 @@ func TestSaveMemorySerial(t *testing.T) {
 func TestSaveMemoryParallel(t *testing.T) {
 	fID := "6"
 	var (
-		servedTh      uint64 = 40
-		pinnedFuncNum int    = 2
+		keepAlive     keepalive.PolicyFactory = keepalive.NewFixedPolicy(testKeepAlive)
+		pinnedFuncNum int                     = 2
 	)
-	funcPool = NewFuncPool(isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
-	var vmGroup sync.WaitGroup
-	for i := 0; i < 100; i++ {
-		vmGroup.Add(1)
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			requireRetired(t, fID)
+		}
 
-		go func(i int) {
-			defer vmGroup.Done()
+		var vmGroup sync.WaitGroup
+		for k := 0; k < 30; k++ {
+			vmGroup.Add(1)
 
-			resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
-			require.NoError(t, err, "Function returned error")
-			require.Equal(t, resp.Payload, "Hello, world!")
-		}(i)
+			go func() {
+				defer vmGroup.Done()
 
+				resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
+				require.NoError(t, err, "Function returned error")
+				require.Equal(t, resp.Payload, "Hello, world!")
+			}()
+		}
+		vmGroup.Wait()
 	}
-	vmGroup.Wait()
 
 	startsGot := funcPool.stats.statMap[fID].started
 	require.Equal(t, 3, int(startsGot), "Cold start (starts) stats are wrong")
@@ -260,13 +280,23 @@ func TestSaveMemoryParallel(t *testing.T) {
 	require.NoError(t, err, "Function returned error, "+message)
 }
 
+// requireRetired Waits until the instance of the function retires after the keep-alive window
+func requireRetired(t *testing.T, fID string) {
+	f, err := funcPool.GetFunction(fID)
+	require.NoError(t, err, "Function must exist")
+
+	require.Eventually(t, func() bool {
+		return f.GetInfo().State != InstanceRunning
+	}, 30*time.Second, 100*time.Millisecond, "The idle instance must retire")
+}
+
 func TestDirectStartStopVM(t *testing.T) {
 	fID := "7"
 	var (
-		servedTh      uint64
+		keepAlive     keepalive.PolicyFactory
 		pinnedFuncNum int
 	)
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	message, err := funcPool.AddInstance(fID, testImageName)
 	require.NoError(t, err, "This error should never happen (addInstance())"+message)
@@ -279,6 +309,199 @@ func TestDirectStartStopVM(t *testing.T) {
 	require.NoError(t, err, "Function returned error, "+message)
 }
 
+func TestRegisterDeregisterFunction(t *testing.T) {
+	fID := "reg-1"
+	var (
+		keepAlive     keepalive.PolicyFactory
+		pinnedFuncNum int
+	)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
+
+	f, err := funcPool.RegisterFunction(fID, testImageName, FunctionConfig{})
+	require.NoError(t, err, "Failed to register function")
+	require.Equal(t, InstanceInactive, f.GetInfo().State, "Registered function must be inactive")
+
+	_, err = funcPool.RegisterFunction(fID, "bogus imageName", FunctionConfig{})
+	require.Error(t, err, "Registering a function with another image must fail")
+	require.Equal(t, codes.AlreadyExists, status.Code(toStatusError(err)), "Conflict must be reported as already exists")
+
+	_, err = funcPool.RegisterFunction(fID, testImageName, FunctionConfig{VMSpec: &ctriface.VMSpec{MemSizeMib: 512}})
+	require.Error(t, err, "Registering a function with another VM spec must fail")
+
+	_, err = funcPool.RegisterFunction("reg-2", testImageName, FunctionConfig{Port: 70000})
+	require.Equal(t, codes.InvalidArgument, status.Code(toStatusError(err)), "Invalid config must be reported as invalid argument")
+
+	resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
+	require.NoError(t, err, "Function returned error")
+	require.Equal(t, resp.Payload, "Hello, world!")
+
+	info := f.GetInfo()
+	require.Equal(t, InstanceRunning, info.State, "Function must be running after the first invocation")
+	require.NotEmpty(t, info.GuestIP, "Guest IP must be set")
+	require.Equal(t, 1, int(info.Served), "Served stats are wrong")
+	require.Equal(t, 1, int(info.Started), "Started stats are wrong")
+	require.NotNil(t, info.ColdStartMetric, "Cold start breakdown must be recorded")
+
+	require.Len(t, funcPool.ListFunctions(), 1, "Wrong number of functions")
+
+	info, err = funcPool.DeregisterFunction(fID)
+	require.NoError(t, err, "Failed to deregister function")
+	require.Equal(t, InstanceInactive, info.State, "Deregistered function must be inactive")
+
+	_, err = funcPool.GetFunction(fID)
+	require.Error(t, err, "Deregistered function must not be found")
+	require.Equal(t, codes.NotFound, status.Code(toStatusError(err)), "Missing function must be reported as not found")
+}
+
+func TestScaleOut(t *testing.T) {
+	fID := "scale-1"
+	var (
+		keepAlive     keepalive.PolicyFactory
+		pinnedFuncNum int
+	)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
+
+	f, err := funcPool.RegisterFunction(fID, testImageName, FunctionConfig{MaxInstances: 2})
+	require.NoError(t, err, "Failed to register function")
+
+	var vmGroup sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		vmGroup.Add(1)
+
+		go func() {
+			defer vmGroup.Done()
+
+			resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
+			require.NoError(t, err, "Function returned error")
+			require.Equal(t, resp.Payload, "Hello, world!")
+		}()
+	}
+	vmGroup.Wait()
+
+	info := f.GetInfo()
+	require.Equal(t, 2, info.MaxInstances, "Wrong maximum number of instances")
+	require.Len(t, info.Instances, 2, "Function must scale out to the maximum number of instances")
+	require.Equal(t, 2, int(info.Started), "Started stats are wrong")
+
+	var served uint64
+	for _, instInfo := range info.Instances {
+		require.Equal(t, InstanceRunning, instInfo.State, "Instance must be running")
+		require.Zero(t, instInfo.Outstanding, "Instance must have no outstanding requests")
+		served += instInfo.Served
+	}
+	require.Equal(t, info.Served, served, "Per-instance served stats are wrong")
+
+	_, err = funcPool.DeregisterFunction(fID)
+	require.NoError(t, err, "Failed to deregister function")
+}
+
+func TestServeDeadline(t *testing.T) {
+	fID := "deadline-1"
+	var (
+		keepAlive     keepalive.PolicyFactory
+		pinnedFuncNum int
+	)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
+
+	f, err := funcPool.RegisterFunction(fID, testImageName, FunctionConfig{Timeout: 5 * time.Second})
+	require.NoError(t, err, "Failed to register function")
+	require.Equal(t, 5*time.Second, f.GetInfo().Timeout, "Wrong timeout")
+
+	// the deadline expires while the instance is starting
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, _, err = funcPool.Serve(ctx, fID, testImageName, "world")
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err), "Request must time out")
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, _, err = funcPool.Serve(ctx, fID, testImageName, "world")
+	require.Equal(t, codes.Canceled, status.Code(err), "Request must be cancelled")
+
+	resp, _, err := funcPool.Serve(context.Background(), fID, testImageName, "world")
+	require.NoError(t, err, "Function returned error")
+	require.Equal(t, resp.Payload, "Hello, world!")
+
+	info := f.GetInfo()
+	require.Equal(t, InstanceRunning, info.State, "Function must be running")
+	for _, instInfo := range info.Instances {
+		require.Zero(t, instInfo.Outstanding, "Timed out requests must release the instance")
+	}
+
+	_, err = funcPool.DeregisterFunction(fID)
+	require.NoError(t, err, "Failed to deregister function")
+}
+
+func TestEnsureStartedCancel(t *testing.T) {
+	cfg := FunctionConfig{MaxInstances: 1, Timeout: defaultTimeout}
+	f := NewFunction("start-1", testImageName, cfg, NewStats(), keepalive.NewFixedPolicy(0)(), true)
+	inst := f.pickInstance()
+
+	// another request is starting the instance
+	inst.starting = make(chan struct{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, isColdStart, err := inst.ensureStarted(ctx)
+	require.Equal(t, context.DeadlineExceeded, err, "Waiting for the start must stop with the context")
+	require.False(t, isColdStart, "Waiting request must not start the instance")
+
+	// the instance started in the meantime
+	inst.setActive(true)
+	_, isColdStart, err = inst.ensureStarted(context.Background())
+	require.NoError(t, err, "Running instance must not be started")
+	require.False(t, isColdStart, "Running instance must not be started")
+}
+
+func TestInstanceFailure(t *testing.T) {
+	cfg := FunctionConfig{MaxInstances: 1, Timeout: defaultTimeout}
+	stats := NewStats()
+	require.NoError(t, stats.CreateStats("fail-1"), "Failed to create stats")
+	f := NewFunction("fail-1", testImageName, cfg, stats, keepalive.NewFixedPolicy(time.Hour)(), false)
+	inst := f.pickInstance()
+	inst.setActive(true)
+
+	err := inst.fail("snapshot", errors.New("bogus error"))
+	var instErr *InstanceError
+	require.True(t, errors.As(err, &instErr), "Failure must return an instance error")
+	require.Equal(t, "snapshot", instErr.Op, "Wrong operation")
+	require.Equal(t, codes.Unavailable, status.Code(toStatusError(err)), "Instance error must be reported as unavailable")
+
+	info := f.GetInfo()
+	require.Equal(t, InstanceUnhealthy, info.State, "Failed instance must be unhealthy")
+	require.Equal(t, 1, int(info.Failed), "Failed stats are wrong")
+	require.Equal(t, 1, int(info.Instances[0].Failed), "Per-instance failed stats are wrong")
+
+	// the unhealthy instance is retired right away rather than after the keep-alive window
+	inst.setActive(false)
+	inst.endRequest()
+	inst.idleMu.Lock()
+	require.NotNil(t, inst.idleTimer, "Unhealthy instance must be retired")
+	inst.stopIdleTimer()
+	inst.idleMu.Unlock()
+}
+
+func TestPickInstance(t *testing.T) {
+	cfg := FunctionConfig{MaxInstances: 2, Timeout: defaultTimeout}
+	f := NewFunction("pick-1", testImageName, cfg, NewStats(), keepalive.NewFixedPolicy(0)(), true)
+
+	first := f.pickInstance()
+	require.Equal(t, 0, first.id, "First request must go to the first instance")
+
+	second := f.pickInstance()
+	require.Equal(t, 1, second.id, "Function must scale out when the instance is busy")
+
+	third := f.pickInstance()
+	require.Contains(t, []int{0, 1}, third.id, "Function must not scale out beyond the maximum")
+	require.Len(t, f.getInstances(), 2, "Function must not scale out beyond the maximum")
+
+	// the first instance is running and has the least outstanding requests
+	first.setActive(true)
+	atomic.AddInt64(&third.outstanding, -1)
+	atomic.AddInt64(&second.outstanding, 1)
+	require.Equal(t, first, f.pickInstance(), "Request must go to the least loaded instance")
+}
+
 func TestAllFunctions(t *testing.T) {
 
 	if testing.Short() {
@@ -298,10 +521,10 @@ func TestAllFunctions(t *testing.T) {
 		"ghcr.io/ease-lab/springboot:var_workload",
 	}
 	var (
-		servedTh      uint64
+		keepAlive     keepalive.PolicyFactory
 		pinnedFuncNum int
 	)
-	funcPool = NewFuncPool(!isSaveMemoryConst, servedTh, pinnedFuncNum, isTestModeConst)
+	funcPool = NewFuncPool(!isSaveMemoryConst, keepAlive, pinnedFuncNum, isTestModeConst)
 
 	for i := 0; i < 2; i++ {
 		var vmGroup sync.WaitGroup